@@ -0,0 +1,183 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// AccessLogEntry is a line of the access log of WithAccessLog. Its fields are
+// written in order, under their JSON names:
+//
+//	timestamp       start of the call, RFC 3339 with nanoseconds
+//	request_id      Lambda request ID, if known
+//	method          method called, or as much of it as the event names
+//	code            gRPC code name as in CodeName, "OK" on success
+//	duration_ms     time spent processing the event
+//	request_bytes   size of the event data, or of the payload if it could not
+//	                be routed
+//	response_bytes  size of the JSON reply returned to Lambda, 0 on failure
+//	                and for Invoke calls
+//	cold_start      whether this is the first call logged by the process
+//	cold_start_ms   time the hook of OnColdStart took, if it ran for the call
+type AccessLogEntry struct {
+	Timestamp     time.Time `json:"timestamp"`
+	RequestID     string    `json:"request_id"`
+	Method        string    `json:"method"`
+	Code          string    `json:"code"`
+	DurationMS    float64   `json:"duration_ms"`
+	RequestBytes  int       `json:"request_bytes"`
+	ResponseBytes int       `json:"response_bytes"`
+	ColdStart     bool      `json:"cold_start"`
+	ColdStartMS   float64   `json:"cold_start_ms,omitempty"`
+}
+
+// WithAccessLog writes an AccessLogEntry line of JSON to w for every event
+// processed, whatever its outcome, including payloads that cannot be routed. A
+// nil w means os.Stdout. Replies are returned to Lambda already encoded, so
+// that sizing them does not encode them twice.
+func WithAccessLog(w io.Writer) ServerOption {
+	if w == nil {
+		w = os.Stdout
+	}
+	return func(o *options) {
+		o.accessLog = &accessLog{w: w}
+	}
+}
+
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var coldStart sync.Once
+
+// isColdStart reports true on its first call in the process.
+func isColdStart() bool {
+	cold := false
+	coldStart.Do(func() {
+		cold = true
+	})
+	return cold
+}
+
+type accessKey struct{}
+
+// pendingAccess holds the entry of a call served by invokeEvent until its
+// reply is encoded.
+type pendingAccess struct {
+	entry *AccessLogEntry
+}
+
+// logAccess writes the entry of a processed event, or leaves it to
+// invokeEvent to complete with the size of the reply.
+func (s *Server) logAccess(c context.Context, ctx *apex.Context, event *Event, id MethodID, err error, start time.Time, duration time.Duration) {
+	if s.opts.accessLog == nil {
+		return
+	}
+	entry := &AccessLogEntry{
+		Timestamp:  start.UTC(),
+		RequestID:  requestID(c, ctx),
+		Method:     string(id),
+		Code:       CodeName(codes.OK),
+		DurationMS: float64(duration) / float64(time.Millisecond),
+		ColdStart:  isColdStart(),
+	}
+	if d, ok := ColdStartDuration(c); ok {
+		entry.ColdStartMS = float64(d) / float64(time.Millisecond)
+	}
+	if entry.Method == "" {
+		entry.Method = eventMethodName(event)
+	}
+	if event.Data != nil {
+		entry.RequestBytes = len(*event.Data)
+	}
+	if err != nil {
+		entry.Code = CodeName(errorStatus(err).Code())
+	}
+	if p, ok := c.Value(accessKey{}).(*pendingAccess); ok {
+		p.entry = entry
+		return
+	}
+	s.writeAccess(entry)
+}
+
+// logRouteFailure writes the entry of a payload that could not be routed.
+func (s *Server) logRouteFailure(c context.Context, ctx *apex.Context, eventMsg json.RawMessage, err error, start time.Time) {
+	if s.opts.accessLog == nil {
+		return
+	}
+	s.writeAccess(&AccessLogEntry{
+		Timestamp:    start.UTC(),
+		RequestID:    requestID(c, ctx),
+		Code:         CodeName(errorStatus(err).Code()),
+		DurationMS:   float64(time.Since(start)) / float64(time.Millisecond),
+		RequestBytes: len(eventMsg),
+		ColdStart:    isColdStart(),
+	})
+}
+
+// accessLogged calls invoke, the encoding of an event served by Run, and
+// writes its access log entry with the size of the reply, which it returns
+// encoded.
+func (s *Server) accessLogged(c context.Context, invoke func(c context.Context) (interface{}, error)) (interface{}, error) {
+	if s.opts.accessLog == nil {
+		return invoke(c)
+	}
+	p := &pendingAccess{}
+	data, err := invoke(context.WithValue(c, accessKey{}, p))
+	if p.entry == nil {
+		return data, err
+	}
+	if err == nil {
+		b, merr := json.Marshal(data)
+		if merr != nil {
+			err = merr
+		} else {
+			data = json.RawMessage(b)
+			p.entry.ResponseBytes = len(b)
+		}
+	}
+	if err != nil {
+		p.entry.Code = CodeName(errorStatus(err).Code())
+	}
+	s.writeAccess(p.entry)
+	return data, err
+}
+
+func (s *Server) writeAccess(entry *AccessLogEntry) {
+	l := s.opts.accessLog
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
+
+// eventMethodName joins the package, service and method an event names, for
+// events that do not address a method.
+func eventMethodName(event *Event) string {
+	var parts []string
+	for _, p := range []*string{event.Package, event.Service} {
+		if p != nil && *p != "" {
+			parts = append(parts, *p)
+		}
+	}
+	name := strings.Join(parts, ".")
+	if event.Method != nil && *event.Method != "" {
+		if strings.Contains(*event.Method, "/") {
+			return strings.TrimPrefix(*event.Method, "/")
+		}
+		name += "/" + *event.Method
+	}
+	return name
+}
@@ -0,0 +1,85 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEchoServer(t, WithAccessLog(&buf))
+	tests := []struct {
+		name     string
+		event    string
+		method   string
+		code     string
+		response int
+	}{
+		{"success", echoEvent("Echo", `{"message":"hi"}`), "apexgrpc.test.Echo/Echo", "OK", len(`{"message":"hi"}`)},
+		{"handler error", echoEvent("Fail", `{"count":5}`), "apexgrpc.test.Echo/Fail", "NOT_FOUND", 0},
+		{"method not found", echoEvent("Nope", `{}`), "apexgrpc.test.Echo/Nope", "UNIMPLEMENTED", 0},
+		{"route failure", `[1,2`, "", "INVALID_ARGUMENT", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			serve(t, s, tt.event)
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("logged %q, want one line", buf.String())
+			}
+			var entry AccessLogEntry
+			if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Method != tt.method || entry.Code != tt.code || entry.ResponseBytes != tt.response || entry.RequestID != "test-request" || entry.Timestamp.IsZero() {
+				t.Errorf("logged %s", lines[0])
+			}
+			if entry.RequestBytes == 0 {
+				t.Errorf("request_bytes = 0 in %s", lines[0])
+			}
+			last := -1
+			for _, key := range []string{"timestamp", "request_id", "method", "code", "duration_ms", "request_bytes", "response_bytes", "cold_start"} {
+				i := strings.Index(lines[0], `"`+key+`":`)
+				if i <= last {
+					t.Fatalf("key %s out of order in %s", key, lines[0])
+				}
+				last = i
+			}
+		})
+	}
+}
+
+func TestAccessLogDurationAndColdStart(t *testing.T) {
+	// Start over as a new process would.
+	coldStart = sync.Once{}
+	var buf bytes.Buffer
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		time.Sleep(2 * time.Millisecond)
+		return echoReply(req), nil
+	}}, WithAccessLog(&buf))
+	for i := 0; i < 3; i++ {
+		serve(t, s, echoEvent("Echo", `{}`))
+	}
+	dec := json.NewDecoder(&buf)
+	for i := 0; i < 3; i++ {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		if d, _ := entry["duration_ms"].(float64); d < 2 {
+			t.Errorf("entry %d: duration_ms = %v, want at least the 2ms of the handler", i, entry["duration_ms"])
+		}
+		if cold := entry["cold_start"] == true; cold != (i == 0) {
+			t.Errorf("entry %d: cold_start = %v, want %v", i, cold, i == 0)
+		}
+	}
+}
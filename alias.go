@@ -0,0 +1,42 @@
+package apexgrpc
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// RegisterAlias routes calls addressed to from, e.g. the old name of a
+// renamed method, to the method registered as to. Both are fully qualified
+// IDs, and from must not be a registered method or alias. Calls through an
+// alias are logged and recorded under to, noting the alias.
+func (s *Server) RegisterAlias(from MethodID, to MethodID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.handlers[to]; !ok {
+		return fmt.Errorf("alias target (%s) is not registered", to)
+	}
+	if _, ok := s.handlers[from]; ok {
+		return fmt.Errorf("alias (%s) is a registered method", from)
+	}
+	if prev, ok := s.aliases[from]; ok {
+		return fmt.Errorf("alias (%s) already routes to (%s)", from, prev)
+	}
+	s.aliases[from] = to
+	s.routes[from] = route{id: to, alias: from}
+	return nil
+}
+
+type aliasContextKey struct{}
+
+func withAlias(c context.Context, alias MethodID) context.Context {
+	if alias == "" {
+		return c
+	}
+	return context.WithValue(c, aliasContextKey{}, alias)
+}
+
+func aliasFromContext(c context.Context) MethodID {
+	alias, _ := c.Value(aliasContextKey{}).(MethodID)
+	return alias
+}
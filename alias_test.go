@@ -0,0 +1,71 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRegisterAlias(t *testing.T) {
+	var buf bytes.Buffer
+	rec := &MemoryRecorder{}
+	s := newEchoServer(t,
+		WithMetricsRecorder(rec),
+		WithLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug)),
+	)
+	from := NewMethodID("", echoService, "Say")
+	to := NewMethodID("", echoService, "Echo")
+	if err := s.RegisterAlias(from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := serve(t, s, echoEvent("Say", `{"message":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+	records := rec.Records()
+	if len(records) != 1 || records[0].ID != to || records[0].Alias != from {
+		t.Errorf("records = %+v, want %s via alias %s", records, to, from)
+	}
+	if !strings.Contains(buf.String(), string(from)) {
+		t.Errorf("log does not mention the alias:\n%s", buf.String())
+	}
+
+	if !s.HasMethod(from) {
+		t.Errorf("HasMethod(%s) = false", from)
+	}
+	var found bool
+	for _, d := range s.Describe() {
+		if d.ID == from {
+			found = true
+			if d.AliasOf != to {
+				t.Errorf("AliasOf = %q, want %q", d.AliasOf, to)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Describe() lacks alias %s", from)
+	}
+
+	for _, c := range []struct {
+		name     string
+		from, to MethodID
+		want     string
+	}{
+		{"unregistered target", NewMethodID("", echoService, "Shout"), NewMethodID("", echoService, "Missing"), "is not registered"},
+		{"registered method", NewMethodID("", echoService, "Fail"), to, "is a registered method"},
+		{"duplicate alias", from, to, "already routes to"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := s.RegisterAlias(c.from, c.to)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("RegisterAlias(%s, %s) = %v, want %q", c.from, c.to, err, c.want)
+			}
+		})
+	}
+	if _, err := serve(t, s, echoEvent("Shout", `{}`)); err == nil {
+		t.Error("rejected alias routes calls")
+	}
+}
@@ -0,0 +1,40 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// WithAnyResolver sets the resolver of google.protobuf.Any type URLs for both
+// request decoding and reply encoding. It overrides the resolvers of the
+// marshal and unmarshal options.
+func WithAnyResolver(r jsonpb.AnyResolver) ServerOption {
+	return func(o *options) {
+		o.anyResolver = r
+	}
+}
+
+type messageResolver map[string]reflect.Type
+
+// NewAnyResolver returns a resolver of the message types of msgs, looked up by
+// full proto name, e.g. "type.googleapis.com/myapp.v1.User".
+func NewAnyResolver(msgs ...proto.Message) jsonpb.AnyResolver {
+	r := messageResolver{}
+	for _, m := range msgs {
+		r[messageFullName(m)] = reflect.TypeOf(m).Elem()
+	}
+	return r
+}
+
+func (r messageResolver) Resolve(typeURL string) (proto.Message, error) {
+	name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+	t, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", name)
+	}
+	return reflect.New(t).Interface().(proto.Message), nil
+}
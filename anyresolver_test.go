@@ -0,0 +1,72 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// anyServiceFiles describes apexgrpc.anytest.Anys, whose Echo method takes
+// and returns a message with a google.protobuf.Any field:
+//
+//	message Wrapped { google.protobuf.Any value = 1; }
+//	service Anys { rpc Echo(Wrapped) returns (Wrapped); }
+func anyServiceFiles() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(anypb.File_google_protobuf_any_proto),
+		{
+			Name:       proto.String("apexgrpc/test/any.proto"),
+			Package:    proto.String("apexgrpc.anytest"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"google/protobuf/any.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Wrapped"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("value"),
+					JsonName: proto.String("value"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".google.protobuf.Any"),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				}},
+			}},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Anys"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Echo"),
+					InputType:  proto.String(".apexgrpc.anytest.Wrapped"),
+					OutputType: proto.String(".apexgrpc.anytest.Wrapped"),
+				}},
+			}},
+		},
+	}}
+}
+
+func echoDynamic(c context.Context, method protoreflect.MethodDescriptor, req *dynamicpb.Message) (protov2.Message, error) {
+	return req, nil
+}
+
+func TestAnyResolver(t *testing.T) {
+	s := NewServer(WithAnyResolver(NewAnyResolver(&wrapperspb.StringValue{})))
+	if err := s.RegisterDynamic(anyServiceFiles(), echoDynamic); err != nil {
+		t.Fatal(err)
+	}
+	event := `{"service":"apexgrpc.anytest.Anys","method":"Echo","data":{"value":{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hi"}}}`
+	got, err := serve(t, s, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"value":{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hi"}}`)
+
+	_, err = serve(t, s, `{"service":"apexgrpc.anytest.Anys","method":"Echo","data":{"value":{"@type":"type.googleapis.com/google.protobuf.Int32Value","value":1}}}`)
+	assertCode(t, err, codes.InvalidArgument)
+}
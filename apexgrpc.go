@@ -1,73 +1,399 @@
 package apexgrpc
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apex/go-apex"
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 type Event struct {
-	Package *string          `json:"package"`
-	Service *string          `json:"service"`
-	Method  *string          `json:"method"`
-	Data    *json.RawMessage `json:"data"`
+	Package         *string             `json:"package"`
+	Service         *string             `json:"service"`
+	Method          *string             `json:"method"`
+	Data            *json.RawMessage    `json:"data"`
+	Encoding        *string             `json:"encoding,omitempty"`
+	Metadata        map[string][]string `json:"metadata,omitempty"`
+	DataRef         *BlobRef            `json:"dataRef,omitempty"`
+	ContentEncoding *string             `json:"contentEncoding,omitempty"`
+	AcceptEncoding  *string             `json:"acceptEncoding,omitempty"`
+	IdempotencyKey  *string             `json:"idempotencyKey,omitempty"`
+	Fields          *string             `json:"fields,omitempty"`
+	DryRun          bool                `json:"dryRun,omitempty"`
+	APIVersion      *string             `json:"apiVersion,omitempty"`
+
+	// raw is the JSON the event was decoded from, if any.
+	raw []byte
 }
 
 type Service struct {
 	Desc   *grpc.ServiceDesc
 	Server interface{}
+
+	lazy       *lazyServer
+	version    string
+	descriptor protoreflect.ServiceDescriptor
 }
 
 type MethodID string
 
 func NewMethodID(pkg string, svc string, mtd string) MethodID {
-	var id string
 	if pkg == "" {
-		id = fmt.Sprintf("%s/%s", svc, mtd)
-	} else {
-		id = fmt.Sprintf("%s.%s/%s", pkg, svc, mtd)
+		return MethodID(svc + "/" + mtd)
 	}
-	return MethodID(id)
+	return MethodID(pkg + "." + svc + "/" + mtd)
 }
 
 func (id MethodID) String() string {
 	return string(id)
 }
 
+// split returns the package-qualified service and the method of id.
+func (id MethodID) split() (string, string) {
+	s := string(id)
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
+
+// methodEvent builds an Event addressed to id with data as its payload.
+func methodEvent(id MethodID, data []byte) Event {
+	svc, mtd := id.split()
+	event := Event{
+		Service: &svc,
+		Method:  &mtd,
+	}
+	if len(data) > 0 {
+		raw := json.RawMessage(data)
+		event.Data = &raw
+	}
+	return event
+}
+
 type handler struct {
-	methodDesc *grpc.MethodDesc
-	server     interface{}
+	serviceDesc *grpc.ServiceDesc
+	methodDesc  *grpc.MethodDesc
+	streamDesc  *grpc.StreamDesc
+	server      interface{}
+	lazy        *lazyServer
+	version     string
+	descriptor  protoreflect.MethodDescriptor
+	httpRules   []*httpRule
 }
 
 type Server struct {
+	opts     options
+	mu       sync.RWMutex
 	handlers map[MethodID]handler
+	aliases  map[MethodID]MethodID
+	routes   map[MethodID]route
+	lenient  map[MethodID]MethodID
+	versions map[string]map[MethodID]MethodID
+	health   *health.Server
+	stats    stats
+
+	idempotencyStore IdempotencyStore
+	flights          flightGroup
+	limiters         map[MethodID]chan struct{}
+	responseCache    *responseCache
+	dynamicTypes     []*dynamicpb.Types
+	httpRoutes       []*httpRule
+	drain            drainState
+	coldStart        coldStartState
 }
 
-func NewServer() *Server {
-	return &Server{
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
 		handlers: map[MethodID]handler{},
+		aliases:  map[MethodID]MethodID{},
+		routes:   map[MethodID]route{},
+		lenient:  map[MethodID]MethodID{},
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	if s.opts.reflection {
+		s.registerServices([]Service{reflectionService(s)})
 	}
+	if s.opts.healthService {
+		s.health = health.NewServer()
+		s.registerServices([]Service{healthService(s.health)})
+	}
+	s.idempotencyStore = s.opts.idempotencyStore
+	if s.idempotencyStore == nil {
+		s.idempotencyStore = &MemoryIdempotencyStore{}
+	}
+	s.limiters = newLimiters(s.opts.concurrencyLimits)
+	s.responseCache = newResponseCache(s.opts.responseCacheSize)
+	return s
+}
+
+// Register adds the methods of svcs to the server. It fails without
+// registering anything if a service is invalid or a method is already
+// registered. It is safe to call while events are served: calls already
+// dispatched are unaffected, and later calls see the new methods.
+func (s *Server) Register(svcs []Service) error {
+	if err := s.checkReserved(svcs); err != nil {
+		return err
+	}
+	return s.registerServices(svcs)
+}
+
+// Deregister removes the methods of the service named serviceName, e.g.
+// "pkg.Service", and reports whether it was registered. Calls already
+// dispatched to it complete.
+func (s *Server) Deregister(serviceName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found bool
+	for id := range s.handlers {
+		if svc, _ := id.split(); svc == serviceName {
+			delete(s.handlers, id)
+			found = true
+		}
+	}
+	if found {
+		for from, to := range s.aliases {
+			if svc, _ := to.split(); svc == serviceName {
+				delete(s.aliases, from)
+			}
+		}
+		s.reindex()
+	}
+	return found
 }
 
-func (s *Server) Register(svcs []Service) {
+// route is what a lookup key resolves to: a method ID and the alias it was
+// addressed by, if any.
+type route struct {
+	id    MethodID
+	alias MethodID
+}
+
+// reindex rebuilds the lookup indexes from the handlers and aliases. routes
+// holds every key accepted without lenient matching, so resolving takes a
+// single lookup. Bare keys have no package and so never shadow a qualified
+// ID; methods and aliases take precedence over them.
+func (s *Server) reindex() {
+	bare := map[MethodID]MethodID{}
+	s.lenient = map[MethodID]MethodID{}
+	for uid := range s.handlers {
+		serviceName, methodName := uid.split()
+		b, ok := bareMethodID(serviceName, methodName)
+		if ok {
+			indexAlias(bare, b, uid)
+		}
+		if s.opts.lenientMatching {
+			s.lenient[foldMethodID(uid)] = uid
+			if ok {
+				indexAlias(s.lenient, foldMethodID(b), uid)
+			}
+		}
+	}
+	s.routes = make(map[MethodID]route, len(bare)+len(s.handlers)+len(s.aliases))
+	for b, uid := range bare {
+		if uid != "" {
+			s.routes[b] = route{id: uid}
+		}
+	}
+	for uid := range s.handlers {
+		s.routes[uid] = route{id: uid}
+	}
+	for from, to := range s.aliases {
+		s.routes[from] = route{id: to, alias: from}
+	}
+	s.indexVersions()
+	s.indexHTTPRules()
+}
+
+// handler returns the handler registered for id.
+func (s *Server) handler(id MethodID) (handler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.handlers[id]
+	return h, ok
+}
+
+func (s *Server) registerServices(svcs []Service) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[MethodID]bool{}
+	folded := map[MethodID]MethodID{}
+	for i, svc := range svcs {
+		if err := validateService(svc); err != nil {
+			return fmt.Errorf("invalid service at index %d: %v", i, err)
+		}
+		for _, id := range serviceMethodIDs(svc.Desc) {
+			if _, ok := s.handlers[id]; ok || seen[id] {
+				return fmt.Errorf("duplicate registration of method (%s)", id)
+			}
+			if _, ok := s.aliases[id]; ok {
+				return fmt.Errorf("method (%s) is registered as an alias", id)
+			}
+			seen[id] = true
+			if !s.opts.lenientMatching {
+				continue
+			}
+			key := foldMethodID(id)
+			prev, ok := folded[key]
+			if !ok {
+				prev, ok = s.lenient[key]
+			}
+			if ok && prev != "" {
+				return fmt.Errorf("method (%s) collides with (%s) under lenient matching", id, prev)
+			}
+			folded[key] = id
+		}
+	}
+	if err := s.checkVersions(svcs); err != nil {
+		return err
+	}
+	rules, err := s.checkHTTPRules(svcs)
+	if err != nil {
+		return err
+	}
 	for _, svc := range svcs {
 		for _, methodDesc := range svc.Desc.Methods {
-			uid := NewMethodID("", svc.Desc.ServiceName, methodDesc.MethodName)
 			desc := methodDesc
-			s.handlers[uid] = handler{
-				methodDesc: &desc,
-				server:     svc.Server,
-			}
+			s.register(svc.Desc.ServiceName, desc.MethodName, handler{
+				serviceDesc: svc.Desc,
+				methodDesc:  &desc,
+				server:      svc.Server,
+				lazy:        svc.lazy,
+				version:     svc.version,
+				descriptor:  methodDescriptor(svc, desc.MethodName),
+				httpRules:   rules[NewMethodID("", svc.Desc.ServiceName, desc.MethodName)],
+			})
+		}
+		for _, streamDesc := range svc.Desc.Streams {
+			desc := streamDesc
+			s.register(svc.Desc.ServiceName, desc.StreamName, handler{
+				serviceDesc: svc.Desc,
+				streamDesc:  &desc,
+				server:      svc.Server,
+				lazy:        svc.lazy,
+				version:     svc.version,
+				descriptor:  methodDescriptor(svc, desc.StreamName),
+				httpRules:   rules[NewMethodID("", svc.Desc.ServiceName, desc.StreamName)],
+			})
+		}
+	}
+	s.reindex()
+	return nil
+}
+
+func (s *Server) register(serviceName string, methodName string, h handler) {
+	s.handlers[NewMethodID("", serviceName, methodName)] = h
+}
+
+func validateService(svc Service) error {
+	if svc.Desc == nil {
+		return fmt.Errorf("missing service descriptor")
+	}
+	if svc.lazy != nil {
+		return nil
+	}
+	if svc.Server == nil {
+		return fmt.Errorf("missing server for service (%s)", svc.Desc.ServiceName)
+	}
+	if svc.Desc.HandlerType != nil {
+		ht := reflect.TypeOf(svc.Desc.HandlerType).Elem()
+		if st := reflect.TypeOf(svc.Server); !st.Implements(ht) {
+			return fmt.Errorf("server of type %v does not implement %v for service (%s)", st, ht, svc.Desc.ServiceName)
+		}
+	}
+	return nil
+}
+
+func serviceMethodIDs(desc *grpc.ServiceDesc) []MethodID {
+	var ids []MethodID
+	for _, m := range desc.Methods {
+		ids = append(ids, NewMethodID("", desc.ServiceName, m.MethodName))
+	}
+	for _, m := range desc.Streams {
+		ids = append(ids, NewMethodID("", desc.ServiceName, m.StreamName))
+	}
+	return ids
+}
+
+// bareMethodID returns the package-less form of a method ID, if the service
+// name has a package.
+func bareMethodID(serviceName string, methodName string) (MethodID, bool) {
+	i := strings.LastIndex(serviceName, ".")
+	if i < 0 {
+		return "", false
+	}
+	return NewMethodID("", serviceName[i+1:], methodName), true
+}
+
+// indexAlias maps alias onto uid; aliases shared by several methods are
+// ambiguous and map to "".
+func indexAlias(index map[MethodID]MethodID, alias MethodID, uid MethodID) {
+	if prev, ok := index[alias]; ok && prev != uid {
+		index[alias] = ""
+		return
+	}
+	index[alias] = uid
+}
+
+// foldMethodID is the key of a method under lenient matching, which covers
+// lowerCamelCase and lowercase spellings of the service and method names.
+func foldMethodID(id MethodID) MethodID {
+	return MethodID(strings.ToLower(string(id)))
+}
+
+// resolve accepts the package given separately, baked into the service name,
+// or omitted when the bare service name is unambiguous. A non-empty version
+// selects among the methods registered with RegisterVersioned first.
+func (s *Server) resolve(version string, pkg string, svc string, mtd string) (MethodID, bool) {
+	id, _, ok := s.resolveAlias(version, pkg, svc, mtd)
+	return id, ok
+}
+
+// resolveAlias is resolve that also returns the alias the method was
+// addressed by, if any.
+func (s *Server) resolveAlias(version string, pkg string, svc string, mtd string) (MethodID, MethodID, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var id MethodID
+	if pkg != "" && !hasPackage(svc, pkg) {
+		id = MethodID(pkg + "." + svc + "/" + mtd)
+	} else {
+		id = MethodID(svc + "/" + mtd)
+	}
+	if version != "" {
+		if uid, ok := s.versions[version][id]; ok {
+			return uid, "", true
+		}
+	}
+	if r, ok := s.routes[id]; ok {
+		return r.id, r.alias, true
+	}
+	if s.opts.lenientMatching {
+		if full := s.lenient[foldMethodID(id)]; full != "" {
+			return full, "", true
 		}
 	}
+	return id, "", false
+}
+
+func hasPackage(svc string, pkg string) bool {
+	return strings.HasPrefix(svc, pkg+".")
 }
 
 func (s *Server) Run() {
@@ -75,73 +401,523 @@ func (s *Server) Run() {
 }
 
 func (s *Server) RunWithContext(c context.Context) {
-	apex.HandleFunc(func(eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
-		var event Event
-		if err := json.Unmarshal(eventMsg, &event); err != nil {
-			return nil, fmt.Errorf("invalid event")
+	apex.HandleFunc(s.ApexHandler(c))
+}
+
+// handleEvent produces the Lambda result of an event served by Run.
+func (s *Server) handleEvent(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+	if s.isWarmup(eventMsg) {
+		return &WarmupResponse{Warmup: "ack"}, nil
+	}
+	if s.opts.responseEnvelope {
+		return s.handleEnvelope(c, eventMsg, ctx), nil
+	}
+	res, err := s.handle(c, eventMsg, ctx)
+	if err == nil {
+		return res, nil
+	}
+	if payload, ok := mappedPayload(err); ok {
+		return payload, nil
+	}
+	if s.opts.stepFunctionsErrors {
+		return nil, s.newStepFunctionsError(err)
+	}
+	if s.opts.structuredErrors {
+		return s.newErrorResponse(err), nil
+	}
+	return nil, err
+}
+
+type lambdaHandler func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error)
+
+func (s *Server) runApex(c context.Context, h lambdaHandler) {
+	apex.HandleFunc(s.apexHandler(c, h))
+}
+
+// ApexHandler returns the handler Run serves events with, without starting
+// the apex loop, so that it can be wrapped or combined with other handlers.
+func (s *Server) ApexHandler(c context.Context) apex.HandlerFunc {
+	return s.apexHandler(c, s.handleEvent)
+}
+
+func (s *Server) apexHandler(c context.Context, h lambdaHandler) apex.HandlerFunc {
+	return func(eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		c, cancel := s.withInvocationDeadline(c, time.Now())
+		defer cancel()
+		return s.admitted(s.recorded(h))(c, eventMsg, ctx)
+	}
+}
+
+func (s *Server) handle(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+	return s.route(c, s.router(eventMsg), eventMsg, ctx)
+}
+
+func (s *Server) router(eventMsg json.RawMessage) Router {
+	if s.opts.router != nil {
+		return s.opts.router
+	}
+	if !s.opts.noSNSDetection && isSNSEvent(eventMsg) {
+		return SNSRouter{Strict: s.opts.strictEvents}
+	}
+	if isBatchEvent(eventMsg) {
+		return BatchRouter{
+			MaxConcurrency: s.opts.batchConcurrency,
+			MaxSize:        s.opts.maxBatchSize,
+			Strict:         s.opts.strictEvents,
+			resolver:       s.marshalOptions().Resolver,
 		}
-		return s.processEvent(c, &event, ctx)
-	})
+	}
+	return DefaultRouter{Strict: s.opts.strictEvents}
+}
+
+func (s *Server) marshalReply(reply proto.Message) (json.RawMessage, error) {
+	raw, err := marshalJSON(s.marshalOptions(), reply)
+	if err == nil && s.opts.int64AsNumber {
+		raw, err = s.int64AsNumber(messageV2(reply).ProtoReflect().Descriptor(), raw)
+	}
+	if err != nil || !s.opts.canonicalJSON {
+		return raw, err
+	}
+	return CanonicalizeJSON(raw)
+}
+
+func (s *Server) Invoke(c context.Context, pkg string, svc string, mtd string, data interface{}) (proto.Message, error) {
+	res, err := s.invoke(c, pkg, svc, mtd, data)
+	if err != nil {
+		return nil, err
+	}
+	return res.unary()
+}
+
+// InvokeRaw calls a unary method like Invoke and returns its reply as the
+// JSON the Lambda handler would, encoded with the configured marshal options,
+// for callers that forward it.
+func (s *Server) InvokeRaw(c context.Context, pkg string, svc string, mtd string, data json.RawMessage) (json.RawMessage, error) {
+	res, err := s.invoke(c, pkg, svc, mtd, data)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := res.unary()
+	if err != nil {
+		return nil, err
+	}
+	return s.encodeJSONReply(res.id, reply)
+}
+
+// InvokeStream calls a server-streaming method and returns every message the
+// handler sent.
+func (s *Server) InvokeStream(c context.Context, pkg string, svc string, mtd string, data interface{}) ([]proto.Message, error) {
+	res, err := s.invoke(c, pkg, svc, mtd, data)
+	if err != nil {
+		return nil, err
+	}
+	if !res.streaming {
+		return nil, fmt.Errorf("method (%s) is not server-streaming", res.id)
+	}
+	return res.replies, nil
 }
 
-func (s *Server) Invoke(c context.Context, pkg string, svc string, mtd string, data interface{}) (interface{}, error) {
-	dataBytes, err := json.Marshal(data)
+func (s *Server) invoke(c context.Context, pkg string, svc string, mtd string, data interface{}) (*result, error) {
+	dataMsg, err := invokeData(data)
 	if err != nil {
 		return nil, err
 	}
-	dataMsg := json.RawMessage(dataBytes)
 	event := Event{
 		Package: &pkg,
 		Service: &svc,
 		Method:  &mtd,
 		Data:    &dataMsg,
 	}
-	return s.processEvent(c, &event, nil)
+	return s.processEvent(withInvoke(c), &event, nil)
+}
+
+// invokeData encodes the data passed to Invoke, taking json.RawMessage and
+// []byte values as already encoded JSON.
+func invokeData(data interface{}) (json.RawMessage, error) {
+	switch d := data.(type) {
+	case json.RawMessage:
+		if d != nil {
+			return d, nil
+		}
+	case []byte:
+		if d != nil {
+			return json.RawMessage(d), nil
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
 }
 
-func (s *Server) InvokeEvent(c context.Context, event *Event) (interface{}, error) {
+func (s *Server) InvokeEvent(c context.Context, event *Event) (proto.Message, error) {
 	if event == nil {
 		return nil, fmt.Errorf("missing event")
 	}
-	return s.processEvent(c, event, nil)
+	res, err := s.processEvent(withInvoke(c), event, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.unary()
+}
+
+// InvokeProto calls a unary method with req as the request message, skipping
+// the JSON round trip of Invoke.
+func (s *Server) InvokeProto(c context.Context, pkg string, svc string, mtd string, req proto.Message) (proto.Message, error) {
+	if req == nil {
+		return nil, fmt.Errorf("missing request message")
+	}
+	event := Event{
+		Package: &pkg,
+		Service: &svc,
+		Method:  &mtd,
+	}
+	res, err := s.processRequest(withInvoke(c), &event, nil, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.unary()
+}
+
+func (s *Server) processEvent(c context.Context, event *Event, ctx *apex.Context) (*result, error) {
+	return s.processRequest(c, event, ctx, nil)
+}
+
+// processRequest dispatches event. A non-nil msg is used as the request
+// message in place of the event data.
+func (s *Server) processRequest(c context.Context, event *Event, ctx *apex.Context, msg proto.Message) (*result, error) {
+	start := time.Now()
+	end, err := s.admit(c)
+	if err != nil {
+		s.logAccess(c, ctx, event, "", err, start, time.Since(start))
+		return nil, err
+	}
+	defer end()
+	source := sourceEvent(c, event)
+	c = s.decorateContext(newEventContext(newApexContext(c, ctx), source))
+	s.logEvent(event)
+	if c, err = s.initialize(c); err != nil {
+		s.logAccess(c, ctx, event, "", err, start, time.Since(start))
+		return nil, err
+	}
+	if err := s.onEvent(c, source); err != nil {
+		s.logAccess(c, ctx, event, "", err, start, time.Since(start))
+		return nil, err
+	}
+	id, alias, res, err := s.dispatch(c, event, msg)
+	duration := time.Since(start)
+	recordEnvelopeMethod(c, id)
+	s.logResult(id, alias, err, duration)
+	s.onResponse(c, id, res, err, duration)
+	s.logAccess(c, ctx, event, id, err, start, duration)
+	return res, err
+}
+
+// dispatch resolves and calls the method event addresses, returning its ID and
+// the alias it was addressed by. The ID is empty if the event does not address
+// a method.
+func (s *Server) dispatch(c context.Context, event *Event, msg proto.Message) (MethodID, MethodID, *result, error) {
+	pkg, svc, mtd, err := eventTarget(event)
+	if err != nil {
+		return "", "", nil, err
+	}
+	encoding, err := s.eventEncoding(event)
+	if err != nil {
+		return "", "", nil, err
+	}
+	methodID, alias, found := s.resolveAlias(eventVersion(event), pkg, svc, mtd)
+	if event, err = s.fetchData(c, methodID, event); err != nil {
+		return methodID, alias, nil, err
+	}
+	if event, err = s.decompressData(methodID, event); err != nil {
+		return methodID, alias, nil, err
+	}
+	if max := s.opts.maxRequestBytes; max > 0 && event.Data != nil && len(*event.Data) > max {
+		return methodID, alias, nil, codedErrorf(codes.ResourceExhausted, "request data for method (%s) is %d bytes, exceeding the limit of %d bytes", methodID, len(*event.Data), max)
+	}
+	if t := s.opts.transcoders[encoding]; t != nil {
+		if event, err = s.transcodeData(methodID, t, event); err != nil {
+			return methodID, alias, nil, s.mapError(c, methodID, err)
+		}
+		// The data is JSON now; the reply is encoded back by encodeResult.
+		encoding = EncodingJSON
+	}
+	event = s.normalizeData(methodID, encoding, event)
+	event, nested, err := s.unnestData(methodID, encoding, event)
+	if err != nil {
+		return methodID, alias, nil, s.mapError(c, methodID, err)
+	}
+	if msg == nil {
+		if event, err = s.transformRequest(methodID, encoding, event); err != nil {
+			return methodID, alias, nil, s.mapError(c, methodID, err)
+		}
+	}
+	if event.Data != nil && isNullData(event.Data) {
+		e := *event
+		e.Data = nil
+		event = &e
+	}
+	if h, ok := s.handler(methodID); ok && msg == nil {
+		if err := s.checkRequiredData(methodID, event.Data); err != nil {
+			return methodID, alias, nil, s.mapError(c, methodID, err)
+		}
+		if s.methodCodec(methodID, encoding) == nil {
+			if err := checkData(methodID, h, encoding, event.Data); err != nil {
+				return methodID, alias, nil, s.mapError(c, methodID, err)
+			}
+		}
+	}
+	md, err := incomingMetadata(event.Metadata)
+	if err != nil {
+		return methodID, alias, nil, s.mapError(c, methodID, err)
+	}
+	md = s.withStaticMetadata(methodID, md)
+	c = withCallerIdentity(c, md)
+	if err := s.authorize(c, methodID, md); err != nil {
+		return methodID, alias, nil, s.mapError(c, methodID, err)
+	}
+	req := &request{
+		encoding: encoding,
+		data:     event.Data,
+		msg:      msg,
+		codec:    s.methodCodec(methodID, encoding),
+		nested:   nested,
+		noCache:  noCache(event.Metadata),
+	}
+	if event.IdempotencyKey != nil {
+		req.idempotencyKey = *event.IdempotencyKey
+	}
+	c = withAlias(metadata.NewIncomingContext(c, md), alias)
+	var res *result
+	if event.DryRun {
+		res, err = s.dryRunMethod(methodID, req)
+	} else if !found && s.opts.unknownMethodHandler != nil {
+		res, err = s.callUnknownMethod(c, methodID, event)
+	} else {
+		res, err = s.callGRPCMethod(c, methodID, req)
+	}
+	if err = canceledError(c, deadlineError(c, err)); err != nil {
+		return methodID, alias, nil, s.mapError(c, methodID, err)
+	}
+	return methodID, alias, res, nil
 }
 
-func (s *Server) processEvent(c context.Context, event *Event, ctx *apex.Context) (interface{}, error) {
-	if event.Package == nil {
-		var p string
-		event.Package = &p
+// eventTarget returns the package, service and method an event addresses. A
+// Method holding a full method string such as "/pkg.Service/Method" takes
+// precedence over Package and Service.
+func eventTarget(event *Event) (string, string, string, error) {
+	if event.Method != nil && strings.Contains(*event.Method, "/") {
+		svc, mtd, ok := parseFullMethod(*event.Method)
+		if !ok {
+			return "", "", "", invalidEventf("malformed method %q", *event.Method)
+		}
+		return "", svc, mtd, nil
 	}
 	if event.Service == nil {
-		return nil, fmt.Errorf("event missing service")
+		return "", "", "", wrapCodedf(codes.InvalidArgument, ErrMissingService, "event missing service%s", keysHint(event))
 	}
 	if event.Method == nil {
-		return nil, fmt.Errorf("event missing method")
+		return "", "", "", wrapCodedf(codes.InvalidArgument, ErrMissingMethod, "event missing method%s", keysHint(event))
 	}
-	var data io.Reader
-	if event.Data == nil {
-		data = strings.NewReader("{}")
-	} else {
-		data = bytes.NewReader(*event.Data)
+	var pkg string
+	if event.Package != nil {
+		pkg = *event.Package
+	}
+	return pkg, *event.Service, *event.Method, nil
+}
+
+// parseFullMethod splits "/pkg.Service/Method" or "pkg.Service/Method".
+func parseFullMethod(s string) (string, string, bool) {
+	s = strings.TrimPrefix(s, "/")
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 || strings.Contains(s[i+1:], "/") {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// request is the payload of a method call: encoded data, or a message handed
+// over by InvokeProto.
+type request struct {
+	encoding string
+	data     *json.RawMessage
+	msg      proto.Message
+	codec    Codec
+	// nested is set when data was the contents of a JSON string.
+	nested bool
+	// idempotencyKey and noCache are taken from the event for
+	// WithIdempotentMethods and WithCachedMethods.
+	idempotencyKey string
+	noCache        bool
+}
+
+// result is the outcome of a dispatched method: a single reply, or the
+// buffered replies of a server-streaming method.
+type result struct {
+	id        MethodID
+	payload   interface{}
+	reply     proto.Message
+	replies   []proto.Message
+	streaming bool
+	header    metadata.MD
+	trailer   metadata.MD
+}
+
+func (r *result) unary() (proto.Message, error) {
+	if r.streaming {
+		return nil, fmt.Errorf("method (%s) is server-streaming", r.id)
+	}
+	if r.payload != nil {
+		return nil, fmt.Errorf("method (%s) returned %T, not a proto message", r.id, r.payload)
+	}
+	return r.reply, nil
+}
+
+func invalidInputError(id MethodID, err error) error {
+	de := &DecodeError{ID: id, Err: err}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		de.Field, de.Expected, de.Got = fe.path, fe.expected, fe.got
 	}
-	methodID := NewMethodID(*event.Package, *event.Service, *event.Method)
-	return s.callGRPCMethod(c, methodID, data)
+	return de
 }
 
-func (s *Server) callGRPCMethod(c context.Context, id MethodID, data io.Reader) (*proto.Message, error) {
+func (s *Server) callGRPCMethod(c context.Context, id MethodID, req *request) (res *result, err error) {
+	h, ok := s.handler(id)
+	if !ok {
+		return nil, &MethodNotFoundError{ID: id}
+	}
+	start := time.Now()
+	defer func() {
+		s.recordInvocation(id, aliasFromContext(c), time.Since(start), err)
+	}()
+	if d := s.methodTimeout(id); d > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, d)
+		defer cancel()
+		mc := c
+		defer func() {
+			err = deadlineError(mc, err)
+		}()
+	}
+	release, err := s.acquire(c, id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer s.recoverPanic(c, id, &err)
+	if h.lazy != nil {
+		if h.server, err = h.lazy.get(c); err != nil {
+			return nil, err
+		}
+	}
+	md := &outgoingMetadata{}
+	if h.streamDesc != nil {
+		res, err = s.callStreamMethod(c, id, h, req, md)
+		if err != nil {
+			return nil, err
+		}
+		res.header, res.trailer = md.header, md.trailer
+		return res, nil
+	}
+	c = newTransportContext(c, id, md)
+	dec := s.newRequestDecoder(req)
 	decode := func(v interface{}) error {
-		if err := jsonpb.Unmarshal(data, v.(proto.Message)); err != nil {
-			return fmt.Errorf("invalid input data for method (%s)", id)
+		if err := dec(v.(proto.Message)); err != nil {
+			return invalidInputError(id, err)
+		}
+		if err := s.validateRequest(id, v.(proto.Message)); err != nil {
+			return err
 		}
+		s.logRequest(id, v.(proto.Message))
 		return nil
 	}
-	h, ok := s.handlers[id]
-	if !ok {
-		return nil, fmt.Errorf("method handler not found - %s", id)
-	}
-	reply, err := h.methodDesc.Handler(h.server, c, decode)
+	reply, err := h.methodDesc.Handler(h.server, c, decode, s.methodInterceptor(id, req, md))
 	if err != nil {
 		return nil, err
 	}
-	replyMsg := reply.(proto.Message)
-	return &replyMsg, nil
+	replyMsg, _ := reply.(proto.Message)
+	return &result{id: id, reply: replyMsg, header: md.header, trailer: md.trailer}, nil
+}
+
+func (s *Server) callStreamMethod(c context.Context, id MethodID, h handler, req *request, md *outgoingMetadata) (*result, error) {
+	desc := h.streamDesc
+	if desc.ClientStreams && desc.ServerStreams {
+		return nil, codedErrorf(codes.Unimplemented, "streaming direction not supported for method (%s)", id)
+	}
+	ss := &serverStream{
+		ctx:           newTransportContext(c, id, md),
+		id:            id,
+		clientStreams: desc.ClientStreams,
+		max:           s.opts.maxStreamReplies,
+		md:            md,
+		validate:      s.validateRequest,
+	}
+	if desc.ClientStreams && req.msg == nil {
+		decs, err := s.newStreamDecoders(id, req.encoding, req.data)
+		if err != nil {
+			return nil, err
+		}
+		ss.decs = decs
+	} else {
+		ss.decs = []messageDecoder{s.newRequestDecoder(req)}
+	}
+	if err := desc.Handler(h.server, ss); err != nil {
+		return nil, err
+	}
+	if desc.ClientStreams {
+		var reply proto.Message
+		if n := len(ss.replies); n > 0 {
+			reply = ss.replies[n-1]
+		}
+		return &result{id: id, reply: reply}, nil
+	}
+	return &result{id: id, replies: ss.replies, streaming: true}, nil
+}
+
+// methodInterceptor returns the interceptor of a unary call of id: the
+// interceptors of WithUnaryInterceptor followed by those of the idempotency
+// store, the response cache and shadowing, which therefore only see calls
+// that passed authorization, all wrapped in the retries of WithRetryPolicy.
+func (s *Server) methodInterceptor(id MethodID, req *request, md *outgoingMetadata) grpc.UnaryServerInterceptor {
+	interceptors := s.opts.interceptors
+	var inner []grpc.UnaryServerInterceptor
+	if s.opts.idempotentMethods[id] && req.idempotencyKey != "" {
+		inner = append(inner, s.idempotencyInterceptor(id, req.idempotencyKey))
+	}
+	if ttl, ok := s.opts.cachedMethods[id]; ok && !req.noCache {
+		inner = append(inner, s.cacheInterceptor(id, ttl, md))
+	}
+	if _, ok := s.opts.shadows[id]; ok {
+		inner = append(inner, s.shadowInterceptor(id))
+	}
+	if len(inner) > 0 {
+		interceptors = append(append([]grpc.UnaryServerInterceptor(nil), interceptors...), inner...)
+	}
+	var interceptor grpc.UnaryServerInterceptor
+	switch len(interceptors) {
+	case 0:
+	case 1:
+		interceptor = interceptors[0]
+	default:
+		interceptor = chainUnaryInterceptors(interceptors)
+	}
+	if p := s.retryPolicy(id); p != nil {
+		interceptor = s.retryInterceptor(id, p, md, interceptor)
+	}
+	return interceptor
+}
+
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(c context.Context, req interface{}) (interface{}, error) {
+				return interceptor(c, req, info, inner)
+			}
+		}
+		return next(c, req)
+	}
 }
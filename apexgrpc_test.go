@@ -0,0 +1,527 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/apex/go-apex"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// The tests of this package call apexgrpc.test.Echo, a service registered in
+// the global registry at init without generated code:
+//
+//	message EchoRequest { string message = 1; int32 count = 2; repeated string tags = 3; int64 id = 4; string secret = 5; }
+//	message EchoReply { same fields }
+//	service Echo {
+//	  rpc Echo(EchoRequest) returns (EchoReply);            // copies the request
+//	  rpc Fail(EchoRequest) returns (EchoReply);            // fails with code count and message
+//	  rpc Split(EchoRequest) returns (stream EchoReply);    // one reply per tag
+//	  rpc Join(stream EchoRequest) returns (EchoReply);     // joins the messages
+//	}
+const (
+	echoPackage = "apexgrpc.test"
+	echoService = "apexgrpc.test.Echo"
+)
+
+var (
+	echoFile       protoreflect.FileDescriptor
+	echoRequestMD  protoreflect.MessageDescriptor
+	echoReplyMD    protoreflect.MessageDescriptor
+	echoServiceMD  protoreflect.ServiceDescriptor
+	echoFileDescPB *descriptorpb.FileDescriptorProto
+)
+
+func init() {
+	fields := func() []*descriptorpb.FieldDescriptorProto {
+		field := func(name string, n int32, t descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+			return &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(name),
+				JsonName: proto.String(name),
+				Number:   proto.Int32(n),
+				Type:     t.Enum(),
+				Label:    label.Enum(),
+			}
+		}
+		opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		return []*descriptorpb.FieldDescriptorProto{
+			field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt),
+			field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, opt),
+			field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_REPEATED),
+			field("id", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, opt),
+			field("secret", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt),
+		}
+	}
+	method := func(name, in, out string, clientStreaming, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String("." + echoPackage + "." + in),
+			OutputType:      proto.String("." + echoPackage + "." + out),
+			ClientStreaming: proto.Bool(clientStreaming),
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+	echoFileDescPB = &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("apexgrpc/test/echo.proto"),
+		Package: proto.String(echoPackage),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("EchoRequest"), Field: fields()},
+			{Name: proto.String("EchoReply"), Field: fields()},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Echo", "EchoRequest", "EchoReply", false, false),
+				method("Fail", "EchoRequest", "EchoReply", false, false),
+				method("Split", "EchoRequest", "EchoReply", false, true),
+				method("Join", "EchoRequest", "EchoReply", true, false),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(echoFileDescPB, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(err)
+	}
+	echoFile = fd
+	echoRequestMD = fd.Messages().ByName("EchoRequest")
+	echoReplyMD = fd.Messages().ByName("EchoReply")
+	echoServiceMD = fd.Services().ByName("Echo")
+	for _, md := range []protoreflect.MessageDescriptor{echoRequestMD, echoReplyMD} {
+		if err := protoregistry.GlobalTypes.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// echoServer implements apexgrpc.test.Echo. echo, if set, replaces the
+// handler of Echo.
+type echoServer struct {
+	echo func(c context.Context, req *dynamicpb.Message) (proto.Message, error)
+}
+
+func newEchoRequest(t testing.TB, js string) *dynamicpb.Message {
+	t.Helper()
+	m := dynamicpb.NewMessage(echoRequestMD)
+	if err := protojson.Unmarshal([]byte(js), m); err != nil {
+		t.Fatalf("decoding %s: %v", js, err)
+	}
+	return m
+}
+
+// echoReply copies the fields of req into a new EchoReply.
+func echoReply(req *dynamicpb.Message) *dynamicpb.Message {
+	reply := dynamicpb.NewMessage(echoReplyMD)
+	req.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		out := echoReplyMD.Fields().ByNumber(fd.Number())
+		if fd.IsList() {
+			list := reply.Mutable(out).List()
+			for i := 0; i < v.List().Len(); i++ {
+				list.Append(v.List().Get(i))
+			}
+			return true
+		}
+		reply.Set(out, v)
+		return true
+	})
+	return reply
+}
+
+func stringField(m protoreflect.ProtoMessage, name string) string {
+	r := m.ProtoReflect()
+	return r.Get(r.Descriptor().Fields().ByName(protoreflect.Name(name))).String()
+}
+
+func (e *echoServer) handle(c context.Context, method string, req *dynamicpb.Message) (proto.Message, error) {
+	switch method {
+	case "Fail":
+		r := req.ProtoReflect()
+		code := codes.Code(r.Get(echoRequestMD.Fields().ByName("count")).Int())
+		return nil, status.Error(code, stringField(req, "message"))
+	case "Echo":
+		if e.echo != nil {
+			return e.echo(c, req)
+		}
+	}
+	return echoReply(req), nil
+}
+
+func echoUnaryHandler(method string) grpc.MethodHandler {
+	return func(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := dynamicpb.NewMessage(echoRequestMD)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(c context.Context, req interface{}) (interface{}, error) {
+			return srv.(*echoServer).handle(c, method, req.(*dynamicpb.Message))
+		}
+		if interceptor == nil {
+			return handler(c, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + echoService + "/" + method}
+		return interceptor(c, req, info, handler)
+	}
+}
+
+func splitHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := dynamicpb.NewMessage(echoRequestMD)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	tags := req.Get(echoRequestMD.Fields().ByName("tags")).List()
+	for i := 0; i < tags.Len(); i++ {
+		reply := dynamicpb.NewMessage(echoReplyMD)
+		reply.Set(echoReplyMD.Fields().ByName("message"), tags.Get(i))
+		if err := stream.SendMsg(reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinHandler(srv interface{}, stream grpc.ServerStream) error {
+	var parts []string
+	for {
+		req := dynamicpb.NewMessage(echoRequestMD)
+		err := stream.RecvMsg(req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		parts = append(parts, stringField(req, "message"))
+	}
+	reply := dynamicpb.NewMessage(echoReplyMD)
+	reply.Set(echoReplyMD.Fields().ByName("message"), protoreflect.ValueOfString(strings.Join(parts, " ")))
+	reply.Set(echoReplyMD.Fields().ByName("count"), protoreflect.ValueOfInt32(int32(len(parts))))
+	return stream.SendMsg(reply)
+}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: echoService,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: echoUnaryHandler("Echo")},
+		{MethodName: "Fail", Handler: echoUnaryHandler("Fail")},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Split", Handler: splitHandler, ServerStreams: true},
+		{StreamName: "Join", Handler: joinHandler, ClientStreams: true},
+	},
+	Metadata: "apexgrpc/test/echo.proto",
+}
+
+func echoServiceWith(srv *echoServer) Service {
+	return Service{Desc: &echoServiceDesc, Server: srv}
+}
+
+// newEchoServer returns a Server configured with opts and serving
+// apexgrpc.test.Echo.
+func newEchoServer(t testing.TB, opts ...ServerOption) *Server {
+	t.Helper()
+	return newEchoServerWith(t, &echoServer{}, opts...)
+}
+
+func newEchoServerWith(t testing.TB, srv *echoServer, opts ...ServerOption) *Server {
+	t.Helper()
+	s := NewServer(opts...)
+	if err := s.Register([]Service{echoServiceWith(srv)}); err != nil {
+		t.Fatalf("registering the echo service: %v", err)
+	}
+	return s
+}
+
+func testApexContext() *apex.Context {
+	return &apex.Context{
+		RequestID:          "test-request",
+		FunctionName:       "test",
+		InvokedFunctionARN: "arn:aws:lambda:us-east-1:000000000000:function:test",
+	}
+}
+
+// serve serves eventMsg like the Lambda runtime and returns the JSON response.
+func serve(t testing.TB, s *Server, eventMsg string) (string, error) {
+	t.Helper()
+	res, err := s.ApexHandler(context.Background())(json.RawMessage(eventMsg), testApexContext())
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("encoding the response: %v", err)
+	}
+	return string(b), nil
+}
+
+// echoEvent returns an Event for method of apexgrpc.test.Echo with data.
+func echoEvent(method, data string) string {
+	return fmt.Sprintf(`{"service":%q,"method":%q,"data":%s}`, echoService, method, data)
+}
+
+// assertJSON fails t unless got and want are equal JSON.
+func assertJSON(t testing.TB, got, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	if string(gb) != string(wb) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func assertCode(t testing.TB, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %v, want %v (err = %v)", got, want, err)
+	}
+}
+
+func TestPackageQualifiedMethodIDs(t *testing.T) {
+	s := newEchoServer(t)
+	want := NewMethodID("", echoService, "Echo")
+	if got := NewMethodID(echoPackage, "Echo", "Echo"); got != want {
+		t.Errorf("NewMethodID with a package = %q, want %q", got, want)
+	}
+	events := map[string]string{
+		"qualified service": echoEvent("Echo", `{"message":"hi"}`),
+		"package field":     fmt.Sprintf(`{"package":%q,"service":"Echo","method":"Echo","data":{"message":"hi"}}`, echoPackage),
+	}
+	for name, event := range events {
+		t.Run(name, func(t *testing.T) {
+			got, err := serve(t, s, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, `{"message":"hi"}`)
+		})
+	}
+	_, err := serve(t, s, fmt.Sprintf(`{"package":"other","service":%q,"method":"Echo","data":{}}`, echoService))
+	assertCode(t, err, codes.Unimplemented)
+}
+
+func TestInvokeReturnsReplyMessage(t *testing.T) {
+	s := newEchoServer(t)
+	reply, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]interface{}{"message": "hi", "count": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := reply.(*dynamicpb.Message)
+	if !ok {
+		t.Fatalf("reply is %T, want *dynamicpb.Message", reply)
+	}
+	if name := m.Descriptor().FullName(); name != echoReplyMD.FullName() {
+		t.Errorf("reply type = %s, want %s", name, echoReplyMD.FullName())
+	}
+	if got := stringField(m, "message"); got != "hi" {
+		t.Errorf("message = %q, want %q", got, "hi")
+	}
+	if _, err := s.Invoke(context.Background(), "", echoService, "Split", map[string]interface{}{}); err == nil {
+		t.Error("Invoke of a server-streaming method: err = nil")
+	}
+}
+
+func TestUnaryInterceptorChain(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name+" "+info.FullMethod)
+			return handler(c, req)
+		}
+	}
+	deny := func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if stringField(req.(proto.Message).(protoreflect.ProtoMessage), "message") == "deny" {
+			return nil, status.Error(codes.PermissionDenied, "denied")
+		}
+		return handler(c, req)
+	}
+	s := newEchoServer(t, WithUnaryInterceptor(record("first"), deny), WithUnaryInterceptor(record("second")))
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first /apexgrpc.test.Echo/Echo", "second /apexgrpc.test.Echo/Echo"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	calls = nil
+	_, err := serve(t, s, echoEvent("Echo", `{"message":"deny"}`))
+	assertCode(t, err, codes.PermissionDenied)
+	if len(calls) != 1 {
+		t.Errorf("calls after a rejection = %q, want only the first interceptor", calls)
+	}
+}
+
+func TestRegisterRejectsInvalidServices(t *testing.T) {
+	s := newEchoServer(t)
+	tests := map[string][]Service{
+		"duplicate method":  {echoServiceWith(&echoServer{})},
+		"missing desc":      {{Server: &echoServer{}}},
+		"missing server":    {{Desc: &echoServiceDesc}},
+		"duplicate in call": {{Desc: &grpc.ServiceDesc{ServiceName: "x.Y", Methods: echoServiceDesc.Methods[:1]}, Server: &echoServer{}}, {Desc: &grpc.ServiceDesc{ServiceName: "x.Y", Methods: echoServiceDesc.Methods[:1]}, Server: &echoServer{}}},
+	}
+	for name, svcs := range tests {
+		t.Run(name, func(t *testing.T) {
+			before := s.Methods()
+			if err := s.Register(svcs); err == nil {
+				t.Fatal("err = nil")
+			}
+			if after := s.Methods(); fmt.Sprint(after) != fmt.Sprint(before) {
+				t.Errorf("methods changed from %v to %v by a failed registration", before, after)
+			}
+		})
+	}
+}
+
+func TestInvokeProto(t *testing.T) {
+	var decoded bool
+	s := newEchoServer(t, WithUnaryInterceptor(func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		decoded = true
+		return handler(c, req)
+	}))
+	reply, err := s.InvokeProto(context.Background(), "", echoService, "Echo", newEchoRequest(t, `{"message":"hi","id":"9007199254740993"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded {
+		t.Error("interceptors not run")
+	}
+	m := reply.(*dynamicpb.Message)
+	if id := m.Get(echoReplyMD.Fields().ByName("id")).Int(); id != 9007199254740993 {
+		t.Errorf("id = %d, want 9007199254740993", id)
+	}
+	if _, err := s.InvokeProto(context.Background(), "", echoService, "Echo", nil); err == nil {
+		t.Error("nil request: err = nil")
+	}
+}
+
+func TestFullMethodStrings(t *testing.T) {
+	s := newEchoServer(t)
+	for _, method := range []string{"/apexgrpc.test.Echo/Echo", "apexgrpc.test.Echo/Echo"} {
+		got, err := serve(t, s, fmt.Sprintf(`{"service":"ignored","method":%q,"data":{"message":"hi"}}`, method))
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		assertJSON(t, got, `{"message":"hi"}`)
+	}
+	for _, method := range []string{"/apexgrpc.test.Echo/", "/Echo", "a/b/c"} {
+		_, err := serve(t, s, fmt.Sprintf(`{"method":%q,"data":{}}`, method))
+		assertCode(t, err, codes.InvalidArgument)
+	}
+}
+
+func TestRegisterWhileServing(t *testing.T) {
+	s := newEchoServer(t)
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	other := &grpc.ServiceDesc{ServiceName: "apexgrpc.test.Other", Methods: echoServiceDesc.Methods[:1]}
+	for i := 0; i < 50; i++ {
+		if err := s.Register([]Service{{Desc: other, Server: &echoServer{}}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Invoke(context.Background(), "", "apexgrpc.test.Other", "Echo", map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Deregister("apexgrpc.test.Other") {
+			t.Fatal("Deregister reported the service as not registered")
+		}
+	}
+	close(done)
+	if err := <-errs; err != nil {
+		t.Errorf("call during registration: %v", err)
+	}
+	_, err := s.Invoke(context.Background(), "", "apexgrpc.test.Other", "Echo", map[string]string{})
+	assertCode(t, err, codes.Unimplemented)
+}
+
+func BenchmarkProcessEvent(b *testing.B) {
+	s := newEchoServer(b)
+	h := s.ApexHandler(context.Background())
+	event := json.RawMessage(echoEvent("Echo", `{"message":"hello","count":3,"tags":["a","b","c"]}`))
+	ctx := testApexContext()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := h(event, ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInvoke(b *testing.B) {
+	s := newEchoServer(b)
+	req := map[string]interface{}{"message": "hello", "count": 3, "tags": []string{"a", "b", "c"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Invoke(context.Background(), "", echoService, "Echo", req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolve(b *testing.B) {
+	s := newEchoServer(b, WithLenientMethodMatching())
+	calls := []struct{ pkg, svc, mtd string }{
+		{"", echoService, "Echo"},
+		{echoPackage, "Echo", "Echo"},
+		{"", "Echo", "Echo"},
+		{"", "apexgrpc.test.echo", "echo"},
+	}
+	for _, c := range calls {
+		if _, ok := s.resolve("", c.pkg, c.svc, c.mtd); !ok {
+			b.Fatalf("%+v not resolved", c)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := calls[i%len(calls)]
+		s.resolve("", c.pkg, c.svc, c.mtd)
+	}
+}
+
+func BenchmarkInvokeRaw(b *testing.B) {
+	s := newEchoServer(b)
+	req := json.RawMessage(`{"message":"hello","count":3,"tags":["a","b","c"]}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.InvokeRaw(context.Background(), "", echoService, "Echo", req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
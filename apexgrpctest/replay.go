@@ -0,0 +1,154 @@
+// Package apexgrpctest helps test apexgrpc servers.
+package apexgrpctest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// LoadRecords reads the recordings of the JSONL file at path, as written by
+// apexgrpc.NewJSONLRecorder.
+func LoadRecords(path string) ([]apexgrpc.Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recs []apexgrpc.Recording
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var rec apexgrpc.Recording
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// ReplayOption configures Replay.
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	ignore [][]string
+}
+
+// IgnorePaths leaves the fields at paths out of the comparison of responses.
+// A path is a dotted list of object keys, e.g. "meta.durationMs"; it applies
+// to every element of the arrays on the way.
+func IgnorePaths(paths ...string) ReplayOption {
+	return func(o *replayOptions) {
+		for _, p := range paths {
+			o.ignore = append(o.ignore, strings.Split(p, "."))
+		}
+	}
+}
+
+// Replay serves the event of each recording with s and reports an error for
+// every response that differs from the recorded one. Failed calls match if
+// they fail with the recorded gRPC code.
+func Replay(t *testing.T, s *apexgrpc.Server, recs []apexgrpc.Recording, opts ...ReplayOption) {
+	t.Helper()
+	var o replayOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	h := s.ApexHandler(context.Background())
+	for i, rec := range recs {
+		name := fmt.Sprintf("recording %d", i)
+		if rec.Method != "" {
+			name += " (" + rec.Method.String() + ")"
+		}
+		if rec.Event == nil {
+			t.Errorf("%s: no event was recorded", name)
+			continue
+		}
+		res, err := h(rec.Event, nil)
+		if rec.Error != nil {
+			if code := apexgrpc.Code(err); code != rec.Error.GRPCCode {
+				t.Errorf("%s: got code %v (%v), recorded %v: %s", name, code, err, rec.Error.GRPCCode, rec.Error.Message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got error %v, recorded a response", name, err)
+			continue
+		}
+		got, err := json.Marshal(res)
+		if err != nil {
+			t.Errorf("%s: encoding response: %v", name, err)
+			continue
+		}
+		if diff := diffJSON(rec.Response, got, o.ignore); diff != "" {
+			t.Errorf("%s: %s", name, diff)
+		}
+	}
+}
+
+// diffJSON describes how got differs from want, or returns "" if they are
+// equal apart from the ignored paths.
+func diffJSON(want []byte, got []byte, ignore [][]string) string {
+	w, err := decodeJSON(want)
+	if err != nil {
+		return fmt.Sprintf("decoding recorded response: %v", err)
+	}
+	g, err := decodeJSON(got)
+	if err != nil {
+		return fmt.Sprintf("decoding response: %v", err)
+	}
+	for _, path := range ignore {
+		w = deletePath(w, path)
+		g = deletePath(g, path)
+	}
+	if reflect.DeepEqual(w, g) {
+		return ""
+	}
+	wb, _ := json.Marshal(w)
+	gb, _ := json.Marshal(g)
+	return fmt.Sprintf("response differs:\n got: %s\nwant: %s", gb, wb)
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func deletePath(v interface{}, path []string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = deletePath(v[i], path)
+		}
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(v, path[0])
+		} else if next, ok := v[path[0]]; ok {
+			v[path[0]] = deletePath(next, path[1:])
+		}
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+package apexgrpctest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// structService is apexgrpctest.Structs. Echo returns its google.protobuf.Struct
+// request with the request ID of the call added as "requestId"; Fail fails
+// with codes.NotFound.
+var structService = apexgrpc.Service{
+	Desc: &grpc.ServiceDesc{
+		ServiceName: "apexgrpctest.Structs",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Echo", Handler: structHandler(func(c context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				if ctx, ok := apexgrpc.FromContext(c); ok {
+					req.Fields["requestId"] = structpb.NewStringValue(ctx.RequestID)
+				}
+				return req, nil
+			})},
+			{MethodName: "Fail", Handler: structHandler(func(c context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				return nil, status.Error(codes.NotFound, "not found")
+			})},
+		},
+	},
+	Server: struct{}{},
+}
+
+func structHandler(f func(context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := &structpb.Struct{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if req.Fields == nil {
+			req.Fields = map[string]*structpb.Value{}
+		}
+		handler := func(c context.Context, req interface{}) (interface{}, error) {
+			return f(c, req.(*structpb.Struct))
+		}
+		if interceptor == nil {
+			return handler(c, req)
+		}
+		return interceptor(c, req, &grpc.UnaryServerInfo{Server: srv}, handler)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := apexgrpc.NewServer(apexgrpc.WithRecorder(apexgrpc.NewJSONLRecorder(f)))
+	if err := s.Register([]apexgrpc.Service{structService}); err != nil {
+		t.Fatal(err)
+	}
+	ts := Wrap(s)
+	if _, err := ts.Call(t, "apexgrpctest.Structs/Echo", `{"a":1}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Call(t, "apexgrpctest.Structs/Fail", `{}`); err == nil {
+		t.Fatal("Fail: err = nil")
+	}
+	f.Close()
+
+	recs, err := LoadRecords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[1].Error == nil || recs[1].Error.GRPCCode != codes.NotFound {
+		t.Fatalf("loaded %+v", recs)
+	}
+	// The replayed calls have no request ID.
+	replay := apexgrpc.NewServer()
+	if err := replay.Register([]apexgrpc.Service{structService}); err != nil {
+		t.Fatal(err)
+	}
+	Replay(t, replay, recs, IgnorePaths("requestId"))
+}
+
+func TestLoadRecordsErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRecords(path); err == nil || err.Error() != path+":3: invalid character 'o' in literal null (expecting 'u')" {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := LoadRecords(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("missing file: err = nil")
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		want, got string
+		ignore    []string
+		same      bool
+	}{
+		{`{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, nil, true},
+		{`{"a":1}`, `{"a":1.0}`, nil, false},
+		{`{"a":1,"meta":{"durationMs":3}}`, `{"a":1,"meta":{"durationMs":5}}`, nil, false},
+		{`{"a":1,"meta":{"durationMs":3}}`, `{"a":1,"meta":{"durationMs":5}}`, []string{"meta.durationMs"}, true},
+		{`[{"t":1,"v":"x"}]`, `[{"t":2,"v":"x"}]`, []string{"t"}, true},
+		{`[{"t":1,"v":"x"}]`, `[{"t":2,"v":"y"}]`, []string{"t"}, false},
+	}
+	for _, tt := range tests {
+		var o replayOptions
+		IgnorePaths(tt.ignore...)(&o)
+		if diff := diffJSON([]byte(tt.want), []byte(tt.got), o.ignore); (diff == "") != tt.same {
+			t.Errorf("diffJSON(%s, %s, %v) = %q", tt.want, tt.got, tt.ignore, diff)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package apexgrpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apex/go-apex"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of AssertGolden")
+
+// TestServer serves events to a Server in memory the way the Lambda runtime
+// does, with a fabricated apex.Context so that apexgrpc.FromContext works in
+// handlers.
+type TestServer struct {
+	Server *apexgrpc.Server
+
+	calls int64
+}
+
+// NewTestServer returns a TestServer for a new Server with svcs registered,
+// failing t if they cannot be.
+func NewTestServer(t *testing.T, svcs ...apexgrpc.Service) *TestServer {
+	t.Helper()
+	s := apexgrpc.NewServer()
+	if err := s.Register(svcs); err != nil {
+		t.Fatalf("registering services: %v", err)
+	}
+	return Wrap(s)
+}
+
+// Wrap returns a TestServer for a configured Server.
+func Wrap(s *apexgrpc.Server) *TestServer {
+	return &TestServer{Server: s}
+}
+
+// Context returns the apex.Context events are served with. Each call has a
+// new request ID.
+func (ts *TestServer) Context() *apex.Context {
+	n := atomic.AddInt64(&ts.calls, 1)
+	return &apex.Context{
+		InvokeID:                 fmt.Sprintf("apexgrpctest-%d", n),
+		RequestID:                fmt.Sprintf("apexgrpctest-%d", n),
+		FunctionName:             "apexgrpctest",
+		FunctionVersion:          "$LATEST",
+		MemoryLimitInMB:          "128",
+		IsDefaultFunctionVersion: true,
+		InvokedFunctionARN:       "arn:aws:lambda:us-east-1:000000000000:function:apexgrpctest",
+	}
+}
+
+// Serve serves a raw Lambda payload like apex does and returns the JSON the
+// function responds with.
+func (ts *TestServer) Serve(t *testing.T, eventMsg []byte) ([]byte, error) {
+	t.Helper()
+	res, err := ts.Server.ApexHandler(context.Background())(json.RawMessage(eventMsg), ts.Context())
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("encoding response: %v", err)
+	}
+	return b, nil
+}
+
+// Call calls method, e.g. "pkg.Service/Method", with the JSON request data
+// and returns the JSON response.
+func (ts *TestServer) Call(t *testing.T, method string, requestJSON string) (string, error) {
+	t.Helper()
+	event := map[string]interface{}{"method": method}
+	if requestJSON != "" {
+		event["data"] = json.RawMessage(requestJSON)
+	}
+	eventMsg, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("encoding event: %v", err)
+	}
+	b, err := ts.Serve(t, eventMsg)
+	return string(b), err
+}
+
+// CallProto calls method with req and decodes the response into resp.
+func (ts *TestServer) CallProto(t *testing.T, method string, req proto.Message, resp proto.Message) error {
+	t.Helper()
+	data, err := protojson.Marshal(protoadapt.MessageV2Of(req))
+	if err != nil {
+		t.Fatalf("encoding request: %v", err)
+	}
+	out, err := ts.Call(t, method, string(data))
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal([]byte(out), protoadapt.MessageV2Of(resp)); err != nil {
+		t.Fatalf("decoding response %s: %v", out, err)
+	}
+	return nil
+}
+
+// AssertGolden calls method with the JSON request in requestFile and fails t
+// unless the response matches goldenFile. Responses are compared in a
+// canonical form with sorted keys. Run the test with -update to write the
+// golden file instead.
+func (ts *TestServer) AssertGolden(t *testing.T, method string, requestFile string, goldenFile string) {
+	t.Helper()
+	req, err := os.ReadFile(requestFile)
+	if err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+	out, err := ts.Call(t, method, string(bytes.TrimSpace(req)))
+	if err != nil {
+		t.Fatalf("calling %s: %v", method, err)
+	}
+	got, err := canonicalJSON([]byte(out))
+	if err != nil {
+		t.Fatalf("canonicalizing response: %v", err)
+	}
+	if *update {
+		if err := os.WriteFile(goldenFile, got, 0644); err != nil {
+			t.Fatalf("writing golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run with -update to create it)", err)
+	}
+	if want, err = canonicalJSON(want); err != nil {
+		t.Fatalf("canonicalizing golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response of %s differs from %s:\n got: %s\nwant: %s", method, goldenFile, got, want)
+	}
+}
+
+// canonicalJSON reencodes b with apexgrpc.CanonicalizeJSON and a fixed
+// indentation.
+func canonicalJSON(b []byte) ([]byte, error) {
+	c, err := apexgrpc.CanonicalizeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, c, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
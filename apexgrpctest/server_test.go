@@ -0,0 +1,64 @@
+package apexgrpctest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+func TestCall(t *testing.T) {
+	ts := NewTestServer(t, structService)
+	got, err := ts.Call(t, "apexgrpctest.Structs/Echo", `{"a":"b"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `{"a":"b","requestId":"apexgrpctest-1"}` {
+		t.Errorf("Call = %s", got)
+	}
+	if _, err := ts.Call(t, "apexgrpctest.Structs/Fail", ""); apexgrpc.Code(err) != codes.NotFound {
+		t.Errorf("Fail: err = %v", err)
+	}
+	if _, err := ts.Call(t, "apexgrpctest.Structs/Nope", ""); apexgrpc.Code(err) != codes.Unimplemented {
+		t.Errorf("unknown method: err = %v", err)
+	}
+}
+
+func TestCallProto(t *testing.T) {
+	ts := NewTestServer(t, structService)
+	req, err := structpb.NewStruct(map[string]interface{}{"n": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp structpb.Struct
+	if err := ts.CallProto(t, "apexgrpctest.Structs/Echo", req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Fields["n"].GetNumberValue() != 2 || resp.Fields["requestId"].GetStringValue() != "apexgrpctest-1" {
+		t.Errorf("CallProto = %v", &resp)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	NewTestServer(t, structService).AssertGolden(t, "apexgrpctest.Structs/Echo", "testdata/echo.request.json", "testdata/echo.golden.json")
+
+	golden := filepath.Join(t.TempDir(), "echo.golden.json")
+	*update = true
+	defer func() { *update = false }()
+	NewTestServer(t, structService).AssertGolden(t, "apexgrpctest.Structs/Echo", "testdata/echo.request.json", golden)
+	got, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/echo.golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("-update wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+// APIGatewayProxyRequest is the event delivered by API Gateway in Lambda
+// proxy mode.
+type APIGatewayProxyRequest struct {
+	Resource                        string                        `json:"resource"`
+	Path                            string                        `json:"path"`
+	HTTPMethod                      string                        `json:"httpMethod"`
+	Headers                         map[string]string             `json:"headers"`
+	MultiValueHeaders               map[string][]string           `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string             `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string           `json:"multiValueQueryStringParameters"`
+	PathParameters                  map[string]string             `json:"pathParameters"`
+	StageVariables                  map[string]string             `json:"stageVariables"`
+	RequestContext                  APIGatewayProxyRequestContext `json:"requestContext"`
+	Body                            string                        `json:"body"`
+	IsBase64Encoded                 bool                          `json:"isBase64Encoded"`
+}
+
+type APIGatewayProxyRequestContext struct {
+	RequestID  string             `json:"requestId"`
+	Stage      string             `json:"stage"`
+	ResourceID string             `json:"resourceId"`
+	Identity   APIGatewayIdentity `json:"identity"`
+}
+
+// APIGatewayIdentity describes the caller of an API Gateway request. The IAM
+// fields are set for requests signed with SigV4.
+type APIGatewayIdentity struct {
+	SourceIP              string `json:"sourceIp"`
+	UserAgent             string `json:"userAgent"`
+	AccountID             string `json:"accountId"`
+	Caller                string `json:"caller"`
+	User                  string `json:"user"`
+	UserARN               string `json:"userArn"`
+	CognitoIdentityID     string `json:"cognitoIdentityId"`
+	CognitoIdentityPoolID string `json:"cognitoIdentityPoolId"`
+}
+
+// APIGatewayProxyResponse is the result returned to API Gateway in Lambda
+// proxy mode.
+type APIGatewayProxyResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// WithAPIGatewayPathPrefix sets the path prefix in front of
+// "/pkg.Service/Method" for requests routed by the API Gateway adapter.
+func WithAPIGatewayPathPrefix(prefix string) ServerOption {
+	return func(o *options) {
+		o.apiGatewayPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// RunAPIGateway serves API Gateway Lambda proxy requests, routing
+// POST /pkg.Service/Method to the registered handler.
+func (s *Server) RunAPIGateway() {
+	s.RunAPIGatewayWithContext(context.Background())
+}
+
+func (s *Server) RunAPIGatewayWithContext(c context.Context) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.handleAPIGateway(c, eventMsg, ctx), nil
+	})
+}
+
+func (s *Server) handleAPIGateway(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) *APIGatewayProxyResponse {
+	var req APIGatewayProxyRequest
+	if err := json.Unmarshal(eventMsg, &req); err != nil {
+		return newAPIGatewayResponse(newHTTPErrorResponse(http.StatusBadRequest, invalidEventf("invalid event")))
+	}
+	res := s.serveHTTP(c, &httpRequest{
+		method:  req.HTTPMethod,
+		path:    req.Path,
+		query:   queryValues(req.QueryStringParameters, req.MultiValueQueryStringParameters),
+		headers: headerMetadata(req.Headers, req.MultiValueHeaders),
+		body:    req.Body,
+		base64:  req.IsBase64Encoded,
+		identity: &CallerIdentity{
+			CallerARN:             req.RequestContext.Identity.UserARN,
+			AccountID:             req.RequestContext.Identity.AccountID,
+			CognitoIdentityID:     req.RequestContext.Identity.CognitoIdentityID,
+			CognitoIdentityPoolID: req.RequestContext.Identity.CognitoIdentityPoolID,
+			SourceIP:              req.RequestContext.Identity.SourceIP,
+		},
+	}, s.opts.apiGatewayPrefix, ctx)
+	return newAPIGatewayResponse(res)
+}
+
+func newAPIGatewayResponse(res *httpResponse) *APIGatewayProxyResponse {
+	return &APIGatewayProxyResponse{
+		StatusCode:      res.status,
+		Headers:         res.headers,
+		Body:            res.body,
+		IsBase64Encoded: res.base64,
+	}
+}
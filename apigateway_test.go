@@ -0,0 +1,42 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestAPIGateway(t *testing.T) {
+	s := newEchoServer(t, WithAPIGatewayPathPrefix("/api/"))
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"call", http.MethodPost, "/api/apexgrpc.test.Echo/Echo", `{"message":"hi"}`, http.StatusOK, `{"message":"hi"}`},
+		{"empty body", http.MethodPost, "/api/apexgrpc.test.Echo/Echo", "", http.StatusOK, `{}`},
+		{"status", http.MethodPost, "/api/apexgrpc.test.Echo/Fail", `{"count":5,"message":"gone"}`, http.StatusNotFound, ""},
+		{"unknown path", http.MethodPost, "/api/nope", `{}`, http.StatusNotFound, ""},
+		{"wrong method", http.MethodGet, "/api/apexgrpc.test.Echo/Echo", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, _ := json.Marshal(APIGatewayProxyRequest{HTTPMethod: tt.method, Path: tt.path, Body: tt.body})
+			res := s.handleAPIGateway(context.Background(), event, testApexContext())
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", res.StatusCode, tt.status, res.Body)
+			}
+			if tt.want != "" {
+				assertJSON(t, res.Body, tt.want)
+			}
+			if res.Headers["Content-Type"] != "application/json" {
+				t.Errorf("Content-Type = %q", res.Headers["Content-Type"])
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Package auth authenticates the method calls of an apexgrpc.Server with JWT
+// bearer tokens carried in the event metadata.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// Claims are the claims of a validated token.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the claims of the token that authenticated the
+// call handled with c.
+func ClaimsFromContext(c context.Context) (Claims, bool) {
+	claims, ok := c.Value(claimsContextKey{}).(Claims)
+	return claims, ok
+}
+
+// Option configures UnaryServerInterceptor.
+type Option func(*config)
+
+type config struct {
+	metadataKey string
+	audience    string
+	issuer      string
+	leeway      time.Duration
+	exempt      map[string]bool
+	now         func() time.Time
+}
+
+// WithAudience requires tokens to name aud in their "aud" claim.
+func WithAudience(aud string) Option {
+	return func(c *config) {
+		c.audience = aud
+	}
+}
+
+// WithIssuer requires tokens to carry iss as their "iss" claim.
+func WithIssuer(iss string) Option {
+	return func(c *config) {
+		c.issuer = iss
+	}
+}
+
+// WithLeeway tolerates clock skew of up to d when checking "exp" and "nbf".
+func WithLeeway(d time.Duration) Option {
+	return func(c *config) {
+		c.leeway = d
+	}
+}
+
+// WithMetadataKey reads the token from key instead of "authorization".
+func WithMetadataKey(key string) Option {
+	return func(c *config) {
+		c.metadataKey = strings.ToLower(key)
+	}
+}
+
+// WithExemptMethods lets the methods ids be called without a token.
+func WithExemptMethods(ids ...apexgrpc.MethodID) Option {
+	return func(c *config) {
+		for _, id := range ids {
+			c.exempt[id.String()] = true
+		}
+	}
+}
+
+var errUnauthenticated = status.Error(codes.Unauthenticated, "missing or invalid credentials")
+
+// UnaryServerInterceptor returns an interceptor, to be installed with
+// apexgrpc.WithUnaryInterceptor, that requires a "Bearer" token in the
+// "authorization" metadata of every call. Tokens must be signed with a key of
+// keys and must not be expired; their claims are available to handlers
+// through ClaimsFromContext. Failures are reported as codes.Unauthenticated
+// without details of what was wrong with the token.
+func UnaryServerInterceptor(keys KeySet, opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := &config{
+		metadataKey: "authorization",
+		exempt:      map[string]bool{},
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if cfg.exempt[strings.TrimPrefix(info.FullMethod, "/")] {
+			return handler(c, req)
+		}
+		token, ok := bearerToken(c, cfg.metadataKey)
+		if !ok {
+			return nil, errUnauthenticated
+		}
+		claims, err := cfg.validate(c, keys, token)
+		if err != nil {
+			return nil, errUnauthenticated
+		}
+		return handler(context.WithValue(c, claimsContextKey{}, claims), req)
+	}
+}
+
+func bearerToken(c context.Context, key string) (string, bool) {
+	md, _ := metadata.FromIncomingContext(c)
+	vals := md.Get(key)
+	if len(vals) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(vals[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (cfg *config) validate(c context.Context, keys KeySet, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys.Key(c, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, cfg.checkClaims(claims)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (cfg *config) checkClaims(claims Claims) error {
+	now := cfg.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(cfg.leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(cfg.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+	if cfg.issuer != "" && claims["iss"] != cfg.issuer {
+		return errors.New("wrong issuer")
+	}
+	if cfg.audience != "" && !hasAudience(claims["aud"], cfg.audience) {
+		return errors.New("wrong audience")
+	}
+	return nil
+}
+
+// hasAudience reports whether the "aud" claim, a string or an array of
+// strings, names aud.
+func hasAudience(claim interface{}, aud string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, a := range v {
+			if a == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var errAlgorithm = errors.New("unsupported algorithm or key")
+
+func verify(alg string, key interface{}, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return errAlgorithm
+	}
+	var h crypto.Hash
+	// curveBits is the size of the curve ES algorithms sign with.
+	var curveBits int
+	switch alg[2:] {
+	case "256":
+		h, curveBits = crypto.SHA256, 256
+	case "384":
+		h, curveBits = crypto.SHA384, 384
+	case "512":
+		h, curveBits = crypto.SHA512, 521
+	default:
+		return errAlgorithm
+	}
+	digest := newHash(h)
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+	switch k := key.(type) {
+	case []byte:
+		if alg[:2] != "HS" {
+			return errAlgorithm
+		}
+		mac := hmac.New(func() hash.Hash { return newHash(h) }, k)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, h, sum, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, h, sum, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" || k.Curve.Params().BitSize != curveBits {
+			return errAlgorithm
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, sum, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errAlgorithm
+}
+
+func newHash(h crypto.Hash) hash.Hash {
+	switch h {
+	case crypto.SHA384:
+		return sha512.New384()
+	case crypto.SHA512:
+		return sha512.New()
+	}
+	return sha256.New()
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+var secret = []byte("secret")
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hs256Token(t *testing.T, claims Claims) string {
+	t.Helper()
+	signed := segment(t, header{Alg: "HS256"}) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func es256Token(t *testing.T, key *ecdsa.PrivateKey, claims Claims) string {
+	t.Helper()
+	signed := segment(t, header{Alg: "ES256"}) + "." + segment(t, claims)
+	sum := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() Claims {
+	return Claims{
+		"sub": "alice",
+		"aud": "api",
+		"exp": float64(time.Now().Add(time.Hour).Unix()),
+	}
+}
+
+// call runs interceptor for method with token as the bearer token, returning
+// the subject the handler saw.
+func call(interceptor grpc.UnaryServerInterceptor, method, token string) (string, error) {
+	c := context.Background()
+	if token != "" {
+		c = metadata.NewIncomingContext(c, metadata.Pairs("authorization", "Bearer "+token))
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/" + method}
+	reply, err := interceptor(c, nil, info, func(c context.Context, req interface{}) (interface{}, error) {
+		claims, _ := ClaimsFromContext(c)
+		return claims.Subject(), nil
+	})
+	sub, _ := reply.(string)
+	return sub, err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(StaticKeys{"": secret},
+		WithAudience("api"),
+		WithExemptMethods(apexgrpc.NewMethodID("", "test.Health", "Check")),
+	)
+	expired := validClaims()
+	expired["exp"] = float64(time.Now().Add(-time.Hour).Unix())
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = []interface{}{"other"}
+	tests := []struct {
+		name    string
+		method  string
+		token   string
+		subject string
+		code    codes.Code
+	}{
+		{"valid", "test.Echo/Echo", hs256Token(t, validClaims()), "alice", codes.OK},
+		{"missing token", "test.Echo/Echo", "", "", codes.Unauthenticated},
+		{"expired", "test.Echo/Echo", hs256Token(t, expired), "", codes.Unauthenticated},
+		{"wrong audience", "test.Echo/Echo", hs256Token(t, wrongAudience), "", codes.Unauthenticated},
+		{"tampered", "test.Echo/Echo", hs256Token(t, validClaims()) + "x", "", codes.Unauthenticated},
+		{"exempt method", "test.Health/Check", "", "", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := call(interceptor, tt.method, tt.token)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", code, tt.code, err)
+			}
+			if sub != tt.subject {
+				t.Errorf("subject = %q, want %q", sub, tt.subject)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsCurveMismatch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := es256Token(t, key, validClaims())
+	if _, err := call(UnaryServerInterceptor(StaticKeys{"": &key.PublicKey}), "test.Echo/Echo", token); err != nil {
+		t.Fatalf("ES256 with a P-256 key: %v", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = es256Token(t, other, validClaims())
+	_, err = call(UnaryServerInterceptor(StaticKeys{"": &other.PublicKey}), "test.Echo/Echo", token)
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("ES256 with a P-384 key: code = %v, want %v", code, codes.Unauthenticated)
+	}
+}
+
+func TestJWKSSharesFetches(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "k1",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+			}},
+		})
+	}))
+	defer srv.Close()
+	jwks := NewJWKS(srv.URL, time.Hour)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k, err := jwks.Key(context.Background(), "k1")
+			if err == nil {
+				if pk, ok := k.(*ecdsa.PublicKey); !ok || pk.X.Cmp(key.X) != 0 {
+					err = errors.New("wrong key")
+				}
+			}
+			errs <- err
+		}()
+	}
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+	if _, err := jwks.Key(context.Background(), "k2"); err == nil {
+		t.Error("unknown key: err = nil")
+	}
+}
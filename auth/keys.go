@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// KeySet provides the keys tokens are verified with. Keys are []byte for HMAC,
+// *rsa.PublicKey or *ecdsa.PublicKey.
+type KeySet interface {
+	// Key returns the key with the given ID, the "kid" header of the token,
+	// which may be empty.
+	Key(c context.Context, kid string) (interface{}, error)
+}
+
+// StaticKeys is a KeySet of fixed keys by ID. A token without a key ID is
+// verified with the key stored under "".
+type StaticKeys map[string]interface{}
+
+func (k StaticKeys) Key(c context.Context, kid string) (interface{}, error) {
+	key, ok := k[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// JWKS is a KeySet fetched from a JSON Web Key Set URL. Keys are cached for
+// TTL and refetched early, at most once per minute, when a token names an
+// unknown key. Concurrent calls share a single fetch, which other calls for a
+// cached key do not wait for.
+type JWKS struct {
+	URL    string
+	TTL    time.Duration
+	Client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+	flight  *jwksFetch
+}
+
+// jwksFetch is a fetch of the key set in progress.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKS returns a JWKS for url that caches keys for ttl.
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{URL: url, TTL: ttl}
+}
+
+const jwksMinRefresh = time.Minute
+
+func (j *JWKS) Key(c context.Context, kid string) (interface{}, error) {
+	j.mu.Lock()
+	age := time.Since(j.fetched)
+	key, ok := j.keys[kid]
+	if j.keys != nil && age <= j.TTL && (ok || age <= jwksMinRefresh) {
+		j.mu.Unlock()
+		return foundKey(key, ok, kid)
+	}
+	f := j.flight
+	if f == nil {
+		f = &jwksFetch{done: make(chan struct{})}
+		j.flight = f
+		j.mu.Unlock()
+		keys, err := j.fetch(c)
+		j.mu.Lock()
+		if err == nil {
+			j.keys, j.fetched = keys, time.Now()
+		}
+		f.err, j.flight = err, nil
+		j.mu.Unlock()
+		close(f.done)
+	} else {
+		j.mu.Unlock()
+		if ok {
+			return key, nil
+		}
+		select {
+		case <-f.done:
+		case <-c.Done():
+			return nil, c.Err()
+		}
+	}
+	if f.err != nil {
+		if ok {
+			return key, nil
+		}
+		return nil, f.err
+	}
+	j.mu.Lock()
+	key, ok = j.keys[kid]
+	j.mu.Unlock()
+	return foundKey(key, ok, kid)
+}
+
+func foundKey(key interface{}, ok bool, kid string) (interface{}, error) {
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *JWKS) fetch(c context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(c))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", j.URL, resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
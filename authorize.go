@@ -0,0 +1,97 @@
+package apexgrpc
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Authorizer decides whether a method may be called with the incoming
+// metadata md. It runs after the method is resolved and before the request is
+// decoded. Errors without a gRPC status are reported as
+// codes.PermissionDenied.
+type Authorizer func(c context.Context, id MethodID, md metadata.MD) error
+
+// WithAuthorizer installs f to authorize every method call, on both the
+// Lambda and Invoke paths.
+func WithAuthorizer(f Authorizer) ServerOption {
+	return func(o *options) {
+		o.authorizer = f
+	}
+}
+
+// WithoutInvokeAuthorization skips the authorizer for calls made through
+// Invoke, InvokeEvent, InvokeProto and InvokeStream.
+func WithoutInvokeAuthorization() ServerOption {
+	return func(o *options) {
+		o.noInvokeAuthorization = true
+	}
+}
+
+// MetadataPolicy maps method patterns to the metadata a call must carry. A
+// pattern is a method ID or "pkg.Service/*" for every method of a service; an
+// exact match takes precedence. Methods matching no pattern are allowed.
+//
+// Only the caller identity keys, such as CallerARNMetadataKey and
+// CallerAccountMetadataKey, are set by the server. Every other key is taken
+// from the event as the caller sent it, so requiring it only proves that the
+// caller asserted it: it is not authentication unless its value is a secret,
+// e.g. a shared API key.
+type MetadataPolicy map[string]MetadataRequirement
+
+// MetadataRequirement maps metadata keys to a required value. An empty value
+// only requires the key to be present.
+type MetadataRequirement map[string]string
+
+// Authorize implements Authorizer.
+func (p MetadataPolicy) Authorize(c context.Context, id MethodID, md metadata.MD) error {
+	req, ok := p[id.String()]
+	if !ok {
+		svc, _ := id.split()
+		if req, ok = p[svc+"/*"]; !ok {
+			return nil
+		}
+	}
+	for key, want := range req {
+		vals := md.Get(key)
+		if len(vals) == 0 {
+			return codedErrorf(codes.PermissionDenied, "method (%s) requires metadata %q", id, strings.ToLower(key))
+		}
+		if want != "" && !containsString(vals, want) {
+			return codedErrorf(codes.PermissionDenied, "method (%s) requires metadata %q to be %q", id, strings.ToLower(key), want)
+		}
+	}
+	return nil
+}
+
+func containsString(vals []string, s string) bool {
+	for _, v := range vals {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type invokeContextKey struct{}
+
+// withInvoke marks c as a call made through the Invoke methods.
+func withInvoke(c context.Context) context.Context {
+	return context.WithValue(c, invokeContextKey{}, true)
+}
+
+func (s *Server) authorize(c context.Context, id MethodID, md metadata.MD) error {
+	if s.opts.authorizer == nil {
+		return nil
+	}
+	if invoked, _ := c.Value(invokeContextKey{}).(bool); invoked && s.opts.noInvokeAuthorization {
+		return nil
+	}
+	err := s.opts.authorizer(c, id, md)
+	if err == nil || Code(err) != codes.Unknown {
+		return err
+	}
+	return wrapCodedf(codes.PermissionDenied, err, "%s", err.Error())
+}
@@ -0,0 +1,84 @@
+package apexgrpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizer(t *testing.T) {
+	var authorized []MethodID
+	s := newEchoServer(t, WithAuthorizer(func(c context.Context, id MethodID, md metadata.MD) error {
+		authorized = append(authorized, id)
+		switch md.Get("x-role")[0] {
+		case "admin":
+			return nil
+		case "anonymous":
+			return status.Error(codes.Unauthenticated, "log in")
+		}
+		return errors.New("not an admin")
+	}))
+	event := func(role, data string) string {
+		return fmt.Sprintf(`{"service":%q,"method":"Echo","data":%s,"metadata":{"x-role":[%q]}}`, echoService, data, role)
+	}
+	if _, err := serve(t, s, event("admin", `{"message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Denied calls fail before their invalid data is decoded.
+	_, err := serve(t, s, event("user", `{"bogus":1}`))
+	assertCode(t, err, codes.PermissionDenied)
+	_, err = serve(t, s, event("anonymous", `{"bogus":1}`))
+	assertCode(t, err, codes.Unauthenticated)
+	if len(authorized) != 3 || authorized[0] != NewMethodID("", echoService, "Echo") {
+		t.Errorf("authorized = %v", authorized)
+	}
+}
+
+func TestInvokeAuthorization(t *testing.T) {
+	deny := WithAuthorizer(func(context.Context, MethodID, metadata.MD) error {
+		return status.Error(codes.PermissionDenied, "denied")
+	})
+	_, err := newEchoServer(t, deny).Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+	assertCode(t, err, codes.PermissionDenied)
+
+	s := newEchoServer(t, deny, WithoutInvokeAuthorization())
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Errorf("Invoke with WithoutInvokeAuthorization: %v", err)
+	}
+	_, err = serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.PermissionDenied)
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	s := newEchoServer(t, WithAuthorizer(MetadataPolicy{
+		"apexgrpc.test.Echo/*":     {"x-tenant": ""},
+		"apexgrpc.test.Echo/Fail":  {"x-role": "admin"},
+		"apexgrpc.test.Echo/Split": {CallerAccountMetadataKey: "123456789012"},
+	}.Authorize))
+	event := func(method, md string) string {
+		return fmt.Sprintf(`{"service":%q,"method":%q,"data":{"count":0},"metadata":%s}`, echoService, method, md)
+	}
+	tests := []struct {
+		name  string
+		event string
+		code  codes.Code
+	}{
+		{"wildcard", event("Echo", `{"x-tenant":["acme"]}`), codes.OK},
+		{"wildcard missing key", event("Echo", `{}`), codes.PermissionDenied},
+		{"exact takes precedence", event("Fail", `{"x-role":["admin"]}`), codes.OK},
+		{"exact wrong value", event("Fail", `{"x-role":["user"],"x-tenant":["acme"]}`), codes.PermissionDenied},
+		// Caller identity keys sent in the event are replaced by the server.
+		{"spoofed identity", event("Split", `{"x-caller-account-id":["123456789012"]}`), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := serve(t, s, tt.event)
+			assertCode(t, err, tt.code)
+		})
+	}
+}
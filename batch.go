@@ -0,0 +1,121 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/apex/go-apex"
+	"google.golang.org/grpc/codes"
+)
+
+// forEach calls fn for every index below n, running at most concurrency calls
+// at once. A concurrency below 2 processes the indexes in order.
+func forEach(n int, concurrency int, fn func(i int)) {
+	if concurrency < 2 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// BatchEvent carries several Events in one invocation.
+type BatchEvent struct {
+	Batch []json.RawMessage `json:"batch"`
+}
+
+// BatchItemResult is the outcome of one Event of a BatchEvent: its encoded
+// reply or its error.
+type BatchItemResult struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error *ErrorBody  `json:"error,omitempty"`
+}
+
+// WithBatchConcurrency lets up to n events of a batch run at once. Results
+// keep the order of the batch either way.
+func WithBatchConcurrency(n int) ServerOption {
+	return func(o *options) {
+		o.batchConcurrency = n
+	}
+}
+
+// WithMaxBatchSize rejects batches of more than n events before running any
+// of them. Zero means no limit.
+func WithMaxBatchSize(n int) ServerOption {
+	return func(o *options) {
+		o.maxBatchSize = n
+	}
+}
+
+// BatchRouter routes a BatchEvent and responds with one BatchItemResult per
+// event, in order. Events succeed or fail independently.
+type BatchRouter struct {
+	MaxConcurrency int
+	MaxSize        int
+	// Strict rejects Events with unknown fields; see WithStrictEventParsing.
+	Strict   bool
+	resolver typeResolver
+}
+
+func (r BatchRouter) Concurrency() int {
+	return r.MaxConcurrency
+}
+
+func (r BatchRouter) Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error) {
+	var event BatchEvent
+	if err := json.Unmarshal(eventMsg, &event); err != nil || event.Batch == nil {
+		return nil, invalidEventf("invalid batch event")
+	}
+	if r.MaxSize > 0 && len(event.Batch) > r.MaxSize {
+		return nil, codedErrorf(codes.ResourceExhausted, "batch of %d events exceeds the limit of %d", len(event.Batch), r.MaxSize)
+	}
+	invs := make([]Invocation, len(event.Batch))
+	for i, raw := range event.Batch {
+		e, err := decodeEvent(raw, r.Strict)
+		if err != nil {
+			invs[i] = Invocation{Err: invalidEventf("invalid event at index %d: %v", i, err)}
+			continue
+		}
+		invs[i] = eventInvocation(&e)
+	}
+	return invs, nil
+}
+
+func (r BatchRouter) EncodeResponse(results []InvocationResult) (interface{}, error) {
+	items := make([]BatchItemResult, len(results))
+	for i, res := range results {
+		if payload, ok := mappedPayload(res.Err); ok {
+			items[i].Data = payload
+		} else if res.Err != nil {
+			items[i].Error = newErrorResponse(res.Err, r.resolver).Error
+		} else {
+			items[i].Data = res.Reply
+		}
+	}
+	return items, nil
+}
+
+// isBatchEvent sniffs whether eventMsg is a BatchEvent.
+func isBatchEvent(eventMsg json.RawMessage) bool {
+	var event struct {
+		Batch json.RawMessage `json:"batch"`
+	}
+	if err := json.Unmarshal(eventMsg, &event); err != nil {
+		return false
+	}
+	return len(event.Batch) > 0 && event.Batch[0] == '['
+}
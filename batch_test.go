@@ -0,0 +1,72 @@
+package apexgrpc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBatchEvent(t *testing.T) {
+	event := `{"batch":[` +
+		echoEvent("Echo", `{"message":"one"}`) + `,` +
+		echoEvent("Fail", `{"count":5,"message":"gone"}`) + `,` +
+		`{"data":{}},1,` +
+		echoEvent("Echo", `{"message":"four"}`) + `]}`
+	want := `[{"data":{"message":"one"}},
+		{"error":{"code":"NOT_FOUND","grpc_code":5,"message":"gone"}},
+		{"error":{"code":"INVALID_ARGUMENT","grpc_code":3,"message":"event missing service (event has fields data)"}},
+		{"error":{"code":"INVALID_ARGUMENT","grpc_code":3,"message":"invalid event at index 3: json: cannot unmarshal number into Go value of type apexgrpc.Event"}},
+		{"data":{"message":"four"}}]`
+	for _, concurrency := range []int{0, 3} {
+		got, err := serve(t, newEchoServer(t, WithBatchConcurrency(concurrency)), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSON(t, got, want)
+	}
+
+	_, err := serve(t, newEchoServer(t, WithMaxBatchSize(4)), event)
+	assertCode(t, err, codes.ResourceExhausted)
+
+	got, err := serve(t, newEchoServer(t), `{"batch":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `[]`)
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var running, peak int
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return echoReply(req), nil
+	}}, WithBatchConcurrency(2))
+	event := `{"batch":[`
+	for i := 0; i < 6; i++ {
+		if i > 0 {
+			event += ","
+		}
+		event += echoEvent("Echo", `{}`)
+	}
+	if _, err := serve(t, s, event+`]}`); err != nil {
+		t.Fatal(err)
+	}
+	if peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+}
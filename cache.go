@@ -0,0 +1,208 @@
+package apexgrpc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+// DefaultResponseCacheSize is the number of responses cached when
+// WithResponseCacheSize is not given.
+const DefaultResponseCacheSize = 1024
+
+// CacheRecorder is implemented by MetricsRecorders that want to know about
+// lookups in the response cache of WithCachedMethods.
+type CacheRecorder interface {
+	RecordCacheLookup(id MethodID, hit bool)
+}
+
+// WithCachedMethods caches the replies of the unary methods ids for ttl and
+// serves repeated calls from the cache without calling the handler. The cache
+// is consulted after authorization and the interceptors, and is keyed by the
+// request message and the caller, as for idempotency keys, so callers are
+// never served each other's replies. Other metadata only varies the key if
+// named with WithCacheKeyMetadata. Field masks,
+// encodings and compression are applied to cached replies like to fresh ones.
+// Failed calls are never cached. Events whose metadata has "cache-control:
+// no-cache" bypass the cache.
+func WithCachedMethods(ttl time.Duration, ids ...MethodID) ServerOption {
+	return func(o *options) {
+		if o.cachedMethods == nil {
+			o.cachedMethods = map[MethodID]time.Duration{}
+		}
+		for _, id := range ids {
+			o.cachedMethods[id] = ttl
+		}
+	}
+}
+
+// WithCacheKeyMetadata adds the values of the incoming metadata keys to the
+// cache keys of WithCachedMethods, for handlers whose replies depend on them,
+// e.g. "accept-language".
+func WithCacheKeyMetadata(keys ...string) ServerOption {
+	return func(o *options) {
+		for _, k := range keys {
+			o.cacheKeyMetadata = append(o.cacheKeyMetadata, strings.ToLower(k))
+		}
+	}
+}
+
+// WithResponseCacheSize keeps at most n responses in the cache of
+// WithCachedMethods, evicting the least recently used.
+func WithResponseCacheSize(n int) ServerOption {
+	return func(o *options) {
+		o.responseCacheSize = n
+	}
+}
+
+// responseCache is an LRU of replies with per-entry expiry.
+type responseCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	reply   proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+	expires time.Time
+}
+
+func newResponseCache(max int) *responseCache {
+	if max <= 0 {
+		max = DefaultResponseCacheSize
+	}
+	return &responseCache{max: max, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (rc *responseCache) get(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		rc.order.Remove(el)
+		delete(rc.entries, key)
+		return nil, false
+	}
+	rc.order.MoveToFront(el)
+	return e, true
+}
+
+func (rc *responseCache) put(e *cacheEntry, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	key := e.key
+	e.expires = time.Now().Add(ttl)
+	if el, ok := rc.entries[key]; ok {
+		el.Value = e
+		rc.order.MoveToFront(el)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(e)
+	for rc.order.Len() > rc.max {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey hashes the method, the request message in deterministic wire
+// format, the caller of c and the values of the metadata keys.
+func cacheKey(c context.Context, id MethodID, req proto.Message, keys []string) (string, bool) {
+	b, err := protov2.MarshalOptions{Deterministic: true}.Marshal(messageV2(req))
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	writeKeyPart(h, id.String())
+	writeKeyPart(h, string(b))
+	writeKeyPart(h, callerScope(c))
+	md, _ := metadata.FromIncomingContext(c)
+	for _, k := range keys {
+		writeKeyPart(h, k)
+		fmt.Fprintf(h, "%d\n", len(md[k]))
+		for _, v := range md[k] {
+			writeKeyPart(h, v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// writeKeyPart writes v length-prefixed, so that parts cannot run together.
+func writeKeyPart(w io.Writer, v string) {
+	fmt.Fprintf(w, "%d:%s", len(v), v)
+}
+
+func noCache(md map[string][]string) bool {
+	for k, vals := range md {
+		if !strings.EqualFold(k, "cache-control") {
+			continue
+		}
+		for _, v := range vals {
+			if strings.Contains(strings.ToLower(v), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheInterceptor serves the calls of id from the response cache. It runs
+// innermost, so that authorization has passed by the time it is consulted.
+func (s *Server) cacheInterceptor(id MethodID, ttl time.Duration, md *outgoingMetadata) grpc.UnaryServerInterceptor {
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(c, req)
+		}
+		key, ok := cacheKey(c, id, msg, s.opts.cacheKeyMetadata)
+		if !ok {
+			return handler(c, req)
+		}
+		if e, ok := s.responseCache.get(key); ok {
+			s.recordCacheLookup(id, true)
+			if err := md.setHeader(e.header.Copy()); err != nil {
+				return nil, err
+			}
+			md.setTrailer(e.trailer.Copy())
+			return cloneProto(e.reply), nil
+		}
+		s.recordCacheLookup(id, false)
+		reply, err := handler(c, req)
+		if m, ok := reply.(proto.Message); ok && err == nil && m != nil {
+			header, trailer := md.snapshot()
+			s.responseCache.put(&cacheEntry{key: key, reply: cloneProto(m), header: header, trailer: trailer}, ttl)
+		}
+		return reply, err
+	}
+}
+
+func (s *Server) recordCacheLookup(id MethodID, hit bool) {
+	s.stats.recordCacheLookup(id, hit)
+	cr, ok := s.opts.metrics.(CacheRecorder)
+	if !ok {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	cr.RecordCacheLookup(id, hit)
+}
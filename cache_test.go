@@ -0,0 +1,110 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// countingEcho replies with count set to the number of calls so far, and
+// sets it as header and trailer metadata.
+func countingEcho(calls *int) *echoServer {
+	return &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		*calls++
+		n := strconv.Itoa(*calls)
+		grpc.SetHeader(c, metadata.Pairs("x-call", n))
+		grpc.SetTrailer(c, metadata.Pairs("x-done", n))
+		reply := echoReply(req)
+		reply.Set(echoReplyMD.Fields().ByName("count"), protoreflect.ValueOfInt32(int32(*calls)))
+		return reply, nil
+	}}
+}
+
+func cachedEvent(message string, md string) string {
+	return fmt.Sprintf(`{"service":%q,"method":"Echo","data":{"message":%q},"metadata":%s}`, echoService, message, md)
+}
+
+func TestResponseCache(t *testing.T) {
+	var calls int
+	rec := &MemoryRecorder{}
+	s := newEchoServerWith(t, countingEcho(&calls),
+		WithCachedMethods(time.Hour, NewMethodID("", echoService, "Echo")),
+		WithCacheKeyMetadata("Accept-Language"),
+		WithMetadataEnvelope(),
+		WithMetricsRecorder(rec),
+	)
+	first := `{"data":{"message":"a","count":1},"metadata":{"header":{"x-call":["1"]},"trailer":{"x-done":["1"]}}}`
+	tests := []struct {
+		name  string
+		event string
+		want  string
+	}{
+		{"miss", cachedEvent("a", `{"x-trace-id":["1"]}`), first},
+		{"hit with other metadata", cachedEvent("a", `{"x-trace-id":["2"],"user-agent":["curl"]}`), first},
+		{"other request", cachedEvent("b", `{}`), `{"data":{"message":"b","count":2},"metadata":{"header":{"x-call":["2"]},"trailer":{"x-done":["2"]}}}`},
+		{"other caller", cachedEvent("a", `{"authorization":["Bearer x"]}`), `{"data":{"message":"a","count":3},"metadata":{"header":{"x-call":["3"]},"trailer":{"x-done":["3"]}}}`},
+		{"key metadata", cachedEvent("a", `{"accept-language":["de"]}`), `{"data":{"message":"a","count":4},"metadata":{"header":{"x-call":["4"]},"trailer":{"x-done":["4"]}}}`},
+		{"no-cache", cachedEvent("a", `{"cache-control":["no-cache"]}`), `{"data":{"message":"a","count":5},"metadata":{"header":{"x-call":["5"]},"trailer":{"x-done":["5"]}}}`},
+		{"hit again", cachedEvent("a", `{}`), first},
+	}
+	for _, tt := range tests {
+		got, err := serve(t, s, tt.event)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		assertJSON(t, got, tt.want)
+	}
+	stats := s.Stats()["apexgrpc.test.Echo/Echo"]
+	if stats.CacheHits != 2 || stats.CacheMisses != 4 {
+		t.Errorf("hits = %d, misses = %d, want 2 and 4", stats.CacheHits, stats.CacheMisses)
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	var calls int
+	s := newEchoServerWith(t, countingEcho(&calls),
+		WithCachedMethods(20*time.Millisecond, NewMethodID("", echoService, "Echo")),
+	)
+	for _, want := range []int{1, 1} {
+		serve(t, s, cachedEvent("a", `{}`))
+		if calls != want {
+			t.Fatalf("calls = %d, want %d", calls, want)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+	serve(t, s, cachedEvent("a", `{}`))
+	if calls != 2 {
+		t.Errorf("calls after expiry = %d, want 2", calls)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	var calls int
+	s := newEchoServerWith(t, countingEcho(&calls),
+		WithCachedMethods(time.Hour, NewMethodID("", echoService, "Echo")),
+		WithResponseCacheSize(2),
+	)
+	for _, message := range []string{"a", "b", "a", "c"} {
+		serve(t, s, cachedEvent(message, `{}`))
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+	// c evicted b, the least recently used, and kept a.
+	serve(t, s, cachedEvent("a", `{}`))
+	if calls != 3 {
+		t.Errorf("a was evicted")
+	}
+	serve(t, s, cachedEvent("b", `{}`))
+	if calls != 4 {
+		t.Errorf("b was not evicted")
+	}
+}
@@ -0,0 +1,308 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// WithCanonicalJSON makes JSON replies byte-stable with CanonicalizeJSON, so
+// that map fields come out in the same order on every call. Multiline
+// marshal options are ignored.
+func WithCanonicalJSON() ServerOption {
+	return func(o *options) {
+		o.canonicalJSON = true
+	}
+}
+
+// maxCanonicalDepth bounds the nesting of values CanonicalizeJSON accepts.
+const maxCanonicalDepth = 10000
+
+var errCanonicalDepth = errors.New("json nested too deeply")
+
+// CanonicalizeJSON returns b in a canonical form: object keys in sorted order,
+// no insignificant whitespace, strings with only the required escapes, and
+// numbers with a fraction or exponent in the shortest form that round-trips
+// through float64, using an exponent only for very small or large values.
+// Integers keep their digits, so int64 values are exact.
+func CanonicalizeJSON(b []byte) ([]byte, error) {
+	c := canonicalizer{in: b, out: make([]byte, 0, len(b))}
+	c.skipSpace()
+	if err := c.value(0); err != nil {
+		return nil, err
+	}
+	c.skipSpace()
+	if c.pos != len(c.in) {
+		return nil, c.errorf("unexpected data after value")
+	}
+	return c.out, nil
+}
+
+type canonicalizer struct {
+	in  []byte
+	pos int
+	out []byte
+	// scratch holds object members while they are sorted.
+	scratch []byte
+}
+
+// member is an object member written to out, located by offsets from the
+// start of its object.
+type member struct {
+	key        string
+	start, end int
+}
+
+func (c *canonicalizer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid json at offset %d: %s", c.pos, fmt.Sprintf(format, args...))
+}
+
+func (c *canonicalizer) skipSpace() {
+	for c.pos < len(c.in) {
+		switch c.in[c.pos] {
+		case ' ', '\t', '\n', '\r':
+			c.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (c *canonicalizer) value(depth int) error {
+	if depth > maxCanonicalDepth {
+		return errCanonicalDepth
+	}
+	if c.pos >= len(c.in) {
+		return c.errorf("unexpected end of input")
+	}
+	switch ch := c.in[c.pos]; {
+	case ch == '{':
+		return c.object(depth)
+	case ch == '[':
+		return c.array(depth)
+	case ch == '"':
+		_, err := c.str()
+		return err
+	case ch == '-' || ch >= '0' && ch <= '9':
+		return c.number()
+	}
+	for _, lit := range []string{"true", "false", "null"} {
+		if bytes.HasPrefix(c.in[c.pos:], []byte(lit)) {
+			c.out = append(c.out, lit...)
+			c.pos += len(lit)
+			return nil
+		}
+	}
+	return c.errorf("unexpected character %q", c.in[c.pos])
+}
+
+func (c *canonicalizer) object(depth int) error {
+	c.pos++
+	start := len(c.out)
+	c.out = append(c.out, '{')
+	var members []member
+	c.skipSpace()
+	if c.pos < len(c.in) && c.in[c.pos] == '}' {
+		c.pos++
+		c.out = append(c.out, '}')
+		return nil
+	}
+	for {
+		c.skipSpace()
+		if c.pos >= len(c.in) || c.in[c.pos] != '"' {
+			return c.errorf("expected object key")
+		}
+		m := member{start: len(c.out) - start}
+		key, err := c.str()
+		if err != nil {
+			return err
+		}
+		m.key = key
+		c.skipSpace()
+		if c.pos >= len(c.in) || c.in[c.pos] != ':' {
+			return c.errorf("expected ':'")
+		}
+		c.pos++
+		c.out = append(c.out, ':')
+		c.skipSpace()
+		if err := c.value(depth + 1); err != nil {
+			return err
+		}
+		m.end = len(c.out) - start
+		members = append(members, m)
+		c.skipSpace()
+		if c.pos >= len(c.in) {
+			return c.errorf("unexpected end of input")
+		}
+		if c.in[c.pos] == '}' {
+			c.pos++
+			break
+		}
+		if c.in[c.pos] != ',' {
+			return c.errorf("expected ',' or '}'")
+		}
+		c.pos++
+		c.out = append(c.out, ',')
+	}
+	sorted := sort.SliceIsSorted(members, func(i, j int) bool { return members[i].key < members[j].key })
+	if !sorted {
+		sort.SliceStable(members, func(i, j int) bool { return members[i].key < members[j].key })
+		c.scratch = append(c.scratch[:0], c.out[start:]...)
+		c.out = append(c.out[:start], '{')
+		for i, m := range members {
+			if i > 0 {
+				c.out = append(c.out, ',')
+			}
+			c.out = append(c.out, c.scratch[m.start:m.end]...)
+		}
+	}
+	c.out = append(c.out, '}')
+	return nil
+}
+
+func (c *canonicalizer) array(depth int) error {
+	c.pos++
+	c.out = append(c.out, '[')
+	c.skipSpace()
+	if c.pos < len(c.in) && c.in[c.pos] == ']' {
+		c.pos++
+		c.out = append(c.out, ']')
+		return nil
+	}
+	for {
+		c.skipSpace()
+		if err := c.value(depth + 1); err != nil {
+			return err
+		}
+		c.skipSpace()
+		if c.pos >= len(c.in) {
+			return c.errorf("unexpected end of input")
+		}
+		if c.in[c.pos] == ']' {
+			c.pos++
+			break
+		}
+		if c.in[c.pos] != ',' {
+			return c.errorf("expected ',' or ']'")
+		}
+		c.pos++
+		c.out = append(c.out, ',')
+	}
+	c.out = append(c.out, ']')
+	return nil
+}
+
+// str copies the string at pos to out with canonical escaping and returns its
+// value.
+func (c *canonicalizer) str() (string, error) {
+	start := c.pos
+	c.pos++
+	escaped := false
+	for {
+		if c.pos >= len(c.in) {
+			return "", c.errorf("unterminated string")
+		}
+		ch := c.in[c.pos]
+		if ch == '"' {
+			break
+		}
+		if ch < 0x20 {
+			return "", c.errorf("control character in string")
+		}
+		if ch == '\\' {
+			escaped = true
+			c.pos++
+		}
+		c.pos++
+	}
+	c.pos++
+	raw := c.in[start:c.pos]
+	if !escaped && utf8.Valid(raw) {
+		c.out = append(c.out, raw...)
+		return string(raw[1 : len(raw)-1]), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		c.pos = start
+		return "", c.errorf("invalid string: %v", err)
+	}
+	c.out = appendJSONString(c.out, s)
+	return s, nil
+}
+
+func appendJSONString(out []byte, s string) []byte {
+	out = append(out, '"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			out = append(out, '\\', '"')
+		case r == '\\':
+			out = append(out, '\\', '\\')
+		case r == '\n':
+			out = append(out, '\\', 'n')
+		case r == '\r':
+			out = append(out, '\\', 'r')
+		case r == '\t':
+			out = append(out, '\\', 't')
+		case r == '\b':
+			out = append(out, '\\', 'b')
+		case r == '\f':
+			out = append(out, '\\', 'f')
+		case r < 0x20:
+			out = append(out, fmt.Sprintf(`\u%04x`, r)...)
+		default:
+			var buf [utf8.UTFMax]byte
+			out = append(out, buf[:utf8.EncodeRune(buf[:], r)]...)
+		}
+	}
+	return append(out, '"')
+}
+
+func (c *canonicalizer) number() error {
+	start := c.pos
+	integer := true
+	if c.in[c.pos] == '-' {
+		c.pos++
+	}
+	for c.pos < len(c.in) {
+		ch := c.in[c.pos]
+		if ch == '.' || ch == 'e' || ch == 'E' || ch == '+' || ch == '-' {
+			integer = false
+		} else if ch < '0' || ch > '9' {
+			break
+		}
+		c.pos++
+	}
+	num := c.in[start:c.pos]
+	if !json.Valid(num) {
+		c.pos = start
+		return c.errorf("invalid number")
+	}
+	if integer {
+		if string(num) == "-0" {
+			num = num[1:]
+		}
+		c.out = append(c.out, num...)
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(num), 64)
+	if err != nil {
+		c.pos = start
+		return c.errorf("invalid number: %v", err)
+	}
+	if f == 0 {
+		// Drop the sign of negative zero.
+		f = 0
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	c.out = strconv.AppendFloat(c.out, f, format, -1, 64)
+	return nil
+}
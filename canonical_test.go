@@ -0,0 +1,71 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeJSON(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{` { "b" : 1 , "a" : [ true, null ] } `, `{"a":[true,null],"b":1}`},
+		{`{"z":{"y":1,"x":2},"a":{}}`, `{"a":{},"z":{"x":2,"y":1}}`},
+		{`"A\/é\n\u0001"`, `"A/é\n\u0001"`},
+		{`[1.50, 1e2, -0, -0.0, 12345678901234567890, 1E-7, 1e21]`, `[1.5,100,0,0,12345678901234567890,1e-07,1e+21]`},
+	}
+	for _, tt := range tests {
+		got, err := CanonicalizeJSON([]byte(tt.in))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("CanonicalizeJSON(%s) = %s, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{``, `{`, `{"a"}`, `[1,]`, `01`, `"a`, `1e400`, `{} {}`, `tru`, strings.Repeat("[", maxCanonicalDepth+2)} {
+		if got, err := CanonicalizeJSON([]byte(in)); err == nil {
+			t.Errorf("CanonicalizeJSON(%.20s) = %s, want an error", in, got)
+		}
+	}
+}
+
+func TestCanonicalJSONReplies(t *testing.T) {
+	s := newEchoServer(t, WithCanonicalJSON())
+	got, err := serve(t, s, echoEvent("Echo", `{"tags":["b","a"],"message":"hi","count":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"count":2,"message":"hi","tags":["b","a"]}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func FuzzCanonicalizeJSON(f *testing.F) {
+	for _, seed := range []string{`{"b":1,"a":[1.5e3,"xé"]}`, `[]`, `"\ud800"`, `-0.0`, `{"a":1,"a":2}`, `123456789012345678901234567890`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		out, err := CanonicalizeJSON(b)
+		var want interface{}
+		if json.Unmarshal(b, &want) != nil {
+			return
+		}
+		if err != nil {
+			if err != errCanonicalDepth {
+				t.Fatalf("CanonicalizeJSON(%q) failed for valid JSON: %v", b, err)
+			}
+			return
+		}
+		var got interface{}
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatalf("CanonicalizeJSON(%q) = %q, which is invalid: %v", b, out, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("CanonicalizeJSON(%q) = %q, which decodes to %v, want %v", b, out, got, want)
+		}
+		again, err := CanonicalizeJSON(out)
+		if err != nil || string(again) != string(out) {
+			t.Fatalf("CanonicalizeJSON(%q) = %q, %v; not idempotent", out, again, err)
+		}
+	})
+}
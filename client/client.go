@@ -0,0 +1,144 @@
+// Package client calls the methods of an apexgrpc.Server running in a Lambda
+// function through generated gRPC client stubs.
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// Invoker invokes the Lambda function with payload and returns its result,
+// e.g. by calling lambda:Invoke with the AWS SDK. It returns an error when the
+// function itself failed.
+type Invoker interface {
+	Invoke(c context.Context, payload []byte) ([]byte, error)
+}
+
+// InvokerFunc adapts a function to an Invoker.
+type InvokerFunc func(c context.Context, payload []byte) ([]byte, error)
+
+func (f InvokerFunc) Invoke(c context.Context, payload []byte) ([]byte, error) {
+	return f(c, payload)
+}
+
+// Conn is a grpc.ClientConnInterface that sends each unary call to a Lambda
+// function as an Event. Failures the function reports as structured errors,
+// see apexgrpc.WithStructuredErrors, become status errors. The server must
+// not use apexgrpc.WithMetadataEnvelope. Streaming calls fail with
+// codes.Unimplemented.
+type Conn struct {
+	invoker   Invoker
+	marshal   protojson.MarshalOptions
+	unmarshal protojson.UnmarshalOptions
+}
+
+var _ grpc.ClientConnInterface = (*Conn)(nil)
+
+// New returns a Conn calling through invoker. Replies are decoded ignoring
+// unknown fields, so that servers can add fields without breaking clients.
+func New(invoker Invoker) *Conn {
+	return &Conn{
+		invoker:   invoker,
+		unmarshal: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+}
+
+// Invoke calls method, e.g. "/pkg.Service/Method". Outgoing metadata of c is
+// sent as the event metadata.
+func (cc *Conn) Invoke(c context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	req, ok := args.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "request of type %T is not a proto message", args)
+	}
+	resp, ok := reply.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "reply of type %T is not a proto message", reply)
+	}
+	data, err := cc.marshal.Marshal(protoadapt.MessageV2Of(req))
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal request: %v", err)
+	}
+	raw := json.RawMessage(data)
+	event := apexgrpc.Event{
+		Method: &method,
+		Data:   &raw,
+	}
+	if md, ok := metadata.FromOutgoingContext(c); ok {
+		event.Metadata = eventMetadata(md)
+	}
+	payload, err := json.Marshal(&event)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal event: %v", err)
+	}
+	out, err := cc.invoker.Invoke(c, payload)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Unknown, err.Error())
+	}
+	if err := responseError(out); err != nil {
+		return err
+	}
+	if err := cc.unmarshal.Unmarshal(out, protoadapt.MessageV2Of(resp)); err != nil {
+		return status.Errorf(codes.Internal, "unmarshal reply: %v", err)
+	}
+	return nil
+}
+
+func (cc *Conn) NewStream(c context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Errorf(codes.Unimplemented, "streaming method %s is not supported", method)
+}
+
+// eventMetadata converts metadata to event metadata, base64 encoding the
+// values of "-bin" keys as the server expects.
+func eventMetadata(md metadata.MD) map[string][]string {
+	m := make(map[string][]string, len(md))
+	for k, vals := range md {
+		for _, v := range vals {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			m[k] = append(m[k], v)
+		}
+	}
+	return m
+}
+
+// responseError returns the status error of a structured error response.
+// Details whose types are not linked into the client are left out.
+func responseError(out []byte) error {
+	var res struct {
+		Error *apexgrpc.ErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil || res.Error == nil {
+		return nil
+	}
+	code := res.Error.GRPCCode
+	if code == codes.OK {
+		code = codes.Unknown
+	}
+	st := &spb.Status{Code: int32(code), Message: res.Error.Message}
+	for _, raw := range res.Error.Details {
+		detail := &anypb.Any{}
+		if err := protojson.Unmarshal(raw, detail); err != nil {
+			continue
+		}
+		st.Details = append(st.Details, detail)
+	}
+	return status.ErrorProto(st)
+}
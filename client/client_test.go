@@ -0,0 +1,151 @@
+package client
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+	"github.com/pilwon/go-apexgrpc/apexgrpctest"
+)
+
+// structService is clienttest.Structs. Echo returns its request with the
+// "x-tenant" metadata and the hex of the "trace-bin" metadata added; Fail
+// fails with codes.InvalidArgument and a BadRequest detail.
+var structService = apexgrpc.Service{
+	Desc: &grpc.ServiceDesc{
+		ServiceName: "clienttest.Structs",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Echo", Handler: structHandler(func(c context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				md, _ := metadata.FromIncomingContext(c)
+				if vals := md.Get("x-tenant"); len(vals) > 0 {
+					req.Fields["tenant"] = structpb.NewStringValue(vals[0])
+				}
+				if vals := md.Get("trace-bin"); len(vals) > 0 {
+					req.Fields["trace"] = structpb.NewStringValue(hex.EncodeToString([]byte(vals[0])))
+				}
+				return req, nil
+			})},
+			{MethodName: "Fail", Handler: structHandler(func(c context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+				st, err := status.New(codes.InvalidArgument, "bad name").WithDetails(&errdetails.BadRequest{
+					FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "required"}},
+				})
+				if err != nil {
+					return nil, err
+				}
+				return nil, st.Err()
+			})},
+		},
+	},
+	Server: struct{}{},
+}
+
+func structHandler(f func(context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := &structpb.Struct{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if req.Fields == nil {
+			req.Fields = map[string]*structpb.Value{}
+		}
+		return f(c, req)
+	}
+}
+
+// newConn returns a Conn invoking a Server with structService in memory.
+func newConn(t *testing.T) *Conn {
+	s := apexgrpc.NewServer(apexgrpc.WithStructuredErrors())
+	if err := s.Register([]apexgrpc.Service{structService}); err != nil {
+		t.Fatal(err)
+	}
+	ts := apexgrpctest.Wrap(s)
+	return New(InvokerFunc(func(c context.Context, payload []byte) ([]byte, error) {
+		return ts.Serve(t, payload)
+	}))
+}
+
+func TestInvoke(t *testing.T) {
+	cc := newConn(t)
+	req, err := structpb.NewStruct(map[string]interface{}{"n": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "acme", "trace-bin", "\x00\xff\x10")
+	var reply structpb.Struct
+	if err := cc.Invoke(c, "/clienttest.Structs/Echo", req, &reply); err != nil {
+		t.Fatal(err)
+	}
+	got := reply.AsMap()
+	if got["n"] != 2.0 || got["tenant"] != "acme" || got["trace"] != "00ff10" {
+		t.Errorf("reply = %v", got)
+	}
+}
+
+func TestInvokeStatusDetails(t *testing.T) {
+	var reply structpb.Struct
+	err := newConn(t).Invoke(context.Background(), "/clienttest.Structs/Fail", &structpb.Struct{}, &reply)
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument || st.Message() != "bad name" {
+		t.Fatalf("err = %v, want InvalidArgument bad name", err)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want 1", details)
+	}
+	br, ok := details[0].(*errdetails.BadRequest)
+	if !ok || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "name" {
+		t.Errorf("detail = %v, want the BadRequest of the server", details[0])
+	}
+
+	err = newConn(t).Invoke(context.Background(), "/clienttest.Structs/Nope", &structpb.Struct{}, &reply)
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("unknown method: code = %v, want %v", code, codes.Unimplemented)
+	}
+}
+
+func TestInvokerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"plain", errors.New("function failed"), codes.Unknown},
+		{"status", status.Error(codes.ResourceExhausted, "throttled"), codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := New(InvokerFunc(func(context.Context, []byte) ([]byte, error) {
+				return nil, tt.err
+			}))
+			err := cc.Invoke(context.Background(), "/clienttest.Structs/Echo", &structpb.Struct{}, &structpb.Struct{})
+			if code := status.Code(err); code != tt.code {
+				t.Errorf("code = %v, want %v (err = %v)", code, tt.code, err)
+			}
+		})
+	}
+
+	cc := New(InvokerFunc(func(context.Context, []byte) ([]byte, error) {
+		return []byte(`{"n":`), nil
+	}))
+	err := cc.Invoke(context.Background(), "/clienttest.Structs/Echo", &structpb.Struct{}, &structpb.Struct{})
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("invalid reply: code = %v, want %v", code, codes.Internal)
+	}
+}
+
+func TestNewStream(t *testing.T) {
+	_, err := newConn(t).NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, "/clienttest.Structs/Watch")
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("code = %v, want %v", code, codes.Unimplemented)
+	}
+}
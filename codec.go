@@ -0,0 +1,67 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec converts the JSON request data and replies of a method in place of
+// protojson. Decode gets the data as it appears in the event, or nil when
+// there is none, and into is the request message. Encode must return JSON.
+type Codec interface {
+	Decode(data []byte, into interface{}) error
+	Encode(reply interface{}) ([]byte, error)
+}
+
+// WithMethodCodec makes method id decode its JSON request data and encode its
+// JSON replies with codec. The shape of the data is left for codec to check.
+// Other encodings, and the Connect and gRPC-Web adapters, are not affected.
+func WithMethodCodec(id MethodID, codec Codec) ServerOption {
+	return func(o *options) {
+		if o.methodCodecs == nil {
+			o.methodCodecs = map[MethodID]Codec{}
+		}
+		o.methodCodecs[id] = codec
+	}
+}
+
+// methodCodec returns the codec of id for encoding, if any.
+func (s *Server) methodCodec(id MethodID, encoding string) Codec {
+	if encoding == EncodingProtoBase64 {
+		return nil
+	}
+	return s.opts.methodCodecs[id]
+}
+
+func newCodecDecoder(codec Codec, data *json.RawMessage) messageDecoder {
+	var raw []byte
+	if data != nil {
+		raw = *data
+	}
+	return func(m proto.Message) error {
+		return codec.Decode(raw, m)
+	}
+}
+
+// encodeJSONReply encodes a reply of id with its codec, or with protojson,
+// and applies its WithResponseTransform.
+func (s *Server) encodeJSONReply(id MethodID, reply proto.Message) (json.RawMessage, error) {
+	codec := s.methodCodec(id, EncodingJSON)
+	if codec == nil {
+		raw, err := s.marshalReply(reply)
+		if err != nil {
+			return nil, err
+		}
+		return s.transformReply(id, raw)
+	}
+	b, err := codec.Encode(reply)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("codec of method (%s) returned invalid JSON", id)
+	}
+	return s.transformReply(id, json.RawMessage(b))
+}
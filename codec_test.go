@@ -0,0 +1,53 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// documentCodec carries an opaque JSON document in the message field of the
+// echo messages.
+type documentCodec struct {
+	invalid bool
+}
+
+func (documentCodec) Decode(data []byte, into interface{}) error {
+	if !json.Valid(data) {
+		return errors.New("not a JSON document")
+	}
+	m := into.(protoreflect.ProtoMessage).ProtoReflect()
+	m.Set(m.Descriptor().Fields().ByName("message"), protoreflect.ValueOfString(string(data)))
+	return nil
+}
+
+func (c documentCodec) Encode(reply interface{}) ([]byte, error) {
+	if c.invalid {
+		return []byte("{"), nil
+	}
+	return []byte(stringField(reply.(protoreflect.ProtoMessage), "message")), nil
+}
+
+func TestMethodCodec(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	s := newEchoServer(t, WithMethodCodec(id, documentCodec{}))
+	doc := `[12345678901234567890.5,{"b":1,"a":2}]`
+	got, err := serve(t, s, echoEvent("Echo", doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != doc {
+		t.Errorf("got %s, want %s", got, doc)
+	}
+	// Other methods keep protojson.
+	_, err = serve(t, s, echoEvent("Fail", doc))
+	assertCode(t, err, codes.InvalidArgument)
+
+	_, err = serve(t, newEchoServer(t, WithMethodCodec(id, documentCodec{invalid: true})), echoEvent("Echo", `{}`))
+	if err == nil {
+		t.Error("codec returning invalid JSON: err = nil")
+	}
+}
@@ -0,0 +1,102 @@
+package apexgrpc
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ColdStartRecorder is implemented by MetricsRecorders that want to know how
+// long the hook of OnColdStart took. The code is codes.Unavailable if it
+// failed.
+type ColdStartRecorder interface {
+	RecordColdStart(duration time.Duration, code codes.Code)
+}
+
+// coldStartState runs the hook of OnColdStart once it succeeds.
+type coldStartState struct {
+	mu     sync.Mutex
+	hook   func(c context.Context) error
+	done   bool
+	err    error
+	failed time.Time
+}
+
+// OnColdStart sets the initialization run once per container, before the
+// first event or Invoke call is processed. Concurrent first calls wait for it
+// rather than running it again. If it fails, calls fail with
+// codes.Unavailable, wrapping its error, and the overall health status turns
+// NOT_SERVING; it is not run again unless WithColdStartRetry is given. It
+// must be called before the server handles its first event, and hook must not
+// call Invoke on the server.
+func (s *Server) OnColdStart(hook func(c context.Context) error) {
+	s.coldStart.mu.Lock()
+	s.coldStart.hook = hook
+	s.coldStart.mu.Unlock()
+}
+
+// WithColdStartRetry runs the hook of OnColdStart again, on the next call, once
+// interval has passed since it failed. Zero retries on every call.
+func WithColdStartRetry(interval time.Duration) ServerOption {
+	return func(o *options) {
+		o.coldStartRetry = true
+		o.coldStartRetryInterval = interval
+	}
+}
+
+type coldStartKey struct{}
+
+// ColdStartDuration returns how long the hook of OnColdStart took if it ran
+// for the call of c, e.g. to attribute its latency in a ResponseHook.
+func ColdStartDuration(c context.Context) (time.Duration, bool) {
+	d, ok := c.Value(coldStartKey{}).(time.Duration)
+	return d, ok
+}
+
+// initialize runs the hook of OnColdStart if it has not succeeded yet,
+// returning c with its duration if it ran.
+func (s *Server) initialize(c context.Context) (context.Context, error) {
+	cs := &s.coldStart
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.done || cs.hook == nil {
+		return c, nil
+	}
+	if cs.err != nil && (!s.opts.coldStartRetry || time.Since(cs.failed) < s.opts.coldStartRetryInterval) {
+		return c, cs.err
+	}
+	start := time.Now()
+	err := cs.hook(c)
+	duration := time.Since(start)
+	c = context.WithValue(c, coldStartKey{}, duration)
+	if err != nil {
+		cs.err = wrapCodedf(codes.Unavailable, err, "cold start initialization failed: %v", err)
+		cs.failed = time.Now()
+	} else {
+		cs.done, cs.err = true, nil
+	}
+	s.recordColdStart(duration, cs.err)
+	s.logColdStart(duration, cs.err)
+	if s.health != nil {
+		status := healthpb.HealthCheckResponse_SERVING
+		if cs.err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		s.health.SetServingStatus("", status)
+	}
+	return c, cs.err
+}
+
+func (s *Server) recordColdStart(duration time.Duration, err error) {
+	cr, ok := s.opts.metrics.(ColdStartRecorder)
+	if !ok {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	cr.RecordColdStart(duration, Code(err))
+}
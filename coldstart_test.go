@@ -0,0 +1,142 @@
+package apexgrpc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// coldStartRecorder records the cold starts reported to it.
+type coldStartRecorder struct {
+	MemoryRecorder
+	mu    sync.Mutex
+	codes []codes.Code
+}
+
+func (r *coldStartRecorder) RecordColdStart(duration time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codes = append(r.codes, code)
+}
+
+func TestOnColdStart(t *testing.T) {
+	var runs int32
+	var timed []bool
+	rec := &coldStartRecorder{}
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		_, ok := ColdStartDuration(c)
+		timed = append(timed, ok)
+		return echoReply(req), nil
+	}}, WithMetricsRecorder(rec))
+	s.OnColdStart(func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	if runs != 0 {
+		t.Fatal("hook ran before the first event")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("hook ran %d times, want 1", runs)
+	}
+	if len(timed) != 3 || !timed[0] || timed[1] || timed[2] {
+		t.Errorf("ColdStartDuration reported = %v, want only for the first call", timed)
+	}
+	if len(rec.codes) != 1 || rec.codes[0] != codes.OK {
+		t.Errorf("recorded cold starts = %v", rec.codes)
+	}
+}
+
+func TestOnColdStartConcurrent(t *testing.T) {
+	var runs int32
+	s := newEchoServer(t, WithBatchConcurrency(4))
+	s.OnColdStart(func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	event := `{"batch":[`
+	for i := 0; i < 8; i++ {
+		if i > 0 {
+			event += ","
+		}
+		event += echoEvent("Echo", `{}`)
+	}
+	if _, err := serve(t, s, event+`]}`); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("hook ran %d times, want 1", runs)
+	}
+}
+
+func TestOnColdStartFailure(t *testing.T) {
+	errInit := errors.New("loading the model")
+	var runs int32
+	hook := func(context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return errInit
+		}
+		return nil
+	}
+
+	rec := &coldStartRecorder{}
+	s := newEchoServer(t, WithHealthService(), WithMetricsRecorder(rec))
+	s.OnColdStart(hook)
+	for i := 0; i < 2; i++ {
+		_, err := serve(t, s, echoEvent("Echo", `{}`))
+		assertCode(t, err, codes.Unavailable)
+		if !errors.Is(err, errInit) {
+			t.Errorf("err = %v, want it to wrap the hook's error", err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("hook ran %d times without WithColdStartRetry, want 1", runs)
+	}
+	res, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("health = %v (%v), want NOT_SERVING", res, err)
+	}
+	if len(rec.codes) != 1 || rec.codes[0] != codes.Unavailable {
+		t.Errorf("recorded cold starts = %v", rec.codes)
+	}
+
+	runs = 0
+	s = newEchoServer(t, WithHealthService(), WithColdStartRetry(0))
+	s.OnColdStart(hook)
+	_, err = serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.Unavailable)
+	if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+		t.Fatalf("retried hook: %v", err)
+	}
+	res, err = s.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health = %v (%v), want SERVING", res, err)
+	}
+
+	runs = 0
+	s = newEchoServer(t, WithColdStartRetry(time.Hour))
+	s.OnColdStart(hook)
+	for i := 0; i < 2; i++ {
+		_, err := serve(t, s, echoEvent("Echo", `{}`))
+		assertCode(t, err, codes.Unavailable)
+	}
+	if runs != 1 {
+		t.Errorf("hook ran %d times within the retry interval, want 1", runs)
+	}
+}
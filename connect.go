@@ -0,0 +1,171 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	connectProtocolVersion  = "1"
+	connectJSONContentType  = "application/json"
+	connectProtoContentType = "application/proto"
+)
+
+// ConnectError is the body of a failed Connect unary call.
+type ConnectError struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message,omitempty"`
+	Details []ConnectErrorDetail `json:"details,omitempty"`
+}
+
+// ConnectErrorDetail is a status detail in the Connect error format: the full
+// name of the message and its unpadded base64 wire encoding.
+type ConnectErrorDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// isConnect reports whether req is a Connect unary call: one sending the
+// Connect-Protocol-Version header, or using the application/proto content
+// type that no other mode accepts.
+func isConnect(req *httpRequest) bool {
+	return req.header("connect-protocol-version") != "" || contentType(req) == connectProtoContentType
+}
+
+func contentType(req *httpRequest) string {
+	ct := req.header("content-type")
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.TrimSpace(ct)
+}
+
+// serveConnect serves a Connect unary call with a JSON or binary proto body.
+func (s *Server) serveConnect(c context.Context, req *httpRequest, svc string, mtd string, body []byte, ctx *apex.Context) *httpResponse {
+	if v := req.header("connect-protocol-version"); v != "" && v != connectProtocolVersion {
+		return newConnectErrorResponse(codedErrorf(codes.InvalidArgument, "unsupported connect-protocol-version %q", v))
+	}
+	ct := contentType(req)
+	if ct != connectJSONContentType && ct != connectProtoContentType {
+		return newConnectErrorResponse(codedErrorf(codes.InvalidArgument, "unsupported content type %q", ct))
+	}
+	id, _ := s.resolve("", "", svc, mtd)
+	if h, ok := s.handler(id); ok && h.streamDesc != nil {
+		return newConnectErrorResponse(codedErrorf(codes.Unimplemented, "streaming method (%s) is not supported over connect", id))
+	}
+	event := Event{
+		Service:  &svc,
+		Method:   &mtd,
+		Metadata: req.headers,
+	}
+	if len(body) > 0 {
+		data := json.RawMessage(body)
+		if ct == connectProtoContentType {
+			data, _ = json.Marshal(base64.StdEncoding.EncodeToString(body))
+			encoding := EncodingProtoBase64
+			event.Encoding = &encoding
+		}
+		event.Data = &data
+	}
+	res, err := s.processEvent(c, &event, ctx)
+	if err != nil {
+		return newConnectErrorResponse(err)
+	}
+	reply, err := res.unary()
+	if err != nil {
+		return newConnectErrorResponse(err)
+	}
+	var msg []byte
+	if ct == connectProtoContentType {
+		msg, err = marshalProto(reply)
+	} else {
+		msg, err = s.marshalReply(reply)
+	}
+	if err != nil {
+		return newConnectErrorResponse(err)
+	}
+	headers := connectHeaders(res.header, res.trailer)
+	headers["Content-Type"] = ct
+	out := &httpResponse{status: http.StatusOK, headers: headers, body: string(msg)}
+	if ct == connectProtoContentType {
+		out.body = base64.StdEncoding.EncodeToString(msg)
+		out.base64 = true
+	}
+	return out
+}
+
+// connectHeaders sends header metadata as headers and trailer metadata as
+// headers prefixed with "Trailer-", as Connect unary calls do.
+func connectHeaders(header metadata.MD, trailer metadata.MD) map[string]string {
+	headers := map[string]string{}
+	for k, vals := range encodeMetadata(header) {
+		headers[k] = strings.Join(vals, ", ")
+	}
+	for k, vals := range encodeMetadata(trailer) {
+		headers["Trailer-"+k] = strings.Join(vals, ", ")
+	}
+	return headers
+}
+
+// ConnectCodeName returns the Connect name of a gRPC code, e.g. "not_found".
+func ConnectCodeName(code codes.Code) string {
+	if code == codes.Canceled {
+		return "canceled"
+	}
+	return strings.ToLower(CodeName(code))
+}
+
+// connectHTTPStatus maps a gRPC code to the HTTP status of the Connect
+// protocol.
+func connectHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func newConnectErrorResponse(err error) *httpResponse {
+	st := errorStatus(err)
+	body := ConnectError{
+		Code:    ConnectCodeName(st.Code()),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		body.Details = append(body.Details, ConnectErrorDetail{
+			Type:  detail.TypeUrl[strings.LastIndex(detail.TypeUrl, "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(detail.Value),
+		})
+	}
+	b, _ := json.Marshal(body)
+	return &httpResponse{
+		status:  connectHTTPStatus(st.Code()),
+		headers: map[string]string{"Content-Type": connectJSONContentType},
+		body:    string(b),
+	}
+}
@@ -0,0 +1,104 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestServeConnect(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		if stringField(req, "message") == "detail" {
+			st, _ := status.New(codes.InvalidArgument, "bad").WithDetails(&errdetails.ErrorInfo{Reason: "BAD"})
+			return nil, st.Err()
+		}
+		grpc.SetHeader(c, metadata.Pairs("x-header", "h"))
+		grpc.SetTrailer(c, metadata.Pairs("x-trailer", "t"))
+		return echoReply(req), nil
+	}})
+	call := func(method string, headers map[string][]string, body []byte) *httpResponse {
+		return s.serveHTTP(context.Background(), &httpRequest{
+			method:  http.MethodPost,
+			path:    "/apexgrpc.test.Echo/" + method,
+			headers: headers,
+			body:    base64.StdEncoding.EncodeToString(body),
+			base64:  true,
+		}, "", testApexContext())
+	}
+	jsonHeaders := map[string][]string{"content-type": {"application/json"}, "connect-protocol-version": {"1"}}
+
+	res := call("Echo", jsonHeaders, []byte(`{"message":"hi"}`))
+	if res.status != http.StatusOK || res.headers["Content-Type"] != "application/json" {
+		t.Fatalf("response = %+v", res)
+	}
+	assertJSON(t, res.body, `{"message":"hi"}`)
+	if res.headers["x-header"] != "h" || res.headers["Trailer-x-trailer"] != "t" {
+		t.Errorf("headers = %v, want header and Trailer- prefixed trailer metadata", res.headers)
+	}
+
+	req, err := protov2.Marshal(newEchoRequest(t, `{"message":"bin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = call("Echo", map[string][]string{"content-type": {"application/proto"}}, req)
+	if res.status != http.StatusOK || !res.base64 || res.headers["Content-Type"] != "application/proto" {
+		t.Fatalf("proto response = %+v", res)
+	}
+	b, _ := base64.StdEncoding.DecodeString(res.body)
+	reply := dynamicpb.NewMessage(echoReplyMD)
+	if err := protov2.Unmarshal(b, reply); err != nil || stringField(reply, "message") != "bin" {
+		t.Errorf("proto reply = %v, %v", reply, err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string][]string
+		body    string
+		status  int
+		want    string
+	}{
+		{"not found", "Fail", jsonHeaders, `{"count":5,"message":"gone"}`, http.StatusNotFound, `{"code":"not_found","message":"gone"}`},
+		{"canceled", "Fail", jsonHeaders, `{"count":1,"message":"stop"}`, 499, `{"code":"canceled","message":"stop"}`},
+		{"details", "Echo", jsonHeaders, `{"message":"detail"}`, http.StatusBadRequest, ""},
+		{"protocol version", "Echo", map[string][]string{"content-type": {"application/json"}, "connect-protocol-version": {"2"}}, `{}`, http.StatusBadRequest, ""},
+		{"content type", "Echo", map[string][]string{"content-type": {"text/plain"}, "connect-protocol-version": {"1"}}, `{}`, http.StatusBadRequest, ""},
+		{"streaming", "Split", jsonHeaders, `{}`, http.StatusNotImplemented, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := call(tt.method, tt.headers, []byte(tt.body))
+			if res.status != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", res.status, tt.status, res.body)
+			}
+			if tt.want != "" {
+				assertJSON(t, res.body, tt.want)
+			}
+		})
+	}
+
+	res = call("Echo", jsonHeaders, []byte(`{"message":"detail"}`))
+	var ce ConnectError
+	if err := json.Unmarshal([]byte(res.body), &ce); err != nil {
+		t.Fatal(err)
+	}
+	if len(ce.Details) != 1 || ce.Details[0].Type != "google.rpc.ErrorInfo" {
+		t.Fatalf("details = %+v", ce.Details)
+	}
+	v, err := base64.RawStdEncoding.DecodeString(ce.Details[0].Value)
+	info := &errdetails.ErrorInfo{}
+	if err != nil || protov2.Unmarshal(v, info) != nil || info.Reason != "BAD" {
+		t.Errorf("detail value %q does not decode to the ErrorInfo", ce.Details[0].Value)
+	}
+}
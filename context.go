@@ -0,0 +1,78 @@
+package apexgrpc
+
+import (
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+type apexContextKey struct{}
+
+// FromContext returns the Lambda invocation context of the event being
+// handled. It reports false for calls made through Invoke.
+func FromContext(c context.Context) (*apex.Context, bool) {
+	ctx, ok := c.Value(apexContextKey{}).(*apex.Context)
+	return ctx, ok && ctx != nil
+}
+
+// WithContextValues decorates the context of every method call with f, e.g. to
+// add the dependencies handlers read from it. It runs once per call, on the
+// Run and Invoke paths alike, after the invocation deadline and the values of
+// FromContext and EventFromContext are set and before event hooks and
+// interceptors. Decorators added by several options run in order, each on the
+// context returned by the previous one.
+func WithContextValues(f func(c context.Context) context.Context) ServerOption {
+	return func(o *options) {
+		o.contextDecorators = append(o.contextDecorators, f)
+	}
+}
+
+func (s *Server) decorateContext(c context.Context) context.Context {
+	for _, f := range s.opts.contextDecorators {
+		c = f(c)
+	}
+	return c
+}
+
+type eventContextKey struct{}
+
+// EventFromContext returns a copy of the Event being handled as the caller
+// sent it, before routing, including the synthetic Event of Invoke calls and
+// of payloads routers build without an Event. The event has been
+// routed by the time handlers and interceptors see it, so changing it has no
+// effect; its Data and Metadata are shared and must not be modified.
+func EventFromContext(c context.Context) (*Event, bool) {
+	event, ok := c.Value(eventContextKey{}).(*Event)
+	if !ok {
+		return nil, false
+	}
+	e := *event
+	return &e, true
+}
+
+func newEventContext(c context.Context, event *Event) context.Context {
+	return context.WithValue(c, eventContextKey{}, event)
+}
+
+type sourceEventKey struct{}
+
+// newSourceEventContext records the Event an invocation was routed from, for
+// sourceEvent.
+func newSourceEventContext(c context.Context, event *Event) context.Context {
+	return context.WithValue(c, sourceEventKey{}, event)
+}
+
+// sourceEvent returns the Event the invocation of c was routed from, or event,
+// the one dispatched, if there is none.
+func sourceEvent(c context.Context, event *Event) *Event {
+	if e, ok := c.Value(sourceEventKey{}).(*Event); ok {
+		return e
+	}
+	return event
+}
+
+func newApexContext(c context.Context, ctx *apex.Context) context.Context {
+	if ctx == nil {
+		return c
+	}
+	return context.WithValue(c, apexContextKey{}, ctx)
+}
@@ -0,0 +1,91 @@
+package apexgrpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestFromContext(t *testing.T) {
+	var got *Event
+	var requestID string
+	var invoked bool
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		if ctx, ok := FromContext(c); ok {
+			requestID = ctx.RequestID
+		}
+		got, _ = EventFromContext(c)
+		invoked = true
+		return echoReply(req), nil
+	}})
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !invoked {
+		t.Fatal("handler not called")
+	}
+	if requestID != "test-request" {
+		t.Errorf("request ID = %q, want %q", requestID, "test-request")
+	}
+	if got == nil || got.Method == nil || *got.Method != "Echo" {
+		t.Errorf("EventFromContext = %+v, want the event served", got)
+	}
+	requestID = "unset"
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if requestID != "unset" {
+		t.Errorf("Invoke calls have an apex context with request ID %q", requestID)
+	}
+}
+
+type depKey struct{}
+
+func TestWithContextValues(t *testing.T) {
+	var seen []string
+	decorator := func(name string) func(context.Context) context.Context {
+		return func(c context.Context) context.Context {
+			deps, _ := c.Value(depKey{}).([]string)
+			if _, ok := EventFromContext(c); !ok {
+				name += "(no event)"
+			}
+			return context.WithValue(c, depKey{}, append(deps[:len(deps):len(deps)], name))
+		}
+	}
+	var calls int
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		seen, _ = c.Value(depKey{}).([]string)
+		return echoReply(req), nil
+	}},
+		WithContextValues(decorator("db")),
+		WithContextValues(decorator("config")),
+		WithContextValues(decorator("clock")),
+		WithUnaryInterceptor(func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if deps, _ := c.Value(depKey{}).([]string); len(deps) == 3 {
+				calls++
+			}
+			return handler(c, req)
+		}),
+	)
+	want := []string{"db", "config", "clock"}
+	if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Run path: handler saw %v, want %v", seen, want)
+	}
+	seen = nil
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Invoke path: handler saw %v, want %v", seen, want)
+	}
+	if calls != 2 {
+		t.Errorf("interceptors saw the decorated context %d times, want 2", calls)
+	}
+}
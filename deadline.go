@@ -0,0 +1,66 @@
+package apexgrpc
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withInvocationDeadline bounds c by the Lambda invocation deadline, taken
+// from the function timeout or from a deadline c already carries.
+func (s *Server) withInvocationDeadline(c context.Context, received time.Time) (context.Context, context.CancelFunc) {
+	deadline, ok := c.Deadline()
+	if s.opts.functionTimeout > 0 {
+		if d := received.Add(s.opts.functionTimeout); !ok || d.Before(deadline) {
+			deadline, ok = d, true
+		}
+	}
+	if !ok {
+		return c, func() {}
+	}
+	return context.WithDeadline(c, deadline.Add(-s.opts.deadlineMargin))
+}
+
+// deadlineError reports a handler failure caused by an expired deadline as
+// codes.DeadlineExceeded unless the handler chose a status itself.
+func deadlineError(c context.Context, err error) error {
+	if err == nil || c.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if Code(err) != codes.Unknown {
+		return err
+	}
+	return status.Error(codes.DeadlineExceeded, err.Error())
+}
+
+// WithMethodTimeout bounds every call of the method id to d, which wins over
+// WithDefaultMethodTimeout. The handler context expires at the earlier of this
+// timeout and the invocation deadline, and a handler failing because of it
+// reports codes.DeadlineExceeded. The call still waits for the handler to
+// return, so a handler that ignores its context is not interrupted, and its
+// reply is kept if it returns one.
+func WithMethodTimeout(id MethodID, d time.Duration) ServerOption {
+	return func(o *options) {
+		if o.methodTimeouts == nil {
+			o.methodTimeouts = map[MethodID]time.Duration{}
+		}
+		o.methodTimeouts[id] = d
+	}
+}
+
+// WithDefaultMethodTimeout bounds calls of methods without a
+// WithMethodTimeout to d. Zero means no bound.
+func WithDefaultMethodTimeout(d time.Duration) ServerOption {
+	return func(o *options) {
+		o.defaultMethodTimeout = d
+	}
+}
+
+func (s *Server) methodTimeout(id MethodID) time.Duration {
+	if d, ok := s.opts.methodTimeouts[id]; ok {
+		return d
+	}
+	return s.opts.defaultMethodTimeout
+}
@@ -0,0 +1,97 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// waitingEcho waits for its context to end unless the request message is
+// "fast".
+func waitingEcho(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+	if stringField(req, "message") == "fast" {
+		return echoReply(req), nil
+	}
+	<-c.Done()
+	return nil, c.Err()
+}
+
+func TestMethodTimeouts(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	tests := []struct {
+		name string
+		opts []ServerOption
+	}{
+		{"method", []ServerOption{WithMethodTimeout(id, 10*time.Millisecond)}},
+		{"default", []ServerOption{WithDefaultMethodTimeout(10 * time.Millisecond)}},
+		{"method wins", []ServerOption{WithDefaultMethodTimeout(time.Hour), WithMethodTimeout(id, 10*time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newEchoServerWith(t, &echoServer{echo: waitingEcho}, tt.opts...)
+			start := time.Now()
+			_, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+			assertCode(t, err, codes.DeadlineExceeded)
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("call took %v", d)
+			}
+			if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{"message": "fast"}); err != nil {
+				t.Errorf("fast call: %v", err)
+			}
+		})
+	}
+}
+
+func TestInvocationDeadline(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		deadline, hasDeadline = c.Deadline()
+		return echoReply(req), nil
+	}}, WithDeadlineMargin(100*time.Millisecond))
+
+	lambdaDeadline := time.Now().Add(time.Minute)
+	c, cancel := context.WithDeadline(context.Background(), lambdaDeadline)
+	defer cancel()
+	if _, err := s.ApexHandler(c)(json.RawMessage(echoEvent("Echo", `{}`)), testApexContext()); err != nil {
+		t.Fatal(err)
+	}
+	if want := lambdaDeadline.Add(-100 * time.Millisecond); !hasDeadline || !deadline.Equal(want) {
+		t.Errorf("handler deadline = %v (%v), want %v", deadline, hasDeadline, want)
+	}
+
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if hasDeadline {
+		t.Errorf("Invoke handler has deadline %v", deadline)
+	}
+}
+
+func TestInvocationDeadlineExceeded(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: waitingEcho}, WithFunctionTimeout(20*time.Millisecond), WithDeadlineMargin(10*time.Millisecond))
+	start := time.Now()
+	_, err := serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.DeadlineExceeded)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("call took %v", d)
+	}
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"fast"}`)); err != nil {
+		t.Errorf("fast call: %v", err)
+	}
+
+	// Routing errors keep their codes under a deadline.
+	for event, code := range map[string]codes.Code{
+		echoEvent("Nope", `{}`): codes.Unimplemented,
+		`{"service":"apexgrpc.test.Nope","method":"Echo","data":{}}`: codes.Unimplemented,
+		`{"method":"/Echo","data":{}}`:                               codes.InvalidArgument,
+	} {
+		_, err := serve(t, s, event)
+		assertCode(t, err, code)
+	}
+}
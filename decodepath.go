@@ -0,0 +1,282 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldError locates a decode error at a field of the request data.
+type fieldError struct {
+	// path is a JSON pointer to the offending value.
+	path     string
+	expected string
+	got      string
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("at %s: expected %s, got %s", e.path, e.expected, e.got)
+}
+
+// locateDecodeError walks raw, request data that failed to decode into a
+// message of type md, for the first value whose JSON type the field it is
+// given for cannot take. protojson errors only carry a line and column, so
+// this is how decode errors name the offending field. It returns nil when no
+// such value is found, leaving the decode error as protojson reported it.
+func locateDecodeError(md protoreflect.MessageDescriptor, raw []byte) *fieldError {
+	return checkMessageJSON(md, "", raw)
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func checkMessageJSON(md protoreflect.MessageDescriptor, path string, raw []byte) *fieldError {
+	if fe := checkWellKnownJSON(md, path, raw); fe != nil || wellKnownSchema(md) != nil {
+		return fe
+	}
+	if kind := jsonValueKind(raw); kind != '{' {
+		return &fieldError{path: pointerOrRoot(path), expected: "message " + string(md.FullName()), got: jsonKind(kind)}
+	}
+	members, err := jsonObject(raw)
+	if err != nil {
+		return nil
+	}
+	fields := md.Fields()
+	for _, m := range members {
+		fd := fields.ByJSONName(m.key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(m.key))
+		}
+		if fd == nil || isJSONNull(m.value) {
+			// Unknown fields are reported by protojson with a suggestion.
+			continue
+		}
+		if fe := checkFieldJSON(fd, path+"/"+escapePointer(m.key), m.value); fe != nil {
+			return fe
+		}
+	}
+	return nil
+}
+
+func checkFieldJSON(fd protoreflect.FieldDescriptor, path string, raw []byte) *fieldError {
+	switch {
+	case fd.IsMap():
+		if kind := jsonValueKind(raw); kind != '{' {
+			return &fieldError{path: path, expected: "map", got: jsonKind(kind)}
+		}
+		members, err := jsonObject(raw)
+		if err != nil {
+			return nil
+		}
+		for _, m := range members {
+			if fe := checkSingularJSON(fd.MapValue(), path+"/"+escapePointer(m.key), m.value); fe != nil {
+				return fe
+			}
+		}
+		return nil
+	case fd.IsList():
+		if kind := jsonValueKind(raw); kind != '[' {
+			return &fieldError{path: path, expected: "repeated " + fieldTypeName(fd), got: jsonKind(kind)}
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil
+		}
+		for i, e := range elems {
+			if fe := checkSingularJSON(fd, path+"/"+strconv.Itoa(i), e); fe != nil {
+				return fe
+			}
+		}
+		return nil
+	}
+	return checkSingularJSON(fd, path, raw)
+}
+
+func fieldTypeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "message " + string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return "enum " + string(fd.Enum().FullName())
+	}
+	return fd.Kind().String()
+}
+
+func checkSingularJSON(fd protoreflect.FieldDescriptor, path string, raw []byte) *fieldError {
+	kind := jsonValueKind(raw)
+	mismatch := &fieldError{path: path, expected: fieldTypeName(fd), got: jsonKind(kind)}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if kind == 'n' && fd.Message().FullName() == "google.protobuf.Value" {
+			return nil
+		}
+		return checkMessageJSON(fd.Message(), path, raw)
+	case protoreflect.EnumKind:
+		if kind == 'n' && fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil
+		}
+		if kind == '"' {
+			var name string
+			if json.Unmarshal(raw, &name) == nil && fd.Enum().Values().ByName(protoreflect.Name(name)) == nil {
+				// The name is left out as the value may be redacted.
+				mismatch.got = "an unknown value name"
+				return mismatch
+			}
+			return nil
+		}
+		if kind == '0' {
+			return checkIntegerJSON(mismatch, raw, math.MinInt32, math.MaxInt32)
+		}
+	case protoreflect.BoolKind:
+		if kind == 't' {
+			return nil
+		}
+	case protoreflect.StringKind:
+		if kind == '"' {
+			return nil
+		}
+	case protoreflect.BytesKind:
+		if kind == '"' {
+			var s string
+			if json.Unmarshal(raw, &s) == nil && !isBase64(s) {
+				mismatch.got = "a string that is not base64"
+				return mismatch
+			}
+			return nil
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if kind == '0' {
+			return nil
+		}
+		if kind == '"' {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				if _, err := strconv.ParseFloat(s, 64); err == nil || s == "NaN" || s == "Infinity" || s == "-Infinity" {
+					return nil
+				}
+			}
+			mismatch.got = "a non-numeric string"
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return checkIntegerJSON(mismatch, raw, math.MinInt32, math.MaxInt32)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return checkIntegerJSON(mismatch, raw, 0, math.MaxUint32)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return checkIntegerJSON(mismatch, raw, math.MinInt64, math.MaxInt64)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return checkIntegerJSON(mismatch, raw, 0, math.MaxUint64)
+	default:
+		return nil
+	}
+	return mismatch
+}
+
+// checkIntegerJSON accepts numbers and numeric strings holding an integer in
+// [min, max].
+func checkIntegerJSON(mismatch *fieldError, raw []byte, min float64, max float64) *fieldError {
+	kind := jsonValueKind(raw)
+	text := string(bytes.TrimSpace(raw))
+	if kind == '"' {
+		if json.Unmarshal(raw, &text) != nil {
+			return mismatch
+		}
+	} else if kind != '0' {
+		return mismatch
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	switch {
+	case err != nil:
+		mismatch.got = "a non-numeric string"
+	case f != math.Trunc(f):
+		mismatch.got = "a fractional number"
+	case f < min || f > max:
+		mismatch.got = "an out of range number"
+	default:
+		return nil
+	}
+	return mismatch
+}
+
+// wellKnownJSONKinds returns the kinds, as returned by jsonValueKind, the JSON
+// form of a well-known type may take, or "" for google.protobuf.Value, which
+// takes any.
+func wellKnownJSONKinds(name protoreflect.FullName) (string, bool) {
+	switch name {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return `"`, true
+	case "google.protobuf.Struct", "google.protobuf.Any", "google.protobuf.Empty":
+		return "{", true
+	case "google.protobuf.ListValue":
+		return "[", true
+	case "google.protobuf.BoolValue":
+		return "t", true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value", "google.protobuf.Int64Value",
+		"google.protobuf.UInt64Value", "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return `0"`, true
+	case "google.protobuf.Value":
+		return "", true
+	}
+	return "", false
+}
+
+// messageJSONKinds returns the kinds the JSON form of md may take: an object,
+// or those of wellKnownJSONKinds.
+func messageJSONKinds(md protoreflect.MessageDescriptor) string {
+	if kinds, ok := wellKnownJSONKinds(md.FullName()); ok {
+		return kinds
+	}
+	return "{"
+}
+
+// checkWellKnownJSON checks the JSON forms of well-known types that are not
+// objects.
+func checkWellKnownJSON(md protoreflect.MessageDescriptor, path string, raw []byte) *fieldError {
+	kinds, ok := wellKnownJSONKinds(md.FullName())
+	if !ok || kinds == "" {
+		return nil
+	}
+	if kind := jsonValueKind(raw); strings.IndexByte(kinds, kind) < 0 {
+		return &fieldError{path: pointerOrRoot(path), expected: string(md.FullName()), got: jsonKind(kind)}
+	}
+	return nil
+}
+
+func pointerOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// jsonValueKind returns the first byte of a JSON value, with 't' for both
+// booleans and '0' for numbers.
+func jsonValueKind(raw []byte) byte {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	if len(raw) == 0 {
+		return 0
+	}
+	switch c := raw[0]; c {
+	case '{', '[', '"', 'n', 't':
+		return c
+	case 'f':
+		return 't'
+	}
+	return '0'
+}
+
+func isBase64(s string) bool {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if _, err := enc.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
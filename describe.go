@@ -0,0 +1,205 @@
+package apexgrpc
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MethodDescription describes a registered method or alias. Request and
+// Response are read from the proto descriptor of the service when it is in the
+// global registry, and otherwise from its HandlerType; they are empty when
+// neither is available.
+type MethodDescription struct {
+	ID            MethodID `json:"id"`
+	AliasOf       MethodID `json:"alias_of,omitempty"`
+	Version       string   `json:"version,omitempty"`
+	Request       string   `json:"request,omitempty"`
+	Response      string   `json:"response,omitempty"`
+	ClientStreams bool     `json:"client_streams,omitempty"`
+	ServerStreams bool     `json:"server_streams,omitempty"`
+}
+
+// Methods returns the IDs of all registered methods and aliases in sorted
+// order. See MethodsByVersion for the API versions of versioned methods.
+func (s *Server) Methods() []MethodID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.methods()
+}
+
+func (s *Server) methods() []MethodID {
+	ids := make([]MethodID, 0, len(s.handlers)+len(s.aliases))
+	for id := range s.handlers {
+		ids = append(ids, id)
+	}
+	for id := range s.aliases {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// HasMethod reports whether a handler or alias is registered for the fully
+// qualified id, e.g. "pkg.Service/Method".
+func (s *Server) HasMethod(id MethodID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.handlers[id]
+	if !ok {
+		_, ok = s.aliases[id]
+	}
+	return ok
+}
+
+// Describe returns a description of every registered method, ordered as
+// Methods.
+func (s *Server) Describe() []MethodDescription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.methods()
+	descs := make([]MethodDescription, len(ids))
+	for i, id := range ids {
+		if to, ok := s.aliases[id]; ok {
+			descs[i] = describeMethod(to, s.handlers[to])
+			descs[i].ID, descs[i].AliasOf = id, to
+			continue
+		}
+		descs[i] = describeMethod(id, s.handlers[id])
+	}
+	return descs
+}
+
+func describeMethod(id MethodID, h handler) MethodDescription {
+	d := MethodDescription{ID: id, Version: h.version}
+	if h.streamDesc != nil {
+		d.ClientStreams = h.streamDesc.ClientStreams
+		d.ServerStreams = h.streamDesc.ServerStreams
+	}
+	if h.descriptor != nil {
+		d.Request = string(h.descriptor.Input().FullName())
+		d.Response = string(h.descriptor.Output().FullName())
+		return d
+	}
+	req, resp := methodTypes(id, h)
+	d.Request = messageName(req)
+	d.Response = messageName(resp)
+	return d
+}
+
+// methodTypes returns the request and response message types of h, read from
+// the signature of its server interface.
+func methodTypes(id MethodID, h handler) (reflect.Type, reflect.Type) {
+	if h.serviceDesc == nil || h.serviceDesc.HandlerType == nil {
+		return nil, nil
+	}
+	_, mtd := id.split()
+	m, ok := reflect.TypeOf(h.serviceDesc.HandlerType).Elem().MethodByName(mtd)
+	if !ok {
+		return nil, nil
+	}
+	var clientStreams, serverStreams bool
+	if h.streamDesc != nil {
+		clientStreams, serverStreams = h.streamDesc.ClientStreams, h.streamDesc.ServerStreams
+	}
+	return methodMessageTypes(m.Type, clientStreams, serverStreams)
+}
+
+// methodMessageTypes extracts the request and response types from the
+// signature of a generated server interface method:
+//
+//	unary:          Method(context.Context, *Req) (*Resp, error)
+//	server stream:  Method(*Req, Svc_MethodServer) error
+//	client or bidi: Method(Svc_MethodServer) error
+//
+// Stream types are read from the Recv, Send and SendAndClose methods of the
+// generated stream interface.
+func methodMessageTypes(t reflect.Type, clientStreams bool, serverStreams bool) (reflect.Type, reflect.Type) {
+	switch {
+	case !clientStreams && !serverStreams:
+		if t.NumIn() == 2 && t.NumOut() == 2 {
+			return t.In(1), t.Out(0)
+		}
+	case !clientStreams:
+		if t.NumIn() == 2 {
+			return t.In(0), streamMethodArg(t.In(1), "Send")
+		}
+	default:
+		if t.NumIn() == 1 {
+			req := streamMethodResult(t.In(0), "Recv")
+			if serverStreams {
+				return req, streamMethodArg(t.In(0), "Send")
+			}
+			return req, streamMethodArg(t.In(0), "SendAndClose")
+		}
+	}
+	return nil, nil
+}
+
+func streamMethodArg(stream reflect.Type, name string) reflect.Type {
+	m, ok := stream.MethodByName(name)
+	if !ok || m.Type.NumIn() != 1 {
+		return nil
+	}
+	return m.Type.In(0)
+}
+
+func streamMethodResult(stream reflect.Type, name string) reflect.Type {
+	m, ok := stream.MethodByName(name)
+	if !ok || m.Type.NumOut() != 2 {
+		return nil
+	}
+	return m.Type.Out(0)
+}
+
+// messageName returns the proto name of a message pointer type.
+func messageName(t reflect.Type) string {
+	if t == nil || t.Kind() != reflect.Ptr {
+		return ""
+	}
+	msg, ok := reflect.New(t.Elem()).Interface().(proto.Message)
+	if !ok {
+		return ""
+	}
+	return messageFullName(msg)
+}
+
+// methodMessages returns constructors of empty requests and replies of h,
+// of the Go types of its server interface or, for services known only by
+// descriptor, dynamic messages of its input and output types. They are nil
+// when neither is available.
+func methodMessages(id MethodID, h handler) (func() proto.Message, func() proto.Message) {
+	req, resp := methodTypes(id, h)
+	newReq, newResp := messageConstructor(req), messageConstructor(resp)
+	if h.descriptor != nil {
+		if newReq == nil {
+			newReq = dynamicConstructor(h.descriptor.Input())
+		}
+		if newResp == nil {
+			newResp = dynamicConstructor(h.descriptor.Output())
+		}
+	}
+	return newReq, newResp
+}
+
+func messageConstructor(t reflect.Type) func() proto.Message {
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+	if _, ok := reflect.New(t.Elem()).Interface().(proto.Message); !ok {
+		return nil
+	}
+	return func() proto.Message {
+		return reflect.New(t.Elem()).Interface().(proto.Message)
+	}
+}
+
+func dynamicConstructor(md protoreflect.MessageDescriptor) func() proto.Message {
+	return func() proto.Message {
+		return protoadapt.MessageV1Of(dynamicpb.NewMessage(md))
+	}
+}
@@ -0,0 +1,42 @@
+package apexgrpc
+
+import (
+	"testing"
+)
+
+func TestMethods(t *testing.T) {
+	s := newEchoServer(t)
+	want := []MethodID{
+		"apexgrpc.test.Echo/Echo",
+		"apexgrpc.test.Echo/Fail",
+		"apexgrpc.test.Echo/Join",
+		"apexgrpc.test.Echo/Split",
+	}
+	got := s.Methods()
+	if len(got) != len(want) {
+		t.Fatalf("Methods() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Methods()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if !s.HasMethod("apexgrpc.test.Echo/Echo") || s.HasMethod("apexgrpc.test.Echo/Nope") {
+		t.Error("HasMethod disagrees with Methods")
+	}
+	descs := s.Describe()
+	byID := map[MethodID]MethodDescription{}
+	for _, d := range descs {
+		byID[d.ID] = d
+	}
+	echo := byID["apexgrpc.test.Echo/Echo"]
+	if echo.Request != "apexgrpc.test.EchoRequest" || echo.Response != "apexgrpc.test.EchoReply" || echo.ClientStreams || echo.ServerStreams {
+		t.Errorf("Echo described as %+v", echo)
+	}
+	if d := byID["apexgrpc.test.Echo/Split"]; !d.ServerStreams || d.ClientStreams {
+		t.Errorf("Split described as %+v", d)
+	}
+	if d := byID["apexgrpc.test.Echo/Join"]; !d.ClientStreams || d.ServerStreams {
+		t.Errorf("Join described as %+v", d)
+	}
+}
@@ -0,0 +1,137 @@
+package apexgrpc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// serviceDescriptor looks up the descriptor of a service in the global
+// registry, in the proto file named by desc.Metadata if given. It returns nil
+// for services that are not registered there.
+func serviceDescriptor(desc *grpc.ServiceDesc) protoreflect.ServiceDescriptor {
+	name := protoreflect.FullName(desc.ServiceName)
+	if path, ok := desc.Metadata.(string); ok && path != "" {
+		if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+			if sd := fd.Services().ByName(name.Name()); sd != nil {
+				return sd
+			}
+		}
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil
+	}
+	sd, _ := d.(protoreflect.ServiceDescriptor)
+	return sd
+}
+
+// methodDescriptor returns the descriptor of the method named methodName of
+// svc, or nil if the service has none.
+func methodDescriptor(svc Service, methodName string) protoreflect.MethodDescriptor {
+	sd := svc.descriptor
+	if sd == nil {
+		sd = serviceDescriptor(svc.Desc)
+	}
+	if sd == nil {
+		return nil
+	}
+	return sd.Methods().ByName(protoreflect.Name(methodName))
+}
+
+var unknownField = regexp.MustCompile(`unknown field "([^"]+)"`)
+
+// maxSuggestMessages bounds how many nested message types are searched for a
+// field name to suggest.
+const maxSuggestMessages = 64
+
+// unknownFieldError names the message and suggests the closest field for a
+// decode error about a misspelled field of m or of a message nested in it.
+// Other errors are returned unchanged.
+func unknownFieldError(m proto.Message, err error) error {
+	if err == nil {
+		return nil
+	}
+	match := unknownField.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	md, field, ok := suggestField(messageV2(m).ProtoReflect().Descriptor(), match[1])
+	if !ok {
+		return err
+	}
+	hint := fmt.Sprintf("%s in %s; did you mean %q?", match[0], md.FullName(), field)
+	return errors.New(strings.Replace(err.Error(), match[0], hint, 1))
+}
+
+// suggestField searches md and the messages nested in it, nearest first, for
+// the field name closest to name by edit distance.
+func suggestField(md protoreflect.MessageDescriptor, name string) (protoreflect.MessageDescriptor, string, bool) {
+	max := 2
+	if len(name) <= 4 {
+		max = 1
+	}
+	var best protoreflect.MessageDescriptor
+	var bestName string
+	bestDist := max + 1
+	seen := map[protoreflect.FullName]bool{md.FullName(): true}
+	queue := []protoreflect.MessageDescriptor{md}
+	for len(queue) > 0 && len(seen) <= maxSuggestMessages {
+		md := queue[0]
+		queue = queue[1:]
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			for _, candidate := range []string{fd.JSONName(), string(fd.Name())} {
+				if d := editDistance(name, candidate); d > 0 && d < bestDist {
+					best, bestName, bestDist = md, candidate, d
+				}
+			}
+			if fd.IsMap() {
+				fd = fd.MapValue()
+			}
+			if sub := fd.Message(); sub != nil && !seen[sub.FullName()] {
+				seen[sub.FullName()] = true
+				queue = append(queue, sub)
+			}
+		}
+	}
+	return best, bestName, best != nil
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,79 @@
+package apexgrpc
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestServiceDescriptor(t *testing.T) {
+	if sd := serviceDescriptor(&echoServiceDesc); sd == nil || sd.FullName() != echoService {
+		t.Errorf("serviceDescriptor(Echo) = %v", sd)
+	}
+	desc := echoServiceDesc
+	desc.Metadata = "apexgrpc/test/missing.proto"
+	if sd := serviceDescriptor(&desc); sd == nil || sd.FullName() != echoService {
+		t.Errorf("serviceDescriptor by name = %v", sd)
+	}
+
+	// Services missing from the registry are served without descriptors.
+	unknown := grpc.ServiceDesc{
+		ServiceName: "apexgrpc.unregistered.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods:     echoServiceDesc.Methods[:1],
+	}
+	if sd := serviceDescriptor(&unknown); sd != nil {
+		t.Errorf("serviceDescriptor(unregistered) = %v", sd.FullName())
+	}
+	s := NewServer()
+	if err := s.Register([]Service{{Desc: &unknown, Server: &echoServer{}}}); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Describe(); len(d) != 1 || d[0].Request != "" || d[0].Response != "" {
+		t.Errorf("Describe() = %+v", d)
+	}
+	got, err := serve(t, s, `{"service":"apexgrpc.unregistered.Echo","method":"Echo","data":{"message":"hi"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+}
+
+func TestUnknownFieldSuggestions(t *testing.T) {
+	s := newEchoServer(t)
+	for data, want := range map[string]string{
+		`{"mesage":"hi"}`: `unknown field "mesage" in apexgrpc.test.EchoRequest; did you mean "message"?`,
+		`{"tag":["a"]}`:   `unknown field "tag" in apexgrpc.test.EchoRequest; did you mean "tags"?`,
+	} {
+		_, err := serve(t, s, echoEvent("Echo", data))
+		assertCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("data %s: err = %v, want %q", data, err, want)
+		}
+	}
+	_, err := serve(t, s, echoEvent("Echo", `{"unrelated":1}`))
+	assertCode(t, err, codes.InvalidArgument)
+	if strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("err = %v, want no suggestion", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"email", "email", 0},
+		{"emial", "email", 2},
+		{"emal", "email", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	} {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
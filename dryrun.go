@@ -0,0 +1,59 @@
+package apexgrpc
+
+import "google.golang.org/grpc/codes"
+
+// DryRunResponse is returned for events with "dryRun": true, which are
+// routed and decoded but not handled.
+type DryRunResponse struct {
+	DryRun       bool   `json:"dryRun"`
+	Method       string `json:"method"`
+	RequestValid bool   `json:"requestValid"`
+	RequestType  string `json:"requestType"`
+}
+
+// WithDryRun accepts events with "dryRun": true. Such an event has its method
+// resolved and its request decoded and validated like a real call, failing with
+// the same errors, but the handler is not called; the response is a
+// DryRunResponse. Dry-run events are rejected by default.
+func WithDryRun() ServerOption {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+func (s *Server) dryRunMethod(id MethodID, req *request) (*result, error) {
+	if !s.opts.dryRun {
+		return nil, codedErrorf(codes.FailedPrecondition, "dry run is not enabled")
+	}
+	h, ok := s.handler(id)
+	if !ok {
+		return nil, &MethodNotFoundError{ID: id}
+	}
+	d := describeMethod(id, h)
+	newRequest, _ := methodMessages(id, h)
+	if newRequest == nil {
+		return nil, codedErrorf(codes.Unimplemented, "dry run is not supported for method (%s)", id)
+	}
+	decs := []messageDecoder{s.newRequestDecoder(req)}
+	if d.ClientStreams && req.msg == nil {
+		var err error
+		if decs, err = s.newStreamDecoders(id, req.encoding, req.data); err != nil {
+			return nil, err
+		}
+	}
+	for _, dec := range decs {
+		msg := newRequest()
+		if err := dec(msg); err != nil {
+			return nil, invalidInputError(id, err)
+		}
+		if err := s.validateRequest(id, msg); err != nil {
+			return nil, err
+		}
+	}
+	return &result{id: id, payload: &DryRunResponse{
+		DryRun:       true,
+		Method:       id.String(),
+		RequestValid: true,
+		RequestType:  d.Request,
+	}}, nil
+}
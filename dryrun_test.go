@@ -0,0 +1,56 @@
+package apexgrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func dryRunEvent(method, data string) string {
+	return `{"service":"apexgrpc.test.Echo","method":"` + method + `","dryRun":true,"data":` + data + `}`
+}
+
+func TestDryRun(t *testing.T) {
+	var called bool
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		called = true
+		return echoReply(req), nil
+	}}
+	s := newEchoServerWith(t, srv, WithDryRun(), WithRequestValidator(requireMessage))
+	got, err := serve(t, s, dryRunEvent("Echo", `{"message":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"dryRun":true,"method":"apexgrpc.test.Echo/Echo","requestValid":true,"requestType":"apexgrpc.test.EchoRequest"}`)
+	if called {
+		t.Error("handler called for a dry run")
+	}
+
+	tests := []struct {
+		name  string
+		event string
+		code  codes.Code
+	}{
+		{"unknown method", dryRunEvent("Nope", `{}`), codes.Unimplemented},
+		{"invalid data", dryRunEvent("Echo", `{"count":"x"}`), codes.InvalidArgument},
+		{"validator", dryRunEvent("Echo", `{}`), codes.InvalidArgument},
+		{"client stream", dryRunEvent("Join", `[{"message":"a"},{"count":"x"}]`), codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dryErr := serve(t, s, tt.event)
+			assertCode(t, dryErr, tt.code)
+			_, err := serve(t, s, strings.Replace(tt.event, `"dryRun":true,`, "", 1))
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestDryRunRejectedByDefault(t *testing.T) {
+	_, err := serve(t, newEchoServer(t), dryRunEvent("Echo", `{"message":"hi"}`))
+	assertCode(t, err, codes.FailedPrecondition)
+}
@@ -0,0 +1,154 @@
+package apexgrpc
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DynamicHandler handles calls of a method registered with RegisterDynamic.
+// req is a message of the method's input type; the reply should be of its
+// output type.
+type DynamicHandler func(c context.Context, method protoreflect.MethodDescriptor, req *dynamicpb.Message) (protov2.Message, error)
+
+// RegisterDynamic adds the unary methods of every service described by fdset
+// like Register, without generated code. Requests are decoded into dynamic
+// messages and passed to h through the interceptor chain. The message types of
+// fdset are also used to resolve google.protobuf.Any values unless a resolver
+// is configured. It fails if a service has streaming methods.
+func (s *Server) RegisterDynamic(fdset *descriptorpb.FileDescriptorSet, h DynamicHandler) error {
+	if h == nil {
+		return fmt.Errorf("missing dynamic handler")
+	}
+	files, err := protodesc.NewFiles(fdset)
+	if err != nil {
+		return fmt.Errorf("invalid file descriptor set: %v", err)
+	}
+	var svcs []Service
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			var svc Service
+			if svc, err = dynamicService(services.Get(i), h); err != nil {
+				return false
+			}
+			svcs = append(svcs, svc)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Register(svcs); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dynamicTypes = append(s.dynamicTypes, dynamicpb.NewTypes(files))
+	s.mu.Unlock()
+	return nil
+}
+
+func dynamicService(sd protoreflect.ServiceDescriptor, h DynamicHandler) (Service, error) {
+	desc := &grpc.ServiceDesc{ServiceName: string(sd.FullName())}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			return Service{}, fmt.Errorf("streaming method (%s) is not supported by RegisterDynamic", md.FullName())
+		}
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(md.Name()),
+			Handler:    dynamicMethodHandler(desc.ServiceName, md),
+		})
+	}
+	return Service{Desc: desc, Server: h, descriptor: sd}, nil
+}
+
+func dynamicMethodHandler(serviceName string, md protoreflect.MethodDescriptor) grpc.MethodHandler {
+	fullMethod := "/" + serviceName + "/" + string(md.Name())
+	return func(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := dynamicpb.NewMessage(md.Input())
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(c context.Context, req interface{}) (interface{}, error) {
+			reply, err := srv.(DynamicHandler)(c, md, req.(*dynamicpb.Message))
+			if err != nil || reply == nil {
+				return nil, err
+			}
+			return protoadapt.MessageV1Of(reply), nil
+		}
+		if interceptor == nil {
+			return handler(c, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		return interceptor(c, req, info, handler)
+	}
+}
+
+// dynamicResolver resolves types from the global registry and then from the
+// descriptor sets given to RegisterDynamic.
+type dynamicResolver []*dynamicpb.Types
+
+func (r dynamicResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	for _, types := range r {
+		if err == nil {
+			break
+		}
+		mt, err = types.FindMessageByName(name)
+	}
+	return mt, err
+}
+
+func (r dynamicResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByURL(url)
+	for _, types := range r {
+		if err == nil {
+			break
+		}
+		mt, err = types.FindMessageByURL(url)
+	}
+	return mt, err
+}
+
+func (r dynamicResolver) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	xt, err := protoregistry.GlobalTypes.FindExtensionByName(name)
+	for _, types := range r {
+		if err == nil {
+			break
+		}
+		xt, err = types.FindExtensionByName(name)
+	}
+	return xt, err
+}
+
+func (r dynamicResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	xt, err := protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+	for _, types := range r {
+		if err == nil {
+			break
+		}
+		xt, err = types.FindExtensionByNumber(message, field)
+	}
+	return xt, err
+}
+
+// typeResolver returns the resolver for the protojson options when one is
+// not configured: the global registry, extended by RegisterDynamic.
+func (s *Server) typeResolver() typeResolver {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.dynamicTypes) == 0 {
+		return nil
+	}
+	return dynamicResolver(s.dynamicTypes)
+}
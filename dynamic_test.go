@@ -0,0 +1,82 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestRegisterDynamic(t *testing.T) {
+	var method protoreflect.FullName
+	s := NewServer()
+	err := s.RegisterDynamic(anyServiceFiles(), func(c context.Context, md protoreflect.MethodDescriptor, req *dynamicpb.Message) (protov2.Message, error) {
+		method = md.FullName()
+		if !req.Has(md.Input().Fields().ByName("value")) {
+			return nil, status.Error(codes.InvalidArgument, "value is required")
+		}
+		return req, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := NewMethodID("", "apexgrpc.anytest.Anys", "Echo")
+	if ids := s.Methods(); len(ids) != 1 || ids[0] != id {
+		t.Errorf("Methods = %v, want [%s]", ids, id)
+	}
+
+	// The Any value is a message known only from the descriptor set.
+	data := `{"value":{"@type":"type.googleapis.com/apexgrpc.anytest.Wrapped","value":{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hi"}}}`
+	got, err := serve(t, s, `{"service":"apexgrpc.anytest.Anys","method":"Echo","data":`+data+`}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, data)
+	if method != "apexgrpc.anytest.Anys.Echo" {
+		t.Errorf("handler saw method %s", method)
+	}
+
+	_, err = serve(t, s, `{"service":"apexgrpc.anytest.Anys","method":"Echo","data":{}}`)
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestRegisterDynamicErrors(t *testing.T) {
+	streaming := anyServiceFiles()
+	streaming.File[1].Service[0].Method[0].ServerStreaming = proto.Bool(true)
+	invalid := anyServiceFiles()
+	invalid.File = invalid.File[1:]
+	tests := []struct {
+		name  string
+		fdset *descriptorpb.FileDescriptorSet
+		h     DynamicHandler
+	}{
+		{"nil handler", anyServiceFiles(), nil},
+		{"streaming method", streaming, echoDynamic},
+		{"missing dependency", invalid, echoDynamic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if err := s.RegisterDynamic(tt.fdset, tt.h); err == nil {
+				t.Fatal("err = nil")
+			}
+			if ids := s.Methods(); len(ids) != 0 {
+				t.Errorf("registered %v", ids)
+			}
+		})
+	}
+
+	s := NewServer()
+	if err := s.RegisterDynamic(anyServiceFiles(), echoDynamic); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterDynamic(anyServiceFiles(), echoDynamic); err == nil {
+		t.Error("registering twice: err = nil")
+	}
+}
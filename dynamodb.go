@@ -0,0 +1,238 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+const dynamoDBEventSource = "aws:dynamodb"
+
+type DynamoDBEvent struct {
+	Records []DynamoDBEventRecord `json:"Records"`
+}
+
+type DynamoDBEventRecord struct {
+	EventID        string               `json:"eventID"`
+	EventName      string               `json:"eventName"`
+	EventVersion   string               `json:"eventVersion"`
+	EventSource    string               `json:"eventSource"`
+	EventSourceARN string               `json:"eventSourceARN"`
+	AWSRegion      string               `json:"awsRegion"`
+	DynamoDB       DynamoDBStreamRecord `json:"dynamodb"`
+}
+
+type DynamoDBStreamRecord struct {
+	ApproximateCreationDateTime float64                    `json:"ApproximateCreationDateTime"`
+	Keys                        map[string]json.RawMessage `json:"Keys"`
+	NewImage                    map[string]json.RawMessage `json:"NewImage"`
+	OldImage                    map[string]json.RawMessage `json:"OldImage"`
+	SequenceNumber              string                     `json:"SequenceNumber"`
+	SizeBytes                   int64                      `json:"SizeBytes"`
+	StreamViewType              string                     `json:"StreamViewType"`
+}
+
+type dynamoDBRoute struct {
+	table     string
+	eventName string
+}
+
+// WithDynamoDBRoute dispatches stream records of eventName ("INSERT",
+// "MODIFY" or "REMOVE") on table to method id. The request is the record's
+// new image, or its old image for REMOVE, converted to plain JSON.
+func WithDynamoDBRoute(table string, eventName string, id MethodID) ServerOption {
+	return func(o *options) {
+		if o.dynamoDBRoutes == nil {
+			o.dynamoDBRoutes = map[dynamoDBRoute]MethodID{}
+		}
+		o.dynamoDBRoutes[dynamoDBRoute{table: table, eventName: eventName}] = id
+	}
+}
+
+// WithStrictDynamoDBRouting makes records without a route fail instead of
+// being skipped.
+func WithStrictDynamoDBRouting() ServerOption {
+	return func(o *options) {
+		o.dynamoDBStrict = true
+	}
+}
+
+// RunDynamoDBStreams serves DynamoDB Streams events using the routes given by
+// WithDynamoDBRoute. Like RunKinesis it stops at the first failed record and
+// reports it in batchItemFailures.
+func (s *Server) RunDynamoDBStreams() {
+	s.RunDynamoDBStreamsWithContext(context.Background())
+}
+
+func (s *Server) RunDynamoDBStreamsWithContext(c context.Context) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.handleDynamoDBStreams(c, eventMsg, ctx)
+	})
+}
+
+func (s *Server) handleDynamoDBStreams(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (*BatchResponse, error) {
+	var event DynamoDBEvent
+	if err := json.Unmarshal(eventMsg, &event); err != nil || len(event.Records) == 0 {
+		return nil, invalidEventf("invalid DynamoDB Streams event")
+	}
+	return processOrdered(len(event.Records), func(i int) string {
+		return event.Records[i].DynamoDB.SequenceNumber
+	}, func(i int) error {
+		return s.processDynamoDBRecord(c, &event.Records[i], ctx)
+	}), nil
+}
+
+func (s *Server) processDynamoDBRecord(c context.Context, record *DynamoDBEventRecord, ctx *apex.Context) error {
+	if record.EventSource != dynamoDBEventSource {
+		return codedErrorf(codes.InvalidArgument, "record %s is not a DynamoDB Streams record", record.EventID)
+	}
+	table := dynamoDBTableName(record.EventSourceARN)
+	id, ok := s.opts.dynamoDBRoutes[dynamoDBRoute{table: table, eventName: record.EventName}]
+	if !ok {
+		if s.opts.dynamoDBStrict {
+			return codedErrorf(codes.Unimplemented, "no route for %s on table %s", record.EventName, table)
+		}
+		return nil
+	}
+	image := record.DynamoDB.NewImage
+	if record.EventName == "REMOVE" || image == nil {
+		image = record.DynamoDB.OldImage
+	}
+	if image == nil {
+		image = record.DynamoDB.Keys
+	}
+	data, err := ConvertAttributeValueMap(image)
+	if err != nil {
+		return codedErrorf(codes.InvalidArgument, "invalid image in record %s: %v", record.EventID, err)
+	}
+	event := methodEvent(id, data)
+	event.Metadata = map[string][]string{
+		"x-dynamodb-table":      {table},
+		"x-dynamodb-event-name": {record.EventName},
+	}
+	_, err = s.processEvent(c, &event, ctx)
+	return err
+}
+
+// dynamoDBTableName extracts the table from a stream ARN such as
+// arn:aws:dynamodb:us-east-1:123456789012:table/users/stream/2020-01-01T00:00:00.000.
+func dynamoDBTableName(arn string) string {
+	i := strings.Index(arn, ":table/")
+	if i < 0 {
+		return ""
+	}
+	table := arn[i+len(":table/"):]
+	if j := strings.Index(table, "/"); j >= 0 {
+		table = table[:j]
+	}
+	return table
+}
+
+// processOrdered processes n records in order and stops at the first failure,
+// which is the checkpoint reported for stream event sources.
+func processOrdered(n int, id func(i int) string, fn func(i int) error) *BatchResponse {
+	res := &BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+	for i := 0; i < n; i++ {
+		if err := fn(i); err != nil {
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: id(i)})
+			break
+		}
+	}
+	return res
+}
+
+// ConvertAttributeValueMap converts a DynamoDB item in AttributeValue JSON,
+// e.g. {"id": {"S": "1"}}, into plain JSON such as {"id": "1"}.
+func ConvertAttributeValueMap(item map[string]json.RawMessage) (json.RawMessage, error) {
+	m := make(map[string]interface{}, len(item))
+	for k, av := range item {
+		v, err := ConvertAttributeValue(av)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %v", k, err)
+		}
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// ConvertAttributeValue converts one AttributeValue into a value that
+// encoding/json marshals as plain JSON. Numbers keep their exact text and
+// binary values stay base64 encoded.
+func ConvertAttributeValue(av json.RawMessage) (interface{}, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(av, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("attribute value must have exactly one type, got %d", len(typed))
+	}
+	for typ, raw := range typed {
+		switch typ {
+		case "S", "B":
+			var v string
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		case "N":
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, err
+			}
+			return json.Number(v), nil
+		case "BOOL":
+			var v bool
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		case "NULL":
+			return nil, nil
+		case "SS", "BS":
+			var v []string
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		case "NS":
+			var v []string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, err
+			}
+			nums := make([]json.Number, len(v))
+			for i, n := range v {
+				nums[i] = json.Number(n)
+			}
+			return nums, nil
+		case "M":
+			var v map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, err
+			}
+			m := make(map[string]interface{}, len(v))
+			for k, elem := range v {
+				ev, err := ConvertAttributeValue(elem)
+				if err != nil {
+					return nil, fmt.Errorf("attribute %q: %v", k, err)
+				}
+				m[k] = ev
+			}
+			return m, nil
+		case "L":
+			var v []json.RawMessage
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, err
+			}
+			l := make([]interface{}, len(v))
+			for i, elem := range v {
+				ev, err := ConvertAttributeValue(elem)
+				if err != nil {
+					return nil, fmt.Errorf("index %d: %v", i, err)
+				}
+				l[i] = ev
+			}
+			return l, nil
+		default:
+			return nil, fmt.Errorf("unsupported attribute value type %q", typ)
+		}
+	}
+	return nil, nil
+}
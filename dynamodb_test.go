@@ -0,0 +1,67 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const dynamoDBStreamARN = "arn:aws:dynamodb:us-east-1:000000000000:table/users/stream/2020-01-01T00:00:00.000"
+
+func TestDynamoDBStreams(t *testing.T) {
+	type call struct{ event, message, count string }
+	var calls []call
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ := metadata.FromIncomingContext(c)
+		b, _ := json.Marshal(req.Get(echoRequestMD.Fields().ByName("count")).Int())
+		calls = append(calls, call{md.Get("x-dynamodb-event-name")[0], stringField(req, "message"), string(b)})
+		return echoReply(req), nil
+	}}
+	id := NewMethodID("", echoService, "Echo")
+	s := newEchoServerWith(t, srv, WithDynamoDBRoute("users", "INSERT", id), WithDynamoDBRoute("users", "REMOVE", id))
+	event := `{"Records":[
+		{"eventName":"INSERT","eventSource":"aws:dynamodb","eventSourceARN":"` + dynamoDBStreamARN + `",
+		 "dynamodb":{"SequenceNumber":"1","NewImage":{"message":{"S":"new"},"count":{"N":"2"}}}},
+		{"eventName":"MODIFY","eventSource":"aws:dynamodb","eventSourceARN":"` + dynamoDBStreamARN + `",
+		 "dynamodb":{"SequenceNumber":"2","NewImage":{"message":{"S":"skipped"}}}},
+		{"eventName":"REMOVE","eventSource":"aws:dynamodb","eventSourceARN":"` + dynamoDBStreamARN + `",
+		 "dynamodb":{"SequenceNumber":"3","OldImage":{"message":{"S":"old"}}}}
+	]}`
+	res, err := s.handleDynamoDBStreams(context.Background(), json.RawMessage(event), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BatchItemFailures) != 0 {
+		t.Errorf("failures = %+v", res.BatchItemFailures)
+	}
+	want := []call{{"INSERT", "new", "2"}, {"REMOVE", "old", "0"}}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("calls = %+v, want %+v", calls, want)
+	}
+
+	s = newEchoServerWith(t, srv, WithDynamoDBRoute("users", "INSERT", id), WithStrictDynamoDBRouting())
+	res, err = s.handleDynamoDBStreams(context.Background(), json.RawMessage(event), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BatchItemFailures) != 1 || res.BatchItemFailures[0].ItemIdentifier != "2" {
+		t.Errorf("strict routing failures = %+v, want the MODIFY record", res.BatchItemFailures)
+	}
+}
+
+func TestConvertAttributeValueMap(t *testing.T) {
+	item := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(`{"s":{"S":"x"},"n":{"N":"1.5"},"b":{"BOOL":true},"null":{"NULL":true},
+		"l":{"L":[{"S":"a"},{"N":"2"}]},"m":{"M":{"k":{"S":"v"}}},"ss":{"SS":["a","b"]}}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ConvertAttributeValueMap(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, string(got), `{"s":"x","n":1.5,"b":true,"null":null,"l":["a",2],"m":{"k":"v"},"ss":["a","b"]}`)
+}
@@ -0,0 +1,166 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+const (
+	EncodingJSON        = "json"
+	EncodingProtoBase64 = "proto-base64"
+)
+
+// EncodedResponse is returned to Lambda for events whose data arrived in a
+// non-JSON encoding. Data is a string, or an array of strings for
+// server-streaming methods.
+type EncodedResponse struct {
+	Data     interface{} `json:"data"`
+	Encoding string      `json:"encoding"`
+}
+
+type messageDecoder func(proto.Message) error
+
+func eventEncoding(event *Event) (string, error) {
+	if event.Encoding == nil || *event.Encoding == "" {
+		return EncodingJSON, nil
+	}
+	switch *event.Encoding {
+	case EncodingJSON, EncodingProtoBase64:
+		return *event.Encoding, nil
+	}
+	return "", codedErrorf(codes.InvalidArgument, "unsupported event encoding %q", *event.Encoding)
+}
+
+func (s *Server) newMessageDecoder(encoding string, data *json.RawMessage) messageDecoder {
+	if encoding == EncodingProtoBase64 {
+		return func(m proto.Message) error {
+			var encoded string
+			if data != nil {
+				if err := json.Unmarshal(*data, &encoded); err != nil {
+					return err
+				}
+			}
+			b, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return err
+			}
+			return s.redactDecodeError(unmarshalProto(b, m))
+		}
+	}
+	raw := []byte("{}")
+	if data != nil {
+		raw = *data
+	}
+	uo := s.unmarshalOptions()
+	return func(m proto.Message) error {
+		err := uo.Unmarshal(raw, messageV2(m))
+		if err == nil {
+			return nil
+		}
+		if fe := locateDecodeError(messageV2(m).ProtoReflect().Descriptor(), raw); fe != nil {
+			return fe
+		}
+		return s.redactDecodeError(unknownFieldError(m, err))
+	}
+}
+
+func (s *Server) newRequestDecoder(req *request) messageDecoder {
+	if req.msg != nil {
+		return newProtoDecoder(req.msg)
+	}
+	if req.codec != nil {
+		return newCodecDecoder(req.codec, req.data)
+	}
+	dec := s.newMessageDecoder(req.encoding, req.data)
+	if req.nested {
+		return nestedDecoder(dec)
+	}
+	return dec
+}
+
+// newProtoDecoder copies src into the handler's request message, merging
+// directly when the types match and going through the wire format otherwise.
+func newProtoDecoder(src proto.Message) messageDecoder {
+	return func(m proto.Message) error {
+		if reflect.TypeOf(m) == reflect.TypeOf(src) {
+			protov2.Merge(messageV2(m), messageV2(src))
+			return nil
+		}
+		b, err := marshalProto(src)
+		if err != nil {
+			return err
+		}
+		return unmarshalProto(b, m)
+	}
+}
+
+func (s *Server) encodeResult(encoding string, res *result) (interface{}, error) {
+	if res.payload != nil {
+		return res.payload, nil
+	}
+	if t := s.opts.transcoders[encoding]; t != nil {
+		return s.transcodeResult(t, encoding, res)
+	}
+	if !res.streaming {
+		if encoding != EncodingProtoBase64 {
+			return s.encodeJSONReply(res.id, res.reply)
+		}
+		return s.encodeReply(encoding, res.reply)
+	}
+	if encoding == EncodingProtoBase64 {
+		data := make([]string, len(res.replies))
+		for i, reply := range res.replies {
+			b, err := marshalProto(reply)
+			if err != nil {
+				return nil, err
+			}
+			data[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return &EncodedResponse{Data: data, Encoding: encoding}, nil
+	}
+	data := make([]json.RawMessage, len(res.replies))
+	for i, reply := range res.replies {
+		raw, err := s.encodeJSONReply(res.id, reply)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = raw
+	}
+	return data, nil
+}
+
+func (s *Server) encodeReply(encoding string, reply proto.Message) (interface{}, error) {
+	if encoding == EncodingProtoBase64 {
+		b, err := marshalProto(reply)
+		if err != nil {
+			return nil, err
+		}
+		return &EncodedResponse{
+			Data:     base64.StdEncoding.EncodeToString(b),
+			Encoding: encoding,
+		}, nil
+	}
+	return s.marshalReply(reply)
+}
+
+// limitResponse enforces WithMaxResponseBytes on encoded data, returning it
+// marshaled so that it is not encoded twice.
+func (s *Server) limitResponse(id MethodID, data interface{}) (interface{}, error) {
+	max := s.opts.maxResponseBytes
+	if max <= 0 {
+		return data, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, codedErrorf(codes.ResourceExhausted, "reply of method (%s) is %d bytes, exceeding the limit of %d bytes", id, len(b), max)
+	}
+	return json.RawMessage(b), nil
+}
@@ -0,0 +1,87 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func protoEvent(method, data string) string {
+	return fmt.Sprintf(`{"service":%q,"method":%q,"encoding":"proto-base64","data":%q}`, echoService, method, data)
+}
+
+func marshalEchoRequest(t *testing.T, js string) []byte {
+	t.Helper()
+	b, err := protov2.Marshal(newEchoRequest(t, js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestProtoBase64Encoding(t *testing.T) {
+	s := newEchoServer(t)
+	data := base64.StdEncoding.EncodeToString(marshalEchoRequest(t, `{"message":"hi","id":"9007199254740993"}`))
+	got, err := serve(t, s, protoEvent("Echo", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res EncodedResponse
+	if err := json.Unmarshal([]byte(got), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Encoding != EncodingProtoBase64 {
+		t.Errorf("encoding = %q, want %q", res.Encoding, EncodingProtoBase64)
+	}
+	b, err := base64.StdEncoding.DecodeString(res.Data.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := dynamicpb.NewMessage(echoReplyMD)
+	if err := protov2.Unmarshal(b, reply); err != nil {
+		t.Fatal(err)
+	}
+	if stringField(reply, "message") != "hi" || reply.Get(echoReplyMD.Fields().ByName("id")).Int() != 9007199254740993 {
+		t.Errorf("reply = %v", reply)
+	}
+
+	explicit := strings.Replace(echoEvent("Echo", `{"message":"hi"}`), `"data"`, `"encoding":"json","data"`, 1)
+	got, err = serve(t, s, explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+}
+
+func TestProtoBase64EncodingErrors(t *testing.T) {
+	s := newEchoServer(t)
+	valid := base64.StdEncoding.EncodeToString(marshalEchoRequest(t, `{"message":"hi"}`))
+	garbage := base64.StdEncoding.EncodeToString(append(marshalEchoRequest(t, `{"message":"hi"}`), 0xff, 0xff))
+	for _, tt := range []struct {
+		name, event string
+		code        codes.Code
+		err         string
+	}{
+		{"invalid base64", protoEvent("Echo", "not base64!"), codes.InvalidArgument, "invalid input data for method (apexgrpc.test.Echo/Echo)"},
+		{"trailing garbage", protoEvent("Echo", garbage), codes.InvalidArgument, "invalid input data for method (apexgrpc.test.Echo/Echo)"},
+		{"object data", fmt.Sprintf(`{"service":%q,"method":"Echo","encoding":"proto-base64","data":{}}`, echoService), codes.InvalidArgument, "expected a JSON string, got a JSON object"},
+		{"unsupported encoding", strings.Replace(protoEvent("Echo", valid), EncodingProtoBase64, "proto-hex", 1), codes.InvalidArgument, `unsupported event encoding "proto-hex"`},
+		{"unknown method", protoEvent("Nope", valid), codes.Unimplemented, "method handler not found - apexgrpc.test.Echo/Nope"},
+		{"unknown service", fmt.Sprintf(`{"service":"apexgrpc.test.Nope","method":"Echo","encoding":"proto-base64","data":%q}`, valid), codes.Unimplemented, "method handler not found - apexgrpc.test.Nope/Echo"},
+		{"malformed method", fmt.Sprintf(`{"method":"/apexgrpc.test.Echo/","encoding":"proto-base64","data":%q}`, valid), codes.InvalidArgument, `malformed method "/apexgrpc.test.Echo/"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := serve(t, s, tt.event)
+			assertCode(t, err, tt.code)
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/apex/go-apex"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"golang.org/x/net/context"
+)
+
+// ResponseEnvelope is returned by Run when WithResponseEnvelope is enabled.
+// Exactly one of Data and Error is set.
+type ResponseEnvelope struct {
+	Data  interface{}   `json:"data,omitempty"`
+	Error *ErrorBody    `json:"error,omitempty"`
+	Meta  *ResponseMeta `json:"meta"`
+}
+
+// ResponseMeta describes the invocation that produced a ResponseEnvelope.
+type ResponseMeta struct {
+	// RequestID is the Lambda request ID, if known.
+	RequestID string `json:"requestId,omitempty"`
+	// Method is the resolved method ID. It is omitted when the payload did not
+	// address exactly one method, e.g. for batches.
+	Method string `json:"method,omitempty"`
+	// DurationMS is the time spent serving the payload, in milliseconds.
+	DurationMS float64 `json:"durationMs"`
+}
+
+// WithResponseEnvelope makes Run return every response as a ResponseEnvelope,
+// including failures, which are reported in its error field instead of as
+// Lambda errors. Invoke is not affected.
+func WithResponseEnvelope() ServerOption {
+	return func(o *options) {
+		o.responseEnvelope = true
+	}
+}
+
+type envelopeKey struct{}
+
+// envelopeMethods collects the methods dispatched for one payload.
+type envelopeMethods struct {
+	mu  sync.Mutex
+	ids []MethodID
+}
+
+func recordEnvelopeMethod(c context.Context, id MethodID) {
+	m, ok := c.Value(envelopeKey{}).(*envelopeMethods)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	m.ids = append(m.ids, id)
+	m.mu.Unlock()
+}
+
+func (s *Server) handleEnvelope(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) *ResponseEnvelope {
+	start := time.Now()
+	methods, ok := c.Value(envelopeKey{}).(*envelopeMethods)
+	if !ok {
+		methods = &envelopeMethods{}
+		c = context.WithValue(c, envelopeKey{}, methods)
+	}
+	res, err := s.handle(c, eventMsg, ctx)
+	meta := &ResponseMeta{
+		RequestID:  requestID(c, ctx),
+		DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if len(methods.ids) == 1 && methods.ids[0] != "" {
+		meta.Method = methods.ids[0].String()
+	}
+	env := &ResponseEnvelope{Data: res, Meta: meta}
+	if err != nil {
+		if payload, ok := mappedPayload(err); ok {
+			env.Data = payload
+		} else {
+			env.Data = nil
+			env.Error = s.newErrorResponse(err).Error
+		}
+	}
+	return env
+}
+
+func requestID(c context.Context, ctx *apex.Context) string {
+	if ctx != nil {
+		return ctx.RequestID
+	}
+	if lc, ok := lambdacontext.FromContext(c); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func serveEnvelope(t *testing.T, s *Server, event string) map[string]json.RawMessage {
+	t.Helper()
+	got, err := serve(t, s, event)
+	if err != nil {
+		t.Fatalf("enveloped responses must not fail: %v", err)
+	}
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(got), &env); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	s := newEchoServer(t, WithResponseEnvelope())
+
+	env := serveEnvelope(t, s, echoEvent("Echo", `{"message":"hi"}`))
+	assertJSON(t, string(env["data"]), `{"message":"hi"}`)
+	if _, ok := env["error"]; ok {
+		t.Errorf("envelope has an error: %s", env["error"])
+	}
+	var meta ResponseMeta
+	if err := json.Unmarshal(env["meta"], &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.RequestID != "test-request" || meta.Method != "apexgrpc.test.Echo/Echo" || meta.DurationMS < 0 {
+		t.Errorf("meta = %+v", meta)
+	}
+
+	env = serveEnvelope(t, s, echoEvent("Fail", `{"count":5,"message":"gone"}`))
+	if _, ok := env["data"]; ok {
+		t.Errorf("failed envelope has data: %s", env["data"])
+	}
+	var body ErrorBody
+	if err := json.Unmarshal(env["error"], &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.GRPCCode != codes.NotFound || body.Message != "gone" {
+		t.Errorf("error = %+v", body)
+	}
+	if err := json.Unmarshal(env["meta"], &meta); err != nil || meta.Method != "apexgrpc.test.Echo/Fail" {
+		t.Errorf("meta = %+v (%v)", meta, err)
+	}
+
+	env = serveEnvelope(t, s, `{"service":"apexgrpc.test.Echo"}`)
+	if err := json.Unmarshal(env["error"], &body); err != nil || body.GRPCCode != codes.InvalidArgument {
+		t.Errorf("error = %+v (%v)", body, err)
+	}
+	if _, ok := env["meta"]; !ok {
+		t.Error("envelope lacks meta")
+	}
+
+	reply, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{"message": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := reply.(*dynamicpb.Message); !ok || stringField(m, "message") != "hi" {
+		t.Errorf("Invoke reply = %v, want the bare reply", reply)
+	}
+}
@@ -0,0 +1,258 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	ErrInvalidEvent   = errors.New("invalid event")
+	ErrMissingService = errors.New("event missing service")
+	ErrMissingMethod  = errors.New("event missing method")
+)
+
+// MethodNotFoundError is returned when no handler is registered for ID.
+type MethodNotFoundError struct {
+	ID MethodID
+}
+
+func (e *MethodNotFoundError) Error() string {
+	return fmt.Sprintf("method handler not found - %s", e.ID)
+}
+
+func (e *MethodNotFoundError) GRPCStatus() *status.Status {
+	return status.New(codes.Unimplemented, e.Error())
+}
+
+// DecodeError is returned when the input data for ID cannot be decoded into
+// its request message. When the offending value is known, Field is a JSON
+// pointer to it within the data, Expected the proto type of its field and Got
+// its JSON type.
+type DecodeError struct {
+	ID       MethodID
+	Err      error
+	Field    string
+	Expected string
+	Got      string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid input data for method (%s): %v", e.ID, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus reports e with a google.rpc.BadRequest detail naming Field, if
+// known.
+func (e *DecodeError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, e.Error())
+	if e.Field == "" {
+		return st
+	}
+	detailed, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       e.Field,
+			Description: fmt.Sprintf("expected %s, got %s", e.Expected, e.Got),
+		}},
+	})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// ValidationError is returned when the request for ID is rejected by the
+// RequestValidator.
+type ValidationError struct {
+	ID  MethodID
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid request for method (%s): %v", e.ID, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// codedError carries a gRPC code for status.FromError while keeping a plain
+// error message. err, when set, is exposed to errors.Is and errors.As.
+type codedError struct {
+	code codes.Code
+	msg  string
+	err  error
+}
+
+func codedErrorf(code codes.Code, format string, a ...interface{}) error {
+	return &codedError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+// wrapCodedf is codedErrorf for an error that wraps err.
+func wrapCodedf(code codes.Code, err error, format string, a ...interface{}) error {
+	return &codedError{code: code, msg: fmt.Sprintf(format, a...), err: err}
+}
+
+// invalidEventf reports an undecodable event as ErrInvalidEvent.
+func invalidEventf(format string, a ...interface{}) error {
+	return wrapCodedf(codes.InvalidArgument, ErrInvalidEvent, format, a...)
+}
+
+func (e *codedError) Error() string {
+	return e.msg
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func (e *codedError) GRPCStatus() *status.Status {
+	return status.New(e.code, e.msg)
+}
+
+var codeNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// CodeName returns the canonical proto name of a gRPC code, e.g. "NOT_FOUND".
+func CodeName(code codes.Code) string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+	return codeNames[codes.Unknown]
+}
+
+type ErrorResponse struct {
+	Error *ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code     string            `json:"code"`
+	GRPCCode codes.Code        `json:"grpc_code"`
+	Message  string            `json:"message"`
+	Details  []json.RawMessage `json:"details,omitempty"`
+}
+
+// Code returns the gRPC code reported for err, looking through wrapped errors.
+// It returns codes.OK for a nil error.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	return errorStatus(err).Code()
+}
+
+// errorStatus converts any error into a status, looking through wrapped errors
+// for one that carries a gRPC status. Errors without one, or that claim
+// codes.OK, are reported as codes.Unknown.
+func errorStatus(err error) *status.Status {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return status.New(codes.Unknown, err.Error())
+	}
+	st := se.GRPCStatus()
+	if st.Code() == codes.OK {
+		return status.New(codes.Unknown, err.Error())
+	}
+	return st
+}
+
+func (s *Server) newErrorResponse(err error) *ErrorResponse {
+	return newErrorResponse(err, s.marshalOptions().Resolver)
+}
+
+// newErrorResponse describes err, encoding its status details in the proto3
+// JSON form of google.protobuf.Any. Details whose type resolver cannot
+// resolve are left out.
+func newErrorResponse(err error, resolver typeResolver) *ErrorResponse {
+	return &ErrorResponse{Error: statusBody(errorStatus(err), resolver)}
+}
+
+func (s *Server) statusBody(st *status.Status) *ErrorBody {
+	return statusBody(st, s.marshalOptions().Resolver)
+}
+
+func statusBody(st *status.Status, resolver typeResolver) *ErrorBody {
+	body := &ErrorBody{
+		Code:     CodeName(st.Code()),
+		GRPCCode: st.Code(),
+		Message:  st.Message(),
+	}
+	mo := protojson.MarshalOptions{Resolver: resolver}
+	for _, detail := range st.Proto().GetDetails() {
+		b, err := marshalJSON(mo, detail)
+		if err != nil {
+			continue
+		}
+		body.Details = append(body.Details, b)
+	}
+	return body
+}
+
+// MappedError is returned when an ErrorMapper replaced the error of a call
+// with a payload. Run returns Payload as the Lambda result, and Invoke callers
+// can retrieve it with errors.As.
+type MappedError struct {
+	Payload interface{}
+	Err     error
+}
+
+func (e *MappedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MappedError) Unwrap() error {
+	return e.Err
+}
+
+func (s *Server) mapError(c context.Context, id MethodID, err error) error {
+	if s.opts.errorMapper == nil {
+		return err
+	}
+	payload, mapped := s.opts.errorMapper(c, id, err)
+	if mapped == nil {
+		mapped = err
+	}
+	if payload != nil {
+		return &MappedError{Payload: payload, Err: mapped}
+	}
+	return mapped
+}
+
+// mappedPayload returns the payload an ErrorMapper substituted for err.
+func mappedPayload(err error) (interface{}, bool) {
+	var me *MappedError
+	if !errors.As(err, &me) {
+		return nil, false
+	}
+	return me.Payload, true
+}
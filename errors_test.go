@@ -0,0 +1,100 @@
+package apexgrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestErrorValues(t *testing.T) {
+	s := newEchoServer(t)
+	c := context.Background()
+
+	_, err := s.InvokeEvent(c, &Event{Method: stringPtr("Echo")})
+	if !errors.Is(err, ErrMissingService) {
+		t.Errorf("missing service: err = %v, want ErrMissingService", err)
+	}
+	_, err = s.InvokeEvent(c, &Event{Service: stringPtr(echoService)})
+	if !errors.Is(err, ErrMissingMethod) {
+		t.Errorf("missing method: err = %v, want ErrMissingMethod", err)
+	}
+
+	_, err = s.Invoke(c, "", echoService, "Nope", map[string]string{})
+	var nf *MethodNotFoundError
+	if !errors.As(err, &nf) || nf.ID != NewMethodID("", echoService, "Nope") {
+		t.Errorf("unknown method: err = %v, want a MethodNotFoundError", err)
+	}
+	assertCode(t, err, codes.Unimplemented)
+
+	_, err = s.Invoke(c, "", echoService, "Echo", map[string]interface{}{"count": "many"})
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Field != "/count" {
+		t.Errorf("invalid data: err = %#v, want a DecodeError for /count", err)
+	}
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestErrorMapper(t *testing.T) {
+	var seen MethodID
+	s := newEchoServer(t, WithErrorMapper(func(c context.Context, id MethodID, err error) (interface{}, error) {
+		seen = id
+		if status.Code(err) == codes.NotFound {
+			return map[string]string{"result": "missing"}, nil
+		}
+		return nil, status.Error(codes.Unavailable, "mapped")
+	}))
+	got, err := serve(t, s, echoEvent("Fail", `{"count":5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"result":"missing"}`)
+	if seen != NewMethodID("", echoService, "Fail") {
+		t.Errorf("mapper saw method %q", seen)
+	}
+
+	_, err = s.Invoke(context.Background(), "", echoService, "Fail", map[string]int{"count": 5})
+	var me *MappedError
+	if !errors.As(err, &me) || me.Payload == nil {
+		t.Errorf("Invoke: err = %v, want a MappedError with the payload", err)
+	}
+
+	_, err = serve(t, s, echoEvent("Fail", `{"count":13}`))
+	assertCode(t, err, codes.Unavailable)
+}
+
+func TestStatusDetails(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "bad").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "message", Description: "required"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		return nil, st.Err()
+	}}, WithStructuredErrors())
+	got, err := serve(t, s, echoEvent("Echo", `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"error":{"code":"INVALID_ARGUMENT","grpc_code":3,"message":"bad","details":[
+		{"@type":"type.googleapis.com/google.rpc.BadRequest","fieldViolations":[{"field":"message","description":"required"}]}]}}`)
+
+	_, err = s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+	details := status.Convert(err).Details()
+	if len(details) != 1 {
+		t.Fatalf("Invoke error details = %v", details)
+	}
+	if br, ok := details[0].(*errdetails.BadRequest); !ok || br.FieldViolations[0].Field != "message" {
+		t.Errorf("Invoke error detail = %v", details[0])
+	}
+}
@@ -0,0 +1,288 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+)
+
+// WithStrictEventParsing rejects Events with top-level fields the Event type
+// does not define, naming them, instead of ignoring them.
+func WithStrictEventParsing() ServerOption {
+	return func(o *options) {
+		o.strictEvents = true
+	}
+}
+
+// WithRequireData fails events without data, or with null data, with
+// codes.InvalidArgument instead of decoding an empty request. Methods given to
+// WithDataOptional are exempt.
+func WithRequireData() ServerOption {
+	return func(o *options) {
+		o.requireData = true
+	}
+}
+
+// WithDataOptional lets events for ids omit data under WithRequireData.
+func WithDataOptional(ids ...MethodID) ServerOption {
+	return func(o *options) {
+		if o.dataOptional == nil {
+			o.dataOptional = map[MethodID]bool{}
+		}
+		for _, id := range ids {
+			o.dataOptional[id] = true
+		}
+	}
+}
+
+// eventFields are the JSON names of the fields of Event.
+var eventFields = func() []string {
+	t := reflect.TypeOf(Event{})
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}()
+
+// decodeEvent decodes raw into an Event, rejecting unknown fields if strict.
+// The error describes what is wrong with raw.
+func decodeEvent(raw []byte, strict bool) (Event, error) {
+	var event Event
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(&event)
+	if err == nil {
+		if _, terr := dec.Token(); terr != io.EOF {
+			return Event{}, fmt.Errorf("unexpected data after the event at offset %d", dec.InputOffset())
+		}
+		event.raw = raw
+		return event, nil
+	}
+	var se *json.SyntaxError
+	switch {
+	case errors.As(err, &se):
+		return Event{}, fmt.Errorf("%v at offset %d", se, se.Offset)
+	case strict && strings.HasPrefix(err.Error(), "json: unknown field "):
+		return Event{}, fmt.Errorf("unexpected fields %s", strings.Join(unknownEventKeys(raw), ", "))
+	}
+	return Event{}, err
+}
+
+// eventKeys returns the top-level keys of raw, sorted.
+func eventKeys(raw []byte) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unknownEventKeys(raw []byte) []string {
+	var unknown []string
+	for _, k := range eventKeys(raw) {
+		if !isEventField(k) {
+			unknown = append(unknown, fmt.Sprintf("%q", k))
+		}
+	}
+	return unknown
+}
+
+// isEventField matches key like encoding/json does, ignoring case.
+func isEventField(key string) bool {
+	for _, name := range eventFields {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// keysHint describes the top-level keys a decoded event was sent with, for
+// errors about missing fields.
+func keysHint(event *Event) string {
+	if event.raw == nil {
+		return ""
+	}
+	keys := eventKeys(event.raw)
+	if len(keys) == 0 {
+		return " (event has no fields)"
+	}
+	return fmt.Sprintf(" (event has fields %s)", strings.Join(keys, ", "))
+}
+
+// WithSingleMessageStreams lets events for client-streaming methods carry a
+// single request in place of an array, as a stream of one message.
+func WithSingleMessageStreams() ServerOption {
+	return func(o *options) {
+		o.singleMessageStreams = true
+	}
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// normalizeData strips a UTF-8 byte order mark, which HTTP clients may send
+// before a body, from the event data, and wraps a single request for a
+// client-streaming method in an array when WithSingleMessageStreams is set.
+func (s *Server) normalizeData(id MethodID, encoding string, event *Event) *Event {
+	if event.Data == nil {
+		return event
+	}
+	data := bytes.TrimPrefix(*event.Data, utf8BOM)
+	if s.opts.singleMessageStreams {
+		h, ok := s.handler(id)
+		trimmed := bytes.TrimLeft(data, " \t\r\n")
+		single := byte('{')
+		if encoding == EncodingProtoBase64 {
+			single = '"'
+		}
+		if ok && h.streamDesc != nil && h.streamDesc.ClientStreams && len(trimmed) > 0 && trimmed[0] == single {
+			data = append(append([]byte{'['}, data...), ']')
+		}
+	}
+	if len(data) == len(*event.Data) {
+		return event
+	}
+	e := *event
+	raw := json.RawMessage(data)
+	e.Data = &raw
+	return &e
+}
+
+// isNullData reports whether data is absent or JSON null.
+func isNullData(data *json.RawMessage) bool {
+	return data == nil || string(bytes.TrimSpace(*data)) == "null"
+}
+
+// WithNestedJSONStrings accepts the request of a method as a JSON string
+// holding the JSON object, as some SNS and Step Functions integrations deliver
+// it. Methods taking a stream of requests, or a well-known type whose JSON form
+// is not an object, such as google.protobuf.StringValue, are not affected.
+func WithNestedJSONStrings() ServerOption {
+	return func(o *options) {
+		o.nestedJSONStrings = true
+	}
+}
+
+// unnestData replaces JSON string data with its contents under
+// WithNestedJSONStrings, reporting whether it did.
+func (s *Server) unnestData(id MethodID, encoding string, event *Event) (*Event, bool, error) {
+	if !s.opts.nestedJSONStrings || encoding != EncodingJSON || event.Data == nil {
+		return event, false, nil
+	}
+	if trimmed := bytes.TrimLeft(*event.Data, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '"' {
+		return event, false, nil
+	}
+	h, ok := s.handler(id)
+	if !ok || h.descriptor == nil || h.descriptor.IsStreamingClient() || messageJSONKinds(h.descriptor.Input()) != "{" {
+		return event, false, nil
+	}
+	var str string
+	if err := json.Unmarshal(*event.Data, &str); err != nil {
+		return event, false, nil
+	}
+	inner := bytes.TrimSpace([]byte(str))
+	var v json.RawMessage
+	if err := json.Unmarshal(inner, &v); err != nil {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			err = fmt.Errorf("%v at offset %d", se, se.Offset)
+		}
+		return nil, false, &DecodeError{ID: id, Err: fmt.Errorf("expected a JSON object, got a JSON string whose contents are not valid JSON: %v", err)}
+	}
+	if inner[0] != '{' {
+		return nil, false, &DecodeError{ID: id, Err: fmt.Errorf("expected a JSON object, got a JSON string holding %s", jsonKind(inner[0]))}
+	}
+	e := *event
+	raw := json.RawMessage(inner)
+	e.Data = &raw
+	return &e, true, nil
+}
+
+// nestedDecoder notes in errors of dec that the data was decoded from the
+// contents of a JSON string.
+func nestedDecoder(dec messageDecoder) messageDecoder {
+	return func(m proto.Message) error {
+		if err := dec(m); err != nil {
+			return fmt.Errorf("data is a JSON string, not an object; decoding its contents as JSON failed: %w", err)
+		}
+		return nil
+	}
+}
+
+func (s *Server) checkRequiredData(id MethodID, data *json.RawMessage) error {
+	if !s.opts.requireData || s.opts.dataOptional[id] || !isNullData(data) {
+		return nil
+	}
+	return codedErrorf(codes.InvalidArgument, "method (%s) requires a request body", id)
+}
+
+// checkData rejects request data for h whose JSON type cannot hold the
+// request: an object, or the JSON form of a well-known type, an array of
+// requests for client-streaming methods, and strings in place of messages
+// encoded as proto-base64.
+func checkData(id MethodID, h handler, encoding string, data *json.RawMessage) error {
+	if data == nil {
+		return nil
+	}
+	var v json.RawMessage
+	if err := json.Unmarshal(*data, &v); err != nil {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			return &DecodeError{ID: id, Err: fmt.Errorf("%v at offset %d of data", se, se.Offset)}
+		}
+		return &DecodeError{ID: id, Err: err}
+	}
+	offset := len(*data) - len(bytes.TrimLeft(*data, " \t\r\n"))
+	want := "{"
+	switch {
+	case h.streamDesc != nil && h.streamDesc.ClientStreams:
+		want = "["
+	case encoding == EncodingProtoBase64:
+		want = `"`
+	case h.descriptor != nil:
+		want = messageJSONKinds(h.descriptor.Input())
+	}
+	got := jsonValueKind(*data)
+	if want == "" || strings.IndexByte(want, got) >= 0 {
+		return nil
+	}
+	expected := jsonKind(want[0])
+	if len(want) > 1 {
+		expected = "the JSON form of " + string(h.descriptor.Input().FullName())
+	}
+	return &DecodeError{ID: id, Err: fmt.Errorf("expected %s, got %s at offset %d of data", expected, jsonKind(got), offset)}
+}
+
+func jsonKind(c byte) string {
+	switch c {
+	case '{':
+		return "a JSON object"
+	case '[':
+		return "a JSON array"
+	case '"':
+		return "a JSON string"
+	case 't', 'f':
+		return "a JSON boolean"
+	case 'n':
+		return "null"
+	}
+	return "a JSON number"
+}
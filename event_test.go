@@ -0,0 +1,232 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestDataShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		data   string
+		err    string
+	}{
+		{"array for unary", "Echo", `[{"message":"a"}]`, "expected a JSON object, got a JSON array at offset 0"},
+		{"string for unary", "Echo", ` "hi"`, "expected a JSON object, got a JSON string at offset 0"},
+		{"array for server stream", "Split", `[]`, "expected a JSON object, got a JSON array"},
+		{"object for client stream", "Join", "\n{}", "expected a JSON array, got a JSON object at offset 0"},
+	}
+	s := newEchoServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := serve(t, s, echoEvent(tt.method, tt.data))
+			assertCode(t, err, codes.InvalidArgument)
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+	got, err := serve(t, s, echoEvent("Echo", " \n\t{\"message\":\"hi\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+}
+
+func TestSingleMessageStreams(t *testing.T) {
+	s := newEchoServer(t, WithSingleMessageStreams())
+	for _, data := range []string{`{"message":"a"}`, `[{"message":"a"}]`} {
+		got, err := serve(t, s, echoEvent("Join", data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSON(t, got, `{"message":"a","count":1}`)
+	}
+	_, err := serve(t, s, echoEvent("Echo", `[{"message":"a"}]`))
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestDataBOM(t *testing.T) {
+	s := newEchoServer(t)
+	event, _ := json.Marshal(APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/apexgrpc.test.Echo/Echo", Body: "\ufeff{\"message\":\"hi\"}"})
+	res := s.handleAPIGateway(context.Background(), event, testApexContext())
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", res.StatusCode, res.Body)
+	}
+	assertJSON(t, res.Body, `{"message":"hi"}`)
+}
+
+func TestStrictEventParsing(t *testing.T) {
+	event := `{"svc":"apexgrpc.test.Echo","mtd":"Echo","data":{}}`
+	_, err := serve(t, newEchoServer(t), event)
+	assertCode(t, err, codes.InvalidArgument)
+	if !strings.Contains(err.Error(), "event missing service (event has fields data, mtd, svc)") {
+		t.Errorf("err = %v", err)
+	}
+
+	s := newEchoServer(t, WithStrictEventParsing())
+	_, err = serve(t, s, event)
+	assertCode(t, err, codes.InvalidArgument)
+	if !strings.Contains(err.Error(), `unexpected fields "mtd", "svc"`) {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := serve(t, s, `{"Service":"apexgrpc.test.Echo","METHOD":"Echo"}`); err != nil {
+		t.Errorf("fields matched without case: %v", err)
+	}
+
+	_, err = serve(t, s, echoEvent("Echo", `{}`)+`{}`)
+	assertCode(t, err, codes.InvalidArgument)
+	if !strings.Contains(err.Error(), "unexpected data after the event") {
+		t.Errorf("err = %v", err)
+	}
+	_, err = serve(t, s, `{"service":}`)
+	assertCode(t, err, codes.InvalidArgument)
+	if !strings.Contains(err.Error(), "at offset 12") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRequireData(t *testing.T) {
+	dataless := func(method string) string {
+		return `{"service":"apexgrpc.test.Echo","method":"` + method + `"}`
+	}
+	nullData := func(method string) string { return echoEvent(method, `null`) }
+	for _, event := range []func(string) string{dataless, nullData} {
+		got, err := serve(t, newEchoServer(t), event("Echo"))
+		if err != nil {
+			t.Fatalf("%s: %v", event("Echo"), err)
+		}
+		assertJSON(t, got, `{}`)
+
+		s := newEchoServer(t, WithRequireData(), WithDataOptional(NewMethodID("", echoService, "Fail")))
+		_, err = serve(t, s, event("Echo"))
+		assertCode(t, err, codes.InvalidArgument)
+		if want := "method (apexgrpc.test.Echo/Echo) requires a request body"; !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want %q", err, want)
+		}
+		_, err = serve(t, s, event("Fail"))
+		assertCode(t, err, codes.OK)
+	}
+}
+
+// wellKnownServiceFiles describes apexgrpc.wkttest.WellKnown, whose methods
+// take and return well-known types:
+//
+//	service WellKnown {
+//	  rpc String(google.protobuf.StringValue) returns (google.protobuf.StringValue);
+//	  rpc Struct(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	  rpc Value(google.protobuf.Value) returns (google.protobuf.Value);
+//	}
+func wellKnownServiceFiles() *descriptorpb.FileDescriptorSet {
+	methods := []*descriptorpb.MethodDescriptorProto{}
+	for name, typ := range map[string]string{"String": "StringValue", "Struct": "Struct", "Value": "Value"} {
+		methods = append(methods, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".google.protobuf." + typ),
+			OutputType: proto.String(".google.protobuf." + typ),
+		})
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(wrapperspb.File_google_protobuf_wrappers_proto),
+		protodesc.ToFileDescriptorProto(structpb.File_google_protobuf_struct_proto),
+		{
+			Name:       proto.String("apexgrpc/test/wkt.proto"),
+			Package:    proto.String("apexgrpc.wkttest"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"google/protobuf/wrappers.proto", "google/protobuf/struct.proto"},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name:   proto.String("WellKnown"),
+				Method: methods,
+			}},
+		},
+	}}
+}
+
+func newWellKnownServer(t *testing.T, opts ...ServerOption) *Server {
+	t.Helper()
+	s := NewServer(opts...)
+	if err := s.RegisterDynamic(wellKnownServiceFiles(), echoDynamic); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func wellKnownEvent(method, data string) string {
+	return `{"service":"apexgrpc.wkttest.WellKnown","method":"` + method + `","data":` + data + `}`
+}
+
+func TestWellKnownRequestData(t *testing.T) {
+	s := newWellKnownServer(t)
+	for _, tt := range []struct{ method, data string }{
+		{"String", `"hi"`},
+		{"Struct", `{"a":1}`},
+		{"Value", `3`},
+		{"Value", `[true]`},
+	} {
+		got, err := serve(t, s, wellKnownEvent(tt.method, tt.data))
+		if err != nil {
+			t.Fatalf("%s(%s): %v", tt.method, tt.data, err)
+		}
+		assertJSON(t, got, tt.data)
+	}
+	for _, tt := range []struct{ method, data, err string }{
+		{"String", `{}`, "expected a JSON string, got a JSON object"},
+		{"Struct", `[]`, "expected a JSON object, got a JSON array"},
+	} {
+		_, err := serve(t, s, wellKnownEvent(tt.method, tt.data))
+		assertCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s(%s): err = %v, want %q", tt.method, tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestNestedJSONStrings(t *testing.T) {
+	nested := `"{\"message\":\"hi\"}"`
+	_, err := serve(t, newEchoServer(t), echoEvent("Echo", nested))
+	assertCode(t, err, codes.InvalidArgument)
+
+	s := newEchoServer(t, WithNestedJSONStrings())
+	got, err := serve(t, s, echoEvent("Echo", nested))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+	for data, want := range map[string]string{
+		`"{\"message\":"`:      "whose contents are not valid JSON",
+		`"[1]"`:                "got a JSON string holding a JSON array",
+		`"{\"message\":1}"`:    "data is a JSON string, not an object; decoding its contents as JSON failed",
+		`"{\"unknown\":true}"`: "decoding its contents as JSON failed",
+	} {
+		_, err := serve(t, s, echoEvent("Echo", data))
+		assertCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("data %s: err = %v, want %q", data, err, want)
+		}
+	}
+
+	// Requests whose JSON form is a string keep it; other well-known
+	// messages are unnested like any message.
+	s = newWellKnownServer(t, WithNestedJSONStrings())
+	got, err = serve(t, s, wellKnownEvent("String", `"{\"a\":1}"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `"{\"a\":1}"`)
+	got, err = serve(t, s, wellKnownEvent("Struct", `"{\"a\":1}"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"a":1}`)
+}
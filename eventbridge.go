@@ -0,0 +1,108 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	scheduledEventSource     = "aws.events"
+	scheduledEventDetailType = "Scheduled Event"
+)
+
+// EventBridgeEvent is the envelope EventBridge (CloudWatch Events) delivers to
+// rule targets.
+type EventBridgeEvent struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       string          `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// EventBridgeFallback handles events that match no route.
+type EventBridgeFallback func(c context.Context, event *EventBridgeEvent) (interface{}, error)
+
+type eventBridgeRoute struct {
+	source     string
+	detailType string
+}
+
+// EventBridgeRouter maps (source, detail-type) pairs to methods. The event's
+// detail is the request of the routed method.
+type EventBridgeRouter struct {
+	routes          map[eventBridgeRoute]MethodID
+	fallback        EventBridgeFallback
+	ignoreScheduled bool
+}
+
+func NewEventBridgeRouter() *EventBridgeRouter {
+	return &EventBridgeRouter{
+		routes: map[eventBridgeRoute]MethodID{},
+	}
+}
+
+func (r *EventBridgeRouter) Route(source string, detailType string, id MethodID) *EventBridgeRouter {
+	r.routes[eventBridgeRoute{source: source, detailType: detailType}] = id
+	return r
+}
+
+// Fallback sets the handler for events without a route. Without one they
+// fail with codes.Unimplemented.
+func (r *EventBridgeRouter) Fallback(f EventBridgeFallback) *EventBridgeRouter {
+	r.fallback = f
+	return r
+}
+
+// IgnoreScheduledEvents treats unrouted scheduled events ("aws.events",
+// "Scheduled Event") as warmup pings that succeed without doing anything.
+func (r *EventBridgeRouter) IgnoreScheduledEvents() *EventBridgeRouter {
+	r.ignoreScheduled = true
+	return r
+}
+
+// RunEventBridge serves EventBridge events according to r.
+func (s *Server) RunEventBridge(r *EventBridgeRouter) {
+	s.RunEventBridgeWithContext(context.Background(), r)
+}
+
+func (s *Server) RunEventBridgeWithContext(c context.Context, r *EventBridgeRouter) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.handleEventBridge(c, r, eventMsg, ctx)
+	})
+}
+
+func (s *Server) handleEventBridge(c context.Context, r *EventBridgeRouter, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+	var eb EventBridgeEvent
+	if err := json.Unmarshal(eventMsg, &eb); err != nil || eb.Source == "" {
+		return nil, invalidEventf("invalid EventBridge event")
+	}
+	id, ok := r.routes[eventBridgeRoute{source: eb.Source, detailType: eb.DetailType}]
+	if !ok {
+		if r.ignoreScheduled && eb.Source == scheduledEventSource && eb.DetailType == scheduledEventDetailType {
+			return nil, nil
+		}
+		if r.fallback != nil {
+			return r.fallback(c, &eb)
+		}
+		return nil, codedErrorf(codes.Unimplemented, "no route for EventBridge event %s/%s", eb.Source, eb.DetailType)
+	}
+	event := methodEvent(id, eb.Detail)
+	event.Metadata = map[string][]string{
+		"x-eventbridge-id":          {eb.ID},
+		"x-eventbridge-source":      {eb.Source},
+		"x-eventbridge-detail-type": {eb.DetailType},
+	}
+	res, err := s.processEvent(c, &event, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.encodeResult(EncodingJSON, res)
+}
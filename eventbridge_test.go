@@ -0,0 +1,70 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestEventBridgeRouter(t *testing.T) {
+	var md metadata.MD
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ = metadata.FromIncomingContext(c)
+		return echoReply(req), nil
+	}})
+	var fallback *EventBridgeEvent
+	r := NewEventBridgeRouter().
+		Route("myapp.orders", "OrderPlaced", NewMethodID("", echoService, "Echo")).
+		Route("myapp.orders", "OrderFailed", NewMethodID("", echoService, "Fail"))
+	handle := func(r *EventBridgeRouter, event string) (string, error) {
+		res, err := s.handleEventBridge(context.Background(), r, json.RawMessage(event), testApexContext())
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b), nil
+	}
+
+	got, err := handle(r, `{"id":"e1","source":"myapp.orders","detail-type":"OrderPlaced","detail":{"message":"order"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"order"}`)
+	if md.Get("x-eventbridge-id")[0] != "e1" || md.Get("x-eventbridge-source")[0] != "myapp.orders" || md.Get("x-eventbridge-detail-type")[0] != "OrderPlaced" {
+		t.Errorf("metadata = %v", md)
+	}
+	_, err = handle(r, `{"source":"myapp.orders","detail-type":"OrderFailed","detail":{"count":9}}`)
+	assertCode(t, err, codes.FailedPrecondition)
+
+	scheduled := `{"source":"aws.events","detail-type":"Scheduled Event","detail":{}}`
+	_, err = handle(r, scheduled)
+	assertCode(t, err, codes.Unimplemented)
+	_, err = handle(r, `{"source":"other","detail-type":"Other","detail":{}}`)
+	assertCode(t, err, codes.Unimplemented)
+	_, err = handle(r, `{"detail":{}}`)
+	assertCode(t, err, codes.InvalidArgument)
+
+	r.IgnoreScheduledEvents().Fallback(func(c context.Context, event *EventBridgeEvent) (interface{}, error) {
+		fallback = event
+		return map[string]string{"handled": event.DetailType}, nil
+	})
+	if got, err := handle(r, scheduled); err != nil || got != "null" {
+		t.Errorf("scheduled event = %s, %v, want a no-op", got, err)
+	}
+	if fallback != nil {
+		t.Error("scheduled event reached the fallback")
+	}
+	got, err = handle(r, `{"source":"other","detail-type":"Other","detail":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"handled":"Other"}`)
+}
@@ -0,0 +1,40 @@
+package apexgrpc
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// UnknownMethodHandler handles events addressed to a method that is not
+// registered, e.g. to forward them to another function. Its result is
+// returned like a reply: a proto.Message is encoded as one, and any other
+// value is returned to Lambda as is.
+type UnknownMethodHandler func(c context.Context, event *Event) (interface{}, error)
+
+// WithUnknownMethodHandler calls h instead of failing events addressed to a
+// method that is not registered. Logs, metrics and hooks see the calls under
+// the method ID the event addressed.
+func WithUnknownMethodHandler(h UnknownMethodHandler) ServerOption {
+	return func(o *options) {
+		o.unknownMethodHandler = h
+	}
+}
+
+func (s *Server) callUnknownMethod(c context.Context, id MethodID, event *Event) (res *result, err error) {
+	start := time.Now()
+	defer func() {
+		s.recordInvocation(id, "", time.Since(start), err)
+	}()
+	defer s.recoverPanic(c, id, &err)
+	payload, err := s.opts.unknownMethodHandler(c, event)
+	if err != nil {
+		return nil, err
+	}
+	res = &result{id: id, payload: payload}
+	if msg, ok := payload.(proto.Message); ok {
+		res.reply, res.payload = msg, nil
+	}
+	return res, nil
+}
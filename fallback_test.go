@@ -0,0 +1,87 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnknownMethodHandler(t *testing.T) {
+	_, err := serve(t, newEchoServer(t), echoEvent("Gone", `{}`))
+	assertCode(t, err, codes.Unimplemented)
+
+	var buf bytes.Buffer
+	var got *Event
+	rec := &MemoryRecorder{}
+	s := newEchoServer(t,
+		WithMetricsRecorder(rec),
+		WithLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug)),
+		WithUnknownMethodHandler(func(c context.Context, event *Event) (interface{}, error) {
+			got = event
+			switch *event.Method {
+			case "Deprecated":
+				return map[string]string{"deprecated": *event.Method}, nil
+			case "Reply":
+				return newEchoRequest(t, `{"message":"fallback"}`), nil
+			}
+			return nil, status.Error(codes.NotFound, "no such method")
+		}),
+	)
+
+	res, err := serve(t, s, echoEvent("Deprecated", `{"message":"raw"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, res, `{"deprecated":"Deprecated"}`)
+	if got == nil || got.Service == nil || *got.Service != echoService || got.Data == nil || !strings.Contains(string(*got.Data), `"raw"`) {
+		t.Errorf("fallback event = %+v", got)
+	}
+
+	res, err = serve(t, s, echoEvent("Reply", `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, res, `{"message":"fallback"}`)
+
+	_, err = serve(t, s, echoEvent("Missing", `{}`))
+	assertCode(t, err, codes.NotFound)
+
+	if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+		t.Fatalf("registered method: %v", err)
+	}
+	records := rec.Records()
+	want := []struct {
+		id   MethodID
+		code codes.Code
+	}{
+		{NewMethodID("", echoService, "Deprecated"), codes.OK},
+		{NewMethodID("", echoService, "Reply"), codes.OK},
+		{NewMethodID("", echoService, "Missing"), codes.NotFound},
+		{NewMethodID("", echoService, "Echo"), codes.OK},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %+v", records)
+	}
+	for i, w := range want {
+		if records[i].ID != w.id || records[i].Code != w.code {
+			t.Errorf("record %d = %+v, want %s %v", i, records[i], w.id, w.code)
+		}
+	}
+	if !strings.Contains(buf.String(), "apexgrpc.test.Echo/Missing") {
+		t.Errorf("fallback errors are not logged:\n%s", buf.String())
+	}
+}
+
+func TestUnknownMethodHandlerPanic(t *testing.T) {
+	s := newEchoServer(t, WithUnknownMethodHandler(func(context.Context, *Event) (interface{}, error) {
+		panic(errors.New("fallback"))
+	}))
+	_, err := serve(t, s, echoEvent("Gone", `{}`))
+	assertCode(t, err, codes.Internal)
+}
@@ -0,0 +1,137 @@
+package apexgrpc
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldTree is a parsed field mask: the selected fields of a message by name,
+// each with the selected fields of its own message. An empty subtree selects
+// the whole field.
+type fieldTree map[protoreflect.Name]fieldTree
+
+// parseFieldMask parses comma-separated field mask paths such as
+// "name,address.city" against md. Paths use proto field names; the JSON names
+// are accepted too. Only the last field of a path may be repeated or a map.
+func parseFieldMask(md protoreflect.MessageDescriptor, mask string) (fieldTree, error) {
+	tree := fieldTree{}
+	for _, path := range strings.Split(mask, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		names, err := resolveFieldPath(md, path)
+		if err != nil {
+			return nil, err
+		}
+		tree.add(names)
+	}
+	return tree, nil
+}
+
+// resolveFieldPath returns the field names along path, starting at md.
+func resolveFieldPath(md protoreflect.MessageDescriptor, path string) ([]protoreflect.Name, error) {
+	var names []protoreflect.Name
+	desc := md
+	for _, seg := range strings.Split(path, ".") {
+		if desc == nil {
+			return nil, codedErrorf(codes.InvalidArgument, "field mask path %q selects inside a field that is not a singular message", path)
+		}
+		fd := lookupField(desc, seg)
+		if fd == nil {
+			return nil, codedErrorf(codes.InvalidArgument, "field mask path %q names unknown field %q of %s", path, seg, desc.FullName())
+		}
+		names = append(names, fd.Name())
+		desc = nil
+		if !fd.IsList() && !fd.IsMap() && (fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind) {
+			desc = fd.Message()
+		}
+	}
+	return names, nil
+}
+
+// add selects the field at names. Selecting a whole field drops narrower
+// selections inside it.
+func (t fieldTree) add(names []protoreflect.Name) {
+	node := t
+	for i, name := range names {
+		child, ok := node[name]
+		if ok && len(child) == 0 {
+			return
+		}
+		if i == len(names)-1 {
+			node[name] = fieldTree{}
+			return
+		}
+		if !ok {
+			child = fieldTree{}
+			node[name] = child
+		}
+		node = child
+	}
+}
+
+func lookupField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+// apply clears the fields of m the tree does not select.
+func (t fieldTree) apply(m protoreflect.Message) {
+	var clear []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		sub, ok := t[fd.Name()]
+		switch {
+		case !ok:
+			clear = append(clear, fd)
+		case len(sub) > 0:
+			sub.apply(m.Mutable(fd).Message())
+		}
+		return true
+	})
+	for _, fd := range clear {
+		m.Clear(fd)
+	}
+}
+
+// filterReply returns a copy of reply with only the fields the mask selects.
+func filterReply(reply proto.Message, tree fieldTree) proto.Message {
+	if reply == nil {
+		return nil
+	}
+	clone := cloneProto(reply)
+	tree.apply(messageV2(clone).ProtoReflect())
+	return clone
+}
+
+// filterResult applies the field mask of an event to the replies of res.
+func filterResult(id MethodID, res *result, mask string) (*result, error) {
+	var md protoreflect.MessageDescriptor
+	switch {
+	case res.reply != nil:
+		md = messageV2(res.reply).ProtoReflect().Descriptor()
+	case len(res.replies) > 0:
+		md = messageV2(res.replies[0]).ProtoReflect().Descriptor()
+	default:
+		return res, nil
+	}
+	tree, err := parseFieldMask(md, mask)
+	if err != nil {
+		return nil, wrapCodedf(codes.InvalidArgument, err, "invalid fields for method (%s): %v", id, err)
+	}
+	filtered := *res
+	filtered.reply = filterReply(res.reply, tree)
+	if res.replies != nil {
+		filtered.replies = make([]proto.Message, len(res.replies))
+		for i, reply := range res.replies {
+			filtered.replies[i] = filterReply(reply, tree)
+		}
+	}
+	return &filtered, nil
+}
@@ -0,0 +1,81 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFilterReply(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       protov2.String("a.proto"),
+		Package:    protov2.String("a"),
+		Dependency: []string{"b.proto", "c.proto"},
+		Options: &descriptorpb.FileOptions{
+			JavaPackage: protov2.String("com.a"),
+			GoPackage:   protov2.String("a/pb"),
+		},
+	}
+	tests := []struct {
+		name string
+		mask string
+		want *descriptorpb.FileDescriptorProto
+	}{
+		{"top level", "name, package", &descriptorpb.FileDescriptorProto{Name: file.Name, Package: file.Package}},
+		{"nested", "options.java_package", &descriptorpb.FileDescriptorProto{Options: &descriptorpb.FileOptions{JavaPackage: file.Options.JavaPackage}}},
+		{"JSON names", "options.goPackage", &descriptorpb.FileDescriptorProto{Options: &descriptorpb.FileOptions{GoPackage: file.Options.GoPackage}}},
+		{"whole message", "options,options.java_package", &descriptorpb.FileDescriptorProto{Options: file.Options}},
+		{"repeated", "dependency", &descriptorpb.FileDescriptorProto{Dependency: file.Dependency}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parseFieldMask(file.ProtoReflect().Descriptor(), tt.mask)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filterReply(file, tree); !protov2.Equal(messageV2(got), tt.want) {
+				t.Errorf("filtered to %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if len(file.Dependency) != 2 || file.Name == nil {
+		t.Errorf("the reply itself was changed: %v", file)
+	}
+}
+
+func TestFilterReplyOneof(t *testing.T) {
+	v := structpb.NewStringValue("x")
+	for mask, kept := range map[string]bool{"string_value": true, "number_value": false} {
+		tree, err := parseFieldMask(v.ProtoReflect().Descriptor(), mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := messageV2(filterReply(v, tree)).(*structpb.Value)
+		if (got.GetKind() != nil) != kept {
+			t.Errorf("%s: kind = %v", mask, got.GetKind())
+		}
+	}
+}
+
+func TestParseFieldMaskErrors(t *testing.T) {
+	md := (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor()
+	for _, mask := range []string{"nope", "options.nope", "message_type.name", "name.length"} {
+		_, err := parseFieldMask(md, mask)
+		assertCode(t, err, codes.InvalidArgument)
+	}
+}
+
+func TestEventFields(t *testing.T) {
+	s := newEchoServer(t)
+	got, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","fields":"message,tags","data":{"message":"hi","count":2,"tags":["a"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi","tags":["a"]}`)
+
+	_, err = serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","fields":"bogus","data":{}}`)
+	assertCode(t, err, codes.InvalidArgument)
+}
@@ -0,0 +1,176 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+// FunctionURLRequest is the payload format 2.0 event delivered by Lambda
+// function URLs.
+type FunctionURLRequest struct {
+	Version               string                    `json:"version"`
+	RawPath               string                    `json:"rawPath"`
+	RawQueryString        string                    `json:"rawQueryString"`
+	Cookies               []string                  `json:"cookies,omitempty"`
+	Headers               map[string]string         `json:"headers"`
+	QueryStringParameters map[string]string         `json:"queryStringParameters,omitempty"`
+	RequestContext        FunctionURLRequestContext `json:"requestContext"`
+	Body                  string                    `json:"body,omitempty"`
+	IsBase64Encoded       bool                      `json:"isBase64Encoded"`
+}
+
+type FunctionURLRequestContext struct {
+	AccountID  string                        `json:"accountId"`
+	RequestID  string                        `json:"requestId"`
+	DomainName string                        `json:"domainName"`
+	TimeEpoch  int64                         `json:"timeEpoch"`
+	HTTP       FunctionURLRequestContextHTTP `json:"http"`
+	Authorizer *FunctionURLAuthorizer        `json:"authorizer,omitempty"`
+}
+
+// FunctionURLAuthorizer is set for function URLs with the AWS_IAM auth type.
+type FunctionURLAuthorizer struct {
+	IAM *FunctionURLIAMAuthorizer `json:"iam,omitempty"`
+}
+
+type FunctionURLIAMAuthorizer struct {
+	AccessKey string `json:"accessKey"`
+	AccountID string `json:"accountId"`
+	CallerID  string `json:"callerId"`
+	UserARN   string `json:"userArn"`
+	UserID    string `json:"userId"`
+}
+
+type FunctionURLRequestContextHTTP struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+type FunctionURLResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	Cookies         []string          `json:"cookies,omitempty"`
+}
+
+// ALBTargetGroupRequest is the event delivered by an Application Load
+// Balancer to a Lambda target.
+type ALBTargetGroupRequest struct {
+	HTTPMethod            string                       `json:"httpMethod"`
+	Path                  string                       `json:"path"`
+	QueryStringParameters map[string]string            `json:"queryStringParameters,omitempty"`
+	Headers               map[string]string            `json:"headers,omitempty"`
+	MultiValueHeaders     map[string][]string          `json:"multiValueHeaders,omitempty"`
+	RequestContext        ALBTargetGroupRequestContext `json:"requestContext"`
+	Body                  string                       `json:"body"`
+	IsBase64Encoded       bool                         `json:"isBase64Encoded"`
+}
+
+type ALBTargetGroupRequestContext struct {
+	ELB struct {
+		TargetGroupArn string `json:"targetGroupArn"`
+	} `json:"elb"`
+}
+
+type ALBTargetGroupResponse struct {
+	StatusCode        int               `json:"statusCode"`
+	StatusDescription string            `json:"statusDescription"`
+	Headers           map[string]string `json:"headers"`
+	Body              string            `json:"body"`
+	IsBase64Encoded   bool              `json:"isBase64Encoded"`
+}
+
+// RunFunctionURL serves Lambda function URL and ALB target events, routing
+// POST /pkg.Service/Method to the registered handler.
+func (s *Server) RunFunctionURL() {
+	s.RunFunctionURLWithContext(context.Background())
+}
+
+func (s *Server) RunFunctionURLWithContext(c context.Context) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.handleFunctionURL(c, eventMsg, ctx), nil
+	})
+}
+
+func (s *Server) handleFunctionURL(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) interface{} {
+	var probe struct {
+		RequestContext struct {
+			ELB *json.RawMessage `json:"elb"`
+		} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(eventMsg, &probe); err != nil {
+		return newFunctionURLResponse(newHTTPErrorResponse(http.StatusBadRequest, invalidEventf("invalid event")))
+	}
+	if probe.RequestContext.ELB != nil {
+		var req ALBTargetGroupRequest
+		if err := json.Unmarshal(eventMsg, &req); err != nil {
+			return newALBResponse(newHTTPErrorResponse(http.StatusBadRequest, invalidEventf("invalid event")))
+		}
+		return newALBResponse(s.serveHTTP(c, &httpRequest{
+			method:  req.HTTPMethod,
+			path:    req.Path,
+			query:   queryValues(req.QueryStringParameters, nil),
+			headers: headerMetadata(req.Headers, req.MultiValueHeaders),
+			body:    req.Body,
+			base64:  req.IsBase64Encoded,
+			identity: &CallerIdentity{
+				SourceIP: forwardedFor(req.Headers["x-forwarded-for"]),
+			},
+		}, "", ctx))
+	}
+	var req FunctionURLRequest
+	if err := json.Unmarshal(eventMsg, &req); err != nil {
+		return newFunctionURLResponse(newHTTPErrorResponse(http.StatusBadRequest, invalidEventf("invalid event")))
+	}
+	return newFunctionURLResponse(s.serveHTTP(c, &httpRequest{
+		method:   req.RequestContext.HTTP.Method,
+		path:     req.RawPath,
+		query:    rawQuery(req.RawQueryString),
+		headers:  headerMetadata(req.Headers, nil),
+		body:     req.Body,
+		base64:   req.IsBase64Encoded,
+		identity: functionURLIdentity(&req.RequestContext),
+	}, "", ctx))
+}
+
+func functionURLIdentity(rc *FunctionURLRequestContext) *CallerIdentity {
+	id := &CallerIdentity{SourceIP: rc.HTTP.SourceIP}
+	if rc.Authorizer != nil && rc.Authorizer.IAM != nil {
+		id.CallerARN = rc.Authorizer.IAM.UserARN
+		id.AccountID = rc.Authorizer.IAM.AccountID
+	}
+	return id
+}
+
+func rawQuery(raw string) url.Values {
+	q, _ := url.ParseQuery(raw)
+	return q
+}
+
+func newFunctionURLResponse(res *httpResponse) *FunctionURLResponse {
+	return &FunctionURLResponse{
+		StatusCode:      res.status,
+		Headers:         res.headers,
+		Body:            res.body,
+		IsBase64Encoded: res.base64,
+	}
+}
+
+func newALBResponse(res *httpResponse) *ALBTargetGroupResponse {
+	return &ALBTargetGroupResponse{
+		StatusCode:        res.status,
+		StatusDescription: fmt.Sprintf("%d %s", res.status, http.StatusText(res.status)),
+		Headers:           res.headers,
+		Body:              res.body,
+		IsBase64Encoded:   res.base64,
+	}
+}
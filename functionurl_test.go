@@ -0,0 +1,100 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func functionURLEvent(t *testing.T, req FunctionURLRequest) json.RawMessage {
+	t.Helper()
+	if req.RequestContext.HTTP.Method == "" {
+		req.RequestContext.HTTP.Method = http.MethodPost
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFunctionURL(t *testing.T) {
+	var md metadata.MD
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ = metadata.FromIncomingContext(c)
+		return echoReply(req), nil
+	}}, WithCORS("https://app.example.com"))
+	serveURL := func(req FunctionURLRequest) *FunctionURLResponse {
+		res, ok := s.handleFunctionURL(context.Background(), functionURLEvent(t, req), testApexContext()).(*FunctionURLResponse)
+		if !ok {
+			t.Fatal("response is not a *FunctionURLResponse")
+		}
+		return res
+	}
+
+	req := FunctionURLRequest{
+		RawPath:         "/apexgrpc.test.Echo/Echo",
+		Headers:         map[string]string{"x-client": "cli", "origin": "https://app.example.com"},
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"message":"hi"}`)),
+		IsBase64Encoded: true,
+	}
+	req.RequestContext.HTTP.SourceIP = "203.0.113.9"
+	req.RequestContext.Authorizer = &FunctionURLAuthorizer{IAM: &FunctionURLIAMAuthorizer{UserARN: "arn:aws:iam::000000000000:user/alice", AccountID: "000000000000"}}
+	res := serveURL(req)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Headers["Content-Type"], "application/json") {
+		t.Fatalf("response = %+v", res)
+	}
+	assertJSON(t, res.Body, `{"message":"hi"}`)
+	if res.Headers["Access-Control-Allow-Origin"] != "https://app.example.com" {
+		t.Errorf("headers = %v, want the allowed origin", res.Headers)
+	}
+	if md.Get("x-client")[0] != "cli" || md.Get(CallerARNMetadataKey)[0] != "arn:aws:iam::000000000000:user/alice" || md.Get(SourceIPMetadataKey)[0] != "203.0.113.9" {
+		t.Errorf("metadata = %v, want the headers and the caller identity", md)
+	}
+
+	tests := []struct {
+		name   string
+		req    FunctionURLRequest
+		status int
+	}{
+		{"handler error", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Fail", Body: `{"count":5}`}, http.StatusNotFound},
+		{"unknown method", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Nope"}, http.StatusNotFound},
+		{"invalid base64", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Echo", Body: "!", IsBase64Encoded: true}, http.StatusBadRequest},
+		{"GET", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Echo", RequestContext: FunctionURLRequestContext{HTTP: FunctionURLRequestContextHTTP{Method: http.MethodGet}}}, http.StatusMethodNotAllowed},
+		{"preflight", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Echo", Headers: map[string]string{"origin": "https://app.example.com"}, RequestContext: FunctionURLRequestContext{HTTP: FunctionURLRequestContextHTTP{Method: http.MethodOptions}}}, http.StatusNoContent},
+		{"preflight of another origin", FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Echo", Headers: map[string]string{"origin": "https://evil.example.com"}, RequestContext: FunctionURLRequestContext{HTTP: FunctionURLRequestContextHTTP{Method: http.MethodOptions}}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := serveURL(tt.req); res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", res.StatusCode, tt.status, res.Body)
+			}
+		})
+	}
+
+	bad, ok := s.handleFunctionURL(context.Background(), json.RawMessage(`[`), testApexContext()).(*FunctionURLResponse)
+	if !ok || bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed event = %+v, want 400", bad)
+	}
+}
+
+func TestALBTarget(t *testing.T) {
+	s := newEchoServer(t)
+	event := `{"httpMethod":"POST","path":"/apexgrpc.test.Echo/Echo","headers":{"x-forwarded-for":"198.51.100.1, 10.0.0.1"},
+		"requestContext":{"elb":{"targetGroupArn":"arn"}},"body":"{\"message\":\"alb\"}","isBase64Encoded":false}`
+	res, ok := s.handleFunctionURL(context.Background(), json.RawMessage(event), testApexContext()).(*ALBTargetGroupResponse)
+	if !ok {
+		t.Fatal("response is not an *ALBTargetGroupResponse")
+	}
+	if res.StatusCode != http.StatusOK || res.StatusDescription != "200 OK" {
+		t.Errorf("response = %+v", res)
+	}
+	assertJSON(t, res.Body, `{"message":"alb"}`)
+}
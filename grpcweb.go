@@ -0,0 +1,190 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	grpcWebDataFrame    byte = 0x00
+	grpcWebTrailerFrame byte = 0x80
+	grpcWebCompressed   byte = 0x01
+)
+
+// isGRPCWeb reports whether contentType is one of the gRPC-Web content types:
+// application/grpc-web and application/grpc-web-text, optionally suffixed with
+// +proto or +json.
+func isGRPCWeb(contentType string) bool {
+	return strings.HasPrefix(contentType, grpcWebContentType)
+}
+
+// grpcWebCodec is the negotiated flavor of a gRPC-Web request.
+type grpcWebCodec struct {
+	contentType string
+	text        bool
+	json        bool
+}
+
+func newGRPCWebCodec(contentType string) grpcWebCodec {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	return grpcWebCodec{
+		contentType: contentType,
+		text:        strings.HasPrefix(contentType, grpcWebTextContentType),
+		json:        strings.HasSuffix(contentType, "+json"),
+	}
+}
+
+// serveGRPCWeb serves a unary gRPC-Web call. The reply is the data frame
+// followed by the trailer frame; failures send the trailer frame alone. The
+// HTTP status is always 200, as gRPC-Web reports outcomes in the trailers.
+func (s *Server) serveGRPCWeb(c context.Context, req *httpRequest, svc string, mtd string, body []byte, ctx *apex.Context) *httpResponse {
+	codec := newGRPCWebCodec(req.header("content-type"))
+	if codec.text {
+		b, err := base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			return codec.response(nil, nil, nil, codedErrorf(codes.InvalidArgument, "invalid grpc-web-text body"))
+		}
+		body = b
+	}
+	msgs, err := parseGRPCWebFrames(body)
+	if err != nil {
+		return codec.response(nil, nil, nil, err)
+	}
+	if len(msgs) > 1 {
+		return codec.response(nil, nil, nil, codedErrorf(codes.Unimplemented, "client streaming is not supported over grpc-web"))
+	}
+	id, _ := s.resolve("", "", svc, mtd)
+	if h, ok := s.handler(id); ok && h.streamDesc != nil {
+		return codec.response(nil, nil, nil, codedErrorf(codes.Unimplemented, "streaming method (%s) is not supported over grpc-web", id))
+	}
+	event := Event{
+		Service:  &svc,
+		Method:   &mtd,
+		Metadata: req.headers,
+	}
+	if len(msgs) == 1 {
+		var data json.RawMessage
+		if codec.json {
+			data = msgs[0]
+		} else {
+			data, _ = json.Marshal(base64.StdEncoding.EncodeToString(msgs[0]))
+			encoding := EncodingProtoBase64
+			event.Encoding = &encoding
+		}
+		event.Data = &data
+	}
+	res, err := s.processEvent(c, &event, ctx)
+	if err != nil {
+		return codec.response(nil, nil, nil, err)
+	}
+	reply, err := res.unary()
+	if err != nil {
+		return codec.response(nil, res.header, res.trailer, err)
+	}
+	var msg []byte
+	if codec.json {
+		msg, err = s.marshalReply(reply)
+	} else {
+		msg, err = marshalProto(reply)
+	}
+	if err != nil {
+		return codec.response(nil, res.header, res.trailer, err)
+	}
+	return codec.response(msg, res.header, res.trailer, nil)
+}
+
+// parseGRPCWebFrames returns the messages of the length-prefixed data frames
+// of body.
+func parseGRPCWebFrames(body []byte) ([][]byte, error) {
+	var msgs [][]byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, codedErrorf(codes.InvalidArgument, "truncated grpc-web frame header")
+		}
+		flags := body[0]
+		n := binary.BigEndian.Uint32(body[1:5])
+		body = body[5:]
+		if uint64(n) > uint64(len(body)) {
+			return nil, codedErrorf(codes.InvalidArgument, "truncated grpc-web frame")
+		}
+		if flags&grpcWebCompressed != 0 {
+			return nil, codedErrorf(codes.Unimplemented, "compressed grpc-web messages are not supported")
+		}
+		if flags&grpcWebTrailerFrame == 0 {
+			msgs = append(msgs, body[:n])
+		}
+		body = body[n:]
+	}
+	return msgs, nil
+}
+
+func appendGRPCWebFrame(buf *bytes.Buffer, flags byte, payload []byte) {
+	var hdr [5]byte
+	hdr[0] = flags
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	buf.Write(hdr[:])
+	buf.Write(payload)
+}
+
+// response frames msg, if any, and the trailers reporting err.
+func (codec grpcWebCodec) response(msg []byte, header metadata.MD, trailer metadata.MD, err error) *httpResponse {
+	headers := map[string]string{"Content-Type": codec.contentType}
+	for k, vals := range encodeMetadata(header) {
+		headers[k] = strings.Join(vals, ", ")
+	}
+	var buf bytes.Buffer
+	if err == nil {
+		appendGRPCWebFrame(&buf, grpcWebDataFrame, msg)
+	}
+	appendGRPCWebFrame(&buf, grpcWebTrailerFrame, grpcWebTrailers(trailer, err))
+	res := &httpResponse{
+		status:  http.StatusOK,
+		headers: headers,
+		body:    base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}
+	if !codec.text {
+		res.base64 = true
+	}
+	return res
+}
+
+// grpcWebTrailers encodes the trailer frame payload as HTTP/1 header lines.
+func grpcWebTrailers(trailer metadata.MD, err error) []byte {
+	code, msg := codes.OK, ""
+	if err != nil {
+		st := errorStatus(err)
+		code, msg = st.Code(), st.Message()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", code)
+	fmt.Fprintf(&b, "grpc-message: %s\r\n", encodeGRPCMessage(msg))
+	md := encodeMetadata(trailer)
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	return []byte(b.String())
+}
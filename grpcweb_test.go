@@ -0,0 +1,165 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func grpcWebFrame(flags byte, payload string) []byte {
+	var buf bytes.Buffer
+	appendGRPCWebFrame(&buf, flags, []byte(payload))
+	return buf.Bytes()
+}
+
+type grpcWebFrameOut struct {
+	flags   byte
+	payload string
+}
+
+// grpcWebResponseFrames decodes the frames of a gRPC-Web response.
+func grpcWebResponseFrames(t *testing.T, res *httpResponse) []grpcWebFrameOut {
+	t.Helper()
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.status)
+	}
+	body, err := base64.StdEncoding.DecodeString(res.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []grpcWebFrameOut
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated response frame")
+		}
+		n := binary.BigEndian.Uint32(body[1:5])
+		frames = append(frames, grpcWebFrameOut{flags: body[0], payload: string(body[5 : 5+n])})
+		body = body[5+n:]
+	}
+	return frames
+}
+
+func TestParseGRPCWebFrames(t *testing.T) {
+	body := append(grpcWebFrame(grpcWebDataFrame, "one"), grpcWebFrame(grpcWebTrailerFrame, "grpc-status: 0\r\n")...)
+	msgs, err := parseGRPCWebFrames(append(body, grpcWebFrame(grpcWebDataFrame, "")...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[0]) != "one" || len(msgs[1]) != 0 {
+		t.Errorf("messages = %q, want the data frames only", msgs)
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+		code codes.Code
+	}{
+		{"truncated header", grpcWebFrame(grpcWebDataFrame, "one")[:3], codes.InvalidArgument},
+		{"truncated frame", grpcWebFrame(grpcWebDataFrame, "one")[:7], codes.InvalidArgument},
+		{"compressed", grpcWebFrame(grpcWebCompressed, "one"), codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGRPCWebFrames(tt.body)
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestServeGRPCWeb(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		grpc.SetHeader(c, metadata.Pairs("x-header", "h"))
+		grpc.SetTrailer(c, metadata.Pairs("x-trailer", "t"))
+		return echoReply(req), nil
+	}})
+	call := func(method, contentType string, body []byte) *httpResponse {
+		b := base64.StdEncoding.EncodeToString(body)
+		return s.serveHTTP(context.Background(), &httpRequest{
+			method:  http.MethodPost,
+			path:    "/apexgrpc.test.Echo/" + method,
+			headers: map[string][]string{"content-type": {contentType}},
+			body:    b,
+			base64:  !strings.HasPrefix(contentType, grpcWebTextContentType),
+		}, "", testApexContext())
+	}
+
+	t.Run("json", func(t *testing.T) {
+		res := call("Echo", "application/grpc-web+json", grpcWebFrame(grpcWebDataFrame, `{"message":"hi"}`))
+		frames := grpcWebResponseFrames(t, res)
+		if len(frames) != 2 || frames[0].flags != grpcWebDataFrame || frames[1].flags != grpcWebTrailerFrame {
+			t.Fatalf("frames = %+v, want a data and a trailer frame", frames)
+		}
+		assertJSON(t, frames[0].payload, `{"message":"hi"}`)
+		if frames[1].payload != "grpc-status: 0\r\ngrpc-message: \r\nx-trailer: t\r\n" {
+			t.Errorf("trailers = %q", frames[1].payload)
+		}
+		if res.headers["Content-Type"] != "application/grpc-web+json" || res.headers["x-header"] != "h" {
+			t.Errorf("headers = %v", res.headers)
+		}
+	})
+
+	t.Run("proto", func(t *testing.T) {
+		req, err := protov2.Marshal(newEchoRequest(t, `{"message":"bin","count":2}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames := grpcWebResponseFrames(t, call("Echo", "application/grpc-web+proto", grpcWebFrame(grpcWebDataFrame, string(req))))
+		if len(frames) != 2 {
+			t.Fatalf("frames = %+v", frames)
+		}
+		reply := dynamicpb.NewMessage(echoReplyMD)
+		if err := protov2.Unmarshal([]byte(frames[0].payload), reply); err != nil {
+			t.Fatal(err)
+		}
+		if stringField(reply, "message") != "bin" {
+			t.Errorf("reply = %v", reply)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		res := call("Echo", "application/grpc-web-text+json", grpcWebFrame(grpcWebDataFrame, `{"message":"text"}`))
+		if res.base64 {
+			t.Error("grpc-web-text response is marked binary")
+		}
+		frames := grpcWebResponseFrames(t, res)
+		if len(frames) != 2 {
+			t.Fatalf("frames = %+v", frames)
+		}
+		assertJSON(t, frames[0].payload, `{"message":"text"}`)
+	})
+
+	errorTests := []struct {
+		name    string
+		method  string
+		body    []byte
+		trailer string
+	}{
+		{"handler error", "Fail", grpcWebFrame(grpcWebDataFrame, `{"count":5,"message":"gone"}`), "grpc-status: 5\r\ngrpc-message: gone\r\n"},
+		{"streaming method", "Split", grpcWebFrame(grpcWebDataFrame, `{}`), "grpc-status: 12\r\n"},
+		{"client streaming", "Echo", append(grpcWebFrame(grpcWebDataFrame, `{}`), grpcWebFrame(grpcWebDataFrame, `{}`)...), "grpc-status: 12\r\n"},
+		{"truncated", "Echo", grpcWebFrame(grpcWebDataFrame, `{}`)[:6], "grpc-status: 3\r\n"},
+		{"compressed", "Echo", grpcWebFrame(grpcWebCompressed, `{}`), "grpc-status: 12\r\n"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := grpcWebResponseFrames(t, call(tt.method, "application/grpc-web+json", tt.body))
+			if len(frames) != 1 || frames[0].flags != grpcWebTrailerFrame {
+				t.Fatalf("frames = %+v, want a trailer-only response", frames)
+			}
+			if !strings.HasPrefix(frames[0].payload, tt.trailer) {
+				t.Errorf("trailers = %q, want prefix %q", frames[0].payload, tt.trailer)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const ContentEncodingGzip = "gzip"
+
+// DefaultMaxDecompressedBytes is the default limit on the decompressed size of
+// gzip request data.
+const DefaultMaxDecompressedBytes = 20 << 20
+
+// ErrDecompressedTooLarge is wrapped by a *DecompressError when request data
+// decompresses to more than the limit set with WithMaxDecompressedBytes, or
+// with WithMaxRequestBytes if that is lower.
+var ErrDecompressedTooLarge = errors.New("decompressed data exceeds the limit")
+
+// DecompressError is returned when the gzip request data for ID is corrupt or
+// too large. It is reported as codes.ResourceExhausted if Err wraps
+// ErrDecompressedTooLarge and as codes.InvalidArgument otherwise.
+type DecompressError struct {
+	ID  MethodID
+	Err error
+}
+
+func (e *DecompressError) Error() string {
+	return fmt.Sprintf("invalid gzip data for method (%s): %v", e.ID, e.Err)
+}
+
+func (e *DecompressError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecompressError) GRPCStatus() *status.Status {
+	code := codes.InvalidArgument
+	if errors.Is(e.Err, ErrDecompressedTooLarge) {
+		code = codes.ResourceExhausted
+	}
+	return status.New(code, e.Error())
+}
+
+// CompressedResponse is returned to Lambda for events with "acceptEncoding":
+// "gzip". Data is the base64 encoded gzip of the reply as it would otherwise
+// be returned.
+type CompressedResponse struct {
+	Data            string `json:"data"`
+	ContentEncoding string `json:"contentEncoding"`
+}
+
+// WithMaxDecompressedBytes limits the decompressed size of gzip request data to
+// n bytes instead of DefaultMaxDecompressedBytes.
+func WithMaxDecompressedBytes(n int) ServerOption {
+	return func(o *options) {
+		o.maxDecompressedBytes = n
+	}
+}
+
+// decompressData returns event with its gzip data decompressed.
+func (s *Server) decompressData(id MethodID, event *Event) (*Event, error) {
+	if event.ContentEncoding == nil || *event.ContentEncoding == "" {
+		return event, nil
+	}
+	if *event.ContentEncoding != ContentEncodingGzip {
+		return nil, codedErrorf(codes.InvalidArgument, "unsupported event content encoding %q", *event.ContentEncoding)
+	}
+	max := s.opts.maxDecompressedBytes
+	if max <= 0 {
+		max = DefaultMaxDecompressedBytes
+	}
+	if n := s.opts.maxRequestBytes; n > 0 && n < max {
+		max = n
+	}
+	b, err := gunzipData(event.Data, max)
+	if err != nil {
+		return nil, &DecompressError{ID: id, Err: err}
+	}
+	e := *event
+	raw := json.RawMessage(b)
+	if s.binaryEncoding(event) {
+		raw, _ = json.Marshal(base64.StdEncoding.EncodeToString(b))
+	}
+	e.Data, e.ContentEncoding = &raw, nil
+	return &e, nil
+}
+
+func gunzipData(data *json.RawMessage, max int) ([]byte, error) {
+	var s string
+	if data != nil {
+		if err := json.Unmarshal(*data, &s); err != nil {
+			return nil, errors.New("data must be a base64 string")
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > max {
+		return nil, ErrDecompressedTooLarge
+	}
+	return out, nil
+}
+
+// compressResponse gzips data for events that accept it.
+func compressResponse(event *Event, data interface{}) (interface{}, error) {
+	if event.AcceptEncoding == nil || *event.AcceptEncoding != ContentEncodingGzip {
+		return data, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &CompressedResponse{
+		Data:            base64.StdEncoding.EncodeToString(buf.Bytes()),
+		ContentEncoding: ContentEncodingGzip,
+	}, nil
+}
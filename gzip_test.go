@@ -0,0 +1,96 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func gzipBase64(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func gzipEvent(method, data string) string {
+	return fmt.Sprintf(`{"service":%q,"method":%q,"contentEncoding":"gzip","data":%q}`, echoService, method, data)
+}
+
+func TestGzipRequestData(t *testing.T) {
+	s := newEchoServer(t)
+	got, err := serve(t, s, gzipEvent("Echo", gzipBase64(t, `{"message":"zipped"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"zipped"}`)
+
+	for name, event := range map[string]string{
+		"not base64":   gzipEvent("Echo", "!!"),
+		"not gzip":     gzipEvent("Echo", base64.StdEncoding.EncodeToString([]byte(`{}`))),
+		"not a string": fmt.Sprintf(`{"service":%q,"method":"Echo","contentEncoding":"gzip","data":{}}`, echoService),
+		"unsupported":  fmt.Sprintf(`{"service":%q,"method":"Echo","contentEncoding":"br","data":"AA=="}`, echoService),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := serve(t, s, event)
+			assertCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestGzipDecompressedLimit(t *testing.T) {
+	bomb := gzipBase64(t, `{"message":"`+strings.Repeat("a", 1<<10)+`"}`)
+
+	_, err := serve(t, newEchoServer(t, WithMaxDecompressedBytes(512)), gzipEvent("Echo", bomb))
+	assertCode(t, err, codes.ResourceExhausted)
+	var derr *DecompressError
+	if !errors.As(err, &derr) || !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("error = %#v, want a DecompressError wrapping ErrDecompressedTooLarge", err)
+	}
+
+	// A lower request size limit stops decompression early.
+	_, err = serve(t, newEchoServer(t, WithMaxRequestBytes(512)), gzipEvent("Echo", bomb))
+	assertCode(t, err, codes.ResourceExhausted)
+	if !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("error = %v, want ErrDecompressedTooLarge", err)
+	}
+
+	if _, err := serve(t, newEchoServer(t), gzipEvent("Echo", bomb)); err != nil {
+		t.Errorf("default limit: %v", err)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	s := newEchoServer(t)
+	event := fmt.Sprintf(`{"service":%q,"method":"Echo","acceptEncoding":"gzip","data":{"message":"hi"}}`, echoService)
+	got, err := serve(t, s, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res CompressedResponse
+	if err := json.Unmarshal([]byte(got), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ContentEncoding != ContentEncodingGzip {
+		t.Errorf("contentEncoding = %q", res.ContentEncoding)
+	}
+	raw := json.RawMessage(fmt.Sprintf("%q", res.Data))
+	b, err := gunzipData(&raw, DefaultMaxDecompressedBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, string(b), `{"message":"hi"}`)
+}
@@ -0,0 +1,37 @@
+package apexgrpc
+
+import (
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// WithHealthService registers the grpc.health.v1.Health/Check method backed by
+// the standard health server. The overall status, service "", starts as
+// SERVING; other services report NOT_FOUND until SetServingStatus is called.
+// Watch is not registered, since a Lambda invocation cannot stay open for
+// updates.
+func WithHealthService() ServerOption {
+	return func(o *options) {
+		o.healthService = true
+	}
+}
+
+// SetServingStatus sets the status Health/Check reports for service. It does
+// nothing unless the server was created with WithHealthService.
+func (s *Server) SetServingStatus(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	if s.health != nil {
+		s.health.SetServingStatus(service, status)
+	}
+}
+
+func healthService(h *health.Server) Service {
+	desc := healthpb.Health_ServiceDesc
+	desc.Methods = nil
+	for _, m := range healthpb.Health_ServiceDesc.Methods {
+		if m.MethodName == "Check" {
+			desc.Methods = append(desc.Methods, m)
+		}
+	}
+	desc.Streams = nil
+	return Service{Desc: &desc, Server: h}
+}
@@ -0,0 +1,36 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func healthEvent(method, data string) string {
+	return `{"service":"grpc.health.v1.Health","method":"` + method + `","data":` + data + `}`
+}
+
+func TestHealthService(t *testing.T) {
+	_, err := serve(t, newEchoServer(t), healthEvent("Check", `{}`))
+	assertCode(t, err, codes.Unimplemented)
+
+	s := newEchoServer(t, WithHealthService())
+	got, err := serve(t, s, healthEvent("Check", `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"status":"SERVING"}`)
+
+	_, err = serve(t, s, healthEvent("Check", `{"service":"apexgrpc.test.Echo"}`))
+	assertCode(t, err, codes.NotFound)
+	s.SetServingStatus("apexgrpc.test.Echo", healthpb.HealthCheckResponse_NOT_SERVING)
+	got, err = serve(t, s, healthEvent("Check", `{"service":"apexgrpc.test.Echo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"status":"NOT_SERVING"}`)
+
+	_, err = serve(t, s, healthEvent("Watch", `{}`))
+	assertCode(t, err, codes.Unimplemented)
+}
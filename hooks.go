@@ -0,0 +1,58 @@
+package apexgrpc
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// EventHook observes an event, as the caller sent it, before it is
+// dispatched. A non-nil error rejects the event and is returned as is.
+type EventHook func(c context.Context, event *Event) error
+
+// ResponseHook observes a finished method call. id is empty if the event did
+// not address a method, and reply is the last message sent by a streaming
+// handler.
+type ResponseHook func(c context.Context, id MethodID, reply proto.Message, err error, duration time.Duration)
+
+// WithOnEvent appends hooks run before every event is routed, in the order
+// given. The first error stops the remaining hooks.
+func WithOnEvent(hooks ...EventHook) ServerOption {
+	return func(o *options) {
+		o.eventHooks = append(o.eventHooks, hooks...)
+	}
+}
+
+// WithOnResponse appends hooks run after every method call, in the order
+// given.
+func WithOnResponse(hooks ...ResponseHook) ServerOption {
+	return func(o *options) {
+		o.responseHooks = append(o.responseHooks, hooks...)
+	}
+}
+
+func (s *Server) onEvent(c context.Context, event *Event) error {
+	for _, hook := range s.opts.eventHooks {
+		if err := hook(c, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) onResponse(c context.Context, id MethodID, res *result, err error, duration time.Duration) {
+	if len(s.opts.responseHooks) == 0 {
+		return
+	}
+	var reply proto.Message
+	if res != nil {
+		reply = res.reply
+		if res.streaming && len(res.replies) > 0 {
+			reply = res.replies[len(res.replies)-1]
+		}
+	}
+	for _, hook := range s.opts.responseHooks {
+		hook(c, id, reply, err, duration)
+	}
+}
@@ -0,0 +1,352 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// HTTPStatusFromCode maps a gRPC code to the HTTP status used by the HTTP
+// adapters, following the grpc-gateway conventions.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// WithCORS answers CORS preflight requests on the HTTP adapters and adds
+// Access-Control-Allow-Origin to responses for the given origins. "*" allows
+// any origin.
+func WithCORS(origins ...string) ServerOption {
+	return func(o *options) {
+		o.corsOrigins = append(o.corsOrigins, origins...)
+	}
+}
+
+// httpRequest is the part of an HTTP-shaped Lambda event the adapters route
+// on. Header names are lowercase.
+type httpRequest struct {
+	method  string
+	path    string
+	query   url.Values
+	headers map[string][]string
+	body    string
+	base64  bool
+	// identity is the caller as told by the event, if it tells.
+	identity *CallerIdentity
+}
+
+// httpResponse is an HTTP response of the adapters. A base64 body holds
+// binary data in base64.
+type httpResponse struct {
+	status  int
+	headers map[string]string
+	body    string
+	base64  bool
+}
+
+func (r *httpRequest) header(name string) string {
+	if vals := r.headers[name]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// serveHTTP routes POST /pkg.Service/Method, after prefix, to the registered
+// handler and maps the outcome to an HTTP response.
+func (s *Server) serveHTTP(c context.Context, req *httpRequest, prefix string, ctx *apex.Context) *httpResponse {
+	if req.identity != nil {
+		c = NewCallerIdentityContext(c, *req.identity)
+	}
+	res := s.serveHTTPMethod(c, req, prefix, ctx)
+	if origin := s.allowedOrigin(req.header("origin")); origin != "" {
+		res.headers["Access-Control-Allow-Origin"] = origin
+		res.headers["Vary"] = "Origin"
+		res.headers["Access-Control-Expose-Headers"] = exposedHeaders(res)
+	}
+	return res
+}
+
+func (s *Server) serveHTTPMethod(c context.Context, req *httpRequest, prefix string, ctx *apex.Context) *httpResponse {
+	if req.method == http.MethodOptions && len(s.opts.corsOrigins) > 0 {
+		return s.preflightResponse(req)
+	}
+	if s.opts.httpRules {
+		if r, vals, ok := s.matchHTTPRule(req.method, strings.TrimPrefix(req.path, prefix)); ok {
+			return s.serveHTTPRule(c, req, r, vals, ctx)
+		}
+	}
+	if req.method != http.MethodPost {
+		return newHTTPErrorResponse(http.StatusMethodNotAllowed, codedErrorf(codes.Unimplemented, "method %s not allowed", req.method))
+	}
+	svc, mtd, ok := s.routeHTTPPath(strings.TrimPrefix(req.path, prefix))
+	if !ok {
+		return newHTTPErrorResponse(http.StatusNotFound, codedErrorf(codes.NotFound, "no method for path %s", req.path))
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return newHTTPErrorResponse(http.StatusBadRequest, err)
+	}
+	if isGRPCWeb(req.header("content-type")) {
+		return s.serveGRPCWeb(c, req, svc, mtd, body, ctx)
+	}
+	if isConnect(req) {
+		return s.serveConnect(c, req, svc, mtd, body, ctx)
+	}
+	event := Event{
+		Service:  &svc,
+		Method:   &mtd,
+		Metadata: req.headers,
+	}
+	if len(body) > 0 {
+		data := json.RawMessage(body)
+		event.Data = &data
+	}
+	return s.serveHTTPEvent(c, &event, ctx)
+}
+
+// serveHTTPEvent processes an event built from an HTTP request and maps the
+// outcome to an HTTP response.
+func (s *Server) serveHTTPEvent(c context.Context, event *Event, ctx *apex.Context) *httpResponse {
+	res, err := s.processEvent(c, event, ctx)
+	if err != nil {
+		res := newHTTPResponse(HTTPStatusFromCode(errorStatus(err).Code()), s.newErrorResponse(err))
+		setStatusHeaders(res.headers, err)
+		return res
+	}
+	data, err := s.encodeResult(EncodingJSON, res)
+	if err != nil {
+		return newHTTPErrorResponse(http.StatusInternalServerError, err)
+	}
+	hres := newHTTPResponse(http.StatusOK, data)
+	setMetadataHeaders(hres.headers, res.header, res.trailer)
+	return hres
+}
+
+// Prefixes of the HTTP response headers carrying the header and trailer
+// metadata set by handlers, as in grpc-gateway.
+const (
+	metadataHeaderPrefix = "Grpc-Metadata-"
+	trailerHeaderPrefix  = "Grpc-Trailer-"
+)
+
+// setMetadataHeaders adds header and trailer metadata to HTTP headers. Values
+// of a key are joined with commas.
+func setMetadataHeaders(headers map[string]string, header metadata.MD, trailer metadata.MD) {
+	for k, vals := range encodeMetadata(header) {
+		headers[http.CanonicalHeaderKey(metadataHeaderPrefix+k)] = strings.Join(vals, ", ")
+	}
+	for k, vals := range encodeMetadata(trailer) {
+		headers[http.CanonicalHeaderKey(trailerHeaderPrefix+k)] = strings.Join(vals, ", ")
+	}
+}
+
+// exposedHeaders lists the headers of res that browsers may read.
+func exposedHeaders(res *httpResponse) string {
+	exposed := []string{"Grpc-Status", "Grpc-Message"}
+	for k := range res.headers {
+		if strings.HasPrefix(k, metadataHeaderPrefix) || strings.HasPrefix(k, trailerHeaderPrefix) {
+			exposed = append(exposed, k)
+		}
+	}
+	sort.Strings(exposed[2:])
+	return strings.Join(exposed, ", ")
+}
+
+func requestBody(req *httpRequest) ([]byte, error) {
+	if !req.base64 {
+		return []byte(req.body), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(req.body)
+	if err != nil {
+		return nil, codedErrorf(codes.InvalidArgument, "invalid base64 body")
+	}
+	return b, nil
+}
+
+// queryValues merges the single- and multi-valued query parameters of an
+// event.
+func queryValues(single map[string]string, multi map[string][]string) url.Values {
+	q := url.Values{}
+	for k, v := range single {
+		q.Set(k, v)
+	}
+	for k, vals := range multi {
+		q[k] = vals
+	}
+	return q
+}
+
+// routeHTTPPath maps "/pkg.Service/Method" onto a registered method.
+func (s *Server) routeHTTPPath(path string) (string, string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 || strings.Contains(path[:i], "/") {
+		return "", "", false
+	}
+	svc, mtd := path[:i], path[i+1:]
+	if _, ok := s.resolve("", "", svc, mtd); !ok {
+		return "", "", false
+	}
+	return svc, mtd, true
+}
+
+func (s *Server) allowedOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, o := range s.opts.corsOrigins {
+		if o == "*" || o == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+func (s *Server) preflightResponse(req *httpRequest) *httpResponse {
+	if s.allowedOrigin(req.header("origin")) == "" {
+		return &httpResponse{status: http.StatusForbidden, headers: map[string]string{}}
+	}
+	allowHeaders := req.header("access-control-request-headers")
+	if allowHeaders == "" {
+		allowHeaders = "Content-Type, Authorization"
+	}
+	return &httpResponse{
+		status: http.StatusNoContent,
+		headers: map[string]string{
+			"Access-Control-Allow-Methods": "POST, OPTIONS",
+			"Access-Control-Allow-Headers": allowHeaders,
+			"Access-Control-Max-Age":       strconv.Itoa(600),
+		},
+	}
+}
+
+// headerMetadata turns HTTP headers into event metadata, preferring the
+// multi-value form when both are present.
+func headerMetadata(headers map[string]string, multi map[string][]string) map[string][]string {
+	md := map[string][]string{}
+	for k, v := range headers {
+		md[strings.ToLower(k)] = []string{v}
+	}
+	for k, vals := range multi {
+		md[strings.ToLower(k)] = vals
+	}
+	return md
+}
+
+func newHTTPResponse(code int, data interface{}) *httpResponse {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return newHTTPErrorResponse(http.StatusInternalServerError, err)
+	}
+	return &httpResponse{
+		status:  code,
+		headers: map[string]string{"Content-Type": "application/json"},
+		body:    string(body),
+	}
+}
+
+func newHTTPErrorResponse(code int, err error) *httpResponse {
+	body, _ := json.Marshal(newErrorResponse(err, nil))
+	res := &httpResponse{
+		status:  code,
+		headers: map[string]string{"Content-Type": "application/json"},
+		body:    string(body),
+	}
+	setStatusHeaders(res.headers, err)
+	return res
+}
+
+// setStatusHeaders adds the grpc-status and grpc-message headers of err.
+func setStatusHeaders(headers map[string]string, err error) {
+	st := errorStatus(err)
+	headers["Grpc-Status"] = strconv.Itoa(int(st.Code()))
+	headers["Grpc-Message"] = encodeGRPCMessage(st.Message())
+}
+
+// encodeGRPCMessage percent-encodes msg as the gRPC protocol requires for the
+// grpc-message header.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// ServeHTTP serves POST /pkg.Service/Method like the API Gateway adapter, so
+// that a Server can run behind net/http during development. Request headers
+// become metadata.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeHTTPResponse(w, newHTTPErrorResponse(http.StatusBadRequest, codedErrorf(codes.InvalidArgument, "invalid body: %v", err)))
+		return
+	}
+	req := &httpRequest{
+		method:  r.Method,
+		path:    r.URL.Path,
+		query:   r.URL.Query(),
+		headers: headerMetadata(nil, r.Header),
+		body:    string(body),
+		identity: &CallerIdentity{
+			SourceIP: remoteIP(r.RemoteAddr),
+		},
+	}
+	writeHTTPResponse(w, s.serveHTTP(r.Context(), req, "", nil))
+}
+
+func writeHTTPResponse(w http.ResponseWriter, res *httpResponse) {
+	for k, v := range res.headers {
+		w.Header().Set(k, v)
+	}
+	body := []byte(res.body)
+	if res.base64 {
+		b, err := base64.StdEncoding.DecodeString(res.body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = b
+	}
+	w.WriteHeader(res.status)
+	w.Write(body)
+}
@@ -0,0 +1,50 @@
+package apexgrpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestServeHTTP(t *testing.T) {
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ := metadata.FromIncomingContext(c)
+		grpc.SetHeader(c, metadata.Pairs("x-seen", strings.Join(md.Get("x-client"), ",")))
+		return echoReply(req), nil
+	}}
+	ts := httptest.NewServer(newEchoServerWith(t, srv))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/apexgrpc.test.Echo/Echo", strings.NewReader(`{"message":"hi"}`))
+	req.Header.Set("X-Client", "cli")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %s", res.StatusCode, body)
+	}
+	assertJSON(t, string(body), `{"message":"hi"}`)
+	if got := res.Header.Get("Grpc-Metadata-X-Seen"); got != "cli" {
+		t.Errorf("Grpc-Metadata-X-Seen = %q, want the request header echoed", got)
+	}
+
+	res, err = http.Post(ts.URL+"/apexgrpc.test.Echo/Fail", "application/json", strings.NewReader(`{"count":7,"message":"no"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden || res.Header.Get("Grpc-Status") != "7" || res.Header.Get("Grpc-Message") != "no" {
+		t.Errorf("status %d, grpc-status %q, grpc-message %q", res.StatusCode, res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message"))
+	}
+}
@@ -0,0 +1,416 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WithHTTPRules routes requests of the HTTP adapters by the google.api.http
+// annotations of methods, e.g. GET /v1/users/{id}, as grpc-gateway does. Path
+// variables and, unless the body is "*", query parameters are set on the
+// request message, and the body fills the whole request or the field named by
+// the rule. Rules need the method descriptors in the global registry; methods
+// without any are still served at POST /pkg.Service/Method. Register fails if
+// two rules match the same requests.
+func WithHTTPRules() ServerOption {
+	return func(o *options) {
+		o.httpRules = true
+	}
+}
+
+// httpRule is a google.api.http binding of a method.
+type httpRule struct {
+	id       MethodID
+	method   string
+	path     string
+	template *pathTemplate
+	body     string
+	input    protoreflect.MessageDescriptor
+}
+
+// pathTemplate is a parsed HTTP rule path. Segments are literals, "*" or a
+// trailing "**"; each variable captures a run of segments.
+type pathTemplate struct {
+	segments []string
+	verb     string
+	vars     []pathVar
+}
+
+type pathVar struct {
+	field      []string
+	start, end int
+}
+
+// parsePathTemplate parses the google.api.http path syntax:
+//
+//	Template = "/" Segments [ ":" Verb ]
+//	Segment  = "*" | "**" | LITERAL | "{" FieldPath [ "=" Segments ] "}"
+func parsePathTemplate(path string) (*pathTemplate, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	t := &pathTemplate{}
+	rest := path[1:]
+	for {
+		if strings.HasPrefix(rest, "{") {
+			end := strings.Index(rest, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable")
+			}
+			field, segs := rest[1:end], "*"
+			if i := strings.Index(field, "="); i >= 0 {
+				field, segs = field[:i], field[i+1:]
+			}
+			if field == "" {
+				return nil, fmt.Errorf("variable without a field")
+			}
+			v := pathVar{field: strings.Split(field, "."), start: len(t.segments)}
+			t.segments = append(t.segments, strings.Split(segs, "/")...)
+			v.end = len(t.segments)
+			t.vars = append(t.vars, v)
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, "/:")
+			if end < 0 {
+				end = len(rest)
+			}
+			t.segments = append(t.segments, rest[:end])
+			rest = rest[end:]
+		}
+		if strings.HasPrefix(rest, ":") {
+			t.verb = rest[1:]
+			if t.verb == "" || strings.Contains(t.verb, "/") {
+				return nil, fmt.Errorf("invalid verb %q", t.verb)
+			}
+			rest = ""
+		}
+		if rest == "" {
+			break
+		}
+		rest = strings.TrimPrefix(rest, "/")
+	}
+	for i, seg := range t.segments {
+		switch {
+		case seg == "":
+			return nil, fmt.Errorf("empty segment")
+		case seg == "**" && i != len(t.segments)-1:
+			return nil, fmt.Errorf("** must be the last segment")
+		case strings.ContainsAny(seg, "{}=") || (seg != "*" && seg != "**" && strings.Contains(seg, "*")):
+			return nil, fmt.Errorf("invalid segment %q", seg)
+		}
+	}
+	return t, nil
+}
+
+// shape identifies the requests a template matches, ignoring variable names.
+func (t *pathTemplate) shape() string {
+	return "/" + strings.Join(t.segments, "/") + ":" + t.verb
+}
+
+func (t *pathTemplate) literals() int {
+	n := 0
+	for _, seg := range t.segments {
+		if seg != "*" && seg != "**" {
+			n++
+		}
+	}
+	return n
+}
+
+// match returns the values of the variables of t for path.
+func (t *pathTemplate) match(path string) ([]string, bool) {
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, part := range parts {
+		if p, err := url.PathUnescape(part); err == nil {
+			parts[i] = p
+		}
+	}
+	deep := t.segments[len(t.segments)-1] == "**"
+	if len(parts) != len(t.segments) && !(deep && len(parts) >= len(t.segments)-1) {
+		return nil, false
+	}
+	for i, seg := range t.segments {
+		switch seg {
+		case "**":
+		case "*":
+			if parts[i] == "" {
+				return nil, false
+			}
+		default:
+			if parts[i] != seg {
+				return nil, false
+			}
+		}
+	}
+	vals := make([]string, len(t.vars))
+	for i, v := range t.vars {
+		end := v.end
+		if deep && end == len(t.segments) {
+			end = len(parts)
+		}
+		if v.start >= end {
+			continue
+		}
+		vals[i] = strings.Join(parts[v.start:end], "/")
+	}
+	return vals, true
+}
+
+// methodHTTPRules compiles the google.api.http rule of md and its additional
+// bindings.
+func methodHTTPRules(id MethodID, md protoreflect.MethodDescriptor) ([]*httpRule, error) {
+	if md == nil {
+		return nil, nil
+	}
+	rule, _ := protov2.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if rule == nil {
+		return nil, nil
+	}
+	var rules []*httpRule
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		method, path := httpRulePattern(r)
+		if path == "" {
+			continue
+		}
+		t, err := parsePathTemplate(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http rule %s %s of method (%s): %v", method, path, id, err)
+		}
+		rules = append(rules, &httpRule{
+			id:       id,
+			method:   method,
+			path:     path,
+			template: t,
+			body:     r.GetBody(),
+			input:    md.Input(),
+		})
+	}
+	return rules, nil
+}
+
+func httpRulePattern(r *annotations.HttpRule) (string, string) {
+	switch {
+	case r.GetGet() != "":
+		return http.MethodGet, r.GetGet()
+	case r.GetPut() != "":
+		return http.MethodPut, r.GetPut()
+	case r.GetPost() != "":
+		return http.MethodPost, r.GetPost()
+	case r.GetDelete() != "":
+		return http.MethodDelete, r.GetDelete()
+	case r.GetPatch() != "":
+		return http.MethodPatch, r.GetPatch()
+	case r.GetCustom() != nil:
+		return r.GetCustom().GetKind(), r.GetCustom().GetPath()
+	}
+	return "", ""
+}
+
+// checkHTTPRules compiles the HTTP rules of the methods of svcs, failing if
+// one matches the same requests as another or as a registered rule.
+func (s *Server) checkHTTPRules(svcs []Service) (map[MethodID][]*httpRule, error) {
+	if !s.opts.httpRules {
+		return nil, nil
+	}
+	taken := map[string]*httpRule{}
+	for _, r := range s.httpRoutes {
+		taken[r.method+" "+r.template.shape()] = r
+	}
+	rules := map[MethodID][]*httpRule{}
+	for _, svc := range svcs {
+		for _, id := range serviceMethodIDs(svc.Desc) {
+			_, mtd := id.split()
+			compiled, err := methodHTTPRules(id, methodDescriptor(svc, mtd))
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range compiled {
+				key := r.method + " " + r.template.shape()
+				if prev, ok := taken[key]; ok {
+					return nil, fmt.Errorf("http rule %s %s of method (%s) conflicts with %s %s of (%s)", r.method, r.path, id, prev.method, prev.path, prev.id)
+				}
+				taken[key] = r
+			}
+			rules[id] = compiled
+		}
+	}
+	return rules, nil
+}
+
+// indexHTTPRules rebuilds the HTTP rules of the handlers, most specific
+// first.
+func (s *Server) indexHTTPRules() {
+	s.httpRoutes = nil
+	for _, h := range s.handlers {
+		s.httpRoutes = append(s.httpRoutes, h.httpRules...)
+	}
+	sort.Slice(s.httpRoutes, func(i, j int) bool {
+		a, b := s.httpRoutes[i].template, s.httpRoutes[j].template
+		if a.literals() != b.literals() {
+			return a.literals() > b.literals()
+		}
+		if len(a.segments) != len(b.segments) {
+			return len(a.segments) > len(b.segments)
+		}
+		return s.httpRoutes[i].path < s.httpRoutes[j].path
+	})
+}
+
+// matchHTTPRule finds the rule for a request and the values of its path
+// variables.
+func (s *Server) matchHTTPRule(method string, path string) (*httpRule, []string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.httpRoutes {
+		if r.method != method {
+			continue
+		}
+		if vals, ok := r.template.match(path); ok {
+			return r, vals, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (s *Server) serveHTTPRule(c context.Context, req *httpRequest, r *httpRule, vals []string, ctx *apex.Context) *httpResponse {
+	body, err := requestBody(req)
+	if err != nil {
+		return newHTTPErrorResponse(http.StatusBadRequest, err)
+	}
+	data, err := s.httpRuleData(r, vals, req.query, body)
+	if err != nil {
+		return newHTTPErrorResponse(http.StatusBadRequest, err)
+	}
+	event := methodEvent(r.id, data)
+	event.Metadata = req.headers
+	return s.serveHTTPEvent(c, &event, ctx)
+}
+
+// httpRuleData builds the JSON request of a call routed by r.
+func (s *Server) httpRuleData(r *httpRule, vals []string, query url.Values, body []byte) ([]byte, error) {
+	obj := map[string]interface{}{}
+	switch r.body {
+	case "":
+	case "*":
+		if len(bytes.TrimSpace(body)) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+			if err := dec.Decode(&obj); err != nil {
+				return nil, codedErrorf(codes.InvalidArgument, "request body must be a JSON object")
+			}
+		}
+	default:
+		if len(bytes.TrimSpace(body)) > 0 {
+			setJSONField(obj, strings.Split(r.body, "."), json.RawMessage(body))
+		}
+	}
+	bound := map[string]bool{}
+	for i, v := range r.template.vars {
+		value, err := s.httpFieldValue(r.input, v.field, vals[i:i+1])
+		if err != nil {
+			return nil, err
+		}
+		setJSONField(obj, v.field, value)
+		bound[strings.Join(v.field, ".")] = true
+	}
+	if r.body != "*" {
+		for key, qvals := range query {
+			if bound[key] || key == r.body || len(qvals) == 0 {
+				continue
+			}
+			field := strings.Split(key, ".")
+			value, err := s.httpFieldValue(r.input, field, qvals)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				setJSONField(obj, field, value)
+			}
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// httpFieldValue converts the path or query values of a field to JSON. Values
+// stay strings, which protojson accepts for numbers, except for bools. It
+// returns nil for unknown fields when unknown fields are allowed.
+func (s *Server) httpFieldValue(md protoreflect.MessageDescriptor, field []string, vals []string) (interface{}, error) {
+	path := strings.Join(field, ".")
+	var fd protoreflect.FieldDescriptor
+	for i, name := range field {
+		if i > 0 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, codedErrorf(codes.InvalidArgument, "field %q is not a message", strings.Join(field[:i], "."))
+			}
+			md = fd.Message()
+		}
+		if fd = lookupField(md, name); fd == nil {
+			if s.opts.unmarshalOptions.DiscardUnknown {
+				return nil, nil
+			}
+			return nil, codedErrorf(codes.InvalidArgument, "unknown field %q in %s", path, md.FullName())
+		}
+	}
+	if fd.IsMap() {
+		return nil, codedErrorf(codes.InvalidArgument, "map field %q cannot be set from the URL", path)
+	}
+	if fd.IsList() {
+		list := make([]interface{}, len(vals))
+		for i, v := range vals {
+			value, err := httpScalarValue(fd, path, v)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	}
+	if len(vals) > 1 {
+		return nil, codedErrorf(codes.InvalidArgument, "field %q is not repeated", path)
+	}
+	return httpScalarValue(fd, path, vals[0])
+}
+
+func httpScalarValue(fd protoreflect.FieldDescriptor, path string, v string) (interface{}, error) {
+	if fd.Kind() != protoreflect.BoolKind {
+		return v, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, codedErrorf(codes.InvalidArgument, "invalid bool %q for field %q", v, path)
+	}
+	return b, nil
+}
+
+// setJSONField sets the nested field of obj at path, creating the objects on
+// the way.
+func setJSONField(obj map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := obj[name].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			obj[name] = next
+		}
+		obj = next
+	}
+	obj[path[len(path)-1]] = value
+}
@@ -0,0 +1,141 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// userServiceFiles describes apexgrpc.httptest.Users with one method per
+// rule, each taking and returning a User:
+//
+//	message Name { string first = 1; string last = 2; }
+//	message User { string id = 1; Name name = 2; repeated string tags = 3; bool active = 4; }
+func userServiceFiles(rules map[string]*annotations.HttpRule) *descriptorpb.FileDescriptorSet {
+	field := func(name string, n int32, t descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(n),
+			Type:     t.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	opt, rep := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	svc := &descriptorpb.ServiceDescriptorProto{Name: proto.String("Users")}
+	for name, rule := range rules {
+		opts := &descriptorpb.MethodOptions{}
+		proto.SetExtension(opts, annotations.E_Http, rule)
+		svc.Method = append(svc.Method, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".apexgrpc.httptest.User"),
+			OutputType: proto.String(".apexgrpc.httptest.User"),
+			Options:    opts,
+		})
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("apexgrpc/test/users.proto"),
+		Package: proto.String("apexgrpc.httptest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Name"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("first", 1, str, opt, ""),
+				field("last", 2, str, opt, ""),
+			}},
+			{Name: proto.String("User"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, opt, ""),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".apexgrpc.httptest.Name"),
+				field("tags", 3, str, rep, ""),
+				field("active", 4, descriptorpb.FieldDescriptorProto_TYPE_BOOL, opt, ""),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{svc},
+	}}}
+}
+
+func TestHTTPRules(t *testing.T) {
+	s := NewServer(WithHTTPRules())
+	err := s.RegisterDynamic(userServiceFiles(map[string]*annotations.HttpRule{
+		"Get":    {Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"}},
+		"Search": {Pattern: &annotations.HttpRule_Get{Get: "/v1/users/search"}},
+		"ByName": {Pattern: &annotations.HttpRule_Get{Get: "/v1/names/{name.first}/{name.last}"}},
+		"Files":  {Pattern: &annotations.HttpRule_Get{Get: "/v1/{id=files/**}"}},
+		"Rename": {Pattern: &annotations.HttpRule_Patch{Patch: "/v1/users/{id}"}, Body: "name"},
+		"Create": {Pattern: &annotations.HttpRule_Post{Post: "/v1/users"}, Body: "*"},
+	}), echoDynamic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		query  map[string][]string
+		body   string
+		status int
+		want   string
+	}{
+		{"path variable", http.MethodGet, "/v1/users/u1", nil, "", http.StatusOK, `{"id":"u1"}`},
+		{"literal before variable", http.MethodGet, "/v1/users/search", nil, "", http.StatusOK, `{}`},
+		{"nested variables", http.MethodGet, "/v1/names/ada/lovelace", nil, "", http.StatusOK, `{"name":{"first":"ada","last":"lovelace"}}`},
+		{"multi-segment variable", http.MethodGet, "/v1/files/a/b", nil, "", http.StatusOK, `{"id":"files/a/b"}`},
+		{"query parameters", http.MethodGet, "/v1/users/u1", map[string][]string{"tags": {"a", "b"}, "active": {"true"}, "name.first": {"ada"}}, "", http.StatusOK, `{"id":"u1","tags":["a","b"],"active":true,"name":{"first":"ada"}}`},
+		{"repeated query on singular field", http.MethodGet, "/v1/users/u1", map[string][]string{"active": {"true", "false"}}, "", http.StatusBadRequest, ""},
+		{"unknown query parameter", http.MethodGet, "/v1/users/u1", map[string][]string{"nope": {"x"}}, "", http.StatusBadRequest, ""},
+		{"body field", http.MethodPatch, "/v1/users/u1", nil, `{"first":"ada"}`, http.StatusOK, `{"id":"u1","name":{"first":"ada"}}`},
+		{"whole body", http.MethodPost, "/v1/users", map[string][]string{"id": {"ignored"}}, `{"id":"u2","tags":["x"]}`, http.StatusOK, `{"id":"u2","tags":["x"]}`},
+		{"unannotated convention", http.MethodPost, "/apexgrpc.httptest.Users/Get", nil, `{"id":"u3"}`, http.StatusOK, `{"id":"u3"}`},
+		{"no rule for the method", http.MethodDelete, "/v1/users/u1", nil, "", http.StatusMethodNotAllowed, ""},
+		{"no route", http.MethodPost, "/v1/nowhere", nil, "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, _ := json.Marshal(APIGatewayProxyRequest{HTTPMethod: tt.method, Path: tt.path, MultiValueQueryStringParameters: tt.query, Body: tt.body})
+			res := s.handleAPIGateway(context.Background(), event, testApexContext())
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", res.StatusCode, tt.status, res.Body)
+			}
+			if tt.want != "" {
+				assertJSON(t, res.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRuleConflicts(t *testing.T) {
+	tests := map[string]map[string]*annotations.HttpRule{
+		"same shape": {
+			"Get":   {Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"}},
+			"Other": {Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{name.first}"}},
+		},
+		"additional binding": {
+			"Get": {Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"}, AdditionalBindings: []*annotations.HttpRule{
+				{Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"}},
+			}},
+		},
+		"invalid template": {
+			"Get": {Pattern: &annotations.HttpRule_Get{Get: "/v1/**/users"}},
+		},
+	}
+	for name, rules := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := NewServer(WithHTTPRules()).RegisterDynamic(userServiceFiles(rules), echoDynamic); err == nil {
+				t.Error("err = nil")
+			}
+		})
+	}
+	// Without WithHTTPRules the annotations are ignored.
+	if err := NewServer().RegisterDynamic(userServiceFiles(tests["same shape"]), echoDynamic); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,262 @@
+package apexgrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DefaultIdempotencyTTL is how long results are kept when
+// WithIdempotencyStore is not given a TTL.
+const DefaultIdempotencyTTL = time.Hour
+
+// StoredResult is the outcome of an idempotent call as kept in an
+// IdempotencyStore: the reply of the handler, in the proto3 JSON form of the
+// message type named by Type, or its error as a google.rpc.Status in wire
+// format, details included.
+type StoredResult struct {
+	Type   string          `json:"type,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Status []byte          `json:"status,omitempty"`
+}
+
+// IdempotencyStore keeps the results of idempotent calls by key. Stores shared
+// between containers, e.g. backed by DynamoDB, can be implemented outside the
+// package.
+type IdempotencyStore interface {
+	Get(c context.Context, key string) (*StoredResult, bool)
+	Put(c context.Context, key string, res *StoredResult, ttl time.Duration)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore local to the container.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	res     *StoredResult
+	expires time.Time
+}
+
+func (m *MemoryIdempotencyStore) Get(c context.Context, key string) (*StoredResult, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return e.res, true
+}
+
+func (m *MemoryIdempotencyStore) Put(c context.Context, key string, res *StoredResult, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[string]memoryEntry{}
+	}
+	now := time.Now()
+	for k, e := range m.entries {
+		if now.After(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryEntry{res: res, expires: now.Add(ttl)}
+}
+
+// WithIdempotentMethods makes calls of the unary methods ids that carry an
+// "idempotencyKey" run at most once per key and caller: repeated calls get the
+// stored reply of the first. The store is consulted after authorization and
+// the interceptors, and keys are scoped to the caller identity and the
+// "authorization" metadata, so a caller cannot replay the result of another.
+// Concurrent calls with the same key in one container wait for the first to
+// finish. Dry runs are not stored. Results are kept in a
+// MemoryIdempotencyStore unless WithIdempotencyStore is given.
+func WithIdempotentMethods(ids ...MethodID) ServerOption {
+	return func(o *options) {
+		if o.idempotentMethods == nil {
+			o.idempotentMethods = map[MethodID]bool{}
+		}
+		for _, id := range ids {
+			o.idempotentMethods[id] = true
+		}
+	}
+}
+
+// WithIdempotencyStore keeps the results of idempotent calls in store for ttl,
+// or DefaultIdempotencyTTL if ttl is zero.
+func WithIdempotencyStore(store IdempotencyStore, ttl time.Duration) ServerOption {
+	return func(o *options) {
+		o.idempotencyStore = store
+		o.idempotencyTTL = ttl
+	}
+}
+
+// WithIdempotentErrors also stores failed results, so that repeated events
+// fail the same way instead of retrying the call.
+func WithIdempotentErrors() ServerOption {
+	return func(o *options) {
+		o.idempotentErrors = true
+	}
+}
+
+// callerScope identifies the caller of the call of c for idempotency keys: a
+// hash of its CallerIdentity, but for the source IP, and of its
+// "authorization" metadata.
+func callerScope(c context.Context) string {
+	id, _ := CallerIdentityFromContext(c)
+	h := sha256.New()
+	for _, v := range []string{id.CallerARN, id.AccountID, id.CognitoIdentityID, id.CognitoIdentityPoolID} {
+		writeKeyPart(h, v)
+	}
+	md, _ := metadata.FromIncomingContext(c)
+	for _, v := range md.Get("authorization") {
+		writeKeyPart(h, v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyInterceptor runs the calls of id carrying key at most once. It
+// runs innermost, so that authorization has passed by the time the store is
+// consulted.
+func (s *Server) idempotencyInterceptor(id MethodID, key string) grpc.UnaryServerInterceptor {
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := id.String() + "#" + callerScope(c) + "#" + key
+		store := s.idempotencyStore
+		if res, ok := store.Get(c, key); ok {
+			return s.storedReply(id, res)
+		}
+		reply, err := s.flights.do(key, func() (interface{}, error) {
+			if res, ok := store.Get(c, key); ok {
+				return s.storedReply(id, res)
+			}
+			reply, err := handler(c, req)
+			if err != nil && !s.opts.idempotentErrors {
+				return nil, err
+			}
+			res, serr := s.storedResult(reply, err)
+			if serr != nil {
+				return nil, serr
+			}
+			ttl := s.opts.idempotencyTTL
+			if ttl <= 0 {
+				ttl = DefaultIdempotencyTTL
+			}
+			store.Put(c, key, res, ttl)
+			return reply, err
+		})
+		// Callers waiting on the same flight must not share the message.
+		if m, ok := reply.(proto.Message); ok && m != nil {
+			reply = cloneProto(m)
+		}
+		return reply, err
+	}
+}
+
+func (s *Server) storedResult(reply interface{}, err error) (*StoredResult, error) {
+	if err != nil {
+		b, merr := protov2.Marshal(errorStatus(err).Proto())
+		if merr != nil {
+			return nil, merr
+		}
+		return &StoredResult{Status: b}, nil
+	}
+	m, ok := reply.(proto.Message)
+	if !ok || m == nil {
+		return nil, codedErrorf(codes.Internal, "reply of type %T cannot be stored", reply)
+	}
+	data, merr := protojson.MarshalOptions{Resolver: s.marshalOptions().Resolver}.Marshal(messageV2(m))
+	if merr != nil {
+		return nil, merr
+	}
+	return &StoredResult{Type: messageFullName(m), Data: data}, nil
+}
+
+// storedReply rebuilds the reply or the error of a stored result of id.
+func (s *Server) storedReply(id MethodID, res *StoredResult) (interface{}, error) {
+	if res.Status != nil {
+		st := &spb.Status{}
+		if err := protov2.Unmarshal(res.Status, st); err != nil {
+			return nil, wrapCodedf(codes.Internal, err, "invalid stored status of method (%s): %v", id, err)
+		}
+		return nil, status.FromProto(st).Err()
+	}
+	m, err := s.newMessage(id, protoreflect.FullName(res.Type))
+	if err != nil {
+		return nil, err
+	}
+	uo := protojson.UnmarshalOptions{Resolver: s.unmarshalOptions().Resolver, DiscardUnknown: true}
+	if err := uo.Unmarshal(res.Data, m); err != nil {
+		return nil, wrapCodedf(codes.Internal, err, "invalid stored reply of method (%s): %v", id, err)
+	}
+	return protoadapt.MessageV1Of(m), nil
+}
+
+// newMessage returns an empty message of the type name, looked up in the
+// global registry or, for dynamic services, the output descriptor of id.
+func (s *Server) newMessage(id MethodID, name protoreflect.FullName) (protov2.Message, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return mt.New().Interface(), nil
+	}
+	if h, ok := s.handler(id); ok && h.descriptor != nil && h.descriptor.Output().FullName() == name {
+		return dynamicpb.NewMessage(h.descriptor.Output()), nil
+	}
+	return nil, codedErrorf(codes.Internal, "unknown stored reply type %q of method (%s)", name, id)
+}
+
+// flightGroup runs one call at a time per key, sharing its result with the
+// callers that wait for it.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flight{}
+	}
+	if f, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.val, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.calls[key] = f
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		f.wg.Done()
+	}()
+	f.val, f.err = fn()
+	return f.val, f.err
+}
@@ -0,0 +1,117 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func idempotentEvent(key, md string) string {
+	return fmt.Sprintf(`{"service":%q,"method":"Echo","data":{"message":"a"},"idempotencyKey":%q,"metadata":%s}`, echoService, key, md)
+}
+
+func TestIdempotentMethods(t *testing.T) {
+	var calls int
+	s := newEchoServerWith(t, countingEcho(&calls),
+		WithIdempotentMethods(NewMethodID("", echoService, "Echo")),
+		WithAuthorizer(func(c context.Context, id MethodID, md metadata.MD) error {
+			if len(md.Get("authorization")) == 0 {
+				return status.Error(codes.PermissionDenied, "denied")
+			}
+			return nil
+		}),
+	)
+	tests := []struct {
+		name  string
+		event string
+		want  string
+	}{
+		{"first", idempotentEvent("k1", `{"authorization":["alice"]}`), `{"message":"a","count":1}`},
+		{"repeated", idempotentEvent("k1", `{"authorization":["alice"]}`), `{"message":"a","count":1}`},
+		{"other key", idempotentEvent("k2", `{"authorization":["alice"]}`), `{"message":"a","count":2}`},
+		{"other caller", idempotentEvent("k1", `{"authorization":["bob"]}`), `{"message":"a","count":3}`},
+	}
+	for _, tt := range tests {
+		got, err := serve(t, s, tt.event)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		assertJSON(t, got, tt.want)
+	}
+	// The stored result of a key is not served to unauthorized calls.
+	_, err := serve(t, s, idempotentEvent("k1", `{}`))
+	assertCode(t, err, codes.PermissionDenied)
+}
+
+func TestIdempotentConcurrentCalls(t *testing.T) {
+	entered, release := make(chan struct{}, 10), make(chan struct{})
+	var mu sync.Mutex
+	var calls int
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		entered <- struct{}{}
+		<-release
+		return echoReply(req), nil
+	}}, WithIdempotentMethods(NewMethodID("", echoService, "Echo")))
+	h := s.ApexHandler(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h([]byte(idempotentEvent("k", `{}`)), testApexContext())
+		}()
+	}
+	<-entered
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestIdempotentErrors(t *testing.T) {
+	var calls int
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		calls++
+		st, err := status.New(codes.FailedPrecondition, "not yet").WithDetails(&errdetails.ErrorInfo{Reason: "PENDING"})
+		if err != nil {
+			return nil, err
+		}
+		return nil, st.Err()
+	}}
+	id := NewMethodID("", echoService, "Echo")
+
+	s := newEchoServerWith(t, srv, WithIdempotentMethods(id))
+	serve(t, s, idempotentEvent("k", `{}`))
+	serve(t, s, idempotentEvent("k", `{}`))
+	if calls != 2 {
+		t.Errorf("calls = %d, want errors not stored by default", calls)
+	}
+
+	calls = 0
+	s = newEchoServerWith(t, srv, WithIdempotentMethods(id), WithIdempotentErrors())
+	for i := 0; i < 2; i++ {
+		_, err := serve(t, s, idempotentEvent("k", `{}`))
+		st := status.Convert(err)
+		if st.Code() != codes.FailedPrecondition || st.Message() != "not yet" || len(st.Details()) != 1 {
+			t.Fatalf("call %d: status = %v, details = %v, want the full stored status", i, st, st.Details())
+		}
+		if info, ok := st.Details()[0].(*errdetails.ErrorInfo); !ok || info.Reason != "PENDING" {
+			t.Errorf("call %d: detail = %v", i, st.Details()[0])
+		}
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
@@ -0,0 +1,105 @@
+package apexgrpc
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys holding the CallerIdentity of a call. Values sent under these
+// keys by the caller are dropped, so handlers can trust them.
+const (
+	InvokedFunctionARNMetadataKey  = "x-amz-invoked-function-arn"
+	CallerARNMetadataKey           = "x-caller-arn"
+	CallerAccountMetadataKey       = "x-caller-account-id"
+	CognitoIdentityMetadataKey     = "x-cognito-identity-id"
+	CognitoIdentityPoolMetadataKey = "x-cognito-identity-pool-id"
+	SourceIPMetadataKey            = "x-source-ip"
+)
+
+// CallerIdentity is what the Lambda invocation tells about its caller: the
+// apex.Context of the plain event path, and the request context of the API
+// Gateway, function URL and ALB adapters. Fields the trigger does not provide
+// are empty.
+type CallerIdentity struct {
+	InvokedFunctionARN    string
+	CallerARN             string
+	AccountID             string
+	CognitoIdentityID     string
+	CognitoIdentityPoolID string
+	SourceIP              string
+}
+
+type identityContextKey struct{}
+
+// CallerIdentityFromContext returns the identity of the caller of the method
+// being handled. It is set on every call, so it reports false only outside
+// handlers and interceptors.
+func CallerIdentityFromContext(c context.Context) (CallerIdentity, bool) {
+	id, ok := c.Value(identityContextKey{}).(*CallerIdentity)
+	if !ok {
+		return CallerIdentity{}, false
+	}
+	return *id, true
+}
+
+// NewCallerIdentityContext returns a copy of c carrying id, which the calls
+// made with it through Invoke report as their caller.
+func NewCallerIdentityContext(c context.Context, id CallerIdentity) context.Context {
+	return context.WithValue(c, identityContextKey{}, &id)
+}
+
+// callerIdentity merges the identity set by an adapter with what the
+// apex.Context of c tells.
+func callerIdentity(c context.Context) CallerIdentity {
+	id, _ := CallerIdentityFromContext(c)
+	if ctx, ok := FromContext(c); ok {
+		if id.InvokedFunctionARN == "" {
+			id.InvokedFunctionARN = ctx.InvokedFunctionARN
+		}
+		if id.CognitoIdentityID == "" {
+			id.CognitoIdentityID = ctx.Identity.CognitoIdentityID
+		}
+		if id.CognitoIdentityPoolID == "" {
+			id.CognitoIdentityPoolID = ctx.Identity.CognitoIdentityPoolID
+		}
+	}
+	return id
+}
+
+// withCallerIdentity sets the identity of the call in md, replacing values
+// sent by the caller, and in the returned context.
+func withCallerIdentity(c context.Context, md metadata.MD) context.Context {
+	id := callerIdentity(c)
+	for key, v := range map[string]string{
+		InvokedFunctionARNMetadataKey:  id.InvokedFunctionARN,
+		CallerARNMetadataKey:           id.CallerARN,
+		CallerAccountMetadataKey:       id.AccountID,
+		CognitoIdentityMetadataKey:     id.CognitoIdentityID,
+		CognitoIdentityPoolMetadataKey: id.CognitoIdentityPoolID,
+		SourceIPMetadataKey:            id.SourceIP,
+	} {
+		delete(md, key)
+		if v != "" {
+			md[key] = []string{v}
+		}
+	}
+	return NewCallerIdentityContext(c, id)
+}
+
+// forwardedFor returns the client address of an X-Forwarded-For header.
+func forwardedFor(header string) string {
+	if i := strings.IndexByte(header, ','); i >= 0 {
+		header = header[:i]
+	}
+	return strings.TrimSpace(header)
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
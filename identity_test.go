@@ -0,0 +1,138 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// identityServer returns a Server whose Echo method stores the caller
+// identity and metadata it was called with in id and md.
+func identityServer(t *testing.T, id *CallerIdentity, md *metadata.MD) *Server {
+	return newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		got, ok := CallerIdentityFromContext(c)
+		if !ok {
+			t.Error("no caller identity in the handler context")
+		}
+		*id = got
+		*md, _ = metadata.FromIncomingContext(c)
+		return echoReply(req), nil
+	}})
+}
+
+func TestCallerIdentityEvent(t *testing.T) {
+	var id CallerIdentity
+	var md metadata.MD
+	s := identityServer(t, &id, &md)
+	// The caller cannot set the identity keys itself.
+	_, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},
+		"metadata":{"x-caller-arn":["arn:aws:iam::1:root"],"x-source-ip":["10.0.0.1"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arn := testApexContext().InvokedFunctionARN
+	if id != (CallerIdentity{InvokedFunctionARN: arn}) {
+		t.Errorf("identity = %+v", id)
+	}
+	if got := md.Get(InvokedFunctionARNMetadataKey); len(got) != 1 || got[0] != arn {
+		t.Errorf("%s = %v", InvokedFunctionARNMetadataKey, got)
+	}
+	if got := md.Get(CallerARNMetadataKey); len(got) != 0 {
+		t.Errorf("spoofed %s = %v", CallerARNMetadataKey, got)
+	}
+	if got := md.Get(SourceIPMetadataKey); len(got) != 0 {
+		t.Errorf("spoofed %s = %v", SourceIPMetadataKey, got)
+	}
+
+	want := CallerIdentity{CallerARN: "arn:aws:iam::2:role/caller", AccountID: "2"}
+	c := NewCallerIdentityContext(context.Background(), want)
+	if _, err := s.Invoke(c, "", echoService, "Echo", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := md.Get(CallerAccountMetadataKey); id != want || len(got) != 1 || got[0] != "2" {
+		t.Errorf("Invoke identity = %+v, metadata %v", id, md)
+	}
+}
+
+func TestCallerIdentityAPIGateway(t *testing.T) {
+	var id CallerIdentity
+	var md metadata.MD
+	s := identityServer(t, &id, &md)
+	req := APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/apexgrpc.test.Echo/Echo", Body: "{}"}
+	req.RequestContext.Identity = APIGatewayIdentity{
+		SourceIP:              "203.0.113.7",
+		AccountID:             "123456789012",
+		UserARN:               "arn:aws:iam::123456789012:user/alice",
+		CognitoIdentityID:     "us-east-1:identity",
+		CognitoIdentityPoolID: "us-east-1:pool",
+	}
+	event, _ := json.Marshal(req)
+	if res := s.handleAPIGateway(context.Background(), event, testApexContext()); res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", res.StatusCode, res.Body)
+	}
+	want := CallerIdentity{
+		InvokedFunctionARN:    testApexContext().InvokedFunctionARN,
+		CallerARN:             "arn:aws:iam::123456789012:user/alice",
+		AccountID:             "123456789012",
+		CognitoIdentityID:     "us-east-1:identity",
+		CognitoIdentityPoolID: "us-east-1:pool",
+		SourceIP:              "203.0.113.7",
+	}
+	if id != want {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+	for key, v := range map[string]string{
+		CallerARNMetadataKey:           want.CallerARN,
+		CallerAccountMetadataKey:       want.AccountID,
+		CognitoIdentityMetadataKey:     want.CognitoIdentityID,
+		CognitoIdentityPoolMetadataKey: want.CognitoIdentityPoolID,
+		SourceIPMetadataKey:            want.SourceIP,
+	} {
+		if got := md.Get(key); len(got) != 1 || got[0] != v {
+			t.Errorf("%s = %v, want %q", key, got, v)
+		}
+	}
+}
+
+func TestCallerIdentityFunctionURL(t *testing.T) {
+	var id CallerIdentity
+	var md metadata.MD
+	s := identityServer(t, &id, &md)
+	req := FunctionURLRequest{RawPath: "/apexgrpc.test.Echo/Echo", Body: "{}"}
+	req.RequestContext.HTTP.SourceIP = "198.51.100.4"
+	req.RequestContext.Authorizer = &FunctionURLAuthorizer{IAM: &FunctionURLIAMAuthorizer{
+		AccountID: "210987654321",
+		UserARN:   "arn:aws:iam::210987654321:role/worker",
+	}}
+	res, ok := s.handleFunctionURL(context.Background(), functionURLEvent(t, req), testApexContext()).(*FunctionURLResponse)
+	if !ok || res.StatusCode != http.StatusOK {
+		t.Fatalf("response = %+v", res)
+	}
+	if id.SourceIP != "198.51.100.4" || id.AccountID != "210987654321" || id.CallerARN != "arn:aws:iam::210987654321:role/worker" {
+		t.Errorf("identity = %+v", id)
+	}
+
+	if _, ok := CallerIdentityFromContext(context.Background()); ok {
+		t.Error("CallerIdentityFromContext reports an identity outside a call")
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	for header, want := range map[string]string{
+		"203.0.113.7":             "203.0.113.7",
+		" 203.0.113.7 , 10.0.0.1": "203.0.113.7",
+		"":                        "",
+	} {
+		if got := forwardedFor(header); got != want {
+			t.Errorf("forwardedFor(%q) = %q, want %q", header, got, want)
+		}
+	}
+	if got := remoteIP("192.0.2.1:5555"); got != "192.0.2.1" {
+		t.Errorf("remoteIP = %q", got)
+	}
+}
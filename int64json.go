@@ -0,0 +1,222 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnsafeInt64Policy decides how WithInt64AsNumber encodes 64-bit integers
+// that a float64 cannot hold exactly.
+type UnsafeInt64Policy int
+
+const (
+	// KeepUnsafeInt64 leaves such values as strings.
+	KeepUnsafeInt64 UnsafeInt64Policy = iota
+	// FailOnUnsafeInt64 fails the reply with codes.OutOfRange.
+	FailOnUnsafeInt64
+)
+
+// maxSafeInteger is the largest integer up to which every integer is exactly
+// representable as a float64.
+const maxSafeInteger = 1<<53 - 1
+
+// WithInt64AsNumber encodes int64, uint64 and their fixed and zigzag variants
+// in JSON replies as numbers rather than the strings proto3 JSON mandates.
+// Fields are found through the reply's descriptor, so string fields are never
+// touched; values inside google.protobuf.Any are left as they are. Values past
+// 2^53 are handled as set by WithUnsafeInt64Policy.
+func WithInt64AsNumber() ServerOption {
+	return func(o *options) {
+		o.int64AsNumber = true
+	}
+}
+
+// WithUnsafeInt64Policy sets how WithInt64AsNumber handles values a float64
+// cannot hold exactly. The default is KeepUnsafeInt64.
+func WithUnsafeInt64Policy(p UnsafeInt64Policy) ServerOption {
+	return func(o *options) {
+		o.unsafeInt64Policy = p
+	}
+}
+
+// int64AsNumber rewrites the 64-bit integers of raw, the JSON form of a
+// message of type md.
+func (s *Server) int64AsNumber(md protoreflect.MessageDescriptor, raw json.RawMessage) (json.RawMessage, error) {
+	w := int64Rewriter{fail: s.opts.unsafeInt64Policy == FailOnUnsafeInt64}
+	if err := w.message(md, raw); err != nil {
+		return nil, err
+	}
+	mo := s.marshalOptions()
+	if !mo.Multiline {
+		return w.buf.Bytes(), nil
+	}
+	indent := mo.Indent
+	if indent == "" {
+		indent = "  "
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, w.buf.Bytes(), "", indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type int64Rewriter struct {
+	fail bool
+	buf  bytes.Buffer
+}
+
+// jsonMember is a member of a JSON object, in the order it appears.
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+func jsonObject(raw json.RawMessage) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var members []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		members = append(members, jsonMember{key: key, value: v})
+	}
+	return members, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return string(bytes.TrimSpace(raw)) == "null"
+}
+
+func (w *int64Rewriter) copy(raw json.RawMessage) error {
+	return json.Compact(&w.buf, raw)
+}
+
+func (w *int64Rewriter) message(md protoreflect.MessageDescriptor, raw json.RawMessage) error {
+	switch md.FullName() {
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return w.integer(md.FullName(), raw)
+	}
+	if wellKnownSchema(md) != nil || isJSONNull(raw) {
+		return w.copy(raw)
+	}
+	members, err := jsonObject(raw)
+	if err != nil {
+		return err
+	}
+	fields := md.Fields()
+	w.buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.buf.Write(appendJSONString(nil, m.key))
+		w.buf.WriteByte(':')
+		fd := fields.ByJSONName(m.key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(m.key))
+		}
+		if fd == nil {
+			// Extensions and Any members are copied as they are.
+			err = w.copy(m.value)
+		} else {
+			err = w.field(fd, m.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte('}')
+	return nil
+}
+
+func (w *int64Rewriter) field(fd protoreflect.FieldDescriptor, raw json.RawMessage) error {
+	if isJSONNull(raw) {
+		return w.copy(raw)
+	}
+	switch {
+	case fd.IsMap():
+		members, err := jsonObject(raw)
+		if err != nil {
+			return err
+		}
+		w.buf.WriteByte('{')
+		for i, m := range members {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.Write(appendJSONString(nil, m.key))
+			w.buf.WriteByte(':')
+			if err := w.singular(fd.MapValue(), m.value); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte('}')
+		return nil
+	case fd.IsList():
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+		w.buf.WriteByte('[')
+		for i, e := range elems {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			if err := w.singular(fd, e); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte(']')
+		return nil
+	}
+	return w.singular(fd, raw)
+}
+
+func (w *int64Rewriter) singular(fd protoreflect.FieldDescriptor, raw json.RawMessage) error {
+	switch fd.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return w.integer(fd.FullName(), raw)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return w.message(fd.Message(), raw)
+	}
+	return w.copy(raw)
+}
+
+// integer writes a string-encoded integer as a number when it is safe to.
+func (w *int64Rewriter) integer(name protoreflect.FullName, raw json.RawMessage) error {
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return w.copy(raw)
+	}
+	if !safeInteger(str) {
+		if w.fail {
+			return codedErrorf(codes.OutOfRange, "value %s of %s cannot be encoded exactly as a JSON number", str, name)
+		}
+		return w.copy(raw)
+	}
+	w.buf.WriteString(str)
+	return nil
+}
+
+func safeInteger(str string) bool {
+	if u, err := strconv.ParseUint(str, 10, 64); err == nil {
+		return u <= maxSafeInteger
+	}
+	i, err := strconv.ParseInt(str, 10, 64)
+	return err == nil && i >= -maxSafeInteger
+}
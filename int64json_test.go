@@ -0,0 +1,107 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// countServiceFiles describes apexgrpc.int64test.Counts:
+//
+//	message Count {
+//	  int64 total = 1; repeated uint64 samples = 2; map<string, sint64> by_key = 3;
+//	  map<int64, string> names = 4; Count child = 5; string label = 6;
+//	}
+//	service Counts { rpc Echo(Count) returns (Count); }
+func countServiceFiles() *descriptorpb.FileDescriptorSet {
+	opt, rep := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	field := func(name, jsonName string, n int32, t descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(jsonName),
+			Number:   proto.Int32(n),
+			Type:     t.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	entry := func(name string, key, value descriptorpb.FieldDescriptorProto_Type) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", "key", 1, key, opt, ""),
+				field("value", "value", 2, value, opt, ""),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("apexgrpc/test/count.proto"),
+		Package: proto.String("apexgrpc.int64test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Count"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("total", "total", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, opt, ""),
+				field("samples", "samples", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT64, rep, ""),
+				field("by_key", "byKey", 3, msg, rep, ".apexgrpc.int64test.Count.ByKeyEntry"),
+				field("names", "names", 4, msg, rep, ".apexgrpc.int64test.Count.NamesEntry"),
+				field("child", "child", 5, msg, opt, ".apexgrpc.int64test.Count"),
+				field("label", "label", 6, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				entry("ByKeyEntry", descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_SINT64),
+				entry("NamesEntry", descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Counts"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".apexgrpc.int64test.Count"),
+				OutputType: proto.String(".apexgrpc.int64test.Count"),
+			}},
+		}},
+	}}}
+}
+
+func countEvent(data string) string {
+	return `{"service":"apexgrpc.int64test.Counts","method":"Echo","data":` + data + `}`
+}
+
+func TestInt64AsNumber(t *testing.T) {
+	newServer := func(opts ...ServerOption) *Server {
+		s := NewServer(append([]ServerOption{WithInt64AsNumber()}, opts...)...)
+		if err := s.RegisterDynamic(countServiceFiles(), echoDynamic); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := newServer()
+	got, err := serve(t, s, countEvent(`{"total":"-5","samples":["1","2"],"byKey":{"a":"-3"},"names":{"7":"seven"},"label":"12","child":{"total":"9","child":{"samples":["4"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"total":-5,"samples":[1,2],"byKey":{"a":-3},"names":{"7":"seven"},"label":"12","child":{"total":9,"child":{"samples":[4]}}}`)
+
+	unsafe := countEvent(`{"total":"9007199254740993","samples":["9007199254740991"]}`)
+	got, err = serve(t, s, unsafe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"total":"9007199254740993","samples":[9007199254740991]}`)
+	_, err = serve(t, newServer(WithUnsafeInt64Policy(FailOnUnsafeInt64)), unsafe)
+	assertCode(t, err, codes.OutOfRange)
+
+	got, err = serve(t, newEchoServer(t, WithInt64AsNumber()), echoEvent("Echo", `{"id":"42","message":"42"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"id":42,"message":"42"}`)
+}
@@ -0,0 +1,84 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+const kinesisEventSource = "aws:kinesis"
+
+type KinesisEvent struct {
+	Records []KinesisEventRecord `json:"Records"`
+}
+
+type KinesisEventRecord struct {
+	EventID        string        `json:"eventID"`
+	EventName      string        `json:"eventName"`
+	EventSource    string        `json:"eventSource"`
+	EventSourceARN string        `json:"eventSourceARN"`
+	AWSRegion      string        `json:"awsRegion"`
+	Kinesis        KinesisRecord `json:"kinesis"`
+}
+
+type KinesisRecord struct {
+	PartitionKey                string  `json:"partitionKey"`
+	SequenceNumber              string  `json:"sequenceNumber"`
+	Data                        string  `json:"data"`
+	ApproximateArrivalTimestamp float64 `json:"approximateArrivalTimestamp"`
+	KinesisSchemaVersion        string  `json:"kinesisSchemaVersion"`
+}
+
+// WithKinesisMethod makes the Kinesis adapter treat each decoded record as the
+// request of method id instead of as an Event.
+func WithKinesisMethod(id MethodID) ServerOption {
+	return func(o *options) {
+		o.kinesisMethod = id
+	}
+}
+
+// RunKinesis serves Kinesis stream events whose records carry Events. Records
+// are processed in order; processing stops at the first failure, which is
+// reported as a batch item failure so the shard resumes from that record.
+func (s *Server) RunKinesis() {
+	s.RunKinesisWithContext(context.Background())
+}
+
+func (s *Server) RunKinesisWithContext(c context.Context) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.handleKinesis(c, eventMsg, ctx)
+	})
+}
+
+func (s *Server) handleKinesis(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (*BatchResponse, error) {
+	var event KinesisEvent
+	if err := json.Unmarshal(eventMsg, &event); err != nil || len(event.Records) == 0 {
+		return nil, invalidEventf("invalid Kinesis event")
+	}
+	return processOrdered(len(event.Records), func(i int) string {
+		return event.Records[i].Kinesis.SequenceNumber
+	}, func(i int) error {
+		return s.processKinesisRecord(c, &event.Records[i], ctx)
+	}), nil
+}
+
+func (s *Server) processKinesisRecord(c context.Context, record *KinesisEventRecord, ctx *apex.Context) error {
+	if record.EventSource != kinesisEventSource {
+		return codedErrorf(codes.InvalidArgument, "record %s is not a Kinesis record", record.EventID)
+	}
+	b, err := base64.StdEncoding.DecodeString(record.Kinesis.Data)
+	if err != nil {
+		return codedErrorf(codes.InvalidArgument, "invalid data in Kinesis record %s", record.EventID)
+	}
+	var event Event
+	if s.opts.kinesisMethod != "" {
+		event = methodEvent(s.opts.kinesisMethod, b)
+	} else if event, err = decodeEvent(b, s.opts.strictEvents); err != nil {
+		return invalidEventf("invalid event in Kinesis record %s: %v", record.EventID, err)
+	}
+	_, err = s.processEvent(c, &event, ctx)
+	return err
+}
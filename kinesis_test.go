@@ -0,0 +1,68 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func kinesisEvent(t *testing.T, data ...string) json.RawMessage {
+	t.Helper()
+	var event KinesisEvent
+	for i, d := range data {
+		event.Records = append(event.Records, KinesisEventRecord{
+			EventID:     "shard:" + string(rune('0'+i)),
+			EventSource: kinesisEventSource,
+			Kinesis: KinesisRecord{
+				SequenceNumber: string(rune('a' + i)),
+				Data:           base64.StdEncoding.EncodeToString([]byte(d)),
+			},
+		})
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKinesis(t *testing.T) {
+	var messages []string
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		messages = append(messages, stringField(req, "message"))
+		return echoReply(req), nil
+	}}
+	s := newEchoServerWith(t, srv)
+	res, err := s.handleKinesis(context.Background(), kinesisEvent(t,
+		echoEvent("Echo", `{"message":"one"}`),
+		echoEvent("Fail", `{"count":14}`),
+		echoEvent("Echo", `{"message":"three"}`),
+	), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BatchItemFailures) != 1 || res.BatchItemFailures[0].ItemIdentifier != "b" {
+		t.Errorf("failures = %+v, want the sequence number of the failed record", res.BatchItemFailures)
+	}
+	if len(messages) != 1 || messages[0] != "one" {
+		t.Errorf("handled %q, want processing to stop at the failure", messages)
+	}
+
+	messages = nil
+	s = newEchoServerWith(t, srv, WithKinesisMethod(NewMethodID("", echoService, "Echo")))
+	res, err = s.handleKinesis(context.Background(), kinesisEvent(t, `{"message":"raw"}`), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BatchItemFailures) != 0 || len(messages) != 1 || messages[0] != "raw" {
+		t.Errorf("failures = %+v, handled %q", res.BatchItemFailures, messages)
+	}
+
+	if _, err := s.handleKinesis(context.Background(), json.RawMessage(`{"Records":[]}`), testApexContext()); err == nil {
+		t.Error("event without records: err = nil")
+	}
+}
@@ -0,0 +1,66 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"golang.org/x/net/context"
+)
+
+// LambdaHandler is a handler for github.com/aws/aws-lambda-go/lambda.Start.
+type LambdaHandler func(c context.Context, eventMsg json.RawMessage) (interface{}, error)
+
+// Handler returns the handler Run serves events with, for use with the
+// aws-lambda-go runtime instead of apex. Handlers get the invocation context,
+// so lambdacontext.FromContext works in them, with values of c as fallback.
+// FromContext reports false since there is no apex.Context.
+func (s *Server) Handler(c context.Context) LambdaHandler {
+	return func(ic context.Context, eventMsg json.RawMessage) (interface{}, error) {
+		ic, cancel := s.withInvocationDeadline(baseValues{ic, c}, time.Now())
+		defer cancel()
+		ic, stop := cancelWith(ic, c)
+		defer stop()
+		res, err := s.admitted(s.recorded(s.handleEvent))(ic, eventMsg, nil)
+		return res, lambdaError(err)
+	}
+}
+
+// RunLambda serves events like Run on the aws-lambda-go runtime.
+func (s *Server) RunLambda() {
+	s.RunLambdaWithContext(context.Background())
+}
+
+func (s *Server) RunLambdaWithContext(c context.Context) {
+	lambda.Start(s.Handler(c))
+}
+
+// cancelWith returns a copy of c that is also canceled when base is done.
+func cancelWith(c context.Context, base context.Context) (context.Context, context.CancelFunc) {
+	if base.Done() == nil {
+		return c, func() {}
+	}
+	c, cancel := context.WithCancel(c)
+	go func() {
+		select {
+		case <-base.Done():
+			cancel()
+		case <-c.Done():
+		}
+	}()
+	return c, cancel
+}
+
+// baseValues is an invocation context that falls back to the values of a
+// base context.
+type baseValues struct {
+	context.Context
+	base context.Context
+}
+
+func (b baseValues) Value(key interface{}) interface{} {
+	if v := b.Context.Value(key); v != nil {
+		return v
+	}
+	return b.base.Value(key)
+}
@@ -0,0 +1,70 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ServiceConstructor builds the server of a service registered with
+// RegisterLazy.
+type ServiceConstructor func(c context.Context) (interface{}, error)
+
+// RegisterLazy adds the methods of desc like Register, building their server
+// with constructor on the first call of any of them. The server is kept for
+// the lifetime of the Server. If constructor fails, the call fails with
+// codes.Unavailable and the next call tries again. Concurrent first calls
+// wait for a single construction.
+func (s *Server) RegisterLazy(desc *grpc.ServiceDesc, constructor ServiceConstructor) error {
+	if constructor == nil {
+		return fmt.Errorf("missing constructor for service (%s)", serviceName(desc))
+	}
+	svc := Service{Desc: desc, lazy: &lazyServer{desc: desc, constructor: constructor}}
+	if err := s.checkReserved([]Service{svc}); err != nil {
+		return err
+	}
+	return s.registerServices([]Service{svc})
+}
+
+func serviceName(desc *grpc.ServiceDesc) string {
+	if desc == nil {
+		return ""
+	}
+	return desc.ServiceName
+}
+
+// lazyServer is the server of a service registered with RegisterLazy.
+type lazyServer struct {
+	desc        *grpc.ServiceDesc
+	constructor ServiceConstructor
+
+	mu     sync.Mutex
+	server interface{}
+}
+
+func (l *lazyServer) get(c context.Context) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.server != nil {
+		return l.server, nil
+	}
+	srv, err := l.constructor(c)
+	if err == nil && srv == nil {
+		err = fmt.Errorf("constructor returned no server")
+	}
+	if err == nil && l.desc.HandlerType != nil {
+		ht := reflect.TypeOf(l.desc.HandlerType).Elem()
+		if st := reflect.TypeOf(srv); !st.Implements(ht) {
+			err = fmt.Errorf("server of type %v does not implement %v", st, ht)
+		}
+	}
+	if err != nil {
+		return nil, wrapCodedf(codes.Unavailable, err, "constructing service (%s): %v", l.desc.ServiceName, err)
+	}
+	l.server = srv
+	return srv, nil
+}
@@ -0,0 +1,78 @@
+package apexgrpc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRegisterLazy(t *testing.T) {
+	var calls int32
+	fail := true
+	s := NewServer()
+	err := s.RegisterLazy(&echoServiceDesc, func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail {
+			return nil, errors.New("model not loaded")
+		}
+		return &echoServer{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.HasMethod(NewMethodID("", echoService, "Echo")) || len(s.Methods()) != 4 {
+		t.Errorf("Methods() before construction = %v", s.Methods())
+	}
+	if calls != 0 {
+		t.Errorf("constructor ran %d times at registration", calls)
+	}
+
+	_, err = serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.Unavailable)
+
+	fail = false
+	for i := 0; i < 2; i++ {
+		got, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSON(t, got, `{"message":"hi"}`)
+	}
+	if calls != 2 {
+		t.Errorf("constructor ran %d times, want 2: one failure and one success", calls)
+	}
+
+	if err := NewServer().RegisterLazy(&echoServiceDesc, nil); err == nil {
+		t.Error("RegisterLazy without a constructor succeeded")
+	}
+}
+
+func TestRegisterLazyConcurrent(t *testing.T) {
+	var calls int32
+	s := NewServer()
+	err := s.RegisterLazy(&echoServiceDesc, func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return &echoServer{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("constructor ran %d times, want 1", calls)
+	}
+}
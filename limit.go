@@ -0,0 +1,71 @@
+package apexgrpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConcurrencyOverflowPolicy decides what happens to calls of a method that is
+// at its concurrency limit.
+type ConcurrencyOverflowPolicy int
+
+const (
+	// QueueOnOverflow makes calls wait for a slot until their context is done.
+	QueueOnOverflow ConcurrencyOverflowPolicy = iota
+	// FailOnOverflow fails calls at once with codes.ResourceExhausted.
+	FailOnOverflow
+)
+
+// WithMethodConcurrencyLimit lets at most n calls of method id run at once,
+// across Invoke calls and concurrent batch events.
+func WithMethodConcurrencyLimit(id MethodID, n int) ServerOption {
+	return func(o *options) {
+		if o.concurrencyLimits == nil {
+			o.concurrencyLimits = map[MethodID]int{}
+		}
+		o.concurrencyLimits[id] = n
+	}
+}
+
+// WithConcurrencyOverflowPolicy sets how calls over a limit set with
+// WithMethodConcurrencyLimit are handled. The default is QueueOnOverflow.
+func WithConcurrencyOverflowPolicy(p ConcurrencyOverflowPolicy) ServerOption {
+	return func(o *options) {
+		o.overflowPolicy = p
+	}
+}
+
+func newLimiters(limits map[MethodID]int) map[MethodID]chan struct{} {
+	limiters := make(map[MethodID]chan struct{}, len(limits))
+	for id, n := range limits {
+		if n > 0 {
+			limiters[id] = make(chan struct{}, n)
+		}
+	}
+	return limiters
+}
+
+// acquire takes a concurrency slot for id, returning the function that
+// releases it.
+func (s *Server) acquire(c context.Context, id MethodID) (func(), error) {
+	sem, ok := s.limiters[id]
+	if !ok {
+		return func() {}, nil
+	}
+	release := func() { <-sem }
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if s.opts.overflowPolicy == FailOnOverflow {
+		return nil, codedErrorf(codes.ResourceExhausted, "method (%s) is at its limit of %d concurrent calls", id, cap(sem))
+	}
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	case <-c.Done():
+		return nil, status.FromContextError(c.Err()).Err()
+	}
+}
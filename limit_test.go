@@ -0,0 +1,59 @@
+package apexgrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// blockingEcho returns a handler that signals entered and waits for release.
+func blockingEcho(entered chan<- struct{}, release <-chan struct{}) *echoServer {
+	return &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		entered <- struct{}{}
+		<-release
+		return echoReply(req), nil
+	}}
+}
+
+func TestMethodConcurrencyLimit(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	tests := []struct {
+		name   string
+		policy ConcurrencyOverflowPolicy
+		code   codes.Code
+	}{
+		{"fail", FailOnOverflow, codes.ResourceExhausted},
+		{"queue", QueueOnOverflow, codes.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entered, release := make(chan struct{}, 1), make(chan struct{})
+			s := newEchoServerWith(t, blockingEcho(entered, release), WithMethodConcurrencyLimit(id, 1), WithConcurrencyOverflowPolicy(tt.policy))
+			first := make(chan error)
+			go func() {
+				_, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+				first <- err
+			}()
+			<-entered
+			c, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := s.Invoke(c, "", echoService, "Echo", map[string]string{})
+			assertCode(t, err, tt.code)
+			// Other methods are not limited.
+			_, err = s.Invoke(context.Background(), "", echoService, "Fail", map[string]int{"count": int(codes.NotFound)})
+			assertCode(t, err, codes.NotFound)
+			close(release)
+			if err := <-first; err != nil {
+				t.Errorf("first call: %v", err)
+			}
+			go func() { <-entered }()
+			if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{}); err != nil {
+				t.Errorf("call after the slot was freed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Log field names. They are part of the API so that log queries keep working
+// across releases.
+const (
+	LogFieldMethod       = "method"
+	LogFieldAlias        = "alias"
+	LogFieldService      = "service"
+	LogFieldPayloadBytes = "payload_bytes"
+	LogFieldDurationMS   = "duration_ms"
+	LogFieldCode         = "code"
+	LogFieldError        = "error"
+	LogFieldRequest      = "request"
+	LogFieldAttempt      = "attempt"
+)
+
+// Logger receives the server's log entries.
+type Logger interface {
+	Log(level LogLevel, msg string, fields map[string]interface{})
+}
+
+// WithLogger sets the logger. By default nothing is logged.
+func WithLogger(l Logger) ServerOption {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(LogLevel, string, map[string]interface{}) {}
+
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+// NewStdLogger adapts l to Logger, writing each entry at or above min as a
+// JSON object with "level" and "msg" keys next to its fields.
+func NewStdLogger(l *log.Logger, min LogLevel) Logger {
+	return stdLogger{l: l, min: min}
+}
+
+func (s stdLogger) Log(level LogLevel, msg string, fields map[string]interface{}) {
+	if level < s.min {
+		return
+	}
+	entry := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	b, err := json.Marshal(entry)
+	if err != nil {
+		s.l.Printf("%s %s %v", level, msg, fields)
+		return
+	}
+	s.l.Print(string(b))
+}
+
+func (s *Server) logger() Logger {
+	if s.opts.logger == nil {
+		return nopLogger{}
+	}
+	return s.opts.logger
+}
+
+func (s *Server) logEvent(event *Event) {
+	l := s.logger()
+	if _, ok := l.(nopLogger); ok {
+		return
+	}
+	fields := map[string]interface{}{}
+	if event.Method != nil {
+		fields[LogFieldMethod] = *event.Method
+	}
+	if event.Service != nil {
+		fields[LogFieldService] = *event.Service
+	}
+	var size int
+	if event.Data != nil {
+		size = len(*event.Data)
+	}
+	fields[LogFieldPayloadBytes] = size
+	l.Log(LevelDebug, "event received", fields)
+	if event.Service != nil && event.Method != nil && strings.Contains(*event.Method, "/") {
+		l.Log(LevelWarn, "full method string overrides event service", fields)
+	}
+}
+
+func (s *Server) logColdStart(duration time.Duration, err error) {
+	l := s.logger()
+	if _, ok := l.(nopLogger); ok {
+		return
+	}
+	fields := map[string]interface{}{
+		LogFieldDurationMS: float64(duration) / float64(time.Millisecond),
+	}
+	if err == nil {
+		l.Log(LevelInfo, "cold start initialized", fields)
+		return
+	}
+	fields[LogFieldError] = err.Error()
+	l.Log(LevelError, "cold start initialization failed", fields)
+}
+
+func (s *Server) logRetry(id MethodID, attempt int, err error) {
+	l := s.logger()
+	if _, ok := l.(nopLogger); ok {
+		return
+	}
+	l.Log(LevelWarn, "retrying method", map[string]interface{}{
+		LogFieldMethod:  id.String(),
+		LogFieldAttempt: attempt,
+		LogFieldCode:    CodeName(errorStatus(err).Code()),
+		LogFieldError:   err.Error(),
+	})
+}
+
+func (s *Server) logResult(id MethodID, alias MethodID, err error, duration time.Duration) {
+	l := s.logger()
+	if _, ok := l.(nopLogger); ok {
+		return
+	}
+	fields := map[string]interface{}{
+		LogFieldMethod:     id.String(),
+		LogFieldDurationMS: float64(duration) / float64(time.Millisecond),
+	}
+	if alias != "" {
+		fields[LogFieldAlias] = alias.String()
+	}
+	if err == nil {
+		fields[LogFieldCode] = CodeName(codes.OK)
+		l.Log(LevelInfo, "method completed", fields)
+		return
+	}
+	fields[LogFieldCode] = CodeName(errorStatus(err).Code())
+	fields[LogFieldError] = err.Error()
+	var notFound *MethodNotFoundError
+	var decode *DecodeError
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &notFound):
+		l.Log(LevelWarn, "method not found", fields)
+	case errors.As(err, &decode):
+		fields[LogFieldError] = decode.Err.Error()
+		l.Log(LevelWarn, "decode failed", fields)
+	case errors.As(err, &invalid):
+		l.Log(LevelWarn, "validation failed", fields)
+	default:
+		l.Log(LevelError, "method failed", fields)
+	}
+}
@@ -0,0 +1,215 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataEnvelope wraps a reply together with the header and trailer
+// metadata set by the handler. It is returned when WithMetadataEnvelope is
+// enabled.
+type MetadataEnvelope struct {
+	Data     interface{}       `json:"data"`
+	Metadata *ResponseMetadata `json:"metadata,omitempty"`
+	// PartialStatus is the status set under the key of WithTrailerStatusKey.
+	PartialStatus *ErrorBody `json:"partialStatus,omitempty"`
+}
+
+type ResponseMetadata struct {
+	Header  map[string][]string `json:"header,omitempty"`
+	Trailer map[string][]string `json:"trailer,omitempty"`
+}
+
+func isBinaryKey(key string) bool {
+	return strings.HasSuffix(key, "-bin")
+}
+
+// incomingMetadata converts event metadata to gRPC metadata. Values of
+// "-bin" keys are base64 encoded on the wire.
+func incomingMetadata(m map[string][]string) (metadata.MD, error) {
+	md := metadata.MD{}
+	for k, vals := range m {
+		key := strings.ToLower(k)
+		for _, v := range vals {
+			if isBinaryKey(key) {
+				b, err := decodeBinaryValue(v)
+				if err != nil {
+					return nil, codedErrorf(codes.InvalidArgument, "invalid metadata value for key %q", k)
+				}
+				v = string(b)
+			}
+			md[key] = append(md[key], v)
+		}
+	}
+	return md, nil
+}
+
+// WithDefaultMetadata adds md to the incoming metadata of every call. Keys the
+// event sets keep only the event's values, and options given several times
+// append values for the same key.
+func WithDefaultMetadata(md metadata.MD) ServerOption {
+	return func(o *options) {
+		o.defaultMetadata = joinMetadata(o.defaultMetadata, md)
+	}
+}
+
+// WithServiceMetadata adds md to the incoming metadata of calls of the
+// service, such as "pkg.Service", like WithDefaultMetadata does for every
+// call. Its values for a key follow those of WithDefaultMetadata.
+func WithServiceMetadata(service string, md metadata.MD) ServerOption {
+	return func(o *options) {
+		if o.serviceMetadata == nil {
+			o.serviceMetadata = map[string]metadata.MD{}
+		}
+		o.serviceMetadata[service] = joinMetadata(o.serviceMetadata[service], md)
+	}
+}
+
+// joinMetadata is metadata.Join with lowercase keys.
+func joinMetadata(mds ...metadata.MD) metadata.MD {
+	out := metadata.MD{}
+	for _, md := range mds {
+		for k, vals := range md {
+			key := strings.ToLower(k)
+			out[key] = append(out[key], vals...)
+		}
+	}
+	return out
+}
+
+// withStaticMetadata adds the metadata of WithDefaultMetadata and
+// WithServiceMetadata to md for keys md does not set. The values are copied,
+// so that handlers changing them do not affect later calls.
+func (s *Server) withStaticMetadata(id MethodID, md metadata.MD) metadata.MD {
+	svc, _ := id.split()
+	statics := []metadata.MD{s.opts.defaultMetadata, s.opts.serviceMetadata[svc]}
+	if len(statics[0]) == 0 && len(statics[1]) == 0 {
+		return md
+	}
+	out := make(metadata.MD, len(md))
+	for k, vals := range md {
+		out[k] = vals
+	}
+	for _, static := range statics {
+		for k, vals := range static {
+			if _, ok := md[k]; ok {
+				continue
+			}
+			out[k] = append(out[k], vals...)
+		}
+	}
+	return out
+}
+
+func decodeBinaryValue(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+func encodeMetadata(md metadata.MD) map[string][]string {
+	if len(md) == 0 {
+		return nil
+	}
+	m := make(map[string][]string, len(md))
+	for k, vals := range md {
+		for _, v := range vals {
+			if isBinaryKey(k) {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			m[k] = append(m[k], v)
+		}
+	}
+	return m
+}
+
+// errHeaderSent is returned when header metadata is set after SendHeader, as
+// grpc.Server does.
+var errHeaderSent = status.Error(codes.Internal, "transport: the stream is done or WriteHeader was already called")
+
+// outgoingMetadata collects the header and trailer metadata a handler sets.
+type outgoingMetadata struct {
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+	sent    bool
+}
+
+func (o *outgoingMetadata) setHeader(md metadata.MD) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.sent {
+		return errHeaderSent
+	}
+	o.header = metadata.Join(o.header, md)
+	return nil
+}
+
+// sendHeader sets md and closes the header metadata. Nothing is sent before
+// the reply, so this only makes later calls fail as they would on a real
+// transport.
+func (o *outgoingMetadata) sendHeader(md metadata.MD) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.sent {
+		return errHeaderSent
+	}
+	o.header = metadata.Join(o.header, md)
+	o.sent = true
+	return nil
+}
+
+// snapshot returns copies of the header and trailer metadata set so far.
+func (o *outgoingMetadata) snapshot() (metadata.MD, metadata.MD) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.header.Copy(), o.trailer.Copy()
+}
+
+// reset discards the metadata of a failed attempt.
+func (o *outgoingMetadata) reset() {
+	o.mu.Lock()
+	o.header, o.trailer, o.sent = nil, nil, false
+	o.mu.Unlock()
+}
+
+func (o *outgoingMetadata) setTrailer(md metadata.MD) {
+	o.mu.Lock()
+	o.trailer = metadata.Join(o.trailer, md)
+	o.mu.Unlock()
+}
+
+// transportStream lets unary handlers call grpc.SetHeader and grpc.SetTrailer.
+type transportStream struct {
+	id MethodID
+	md *outgoingMetadata
+}
+
+func (ts *transportStream) Method() string {
+	return "/" + ts.id.String()
+}
+
+func (ts *transportStream) SetHeader(md metadata.MD) error {
+	return ts.md.setHeader(md)
+}
+
+func (ts *transportStream) SendHeader(md metadata.MD) error {
+	return ts.md.sendHeader(md)
+}
+
+func (ts *transportStream) SetTrailer(md metadata.MD) error {
+	ts.md.setTrailer(md)
+	return nil
+}
+
+func newTransportContext(c context.Context, id MethodID, md *outgoingMetadata) context.Context {
+	return grpc.NewContextWithServerTransportStream(c, &transportStream{id: id, md: md})
+}
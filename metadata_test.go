@@ -0,0 +1,158 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// metadataEcho replies with the values of the incoming "x-user" and
+// "x-token-bin" metadata and sets header and trailer metadata.
+func metadataEcho(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+	md, _ := metadata.FromIncomingContext(c)
+	msg := newEchoRequestFrom(md.Get("x-user"), md.Get("x-token-bin"))
+	if err := grpc.SetHeader(c, metadata.Pairs("x-header", "h", "x-data-bin", "\x00\x01")); err != nil {
+		return nil, err
+	}
+	if err := grpc.SetTrailer(c, metadata.Pairs("x-trailer", "t")); err != nil {
+		return nil, err
+	}
+	return echoReply(msg), nil
+}
+
+func newEchoRequestFrom(users, tokens []string) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(echoRequestMD)
+	if len(users) > 0 {
+		m.Set(echoRequestMD.Fields().ByName("message"), protoreflect.ValueOfString(users[0]))
+	}
+	if len(tokens) > 0 {
+		m.Set(echoRequestMD.Fields().ByName("secret"), protoreflect.ValueOfString(tokens[0]))
+	}
+	return m
+}
+
+func TestEventMetadata(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: metadataEcho}, WithMetadataEnvelope())
+	got, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},
+		"metadata":{"X-User":["alice"],"x-token-bin":["dG9rZW4="]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"data":{"message":"alice","secret":"token"},
+		"metadata":{"header":{"x-header":["h"],"x-data-bin":["AAE="]},"trailer":{"x-trailer":["t"]}}}`)
+
+	_, err = serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},"metadata":{"x-token-bin":["not base64!"]}}`)
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestHTTPMetadataHeaders(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: metadataEcho})
+	event, _ := json.Marshal(APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Path:       "/apexgrpc.test.Echo/Echo",
+		Headers:    map[string]string{"X-User": "alice"},
+	})
+	res := s.handleAPIGateway(context.Background(), event, testApexContext())
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", res.StatusCode, res.Body)
+	}
+	assertJSON(t, res.Body, `{"message":"alice"}`)
+	want := map[string]string{
+		"Grpc-Metadata-X-Header":   "h",
+		"Grpc-Metadata-X-Data-Bin": "AAE=",
+		"Grpc-Trailer-X-Trailer":   "t",
+	}
+	for k, v := range want {
+		if got := res.Headers[k]; got != v {
+			t.Errorf("header %s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestSendHeader(t *testing.T) {
+	var setErr error
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		if err := grpc.SendHeader(c, metadata.Pairs("x-sent", "1")); err != nil {
+			return nil, err
+		}
+		setErr = grpc.SetHeader(c, metadata.Pairs("x-late", "1"))
+		return echoReply(req), nil
+	}}, WithMetadataEnvelope())
+	got, err := serve(t, s, echoEvent("Echo", `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"data":{},"metadata":{"header":{"x-sent":["1"]}}}`)
+	assertCode(t, setErr, codes.Internal)
+}
+
+func TestStaticMetadata(t *testing.T) {
+	var got metadata.MD
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ := metadata.FromIncomingContext(c)
+		got = md.Copy()
+		for k := range md {
+			md[k][0] = "mutated"
+		}
+		md.Append("x-tenant", "appended")
+		return echoReply(req), nil
+	}},
+		WithDefaultMetadata(metadata.Pairs("x-tenant", "acme", "x-region", "us")),
+		WithDefaultMetadata(metadata.Pairs("X-Region", "eu")),
+		WithServiceMetadata(echoService, metadata.Pairs("x-region", "svc", "x-service", "echo")),
+		WithServiceMetadata("other.Service", metadata.Pairs("x-other", "1")),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+			t.Fatal(err)
+		}
+		want := metadata.MD{"x-tenant": {"acme"}, "x-region": {"us", "eu", "svc"}, "x-service": {"echo"}}
+		for k, vals := range want {
+			if !reflect.DeepEqual(got[k], vals) {
+				t.Errorf("call %d: %s = %q, want %q", i, k, got[k], vals)
+			}
+		}
+		if got["x-other"] != nil {
+			t.Errorf("call %d: metadata of another service leaked: %v", i, got)
+		}
+	}
+
+	if _, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},"metadata":{"X-Tenant":["event"]}}`); err != nil {
+		t.Fatal(err)
+	}
+	if vals := got["x-tenant"]; !reflect.DeepEqual(vals, []string{"event"}) {
+		t.Errorf("x-tenant set by the event = %q, want only the event's value", vals)
+	}
+	if vals := got["x-region"]; len(vals) != 3 {
+		t.Errorf("x-region = %q, want the static values", vals)
+	}
+}
+
+func TestInvalidMetadataError(t *testing.T) {
+	var mapped MethodID
+	var log bytes.Buffer
+	s := newEchoServer(t, WithAccessLog(&log), WithErrorMapper(func(c context.Context, id MethodID, err error) (interface{}, error) {
+		mapped = id
+		return nil, err
+	}))
+	_, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},"metadata":{"x-token-bin":["not base64!"]}}`)
+	assertCode(t, err, codes.InvalidArgument)
+	want := NewMethodID("", echoService, "Echo")
+	if mapped != want {
+		t.Errorf("ErrorMapper saw %q, want %q", mapped, want)
+	}
+	var entry AccessLogEntry
+	if err := json.Unmarshal(log.Bytes(), &entry); err != nil || entry.Method != want.String() {
+		t.Errorf("access log = %s, want the method %s", log.String(), want)
+	}
+}
@@ -0,0 +1,276 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// MetricsRecorder is told about every call of a registered method. Calls for
+// unknown methods are not recorded.
+type MetricsRecorder interface {
+	RecordInvocation(id MethodID, duration time.Duration, code codes.Code)
+}
+
+// AliasRecorder is implemented by MetricsRecorders that want to know the
+// alias a call was addressed by. It is used in place of RecordInvocation for
+// such calls.
+type AliasRecorder interface {
+	RecordAliasInvocation(id MethodID, alias MethodID, duration time.Duration, code codes.Code)
+}
+
+// WithMetricsRecorder sets the recorder of method calls. A recorder that
+// panics does not affect the call.
+func WithMetricsRecorder(r MetricsRecorder) ServerOption {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+// MethodStats are the counters of one method.
+type MethodStats struct {
+	Invocations   int64
+	Errors        int64
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+	// CacheHits and CacheMisses count lookups in the response cache of
+	// WithCachedMethods.
+	CacheHits   int64
+	CacheMisses int64
+}
+
+type stats struct {
+	mu      sync.Mutex
+	methods map[MethodID]MethodStats
+}
+
+func (st *stats) record(id MethodID, duration time.Duration, code codes.Code) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.methods == nil {
+		st.methods = map[MethodID]MethodStats{}
+	}
+	m := st.methods[id]
+	m.Invocations++
+	if code != codes.OK {
+		m.Errors++
+	}
+	m.TotalDuration += duration
+	if duration > m.MaxDuration {
+		m.MaxDuration = duration
+	}
+	st.methods[id] = m
+}
+
+func (st *stats) recordCacheLookup(id MethodID, hit bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.methods == nil {
+		st.methods = map[MethodID]MethodStats{}
+	}
+	m := st.methods[id]
+	if hit {
+		m.CacheHits++
+	} else {
+		m.CacheMisses++
+	}
+	st.methods[id] = m
+}
+
+// Stats returns a snapshot of the counters of every method called so far.
+func (s *Server) Stats() map[MethodID]MethodStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	snap := make(map[MethodID]MethodStats, len(s.stats.methods))
+	for id, m := range s.stats.methods {
+		snap[id] = m
+	}
+	return snap
+}
+
+func (s *Server) recordInvocation(id MethodID, alias MethodID, duration time.Duration, err error) {
+	code := Code(err)
+	s.stats.record(id, duration, code)
+	if s.opts.metrics == nil {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	if ar, ok := s.opts.metrics.(AliasRecorder); ok && alias != "" {
+		ar.RecordAliasInvocation(id, alias, duration, code)
+		return
+	}
+	s.opts.metrics.RecordInvocation(id, duration, code)
+}
+
+// InvocationRecord is a call captured by MemoryRecorder.
+type InvocationRecord struct {
+	ID       MethodID
+	Alias    MethodID
+	Duration time.Duration
+	Code     codes.Code
+	// Shadow marks calls of a WithShadow function.
+	Shadow bool
+}
+
+// MemoryRecorder keeps every recorded call in memory.
+type MemoryRecorder struct {
+	mu       sync.Mutex
+	records  []InvocationRecord
+	lookups  []CacheLookupRecord
+	attempts []AttemptRecord
+}
+
+func (r *MemoryRecorder) RecordInvocation(id MethodID, duration time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, InvocationRecord{ID: id, Duration: duration, Code: code})
+}
+
+func (r *MemoryRecorder) RecordAliasInvocation(id MethodID, alias MethodID, duration time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, InvocationRecord{ID: id, Alias: alias, Duration: duration, Code: code})
+}
+
+func (r *MemoryRecorder) RecordShadowInvocation(id MethodID, duration time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, InvocationRecord{ID: id, Duration: duration, Code: code, Shadow: true})
+}
+
+// CacheLookupRecord is a response cache lookup captured by MemoryRecorder.
+type CacheLookupRecord struct {
+	ID  MethodID
+	Hit bool
+}
+
+func (r *MemoryRecorder) RecordCacheLookup(id MethodID, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups = append(r.lookups, CacheLookupRecord{ID: id, Hit: hit})
+}
+
+// CacheLookups returns the cache lookups recorded so far, oldest first.
+func (r *MemoryRecorder) CacheLookups() []CacheLookupRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CacheLookupRecord(nil), r.lookups...)
+}
+
+// AttemptRecord is an attempt of a retried call captured by MemoryRecorder.
+type AttemptRecord struct {
+	ID       MethodID
+	Attempt  int
+	Duration time.Duration
+	Code     codes.Code
+}
+
+func (r *MemoryRecorder) RecordAttempt(id MethodID, attempt int, duration time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, AttemptRecord{ID: id, Attempt: attempt, Duration: duration, Code: code})
+}
+
+// Attempts returns the attempts recorded so far, oldest first.
+func (r *MemoryRecorder) Attempts() []AttemptRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AttemptRecord(nil), r.attempts...)
+}
+
+// Records returns the calls recorded so far, oldest first.
+func (r *MemoryRecorder) Records() []InvocationRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]InvocationRecord(nil), r.records...)
+}
+
+type emfRecorder struct {
+	mu        sync.Mutex
+	w         io.Writer
+	namespace string
+}
+
+// NewEMFRecorder returns a recorder that writes one CloudWatch Embedded Metric
+// Format line per call to w, or to stdout if w is nil. Each line carries the
+// Invocations, Errors and Latency metrics under the Service and Method
+// dimensions.
+func NewEMFRecorder(w io.Writer, namespace string) MetricsRecorder {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &emfRecorder{w: w, namespace: namespace}
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfEntry struct {
+	AWS         emfMetadata `json:"_aws"`
+	Service     string      `json:"Service"`
+	Method      string      `json:"Method"`
+	Alias       string      `json:"Alias,omitempty"`
+	Code        string      `json:"Code"`
+	Invocations int         `json:"Invocations"`
+	Errors      int         `json:"Errors"`
+	Latency     float64     `json:"Latency"`
+}
+
+func (r *emfRecorder) RecordInvocation(id MethodID, duration time.Duration, code codes.Code) {
+	r.RecordAliasInvocation(id, "", duration, code)
+}
+
+// RecordAliasInvocation adds the alias as a property, keeping the dimensions
+// of the canonical method.
+func (r *emfRecorder) RecordAliasInvocation(id MethodID, alias MethodID, duration time.Duration, code codes.Code) {
+	svc, mtd := id.split()
+	entry := emfEntry{
+		AWS: emfMetadata{
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  r.namespace,
+				Dimensions: [][]string{{"Service", "Method"}},
+				Metrics: []emfMetric{
+					{Name: "Invocations", Unit: "Count"},
+					{Name: "Errors", Unit: "Count"},
+					{Name: "Latency", Unit: "Milliseconds"},
+				},
+			}},
+		},
+		Service:     svc,
+		Method:      mtd,
+		Alias:       alias.String(),
+		Code:        CodeName(code),
+		Invocations: 1,
+		Latency:     float64(duration) / float64(time.Millisecond),
+	}
+	if code != codes.OK {
+		entry.Errors = 1
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(b, '\n'))
+}
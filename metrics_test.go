@@ -0,0 +1,64 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+type panickingRecorder struct{}
+
+func (panickingRecorder) RecordInvocation(MethodID, time.Duration, codes.Code) {
+	panic("recorder")
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	rec := &MemoryRecorder{}
+	s := newEchoServer(t, WithMetricsRecorder(rec))
+	serve(t, s, echoEvent("Echo", `{}`))
+	serve(t, s, echoEvent("Fail", `{"count":5}`))
+	records := rec.Records()
+	if len(records) != 2 {
+		t.Fatalf("records = %+v, want 2", records)
+	}
+	if records[0].ID != "apexgrpc.test.Echo/Echo" || records[0].Code != codes.OK {
+		t.Errorf("first record = %+v", records[0])
+	}
+	if records[1].ID != "apexgrpc.test.Echo/Fail" || records[1].Code != codes.NotFound {
+		t.Errorf("second record = %+v", records[1])
+	}
+	stats := s.Stats()["apexgrpc.test.Echo/Fail"]
+	if stats.Invocations != 1 || stats.Errors != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	s = newEchoServer(t, WithMetricsRecorder(panickingRecorder{}))
+	if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+		t.Errorf("call with a panicking recorder: %v", err)
+	}
+}
+
+func TestEMFRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEchoServer(t, WithMetricsRecorder(NewEMFRecorder(&buf, "Test")))
+	serve(t, s, echoEvent("Fail", `{"count":3}`))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrote %q, want one line", buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["Service"] != echoService || entry["Method"] != "Fail" || entry["Code"] != "INVALID_ARGUMENT" || entry["Errors"] != 1.0 || entry["Invocations"] != 1.0 {
+		t.Errorf("entry = %v", entry)
+	}
+	directives := entry["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})
+	if ns := directives[0].(map[string]interface{})["Namespace"]; ns != "Test" {
+		t.Errorf("namespace = %v", ns)
+	}
+}
@@ -0,0 +1,634 @@
+// Package msgpack lets an apexgrpc.Server take request data and return
+// replies in MessagePack, for producers to which JSON payloads are too large.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// Encoding is the event encoding of MessagePack data.
+const Encoding = "msgpack"
+
+// maxDepth bounds the nesting of the values converted.
+const maxDepth = 10000
+
+// WithMsgPack accepts events with the "msgpack" encoding, whose data is
+// base64-encoded MessagePack, and returns their replies the same way.
+func WithMsgPack() apexgrpc.ServerOption {
+	return apexgrpc.WithEncoding(Encoding, Transcoder{})
+}
+
+// Transcoder converts between MessagePack and proto3 JSON, guided by the
+// message descriptor so that no precision is lost:
+//
+//   - messages are maps keyed by field name, JSON or proto, or by number;
+//   - integers keep every bit, and 64-bit integer fields of replies are
+//     integers rather than the strings of proto3 JSON;
+//   - bytes fields are bin values;
+//   - google.protobuf.Timestamp values may be timestamp extensions, and are
+//     in replies.
+type Transcoder struct{}
+
+// target is what a value converts to: a message, a whole map or repeated
+// field, or a scalar of a kind. Its zero value converts generically.
+type target struct {
+	md    protoreflect.MessageDescriptor
+	field protoreflect.FieldDescriptor
+	kind  protoreflect.Kind
+}
+
+// fieldTarget is the target of the value of fd.
+func fieldTarget(fd protoreflect.FieldDescriptor) target {
+	if fd == nil {
+		return target{}
+	}
+	if fd.IsMap() || fd.IsList() {
+		return target{field: fd}
+	}
+	return elemTarget(fd)
+}
+
+// elemTarget is the target of a single element of fd.
+func elemTarget(fd protoreflect.FieldDescriptor) target {
+	switch k := fd.Kind(); k {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageTarget(fd.Message())
+	default:
+		return target{kind: k}
+	}
+}
+
+// messageTarget handles the well-known types whose JSON form is a scalar.
+func messageTarget(md protoreflect.MessageDescriptor) target {
+	switch md.FullName() {
+	case "google.protobuf.Int64Value":
+		return target{kind: protoreflect.Int64Kind}
+	case "google.protobuf.UInt64Value":
+		return target{kind: protoreflect.Uint64Kind}
+	case "google.protobuf.BytesValue":
+		return target{kind: protoreflect.BytesKind}
+	case "google.protobuf.FloatValue":
+		return target{kind: protoreflect.FloatKind}
+	case "google.protobuf.DoubleValue":
+		return target{kind: protoreflect.DoubleKind}
+	}
+	return target{md: md}
+}
+
+func (t target) mapKey(key string) (string, target) {
+	switch {
+	case t.md != nil:
+		fields := t.md.Fields()
+		fd := fields.ByJSONName(key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(key))
+		}
+		return key, fieldTarget(fd)
+	case t.field != nil && t.field.IsMap():
+		return key, elemTarget(t.field.MapValue())
+	}
+	return key, target{}
+}
+
+func (t target) listElem() target {
+	if t.field != nil && t.field.IsList() {
+		return elemTarget(t.field)
+	}
+	return target{}
+}
+
+func (t target) isTimestamp() bool {
+	return t.md != nil && t.md.FullName() == "google.protobuf.Timestamp"
+}
+
+// ToJSON converts a MessagePack message of type md to JSON.
+func (Transcoder) ToJSON(data []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	d := &decoder{in: data}
+	if err := d.value(messageTarget(md), 0); err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.in) {
+		return nil, fmt.Errorf("msgpack: unexpected data at offset %d", d.pos)
+	}
+	return d.out.Bytes(), nil
+}
+
+type decoder struct {
+	in  []byte
+	pos int
+	out bytes.Buffer
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.in)-d.pos < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.in[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *decoder) writeString(s string) {
+	b, _ := json.Marshal(s)
+	d.out.Write(b)
+}
+
+func (d *decoder) value(t target, depth int) error {
+	if depth > maxDepth {
+		return errors.New("msgpack: nested too deeply")
+	}
+	b, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		d.out.WriteString(strconv.Itoa(int(c)))
+		return nil
+	case c >= 0xe0:
+		d.out.WriteString(strconv.Itoa(int(int8(c))))
+		return nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c&0x0f), t, depth)
+	case c&0xf0 == 0x90:
+		return d.arrayValue(int(c&0x0f), t, depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		d.out.WriteString("null")
+	case 0xc2:
+		d.out.WriteString("false")
+	case 0xc3:
+		d.out.WriteString("true")
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+		d.out.WriteString(strconv.FormatUint(v, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		v, err := d.uint(n)
+		if err != nil {
+			return err
+		}
+		// Sign-extend from n bytes.
+		shift := uint(64 - 8*n)
+		d.out.WriteString(strconv.FormatInt(int64(v<<shift)>>shift, 10))
+	case 0xca:
+		v, err := d.uint(4)
+		if err != nil {
+			return err
+		}
+		d.float(float64(math.Float32frombits(uint32(v))), 32)
+	case 0xcb:
+		v, err := d.uint(8)
+		if err != nil {
+			return err
+		}
+		d.float(math.Float64frombits(v), 64)
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return err
+		}
+		b, err := d.read(int(n))
+		if err != nil {
+			return err
+		}
+		d.writeString(base64.StdEncoding.EncodeToString(b))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return err
+		}
+		return d.arrayValue(int(n), t, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return err
+		}
+		return d.mapValue(int(n), t, depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return err
+		}
+		return d.ext(int(n))
+	default:
+		return fmt.Errorf("msgpack: invalid type byte 0x%02x at offset %d", c, d.pos-1)
+	}
+	return nil
+}
+
+func (d *decoder) float(f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		d.out.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		d.out.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		d.out.WriteString(`"-Infinity"`)
+	default:
+		d.out.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
+
+func (d *decoder) str(n int) error {
+	b, err := d.read(n)
+	if err != nil {
+		return err
+	}
+	d.writeString(string(b))
+	return nil
+}
+
+// ext converts the timestamp extension to its RFC 3339 JSON form. Other
+// extension types have no JSON form.
+func (d *decoder) ext(n int) error {
+	typ, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return err
+	}
+	if int8(typ[0]) != -1 {
+		return fmt.Errorf("msgpack: unsupported extension type %d", int8(typ[0]))
+	}
+	var sec int64
+	var nsec uint32
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(b))
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		nsec, sec = uint32(v>>34), int64(v&(1<<34-1))
+	case 12:
+		nsec, sec = binary.BigEndian.Uint32(b), int64(binary.BigEndian.Uint64(b[4:]))
+	default:
+		return fmt.Errorf("msgpack: invalid timestamp of %d bytes", n)
+	}
+	d.writeString(time.Unix(sec, int64(nsec)).UTC().Format(time.RFC3339Nano))
+	return nil
+}
+
+func (d *decoder) arrayValue(n int, t target, depth int) error {
+	d.out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		if err := d.value(t.listElem(), depth+1); err != nil {
+			return err
+		}
+	}
+	d.out.WriteByte(']')
+	return nil
+}
+
+func (d *decoder) mapValue(n int, t target, depth int) error {
+	d.out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		key, err := d.key(t)
+		if err != nil {
+			return err
+		}
+		key, vt := t.mapKey(key)
+		d.writeString(key)
+		d.out.WriteByte(':')
+		if err := d.value(vt, depth+1); err != nil {
+			return err
+		}
+	}
+	d.out.WriteByte('}')
+	return nil
+}
+
+// key reads a map key, which must be a string or an integer. Integer keys of
+// messages are field numbers.
+func (d *decoder) key(t target) (string, error) {
+	start := d.pos
+	sub := &decoder{in: d.in, pos: d.pos}
+	if err := sub.value(target{}, maxDepth); err != nil {
+		return "", err
+	}
+	d.pos = sub.pos
+	raw := sub.out.Bytes()
+	if len(raw) > 0 && raw[0] == '"' {
+		var key string
+		err := json.Unmarshal(raw, &key)
+		return key, err
+	}
+	num, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("msgpack: unsupported map key at offset %d", start)
+	}
+	if t.md != nil {
+		if fd := t.md.Fields().ByNumber(protoreflect.FieldNumber(num)); fd != nil {
+			return fd.JSONName(), nil
+		}
+	}
+	return string(raw), nil
+}
+
+// FromJSON converts the JSON form of a message of type md to MessagePack.
+func (Transcoder) FromJSON(data []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	n, err := parseJSON(dec, 0)
+	if err != nil {
+		return nil, err
+	}
+	e := &encoder{}
+	if err := e.value(n, messageTarget(md)); err != nil {
+		return nil, err
+	}
+	return e.out.Bytes(), nil
+}
+
+// node is a parsed JSON value, keeping the order of object members.
+type node struct {
+	// kind is '{', '[', '"', '0' for numbers, 't' for booleans or 'n'.
+	kind byte
+	text string
+	b    bool
+	keys []string
+	vals []*node
+}
+
+func parseJSON(dec *json.Decoder, depth int) (*node, error) {
+	if depth > maxDepth {
+		return nil, errors.New("json nested too deeply")
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		n := &node{kind: byte(v)}
+		for dec.More() {
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			val, err := parseJSON(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			n.vals = append(n.vals, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &node{kind: '"', text: v}, nil
+	case json.Number:
+		return &node{kind: '0', text: string(v)}, nil
+	case bool:
+		return &node{kind: 't', b: v}, nil
+	}
+	return &node{kind: 'n'}, nil
+}
+
+type encoder struct {
+	out bytes.Buffer
+}
+
+func (e *encoder) value(n *node, t target) error {
+	switch n.kind {
+	case '{':
+		e.header(len(n.vals), 0x80, 0xde)
+		for i, key := range n.keys {
+			key, vt := t.mapKey(key)
+			e.str(key)
+			if err := e.value(n.vals[i], vt); err != nil {
+				return err
+			}
+		}
+	case '[':
+		e.header(len(n.vals), 0x90, 0xdc)
+		for _, v := range n.vals {
+			if err := e.value(v, t.listElem()); err != nil {
+				return err
+			}
+		}
+	case '"':
+		return e.string(n.text, t)
+	case '0':
+		return e.number(n.text, t)
+	case 't':
+		if n.b {
+			e.out.WriteByte(0xc3)
+		} else {
+			e.out.WriteByte(0xc2)
+		}
+	default:
+		e.out.WriteByte(0xc0)
+	}
+	return nil
+}
+
+// string converts a JSON string, which proto3 JSON also uses for 64-bit
+// integers, bytes, special floats and timestamps.
+func (e *encoder) string(s string, t target) error {
+	switch t.kind {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return e.number(s, t)
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(s)
+		}
+		if err != nil {
+			return err
+		}
+		e.bin(b)
+		return nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if f, ok := map[string]float64{"NaN": math.NaN(), "Infinity": math.Inf(1), "-Infinity": math.Inf(-1)}[s]; ok {
+			e.float(f, t.kind)
+			return nil
+		}
+	}
+	if t.isTimestamp() {
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		e.timestamp(ts)
+		return nil
+	}
+	e.str(s)
+	return nil
+}
+
+func (e *encoder) number(text string, t target) error {
+	if t.kind == protoreflect.FloatKind || t.kind == protoreflect.DoubleKind {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		e.float(f, t.kind)
+		return nil
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		e.int(i)
+		return nil
+	}
+	if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+		e.uint(0xcf, u, 8)
+		return nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return err
+	}
+	e.float(f, protoreflect.DoubleKind)
+	return nil
+}
+
+func (e *encoder) uint(head byte, v uint64, n int) {
+	e.out.WriteByte(head)
+	e.bigEndian(v, n)
+}
+
+// bigEndian writes the n low bytes of v.
+func (e *encoder) bigEndian(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.out.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+func (e *encoder) int(i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		e.out.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		e.out.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		e.uint(0xcc, uint64(i), 1)
+	case i >= 0 && i <= math.MaxUint16:
+		e.uint(0xcd, uint64(i), 2)
+	case i >= 0 && i <= math.MaxUint32:
+		e.uint(0xce, uint64(i), 4)
+	case i >= 0:
+		e.uint(0xcf, uint64(i), 8)
+	case i >= math.MinInt8:
+		e.uint(0xd0, uint64(i), 1)
+	case i >= math.MinInt16:
+		e.uint(0xd1, uint64(i), 2)
+	case i >= math.MinInt32:
+		e.uint(0xd2, uint64(i), 4)
+	default:
+		e.uint(0xd3, uint64(i), 8)
+	}
+}
+
+func (e *encoder) float(f float64, kind protoreflect.Kind) {
+	if kind == protoreflect.FloatKind {
+		e.uint(0xca, uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+	e.uint(0xcb, math.Float64bits(f), 8)
+}
+
+func (e *encoder) header(n int, fix byte, head16 byte) {
+	switch {
+	case n < 16:
+		e.out.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		e.uint(head16, uint64(n), 2)
+	default:
+		e.uint(head16+1, uint64(n), 4)
+	}
+}
+
+func (e *encoder) str(s string) {
+	switch n := len(s); {
+	case n < 32:
+		e.out.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.uint(0xd9, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.uint(0xda, uint64(n), 2)
+	default:
+		e.uint(0xdb, uint64(n), 4)
+	}
+	e.out.WriteString(s)
+}
+
+func (e *encoder) bin(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.uint(0xc4, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.uint(0xc5, uint64(n), 2)
+	default:
+		e.uint(0xc6, uint64(n), 4)
+	}
+	e.out.Write(b)
+}
+
+// timestamp writes the timestamp extension in its smallest form.
+func (e *encoder) timestamp(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		e.out.Write([]byte{0xd6, 0xff})
+		e.bigEndian(uint64(sec), 4)
+	case sec >= 0 && sec < 1<<34:
+		e.out.Write([]byte{0xd7, 0xff})
+		e.bigEndian(nsec<<34|uint64(sec), 8)
+	default:
+		e.out.Write([]byte{0xc7, 12, 0xff})
+		e.bigEndian(nsec, 4)
+		e.bigEndian(uint64(sec), 8)
+	}
+}
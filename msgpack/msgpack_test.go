@@ -0,0 +1,142 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+var optionMD = (&descriptorpb.UninterpretedOption{}).ProtoReflect().Descriptor()
+
+// optionPack is a google.protobuf.UninterpretedOption in MessagePack:
+//
+//	{"positive_int_value": uint64 max, "string_value": bin 00 01,
+//	 "name": [{"name_part": "a", "is_extension": true}]}
+var optionPack = []byte{
+	0x83,
+	0xb2, 'p', 'o', 's', 'i', 't', 'i', 'v', 'e', '_', 'i', 'n', 't', '_', 'v', 'a', 'l', 'u', 'e',
+	0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xac, 's', 't', 'r', 'i', 'n', 'g', '_', 'v', 'a', 'l', 'u', 'e',
+	0xc4, 0x02, 0x00, 0x01,
+	0xa4, 'n', 'a', 'm', 'e',
+	0x91, 0x82,
+	0xa9, 'n', 'a', 'm', 'e', '_', 'p', 'a', 'r', 't', 0xa1, 'a',
+	0xac, 'i', 's', '_', 'e', 'x', 't', 'e', 'n', 's', 'i', 'o', 'n', 0xc3,
+}
+
+var optionWant = &descriptorpb.UninterpretedOption{
+	PositiveIntValue: proto.Uint64(math.MaxUint64),
+	StringValue:      []byte{0, 1},
+	Name:             []*descriptorpb.UninterpretedOption_NamePart{{NamePart: proto.String("a"), IsExtension: proto.Bool(true)}},
+}
+
+func TestToJSON(t *testing.T) {
+	js, err := Transcoder{}.ToJSON(optionPack, optionMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got descriptorpb.UninterpretedOption
+	if err := protojson.Unmarshal(js, &got); err != nil {
+		t.Fatalf("ToJSON = %s: %v", js, err)
+	}
+	if !proto.Equal(&got, optionWant) {
+		t.Errorf("ToJSON = %s, want %v", js, optionWant)
+	}
+	for _, bad := range [][]byte{{0x83}, {0xc1}, {0x81, 0xa4, 'n', 'a', 'm', 'e', 0xcf, 0x01}} {
+		if js, err := (Transcoder{}).ToJSON(bad, optionMD); err == nil {
+			t.Errorf("ToJSON(% x) = %s, want an error", bad, js)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	msg := proto.Clone(optionWant).(*descriptorpb.UninterpretedOption)
+	msg.NegativeIntValue = proto.Int64(math.MinInt64)
+	msg.DoubleValue = proto.Float64(0.1)
+	js, err := protojson.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Transcoder{}.FromJSON(js, optionMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 64-bit integers are MessagePack integers, not strings.
+	if !bytes.Contains(b, []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) || !bytes.Contains(b, []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("FromJSON(%s) = % x", js, b)
+	}
+	back, err := Transcoder{}.ToJSON(b, optionMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got descriptorpb.UninterpretedOption
+	if err := protojson.Unmarshal(back, &got); err != nil || !proto.Equal(&got, msg) {
+		t.Errorf("round trip = %s (%v), want %v", back, err, msg)
+	}
+}
+
+func TestWithMsgPack(t *testing.T) {
+	s := apexgrpc.NewServer(WithMsgPack())
+	fdset := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+		{
+			Name:       proto.String("apexgrpc/test/options.proto"),
+			Package:    proto.String("apexgrpc.msgpacktest"),
+			Dependency: []string{"google/protobuf/descriptor.proto"},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Options"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Echo"),
+					InputType:  proto.String(".google.protobuf.UninterpretedOption"),
+					OutputType: proto.String(".google.protobuf.UninterpretedOption"),
+				}},
+			}},
+		},
+	}}
+	err := s.RegisterDynamic(fdset, func(c context.Context, md protoreflect.MethodDescriptor, req *dynamicpb.Message) (proto.Message, error) {
+		return req, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.ApexHandler(context.Background())
+	event := `{"service":"apexgrpc.msgpacktest.Options","method":"Echo","encoding":"msgpack","data":"` + base64.StdEncoding.EncodeToString(optionPack) + `"}`
+	res, err := h(json.RawMessage(event), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, ok := res.(*apexgrpc.EncodedResponse)
+	if !ok || enc.Encoding != Encoding {
+		t.Fatalf("response = %#v", res)
+	}
+	b, err := base64.StdEncoding.DecodeString(enc.Data.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := Transcoder{}.ToJSON(b, optionMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got descriptorpb.UninterpretedOption
+	if err := protojson.Unmarshal(js, &got); err != nil || !proto.Equal(&got, optionWant) {
+		t.Errorf("reply = %s (%v)", js, err)
+	}
+
+	_, err = h(json.RawMessage(`{"service":"apexgrpc.msgpacktest.Options","method":"Echo","encoding":"msgpack","data":"wQ=="}`), nil)
+	if code := apexgrpc.Code(err); code != codes.InvalidArgument {
+		t.Errorf("invalid MessagePack: code = %v (%v)", code, err)
+	}
+}
@@ -0,0 +1,130 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Mux serves several Servers from one Lambda function, routing each event to
+// the Server whose prefix is the longest match of the event's fully qualified
+// method, e.g. "billing." for "billing.v1.Invoices/Get". Each Server handles
+// the event with its own options as if it were served by Server.Run.
+type Mux struct {
+	routes []muxRoute
+	def    *Server
+}
+
+type muxRoute struct {
+	prefix string
+	server *Server
+}
+
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Handle routes methods starting with prefix to s. It panics if prefix is
+// empty or already handled; use Default for unmatched traffic.
+func (m *Mux) Handle(prefix string, s *Server) *Mux {
+	if prefix == "" {
+		panic("apexgrpc: empty Mux prefix")
+	}
+	for _, r := range m.routes {
+		if r.prefix == prefix {
+			panic(fmt.Sprintf("apexgrpc: ambiguous Mux prefix %q", prefix))
+		}
+	}
+	m.routes = append(m.routes, muxRoute{prefix: prefix, server: s})
+	sort.SliceStable(m.routes, func(i, j int) bool { return len(m.routes[i].prefix) > len(m.routes[j].prefix) })
+	return m
+}
+
+// Default serves events that match no prefix, or name no method, with s.
+func (m *Mux) Default(s *Server) *Mux {
+	m.def = s
+	return m
+}
+
+// Methods returns the IDs of the methods of all Servers in sorted order.
+func (m *Mux) Methods() []MethodID {
+	seen := make(map[MethodID]bool)
+	var ids []MethodID
+	for _, s := range m.servers() {
+		for _, id := range s.Methods() {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (m *Mux) servers() []*Server {
+	var servers []*Server
+	for _, r := range m.routes {
+		servers = append(servers, r.server)
+	}
+	if m.def != nil {
+		servers = append(servers, m.def)
+	}
+	return servers
+}
+
+func (m *Mux) Run() {
+	m.RunWithContext(context.Background())
+}
+
+func (m *Mux) RunWithContext(c context.Context) {
+	apex.HandleFunc(m.ApexHandler(c))
+}
+
+// ApexHandler returns the handler Run serves events with, without starting
+// the apex loop.
+func (m *Mux) ApexHandler(c context.Context) apex.HandlerFunc {
+	return func(eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		s, err := m.server(eventMsg)
+		if err != nil {
+			return nil, err
+		}
+		return s.ApexHandler(c)(eventMsg, ctx)
+	}
+}
+
+// server picks the Server for an event.
+func (m *Mux) server(eventMsg json.RawMessage) (*Server, error) {
+	var event Event
+	if err := json.Unmarshal(eventMsg, &event); err != nil {
+		if m.def != nil {
+			return m.def, nil
+		}
+		return nil, invalidEventf("invalid event: %v", err)
+	}
+	pkg, svc, mtd, err := eventTarget(&event)
+	if err != nil {
+		if m.def != nil {
+			return m.def, nil
+		}
+		return nil, err
+	}
+	id := string(NewMethodID(pkg, svc, mtd))
+	if hasPackage(svc, pkg) {
+		id = svc + "/" + mtd
+	}
+	for _, r := range m.routes {
+		if strings.HasPrefix(id, r.prefix) {
+			return r.server, nil
+		}
+	}
+	if m.def != nil {
+		return m.def, nil
+	}
+	return nil, codedErrorf(codes.Unimplemented, "no server for method (%s)", id)
+}
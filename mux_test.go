@@ -0,0 +1,91 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func serveMux(t *testing.T, m *Mux, eventMsg string) (string, error) {
+	t.Helper()
+	res, err := m.ApexHandler(context.Background())([]byte(eventMsg), testApexContext())
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+func TestMux(t *testing.T) {
+	named := func(name string) *Server {
+		return newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+			return newEchoRequest(t, `{"message":"`+name+`"}`), nil
+		}})
+	}
+	wkt := newWellKnownServer(t)
+	m := NewMux().
+		Handle("apexgrpc.", named("outer")).
+		Handle("apexgrpc.test.Echo/Echo", named("inner")).
+		Handle("apexgrpc.wkttest.", wkt)
+
+	for _, tt := range []struct{ event, want string }{
+		{echoEvent("Echo", `{}`), `{"message":"inner"}`},
+		{`{"package":"apexgrpc.test","service":"Echo","method":"Echo","data":{}}`, `{"message":"inner"}`},
+		{`{"method":"/apexgrpc.test.Echo/Echo","data":{}}`, `{"message":"inner"}`},
+		{echoEvent("Fail", `{}`), `{}`},
+		{wellKnownEvent("String", `"hi"`), `"hi"`},
+	} {
+		got, err := serveMux(t, m, tt.event)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.event, err)
+		}
+		assertJSON(t, got, tt.want)
+	}
+	_, err := serveMux(t, m, `{"service":"other.Service","method":"Get"}`)
+	assertCode(t, err, codes.Unimplemented)
+	_, err = serveMux(t, m, `{"method":"Get"}`)
+	assertCode(t, err, codes.InvalidArgument)
+
+	if ids := m.Methods(); len(ids) != 7 || ids[0] != NewMethodID("", echoService, "Echo") {
+		t.Errorf("Methods() = %v", ids)
+	}
+
+	def := NewServer(WithUnknownMethodHandler(func(context.Context, *Event) (interface{}, error) {
+		return "default", nil
+	}))
+	m.Default(def)
+	got, err := serveMux(t, m, `{"service":"other.Service","method":"Get"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `"default"`)
+	// Events naming no method, such as warmup pings, go to the default.
+	got, err = serveMux(t, m, `{"warmup":true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"warmup":"ack"}`)
+}
+
+func TestMuxHandlePanics(t *testing.T) {
+	for name, f := range map[string]func(){
+		"empty prefix":     func() { NewMux().Handle("", NewServer()) },
+		"duplicate prefix": func() { NewMux().Handle("a.", NewServer()).Handle("a.", NewServer()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Handle did not panic")
+				}
+			}()
+			f()
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BlobRef locates an object in a BlobStore, e.g. an S3 bucket and key.
+type BlobRef struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// BlobStore holds payloads too large to pass inline, usually backed by S3.
+type BlobStore interface {
+	// Get returns the object ref points to. It returns an error wrapping
+	// ErrBlobNotFound if there is none.
+	Get(c context.Context, ref BlobRef) ([]byte, error)
+	// Put stores the encoded reply of method id and returns where it was
+	// stored, e.g. under a configured bucket and prefix.
+	Put(c context.Context, id MethodID, data []byte) (BlobRef, error)
+}
+
+// ErrBlobNotFound is returned by BlobStores for missing objects.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// OffloadedResponse is returned to Lambda in place of a reply that was stored
+// in the BlobStore. Size is the length of the stored reply in bytes.
+type OffloadedResponse struct {
+	DataRef BlobRef `json:"dataRef"`
+	Size    int     `json:"size"`
+}
+
+// OffloadError is returned when the request data of an Event cannot be
+// fetched from the BlobStore or a reply cannot be stored in it. Missing
+// objects are reported as codes.NotFound, other failures as
+// codes.Unavailable.
+type OffloadError struct {
+	ID  MethodID
+	Ref BlobRef
+	// Op is "get" or "put".
+	Op  string
+	Err error
+}
+
+func (e *OffloadError) Error() string {
+	if e.Op == "put" {
+		return fmt.Sprintf("storing reply of method (%s): %v", e.ID, e.Err)
+	}
+	return fmt.Sprintf("fetching request data for method (%s) from %s/%s: %v", e.ID, e.Ref.Bucket, e.Ref.Key, e.Err)
+}
+
+func (e *OffloadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OffloadError) GRPCStatus() *status.Status {
+	code := codes.Unavailable
+	if errors.Is(e.Err, ErrBlobNotFound) {
+		code = codes.NotFound
+	}
+	return status.New(code, e.Error())
+}
+
+// WithPayloadOffload lets Events carry "dataRef", a BlobRef, in place of
+// inline data, whose object is fetched from store and decoded as the request.
+// Replies Run would return that encode to more than threshold bytes are put in
+// store and returned as an OffloadedResponse. A threshold of zero or less
+// never offloads replies.
+func WithPayloadOffload(store BlobStore, threshold int) ServerOption {
+	return func(o *options) {
+		o.blobStore = store
+		o.offloadThreshold = threshold
+	}
+}
+
+// fetchData returns event with the object its DataRef points to as its data.
+func (s *Server) fetchData(c context.Context, id MethodID, event *Event) (*Event, error) {
+	if event.DataRef == nil {
+		return event, nil
+	}
+	if s.opts.blobStore == nil {
+		return nil, codedErrorf(codes.InvalidArgument, "event for method (%s) sets dataRef but payload offloading is not enabled", id)
+	}
+	b, err := s.opts.blobStore.Get(c, *event.DataRef)
+	if err != nil {
+		return nil, &OffloadError{ID: id, Ref: *event.DataRef, Op: "get", Err: err}
+	}
+	e := *event
+	raw := json.RawMessage(b)
+	if s.binaryEncoding(event) {
+		raw, _ = json.Marshal(base64.StdEncoding.EncodeToString(b))
+	}
+	e.Data, e.DataRef = &raw, nil
+	return &e, nil
+}
+
+// offloadResponse stores data in the BlobStore if its encoding exceeds the
+// offload threshold.
+func (s *Server) offloadResponse(c context.Context, id MethodID, data interface{}) (interface{}, error) {
+	if s.opts.blobStore == nil || s.opts.offloadThreshold <= 0 {
+		return data, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) <= s.opts.offloadThreshold {
+		return json.RawMessage(b), nil
+	}
+	ref, err := s.opts.blobStore.Put(c, id, b)
+	if err != nil {
+		return nil, &OffloadError{ID: id, Op: "put", Err: err}
+	}
+	return &OffloadedResponse{DataRef: ref, Size: len(b)}, nil
+}
@@ -0,0 +1,109 @@
+package apexgrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// memBlobStore is a BlobStore backed by a map.
+type memBlobStore struct {
+	mu      sync.Mutex
+	objects map[BlobRef][]byte
+	err     error
+}
+
+func (m *memBlobStore) Get(c context.Context, ref BlobRef) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	b, ok := m.objects[ref]
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: %w", ref.Bucket, ref.Key, ErrBlobNotFound)
+	}
+	return b, nil
+}
+
+func (m *memBlobStore) Put(c context.Context, id MethodID, data []byte) (BlobRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return BlobRef{}, m.err
+	}
+	ref := BlobRef{Bucket: "replies", Key: fmt.Sprintf("%s/%d", id, len(m.objects))}
+	m.objects[ref] = data
+	return ref, nil
+}
+
+func refEvent(method string, ref BlobRef) string {
+	return fmt.Sprintf(`{"service":%q,"method":%q,"dataRef":{"bucket":%q,"key":%q}}`, echoService, method, ref.Bucket, ref.Key)
+}
+
+func TestPayloadOffloadRequests(t *testing.T) {
+	ref := BlobRef{Bucket: "requests", Key: "big.json"}
+	store := &memBlobStore{objects: map[BlobRef][]byte{ref: []byte(`{"message":"from the store"}`)}}
+	s := newEchoServer(t, WithPayloadOffload(store, 0))
+
+	got, err := serve(t, s, refEvent("Echo", ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"from the store"}`)
+
+	_, err = serve(t, s, refEvent("Echo", BlobRef{Bucket: "requests", Key: "missing.json"}))
+	assertCode(t, err, codes.NotFound)
+	var oerr *OffloadError
+	if !errors.As(err, &oerr) || oerr.Op != "get" || oerr.Ref.Key != "missing.json" {
+		t.Errorf("error = %#v, want an OffloadError for the get", err)
+	}
+
+	store.err = errors.New("throttled")
+	_, err = serve(t, s, refEvent("Echo", ref))
+	assertCode(t, err, codes.Unavailable)
+	store.err = nil
+
+	_, err = serve(t, newEchoServer(t), refEvent("Echo", ref))
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestPayloadOffloadRequestLimit(t *testing.T) {
+	ref := BlobRef{Bucket: "requests", Key: "big.json"}
+	store := &memBlobStore{objects: map[BlobRef][]byte{ref: []byte(`{"message":"more than sixteen bytes"}`)}}
+	s := newEchoServer(t, WithPayloadOffload(store, 0), WithMaxRequestBytes(16))
+	_, err := serve(t, s, refEvent("Echo", ref))
+	assertCode(t, err, codes.ResourceExhausted)
+}
+
+func TestPayloadOffloadResponses(t *testing.T) {
+	store := &memBlobStore{objects: map[BlobRef][]byte{}}
+	s := newEchoServer(t, WithPayloadOffload(store, 32))
+
+	got, err := serve(t, s, echoEvent("Echo", `{"message":"small"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"small"}`)
+
+	reply := `{"message":"a reply well over the threshold"}`
+	got, err = serve(t, s, echoEvent("Echo", reply))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := BlobRef{Bucket: "replies", Key: "apexgrpc.test.Echo/Echo/0"}
+	assertJSON(t, got, fmt.Sprintf(`{"dataRef":{"bucket":%q,"key":%q},"size":%d}`, ref.Bucket, ref.Key, len(store.objects[ref])))
+	assertJSON(t, string(store.objects[ref]), reply)
+
+	store.err = errors.New("access denied")
+	_, err = serve(t, s, echoEvent("Echo", reply))
+	assertCode(t, err, codes.Unavailable)
+	var oerr *OffloadError
+	if !errors.As(err, &oerr) || oerr.Op != "put" {
+		t.Errorf("error = %#v, want an OffloadError for the put", err)
+	}
+}
@@ -0,0 +1,218 @@
+package apexgrpc
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ServerOption configures a Server. Options are applied in the order they are
+// passed to NewServer; later options override earlier ones.
+type ServerOption func(*options)
+
+// ErrorMapper handles a failed method call. It sees routing, decode and
+// handler errors on both the Lambda and Invoke paths, and err carries its gRPC
+// status for status.FromError. A non-nil payload is returned as the Lambda
+// result of the call in place of the error. Otherwise the returned error, or
+// err if that is nil, is reported.
+type ErrorMapper func(c context.Context, id MethodID, err error) (payload interface{}, mapped error)
+
+type options struct {
+	interceptors           []grpc.UnaryServerInterceptor
+	marshalOptions         protojson.MarshalOptions
+	unmarshalOptions       protojson.UnmarshalOptions
+	errorMapper            ErrorMapper
+	structuredErrors       bool
+	maxStreamReplies       int
+	metadataEnvelope       bool
+	functionTimeout        time.Duration
+	deadlineMargin         time.Duration
+	panicHandler           PanicHandler
+	noPanicRecovery        bool
+	apiGatewayPrefix       string
+	sqsConcurrency         int
+	noSNSDetection         bool
+	kinesisMethod          MethodID
+	dynamoDBRoutes         map[dynamoDBRoute]MethodID
+	dynamoDBStrict         bool
+	corsOrigins            []string
+	router                 Router
+	lenientMatching        bool
+	reflection             bool
+	healthService          bool
+	eventHooks             []EventHook
+	responseHooks          []ResponseHook
+	logger                 Logger
+	metrics                MetricsRecorder
+	batchConcurrency       int
+	maxBatchSize           int
+	maxRequestBytes        int
+	maxResponseBytes       int
+	methodTimeouts         map[MethodID]time.Duration
+	defaultMethodTimeout   time.Duration
+	anyResolver            jsonpb.AnyResolver
+	unknownMethodHandler   UnknownMethodHandler
+	warmupPredicate        WarmupPredicate
+	warmupPredicateSet     bool
+	responseEnvelope       bool
+	authorizer             Authorizer
+	noInvokeAuthorization  bool
+	requestValidator       RequestValidator
+	blobStore              BlobStore
+	offloadThreshold       int
+	maxDecompressedBytes   int
+	idempotentMethods      map[MethodID]bool
+	idempotencyStore       IdempotencyStore
+	idempotencyTTL         time.Duration
+	idempotentErrors       bool
+	concurrencyLimits      map[MethodID]int
+	overflowPolicy         ConcurrencyOverflowPolicy
+	cachedMethods          map[MethodID]time.Duration
+	responseCacheSize      int
+	cacheKeyMetadata       []string
+	stepFunctionsErrors    bool
+	shadows                map[MethodID]shadow
+	shadowSampler          ShadowSampler
+	strictEvents           bool
+	requireData            bool
+	dataOptional           map[MethodID]bool
+	redactedFields         map[protoreflect.FullName]bool
+	requestLogging         bool
+	dryRun                 bool
+	httpRules              bool
+	recorder               Recorder
+	canonicalJSON          bool
+	contextDecorators      []func(context.Context) context.Context
+	accessLog              *accessLog
+	int64AsNumber          bool
+	unsafeInt64Policy      UnsafeInt64Policy
+	singleMessageStreams   bool
+	nestedJSONStrings      bool
+	defaultMetadata        metadata.MD
+	serviceMetadata        map[string]metadata.MD
+	methodCodecs           map[MethodID]Codec
+	transcoders            map[string]Transcoder
+	trailerStatusKey       string
+	retryPolicy            *RetryPolicy
+	noRetryMethods         map[MethodID]bool
+	retryHooks             []RetryHook
+	coldStartRetry         bool
+	coldStartRetryInterval time.Duration
+	requestTransforms      map[MethodID]TransformFunc
+	responseTransforms     map[MethodID]TransformFunc
+}
+
+// WithUnaryInterceptor appends interceptors to the chain wrapping every unary
+// handler. The first interceptor given is the outermost.
+func WithUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// WithResponseMarshaler sets the jsonpb settings used to encode replies
+// returned to Lambda, e.g. OrigName for snake_case field names or
+// EmitDefaults to keep zero-valued fields. They are mapped onto the
+// equivalent protojson options; see WithMarshalOptions.
+func WithResponseMarshaler(m jsonpb.Marshaler) ServerOption {
+	return func(o *options) {
+		o.marshalOptions = marshalOptionsOf(m)
+	}
+}
+
+// WithUnmarshaler sets the jsonpb settings used to decode request data. They
+// are mapped onto the equivalent protojson options; see WithUnmarshalOptions.
+func WithUnmarshaler(u jsonpb.Unmarshaler) ServerOption {
+	return func(o *options) {
+		o.unmarshalOptions = unmarshalOptionsOf(u)
+	}
+}
+
+// WithAllowUnknownFields makes request decoding ignore fields the request
+// message does not define. Decoding is strict by default.
+func WithAllowUnknownFields() ServerOption {
+	return func(o *options) {
+		o.unmarshalOptions.DiscardUnknown = true
+	}
+}
+
+// WithLenientMethodMatching also resolves service and method names regardless
+// of case, so "getUser" reaches GetUser. Register fails if two methods differ
+// only in case.
+func WithLenientMethodMatching() ServerOption {
+	return func(o *options) {
+		o.lenientMatching = true
+	}
+}
+
+// WithErrorMapper installs f to handle errors returned by method calls.
+func WithErrorMapper(f ErrorMapper) ServerOption {
+	return func(o *options) {
+		o.errorMapper = f
+	}
+}
+
+// WithStructuredErrors makes the Lambda handler return failures as an
+// ErrorResponse payload instead of a Lambda error, so callers can tell gRPC
+// status codes apart.
+func WithStructuredErrors() ServerOption {
+	return func(o *options) {
+		o.structuredErrors = true
+	}
+}
+
+// WithMaxStreamResponses caps how many messages a server-streaming handler may
+// send before it fails with codes.ResourceExhausted. Zero means unlimited.
+func WithMaxStreamResponses(n int) ServerOption {
+	return func(o *options) {
+		o.maxStreamReplies = n
+	}
+}
+
+// WithMetadataEnvelope makes the Lambda handler return replies wrapped in a
+// MetadataEnvelope carrying the header and trailer metadata set by handlers.
+func WithMetadataEnvelope() ServerOption {
+	return func(o *options) {
+		o.metadataEnvelope = true
+	}
+}
+
+// WithFunctionTimeout tells the server the Lambda function's configured
+// timeout. apex.Context does not carry the remaining time, so the invocation
+// deadline is computed from the moment the event is received.
+func WithFunctionTimeout(d time.Duration) ServerOption {
+	return func(o *options) {
+		o.functionTimeout = d
+	}
+}
+
+// WithDeadlineMargin reserves d before the invocation deadline so handlers
+// give up while there is still time to return a response.
+func WithDeadlineMargin(d time.Duration) ServerOption {
+	return func(o *options) {
+		o.deadlineMargin = d
+	}
+}
+
+// WithMaxRequestBytes rejects events whose data exceeds n bytes with
+// codes.ResourceExhausted before decoding. The limit applies to the data as
+// decoded, after it is fetched for a dataRef and decompressed. Zero means no
+// limit.
+func WithMaxRequestBytes(n int) ServerOption {
+	return func(o *options) {
+		o.maxRequestBytes = n
+	}
+}
+
+// WithMaxResponseBytes fails invocations whose encoded reply exceeds n bytes
+// with codes.ResourceExhausted. Zero means no limit.
+func WithMaxResponseBytes(n int) ServerOption {
+	return func(o *options) {
+		o.maxResponseBytes = n
+	}
+}
@@ -0,0 +1,91 @@
+package apexgrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestResponseMarshaler(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ServerOption
+		want string
+	}{
+		{"default", nil, `{"message":"hi"}`},
+		{"EmitDefaults", WithResponseMarshaler(jsonpb.Marshaler{EmitDefaults: true}), `{"message":"hi","count":0,"tags":[],"id":"0","secret":""}`},
+		{"EmitUnpopulated", WithMarshalOptions(protojson.MarshalOptions{EmitUnpopulated: true}), `{"message":"hi","count":0,"tags":[],"id":"0","secret":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []ServerOption
+			if tt.opt != nil {
+				opts = append(opts, tt.opt)
+			}
+			got, err := serve(t, newEchoServer(t, opts...), echoEvent("Echo", `{"message":"hi"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	event := echoEvent("Echo", `{"message":"hi","unknown":1}`)
+	_, err := serve(t, newEchoServer(t), event)
+	assertCode(t, err, codes.InvalidArgument)
+
+	got, err := serve(t, newEchoServer(t, WithAllowUnknownFields(), WithMaxRequestBytes(64)), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+	_, err = serve(t, newEchoServer(t, WithAllowUnknownFields(), WithMaxRequestBytes(8)), event)
+	assertCode(t, err, codes.ResourceExhausted)
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	partial, err := protov2.Marshal(&spb.Status{Code: int32(codes.DataLoss), Message: "partial"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		grpc.SetTrailer(c, metadata.Pairs("x-status-bin", string(partial)))
+		return echoReply(req), nil
+	}}
+	event := echoEvent("Echo", `{"message":"`+strings.Repeat("x", 100)+`"}`)
+	for _, tt := range []struct {
+		name string
+		opts []ServerOption
+	}{
+		{"plain", nil},
+		{"envelope", []ServerOption{WithMetadataEnvelope()}},
+		{"partial status", []ServerOption{WithTrailerStatusKey("x-status-bin")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serve(t, newEchoServerWith(t, srv, append(tt.opts, WithMaxResponseBytes(200))...), event)
+			if err != nil {
+				t.Fatalf("reply within the limit: %v", err)
+			}
+			if !strings.Contains(got, strings.Repeat("x", 100)) {
+				t.Errorf("reply = %s", got)
+			}
+			if tt.name == "partial status" && !strings.Contains(got, `"partialStatus"`) {
+				t.Errorf("reply = %s, want a partial status", got)
+			}
+			_, err = serve(t, newEchoServerWith(t, srv, append(tt.opts, WithMaxResponseBytes(50))...), event)
+			assertCode(t, err, codes.ResourceExhausted)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package otel records an OpenTelemetry span for every unary method call of
+// an apexgrpc.Server.
+package otel
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+const instrumentationName = "github.com/pilwon/go-apexgrpc/otel"
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures UnaryServerInterceptor.
+type Option func(*config)
+
+// WithTracerProvider sets the provider of the tracer. The global provider is
+// used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithPropagator sets the propagator that extracts the remote trace context
+// from the event metadata. W3C Trace Context is used by default.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor, to be installed with
+// apexgrpc.WithUnaryInterceptor, that wraps each handler in a server span
+// named after the method ID. A trace context sent in the event metadata, e.g.
+// under "traceparent", becomes the parent of the span. The span ends even if
+// the handler panics.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := config{propagator: propagation.TraceContext{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		provider := cfg.provider
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+		if md, ok := metadata.FromIncomingContext(c); ok {
+			c = cfg.propagator.Extract(c, metadataCarrier(md))
+		}
+		name := strings.TrimPrefix(info.FullMethod, "/")
+		svc, mtd := splitMethod(name)
+		c, span := provider.Tracer(instrumentationName).Start(c, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.service", svc),
+				attribute.String("rpc.method", mtd),
+			),
+		)
+		defer func() {
+			if r := recover(); r != nil {
+				endSpan(span, codes.Internal, fmt.Errorf("panic in method (%s): %v", name, r))
+				panic(r)
+			}
+			endSpan(span, apexgrpc.Code(err), err)
+		}()
+		return handler(c, req)
+	}
+}
+
+func endSpan(span trace.Span, code codes.Code, err error) {
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(code)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+func splitMethod(id string) (string, string) {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return "", id
+	}
+	return id[:i], id[i+1:]
+}
+
+// metadataCarrier adapts incoming gRPC metadata, whose keys are lowercase, to
+// a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	v := m[strings.ToLower(key)]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func (m metadataCarrier) Set(key string, value string) {
+	m[strings.ToLower(key)] = []string{value}
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,92 @@
+package otel
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		status  otelcodes.Code
+		handler func()
+	}{
+		{name: "ok", code: codes.OK, status: otelcodes.Unset},
+		{name: "error", err: status.Error(codes.NotFound, "gone"), code: codes.NotFound, status: otelcodes.Error},
+		{name: "panic", code: codes.Internal, status: otelcodes.Error, handler: func() { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			interceptor := UnaryServerInterceptor(WithTracerProvider(tp))
+			c := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+			info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+			var inner trace.SpanContext
+			func() {
+				defer func() {
+					if r := recover(); r != nil && tt.handler == nil {
+						t.Fatalf("unexpected panic: %v", r)
+					}
+				}()
+				interceptor(c, nil, info, func(c context.Context, req interface{}) (interface{}, error) {
+					inner = trace.SpanContextFromContext(c)
+					if tt.handler != nil {
+						tt.handler()
+					}
+					return nil, tt.err
+				})
+			}()
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("exported %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != "pkg.Service/Method" || span.SpanKind != trace.SpanKindServer {
+				t.Errorf("span %q of kind %v", span.Name, span.SpanKind)
+			}
+			if got := span.Parent.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("parent trace ID = %s, want the one of traceparent", got)
+			}
+			if inner.SpanID() != span.SpanContext.SpanID() {
+				t.Error("handler context does not carry the span")
+			}
+			want := map[attribute.Key]attribute.Value{
+				"rpc.system":           attribute.StringValue("grpc"),
+				"rpc.service":          attribute.StringValue("pkg.Service"),
+				"rpc.method":           attribute.StringValue("Method"),
+				"rpc.grpc.status_code": attribute.Int64Value(int64(tt.code)),
+			}
+			got := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes {
+				got[kv.Key] = kv.Value
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("attribute %s = %v, want %v", k, got[k].Emit(), v.Emit())
+				}
+			}
+			if span.Status.Code != tt.status {
+				t.Errorf("status = %v, want %v", span.Status.Code, tt.status)
+			}
+			if tt.status == otelcodes.Error && len(span.Events) == 0 {
+				t.Error("error not recorded on the span")
+			}
+		})
+	}
+}
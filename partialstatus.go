@@ -0,0 +1,65 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithTrailerStatusKey lets handlers report a partial success the way they
+// would on a grpc.Server: by returning a reply and setting a google.rpc.Status
+// in the trailer metadata under key. The status is returned as the
+// partialStatus of a MetadataEnvelope around the reply, which is used for such
+// replies even without WithMetadataEnvelope. Under a "-bin" key the value is
+// the serialized status, otherwise its base64 encoding. A value that does not
+// decode, or whose code is OK, is logged and dropped; the call still succeeds.
+// Keys are case insensitive, as in metadata.MD.
+func WithTrailerStatusKey(key string) ServerOption {
+	return func(o *options) {
+		o.trailerStatusKey = strings.ToLower(key)
+	}
+}
+
+// partialStatus returns the status a handler set under the trailer status
+// key of res, if any.
+func (s *Server) partialStatus(res *result) *ErrorBody {
+	key := s.opts.trailerStatusKey
+	if key == "" {
+		return nil
+	}
+	vals := res.trailer[key]
+	if len(vals) == 0 {
+		return nil
+	}
+	st, err := decodeStatus(key, vals[len(vals)-1])
+	if err != nil {
+		s.logger().Log(LevelWarn, "dropped partial status", map[string]interface{}{
+			LogFieldMethod: res.id.String(),
+			LogFieldError:  err.Error(),
+		})
+		return nil
+	}
+	return s.statusBody(st)
+}
+
+func decodeStatus(key string, v string) (*status.Status, error) {
+	b := []byte(v)
+	if !isBinaryKey(key) {
+		var err error
+		if b, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, err
+		}
+	}
+	pb := &spb.Status{}
+	if err := unmarshalProto(b, pb); err != nil {
+		return nil, err
+	}
+	if codes.Code(pb.Code) == codes.OK {
+		return nil, errors.New("status code is OK")
+	}
+	return status.FromProto(pb), nil
+}
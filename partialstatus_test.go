@@ -0,0 +1,82 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// trailerEcho returns an Echo server that sets the trailer key to value.
+func trailerEcho(key, value string) *echoServer {
+	return &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		if err := grpc.SetTrailer(c, metadata.Pairs(key, value)); err != nil {
+			return nil, err
+		}
+		return echoReply(req), nil
+	}}
+}
+
+func TestTrailerStatusKey(t *testing.T) {
+	partial, err := protov2.Marshal(&spb.Status{Code: int32(codes.DataLoss), Message: "2 of 3 items failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enveloped := `{"data":{"message":"hi"},"partialStatus":{"code":"` + CodeName(codes.DataLoss) + `","grpc_code":15,"message":"2 of 3 items failed"}}`
+	for _, tt := range []struct {
+		name, option, key, value string
+	}{
+		{"binary key", "x-status-bin", "x-status-bin", string(partial)},
+		{"base64 key", "x-status", "x-status", base64.StdEncoding.EncodeToString(partial)},
+		{"mixed case option", "X-Status-Bin", "x-status-bin", string(partial)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newEchoServerWith(t, trailerEcho(tt.key, tt.value), WithTrailerStatusKey(tt.option))
+			got, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, enveloped)
+		})
+	}
+
+	ok, _ := protov2.Marshal(&spb.Status{Code: int32(codes.OK)})
+	for name, value := range map[string]string{
+		"not base64": "!!",
+		"not status": base64.StdEncoding.EncodeToString([]byte{0xff}),
+		"ok status":  base64.StdEncoding.EncodeToString(ok),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := newEchoServerWith(t, trailerEcho("x-status", value),
+				WithTrailerStatusKey("x-status"),
+				WithLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug)),
+			)
+			got, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, `{"message":"hi"}`)
+			if !strings.Contains(buf.String(), "dropped partial status") {
+				t.Errorf("log = %q, want the dropped status", buf.String())
+			}
+		})
+	}
+
+	// Without the option the trailer is not a status.
+	got, err := serve(t, newEchoServerWith(t, trailerEcho("x-status-bin", string(partial))), echoEvent("Echo", `{"message":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"hi"}`)
+}
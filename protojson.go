@@ -0,0 +1,152 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// WithMarshalOptions sets the protojson options used to encode replies
+// returned to Lambda.
+func WithMarshalOptions(mo protojson.MarshalOptions) ServerOption {
+	return func(o *options) {
+		o.marshalOptions = mo
+	}
+}
+
+// WithUnmarshalOptions sets the protojson options used to decode request
+// data.
+func WithUnmarshalOptions(uo protojson.UnmarshalOptions) ServerOption {
+	return func(o *options) {
+		o.unmarshalOptions = uo
+	}
+}
+
+// typeResolver is the type of the Resolver of the protojson options.
+type typeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// messageV2 returns the APIv2 view of m, bridging messages generated for the
+// legacy API.
+func messageV2(m proto.Message) protov2.Message {
+	return protoadapt.MessageV2Of(m)
+}
+
+func marshalProto(m proto.Message) ([]byte, error) {
+	return protov2.Marshal(messageV2(m))
+}
+
+func unmarshalProto(b []byte, m proto.Message) error {
+	return protov2.Unmarshal(b, messageV2(m))
+}
+
+// cloneProto deep copies m, keeping its Go type.
+func cloneProto(m proto.Message) proto.Message {
+	return protoadapt.MessageV1Of(protov2.Clone(messageV2(m)))
+}
+
+func messageFullName(m proto.Message) string {
+	return string(messageV2(m).ProtoReflect().Descriptor().FullName())
+}
+
+// marshalJSON encodes m with mo. Output that is not multiline is compacted,
+// since protojson varies its whitespace between builds.
+func marshalJSON(mo protojson.MarshalOptions, m proto.Message) (json.RawMessage, error) {
+	b, err := mo.Marshal(messageV2(m))
+	if err != nil {
+		return nil, err
+	}
+	if mo.Multiline {
+		return json.RawMessage(b), nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+func (s *Server) marshalOptions() protojson.MarshalOptions {
+	mo := s.opts.marshalOptions
+	if s.opts.anyResolver != nil {
+		mo.Resolver = anyResolverAdapter{s.opts.anyResolver}
+	} else if mo.Resolver == nil {
+		if r := s.typeResolver(); r != nil {
+			mo.Resolver = r
+		}
+	}
+	return mo
+}
+
+func (s *Server) unmarshalOptions() protojson.UnmarshalOptions {
+	uo := s.opts.unmarshalOptions
+	if s.opts.anyResolver != nil {
+		uo.Resolver = anyResolverAdapter{s.opts.anyResolver}
+	} else if uo.Resolver == nil {
+		if r := s.typeResolver(); r != nil {
+			uo.Resolver = r
+		}
+	}
+	return uo
+}
+
+// marshalOptionsOf maps jsonpb marshaling settings onto protojson.
+func marshalOptionsOf(m jsonpb.Marshaler) protojson.MarshalOptions {
+	mo := protojson.MarshalOptions{
+		Multiline:       m.Indent != "",
+		Indent:          m.Indent,
+		UseProtoNames:   m.OrigName,
+		UseEnumNumbers:  m.EnumsAsInts,
+		EmitUnpopulated: m.EmitDefaults,
+	}
+	if m.AnyResolver != nil {
+		mo.Resolver = anyResolverAdapter{m.AnyResolver}
+	}
+	return mo
+}
+
+// unmarshalOptionsOf maps jsonpb unmarshaling settings onto protojson.
+func unmarshalOptionsOf(u jsonpb.Unmarshaler) protojson.UnmarshalOptions {
+	uo := protojson.UnmarshalOptions{
+		DiscardUnknown: u.AllowUnknownFields,
+	}
+	if u.AnyResolver != nil {
+		uo.Resolver = anyResolverAdapter{u.AnyResolver}
+	}
+	return uo
+}
+
+// anyResolverAdapter serves a jsonpb.AnyResolver as a protojson Resolver.
+// Extensions are looked up in the global registry.
+type anyResolverAdapter struct {
+	r jsonpb.AnyResolver
+}
+
+func (a anyResolverAdapter) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	m, err := a.r.Resolve(url)
+	if err != nil {
+		return nil, err
+	}
+	return messageV2(m).ProtoReflect().Type(), nil
+}
+
+func (a anyResolverAdapter) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	return a.FindMessageByURL(string(name))
+}
+
+func (a anyResolverAdapter) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (a anyResolverAdapter) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
@@ -0,0 +1,44 @@
+package apexgrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+)
+
+func TestLegacyMessages(t *testing.T) {
+	s := newEchoServer(t, WithReflection(), WithUnmarshaler(jsonpb.Unmarshaler{AllowUnknownFields: true}))
+	got, err := serve(t, s, `{"service":"apexgrpc","method":"ListMethods","data":{"includeSchemas":false,"bogus":1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `"apexgrpc.test.Echo/Echo"`) {
+		t.Errorf("ListMethods = %s", got)
+	}
+	m, ok := cloneProto(&ListMethodsRequest{IncludeSchemas: true}).(*ListMethodsRequest)
+	if !ok || !m.IncludeSchemas {
+		t.Errorf("cloneProto = %#v, want a copy of the same type", m)
+	}
+}
+
+func TestMarshalerMapping(t *testing.T) {
+	mo := marshalOptionsOf(jsonpb.Marshaler{Indent: "  ", OrigName: true, EnumsAsInts: true, EmitDefaults: true})
+	if !mo.Multiline || mo.Indent != "  " || !mo.UseProtoNames || !mo.UseEnumNumbers || !mo.EmitUnpopulated {
+		t.Errorf("marshal options = %+v", mo)
+	}
+	if uo := unmarshalOptionsOf(jsonpb.Unmarshaler{AllowUnknownFields: true}); !uo.DiscardUnknown {
+		t.Errorf("unmarshal options = %+v", uo)
+	}
+
+	s := newEchoServer(t, WithResponseMarshaler(jsonpb.Marshaler{Indent: "  "}))
+	got, err := s.InvokeRaw(context.Background(), "", echoService, "Echo", []byte(`{"message":"hi","count":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\n  \"count\"") {
+		t.Errorf("indented reply = %q", got)
+	}
+	assertJSON(t, string(got), `{"message":"hi","count":1}`)
+}
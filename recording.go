@@ -0,0 +1,155 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/apex/go-apex"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// Recording is a Lambda payload captured by a Recorder, for replaying it with
+// apexgrpctest.Replay. Method is set when the payload called a single method.
+// Response is the JSON the function returned, and Error describes the error it
+// failed with instead.
+type Recording struct {
+	Time       time.Time       `json:"time"`
+	Event      json.RawMessage `json:"event,omitempty"`
+	Method     MethodID        `json:"method,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      *ErrorBody      `json:"error,omitempty"`
+	DurationMS float64         `json:"durationMs"`
+}
+
+// Recorder captures the payloads served by a Server.
+type Recorder interface {
+	Record(c context.Context, rec *Recording)
+}
+
+// WithRecorder captures every payload served through Run, the other Run
+// variants and Handler with r. A recorder that panics does not affect the
+// call. With WithRedactedFields, the request and reply of unary methods are
+// redacted; other events and responses are left out of the recording.
+func WithRecorder(r Recorder) ServerOption {
+	return func(o *options) {
+		o.recorder = r
+	}
+}
+
+type jsonlRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLRecorder returns a Recorder writing each Recording to w as a line
+// of JSON, the format apexgrpctest.LoadRecords reads.
+func NewJSONLRecorder(w io.Writer) Recorder {
+	return &jsonlRecorder{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonlRecorder) Record(c context.Context, rec *Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(rec)
+}
+
+// RecordingBuffer is a Recorder keeping recordings in memory.
+type RecordingBuffer struct {
+	mu   sync.Mutex
+	recs []Recording
+}
+
+func (b *RecordingBuffer) Record(c context.Context, rec *Recording) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recs = append(b.recs, *rec)
+}
+
+// Recordings returns the recordings captured so far.
+func (b *RecordingBuffer) Recordings() []Recording {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Recording(nil), b.recs...)
+}
+
+// recorded wraps h to capture its payloads when a recorder is configured.
+func (s *Server) recorded(h lambdaHandler) lambdaHandler {
+	if s.opts.recorder == nil {
+		return h
+	}
+	return func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		start := time.Now()
+		methods := &envelopeMethods{}
+		res, err := h(context.WithValue(c, envelopeKey{}, methods), eventMsg, ctx)
+		rec := &Recording{
+			Time:       start,
+			Event:      eventMsg,
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+		}
+		if len(methods.ids) == 1 {
+			rec.Method = methods.ids[0]
+		}
+		if err != nil {
+			rec.Error = s.newErrorResponse(err).Error
+		} else if b, merr := json.Marshal(res); merr == nil {
+			rec.Response = b
+		}
+		s.record(c, rec)
+		return res, err
+	}
+}
+
+func (s *Server) record(c context.Context, rec *Recording) {
+	defer func() {
+		recover()
+	}()
+	if len(s.opts.redactedFields) > 0 {
+		s.redactRecording(rec)
+	}
+	s.opts.recorder.Record(c, rec)
+}
+
+// redactRecording redacts the request data and reply of a call of a unary
+// method, dropping the event and response when that is not possible.
+func (s *Server) redactRecording(rec *Recording) {
+	event, response := rec.Event, rec.Response
+	rec.Event, rec.Response = nil, nil
+	h, ok := s.handler(rec.Method)
+	if !ok || h.streamDesc != nil {
+		return
+	}
+	newReq, newResp := methodMessages(rec.Method, h)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(event, &fields); err != nil {
+		return
+	}
+	if data, ok := fields["data"]; ok && !isNullData(&data) {
+		if fields["data"], ok = s.redactJSON(newReq, data); !ok {
+			return
+		}
+	}
+	if b, err := json.Marshal(fields); err == nil {
+		rec.Event = b
+	}
+	if response != nil {
+		rec.Response, _ = s.redactJSON(newResp, response)
+	}
+}
+
+// redactJSON decodes raw as a message made by newMsg and encodes it redacted.
+func (s *Server) redactJSON(newMsg func() proto.Message, raw json.RawMessage) (json.RawMessage, bool) {
+	if newMsg == nil {
+		return nil, false
+	}
+	msg := newMsg()
+	uo := s.unmarshalOptions()
+	uo.DiscardUnknown = true
+	if err := uo.Unmarshal(raw, messageV2(msg)); err != nil {
+		return nil, false
+	}
+	b, err := s.marshalReply(s.redact(msg))
+	return b, err == nil
+}
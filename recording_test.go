@@ -0,0 +1,66 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf RecordingBuffer
+	s := newEchoServer(t, WithRecorder(&buf))
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	serve(t, s, echoEvent("Fail", `{"count":5,"message":"gone"}`))
+	recs := buf.Recordings()
+	if len(recs) != 2 {
+		t.Fatalf("recorded %d payloads, want 2", len(recs))
+	}
+	echo := recs[0]
+	if echo.Method != NewMethodID("", echoService, "Echo") || string(echo.Event) != echoEvent("Echo", `{"message":"hi"}`) || echo.Error != nil || echo.Time.IsZero() {
+		t.Errorf("recorded %+v", echo)
+	}
+	assertJSON(t, string(echo.Response), `{"message":"hi"}`)
+	if fail := recs[1]; fail.Error == nil || fail.Error.GRPCCode != codes.NotFound || fail.Response != nil {
+		t.Errorf("recorded %+v", fail)
+	}
+}
+
+func TestRecorderRedacts(t *testing.T) {
+	var buf RecordingBuffer
+	s := newEchoServer(t, WithRecorder(&buf), WithRedactedFields("apexgrpc.test.EchoRequest.secret", "apexgrpc.test.EchoReply.secret"))
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"hi","secret":"hunter2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := buf.Recordings()[0]
+	if rec.Event == nil || rec.Response == nil {
+		t.Fatalf("recorded %+v", rec)
+	}
+	for _, b := range []json.RawMessage{rec.Event, rec.Response} {
+		if bytes.Contains(b, []byte("hunter2")) || !bytes.Contains(b, []byte(Redacted)) {
+			t.Errorf("recorded %s", b)
+		}
+	}
+}
+
+func TestJSONLRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEchoServer(t, WithRecorder(NewJSONLRecorder(&buf)))
+	for i := 0; i < 2; i++ {
+		if _, err := serve(t, s, echoEvent("Echo", `{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %q", buf.String())
+	}
+	var rec Recording
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil || rec.Method != NewMethodID("", echoService, "Echo") {
+		t.Errorf("line %s: %v", lines[1], err)
+	}
+}
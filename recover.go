@@ -0,0 +1,41 @@
+package apexgrpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PanicHandler is told about every panic recovered from a handler, e.g. to log
+// the stack with runtime/debug.Stack.
+type PanicHandler func(c context.Context, id MethodID, recovered interface{})
+
+// WithPanicHandler installs f to observe panics recovered from handlers.
+func WithPanicHandler(f PanicHandler) ServerOption {
+	return func(o *options) {
+		o.panicHandler = f
+	}
+}
+
+// WithoutPanicRecovery lets handler panics crash the invocation instead of
+// turning them into codes.Internal errors.
+func WithoutPanicRecovery() ServerOption {
+	return func(o *options) {
+		o.noPanicRecovery = true
+	}
+}
+
+// recoverPanic must be deferred directly so that recover stops the panic.
+func (s *Server) recoverPanic(c context.Context, id MethodID, err *error) {
+	if s.opts.noPanicRecovery {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	if s.opts.panicHandler != nil {
+		s.opts.panicHandler(c, id, r)
+	}
+	*err = status.Errorf(codes.Internal, "panic in method (%s): %v", id, r)
+}
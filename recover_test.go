@@ -0,0 +1,36 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func panickingEcho(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+	panic("boom")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var recovered interface{}
+	var method MethodID
+	s := newEchoServerWith(t, &echoServer{echo: panickingEcho}, WithPanicHandler(func(c context.Context, id MethodID, r interface{}) {
+		method, recovered = id, r
+	}))
+	_, err := serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.Internal)
+	if recovered != "boom" || method != NewMethodID("", echoService, "Echo") {
+		t.Errorf("panic handler saw %v in %q", recovered, method)
+	}
+
+	s = newEchoServerWith(t, &echoServer{echo: panickingEcho}, WithoutPanicRecovery())
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the handler panic", r)
+		}
+	}()
+	serve(t, s, echoEvent("Echo", `{}`))
+	t.Error("handler panic was recovered")
+}
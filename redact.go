@@ -0,0 +1,117 @@
+package apexgrpc
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redacted replaces the values of redacted fields.
+const Redacted = "[REDACTED]"
+
+// WithRedactedFields hides the values of fields, given by full name such as
+// "myapp.v1.LoginRequest.password", wherever the server echoes a request:
+// string and bytes fields read Redacted and other fields are cleared. Decode
+// errors lose the text of the offending input, keeping only its position.
+func WithRedactedFields(fields ...string) ServerOption {
+	return func(o *options) {
+		if o.redactedFields == nil {
+			o.redactedFields = map[protoreflect.FullName]bool{}
+		}
+		for _, f := range fields {
+			o.redactedFields[protoreflect.FullName(f)] = true
+		}
+	}
+}
+
+// WithRequestLogging logs every decoded unary request at LevelDebug under
+// LogFieldRequest, with WithRedactedFields applied.
+func WithRequestLogging() ServerOption {
+	return func(o *options) {
+		o.requestLogging = true
+	}
+}
+
+// redact returns a copy of msg with the redacted fields hidden, or msg itself
+// if nothing is redacted.
+func (s *Server) redact(msg proto.Message) proto.Message {
+	if len(s.opts.redactedFields) == 0 || msg == nil {
+		return msg
+	}
+	clone := cloneProto(msg)
+	redactMessage(messageV2(clone).ProtoReflect(), s.opts.redactedFields)
+	return clone
+}
+
+func redactMessage(m protoreflect.Message, fields map[protoreflect.FullName]bool) {
+	var hidden []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fields[fd.FullName()] {
+			hidden = append(hidden, fd)
+			return true
+		}
+		switch {
+		case fd.IsMap():
+			if isMessageKind(fd.MapValue().Kind()) {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					redactMessage(mv.Message(), fields)
+					return true
+				})
+			}
+		case fd.IsList():
+			if isMessageKind(fd.Kind()) {
+				l := v.List()
+				for i := 0; i < l.Len(); i++ {
+					redactMessage(l.Get(i).Message(), fields)
+				}
+			}
+		case isMessageKind(fd.Kind()):
+			redactMessage(v.Message(), fields)
+		}
+		return true
+	})
+	for _, fd := range hidden {
+		switch {
+		case fd.IsList() || fd.IsMap():
+			m.Clear(fd)
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString(Redacted))
+		case fd.Kind() == protoreflect.BytesKind:
+			m.Set(fd, protoreflect.ValueOfBytes([]byte(Redacted)))
+		default:
+			m.Clear(fd)
+		}
+	}
+}
+
+func isMessageKind(k protoreflect.Kind) bool {
+	return k == protoreflect.MessageKind || k == protoreflect.GroupKind
+}
+
+var decodePosition = regexp.MustCompile(`\(line \d+:\d+\)`)
+
+// redactDecodeError drops the input text from a decode error when fields are
+// redacted, since it may quote a secret.
+func (s *Server) redactDecodeError(err error) error {
+	if err == nil || len(s.opts.redactedFields) == 0 {
+		return err
+	}
+	if pos := decodePosition.FindString(err.Error()); pos != "" {
+		return errors.New("invalid value " + pos)
+	}
+	return errors.New("invalid value")
+}
+
+func (s *Server) logRequest(id MethodID, msg proto.Message) {
+	l := s.logger()
+	if _, ok := l.(nopLogger); ok || !s.opts.requestLogging {
+		return
+	}
+	fields := map[string]interface{}{LogFieldMethod: id.String()}
+	if raw, err := s.marshalReply(s.redact(msg)); err == nil {
+		fields[LogFieldRequest] = raw
+	}
+	l.Log(LevelDebug, "request decoded", fields)
+}
@@ -0,0 +1,53 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestRequestLoggingRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	req := `{"message":"hi","secret":"hunter2","count":3}`
+	s := newEchoServer(t,
+		WithLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug)),
+		WithRequestLogging(),
+		WithRedactedFields("apexgrpc.test.EchoRequest.secret", "apexgrpc.test.EchoRequest.count"),
+	)
+	got, err := serve(t, s, echoEvent("Echo", req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, req)
+	var line string
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(l, "request decoded") {
+			line = l
+		}
+	}
+	if line == "" {
+		t.Fatalf("no request was logged:\n%s", buf.String())
+	}
+	if strings.Contains(line, "hunter2") || strings.Contains(line, `"count"`) {
+		t.Errorf("logged line shows redacted fields: %s", line)
+	}
+	if !strings.Contains(line, Redacted) || !strings.Contains(line, `"hi"`) {
+		t.Errorf("logged line = %s", line)
+	}
+}
+
+func TestDecodeErrorsRedacted(t *testing.T) {
+	event := echoEvent("Echo", `{"hunter2":1}`)
+	_, err := serve(t, newEchoServer(t), event)
+	if !strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("error without redaction = %v", err)
+	}
+	_, err = serve(t, newEchoServer(t, WithRedactedFields("apexgrpc.test.EchoRequest.secret")), event)
+	assertCode(t, err, codes.InvalidArgument)
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), "(line 1:2)") {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ReflectionService is the reserved service name of the method registered by
+// WithReflection.
+const ReflectionService = "apexgrpc"
+
+// WithReflection registers the reserved method "apexgrpc/ListMethods", which
+// returns the description of every registered method, with their JSON Schemas
+// if the request sets include_schemas. It also registers "apexgrpc/ListServices"
+// and "apexgrpc/FileContainingSymbol", which answer the requests of the same
+// names of grpc.reflection.v1alpha with its messages, so that tools can read
+// the proto descriptors grpcurl would get from a gRPC server. Register then
+// rejects services named "apexgrpc".
+func WithReflection() ServerOption {
+	return func(o *options) {
+		o.reflection = true
+	}
+}
+
+type ListMethodsRequest struct {
+	IncludeSchemas bool `protobuf:"varint,1,opt,name=include_schemas,json=includeSchemas,proto3" json:"include_schemas,omitempty"`
+}
+
+func (m *ListMethodsRequest) Reset()         { *m = ListMethodsRequest{} }
+func (m *ListMethodsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListMethodsRequest) ProtoMessage()    {}
+
+type ListMethodsResponse struct {
+	Methods []*MethodInfo `protobuf:"bytes,1,rep,name=methods,proto3" json:"methods,omitempty"`
+}
+
+func (m *ListMethodsResponse) Reset()         { *m = ListMethodsResponse{} }
+func (m *ListMethodsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListMethodsResponse) ProtoMessage()    {}
+
+type MethodInfo struct {
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	RequestType   string `protobuf:"bytes,2,opt,name=request_type,json=requestType,proto3" json:"request_type,omitempty"`
+	ResponseType  string `protobuf:"bytes,3,opt,name=response_type,json=responseType,proto3" json:"response_type,omitempty"`
+	ClientStreams bool   `protobuf:"varint,4,opt,name=client_streams,json=clientStreams,proto3" json:"client_streams,omitempty"`
+	ServerStreams bool   `protobuf:"varint,5,opt,name=server_streams,json=serverStreams,proto3" json:"server_streams,omitempty"`
+	AliasOf       string `protobuf:"bytes,6,opt,name=alias_of,json=aliasOf,proto3" json:"alias_of,omitempty"`
+	// RequestSchema and ResponseSchema are the JSON Schemas of Schema, as
+	// JSON text.
+	RequestSchema  string `protobuf:"bytes,7,opt,name=request_schema,json=requestSchema,proto3" json:"request_schema,omitempty"`
+	ResponseSchema string `protobuf:"bytes,8,opt,name=response_schema,json=responseSchema,proto3" json:"response_schema,omitempty"`
+}
+
+func (m *MethodInfo) Reset()         { *m = MethodInfo{} }
+func (m *MethodInfo) String() string { return proto.CompactTextString(m) }
+func (*MethodInfo) ProtoMessage()    {}
+
+type ListServicesRequest struct{}
+
+func (m *ListServicesRequest) Reset()         { *m = ListServicesRequest{} }
+func (m *ListServicesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListServicesRequest) ProtoMessage()    {}
+
+// ListServiceResponse mirrors the message of grpc.reflection.v1alpha.
+type ListServiceResponse struct {
+	Service []*ServiceResponse `protobuf:"bytes,1,rep,name=service,proto3" json:"service,omitempty"`
+}
+
+func (m *ListServiceResponse) Reset()         { *m = ListServiceResponse{} }
+func (m *ListServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*ListServiceResponse) ProtoMessage()    {}
+
+type ServiceResponse struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// DescriptorUnavailable is set for services whose proto descriptor is not
+	// registered, which FileContainingSymbol cannot return. It is not part of
+	// grpc.reflection.v1alpha.
+	DescriptorUnavailable bool `protobuf:"varint,2,opt,name=descriptor_unavailable,json=descriptorUnavailable,proto3" json:"descriptor_unavailable,omitempty"`
+}
+
+func (m *ServiceResponse) Reset()         { *m = ServiceResponse{} }
+func (m *ServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*ServiceResponse) ProtoMessage()    {}
+
+type FileContainingSymbolRequest struct {
+	// Symbol is the fully-qualified name of a service, method or message.
+	Symbol string `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+}
+
+func (m *FileContainingSymbolRequest) Reset()         { *m = FileContainingSymbolRequest{} }
+func (m *FileContainingSymbolRequest) String() string { return proto.CompactTextString(m) }
+func (*FileContainingSymbolRequest) ProtoMessage()    {}
+
+// FileDescriptorResponse mirrors the message of grpc.reflection.v1alpha: the
+// serialized FileDescriptorProto of the file and of the files it imports,
+// base64 strings in JSON.
+type FileDescriptorResponse struct {
+	FileDescriptorProto [][]byte `protobuf:"bytes,1,rep,name=file_descriptor_proto,json=fileDescriptorProto,proto3" json:"file_descriptor_proto,omitempty"`
+}
+
+func (m *FileDescriptorResponse) Reset()         { *m = FileDescriptorResponse{} }
+func (m *FileDescriptorResponse) String() string { return proto.CompactTextString(m) }
+func (*FileDescriptorResponse) ProtoMessage()    {}
+
+type reflectionServer interface {
+	ListMethods(context.Context, *ListMethodsRequest) (*ListMethodsResponse, error)
+	ListServices(context.Context, *ListServicesRequest) (*ListServiceResponse, error)
+	FileContainingSymbol(context.Context, *FileContainingSymbolRequest) (*FileDescriptorResponse, error)
+}
+
+type reflection struct {
+	s *Server
+}
+
+func (r reflection) ListMethods(c context.Context, req *ListMethodsRequest) (*ListMethodsResponse, error) {
+	resp := &ListMethodsResponse{}
+	var schemas map[MethodID]*MethodSchema
+	if req.IncludeSchemas {
+		schemas = r.s.Schema()
+	}
+	for _, d := range r.s.Describe() {
+		info := &MethodInfo{
+			Id:            d.ID.String(),
+			RequestType:   d.Request,
+			ResponseType:  d.Response,
+			ClientStreams: d.ClientStreams,
+			ServerStreams: d.ServerStreams,
+			AliasOf:       d.AliasOf.String(),
+		}
+		id := d.ID
+		if d.AliasOf != "" {
+			id = d.AliasOf
+		}
+		if sc := schemas[id]; sc != nil {
+			info.RequestSchema, info.ResponseSchema = string(sc.Request), string(sc.Response)
+		}
+		resp.Methods = append(resp.Methods, info)
+	}
+	return resp, nil
+}
+
+// ListServices lists the registered services by name, the reflection service
+// included as grpc.Server does.
+func (r reflection) ListServices(c context.Context, req *ListServicesRequest) (*ListServiceResponse, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	described := map[string]bool{}
+	for id, h := range r.s.handlers {
+		svc, _ := id.split()
+		described[svc] = described[svc] || h.descriptor != nil
+	}
+	names := make([]string, 0, len(described))
+	for name := range described {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp := &ListServiceResponse{}
+	for _, name := range names {
+		resp.Service = append(resp.Service, &ServiceResponse{Name: name, DescriptorUnavailable: !described[name]})
+	}
+	return resp, nil
+}
+
+// FileContainingSymbol returns the file defining a symbol of the registered
+// services, with its imports, looking in the global registry and in the
+// descriptors given to RegisterDynamic.
+func (r reflection) FileContainingSymbol(c context.Context, req *FileContainingSymbolRequest) (*FileDescriptorResponse, error) {
+	fd := r.s.fileContainingSymbol(protoreflect.FullName(req.Symbol))
+	if fd == nil {
+		return nil, status.Errorf(codes.NotFound, "symbol not found: %s", req.Symbol)
+	}
+	resp := &FileDescriptorResponse{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor) error
+	add = func(fd protoreflect.FileDescriptor) error {
+		if seen[fd.Path()] {
+			return nil
+		}
+		seen[fd.Path()] = true
+		b, err := protov2.Marshal(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return err
+		}
+		resp.FileDescriptorProto = append(resp.FileDescriptorProto, b)
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := add(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(fd); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) fileContainingSymbol(name protoreflect.FullName) protoreflect.FileDescriptor {
+	if d, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+		return d.ParentFile()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id, h := range s.handlers {
+		md := h.descriptor
+		if md == nil {
+			continue
+		}
+		if svc, _ := id.split(); protoreflect.FullName(svc) == name {
+			return md.ParentFile()
+		}
+		for _, d := range []protoreflect.Descriptor{md, md.Input(), md.Output()} {
+			if d.FullName() == name {
+				return d.ParentFile()
+			}
+		}
+	}
+	return nil
+}
+
+func listMethodsHandler(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMethodsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(reflectionServer).ListMethods(c, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ReflectionService + "/ListMethods",
+	}
+	handler := func(c context.Context, req interface{}) (interface{}, error) {
+		return srv.(reflectionServer).ListMethods(c, req.(*ListMethodsRequest))
+	}
+	return interceptor(c, in, info, handler)
+}
+
+func listServicesHandler(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(reflectionServer).ListServices(c, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ReflectionService + "/ListServices",
+	}
+	handler := func(c context.Context, req interface{}) (interface{}, error) {
+		return srv.(reflectionServer).ListServices(c, req.(*ListServicesRequest))
+	}
+	return interceptor(c, in, info, handler)
+}
+
+func fileContainingSymbolHandler(srv interface{}, c context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FileContainingSymbolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(reflectionServer).FileContainingSymbol(c, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ReflectionService + "/FileContainingSymbol",
+	}
+	handler := func(c context.Context, req interface{}) (interface{}, error) {
+		return srv.(reflectionServer).FileContainingSymbol(c, req.(*FileContainingSymbolRequest))
+	}
+	return interceptor(c, in, info, handler)
+}
+
+func reflectionService(s *Server) Service {
+	return Service{
+		Desc: &grpc.ServiceDesc{
+			ServiceName: ReflectionService,
+			HandlerType: (*reflectionServer)(nil),
+			Methods: []grpc.MethodDesc{
+				{MethodName: "ListMethods", Handler: listMethodsHandler},
+				{MethodName: "ListServices", Handler: listServicesHandler},
+				{MethodName: "FileContainingSymbol", Handler: fileContainingSymbolHandler},
+			},
+		},
+		Server: reflection{s: s},
+	}
+}
+
+// checkReserved rejects services that would be shadowed by, or would shadow,
+// the reflection service.
+func (s *Server) checkReserved(svcs []Service) error {
+	if !s.opts.reflection {
+		return nil
+	}
+	for _, svc := range svcs {
+		if svc.Desc == nil {
+			continue
+		}
+		name := svc.Desc.ServiceName
+		if name == ReflectionService || strings.HasSuffix(name, "."+ReflectionService) {
+			return fmt.Errorf("service (%s) collides with the reserved reflection service", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestReflection(t *testing.T) {
+	s := newEchoServer(t, WithReflection())
+	reply, err := s.Invoke(context.Background(), "", ReflectionService, "ListMethods", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var echo *MethodInfo
+	for _, m := range reply.(*ListMethodsResponse).Methods {
+		if m.Id == "apexgrpc.test.Echo/Echo" {
+			echo = m
+		}
+	}
+	if echo == nil || echo.RequestType != "apexgrpc.test.EchoRequest" || echo.ResponseType != "apexgrpc.test.EchoReply" {
+		t.Errorf("ListMethods described Echo as %+v", echo)
+	}
+
+	got, err := serve(t, s, `{"service":"apexgrpc","method":"ListServices","data":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"service":[{"name":"apexgrpc","descriptorUnavailable":true},{"name":"apexgrpc.test.Echo"}]}`)
+
+	err = s.Register([]Service{{Desc: &grpc.ServiceDesc{ServiceName: "x.apexgrpc"}, Server: &echoServer{}}})
+	if err == nil {
+		t.Error("registering a service named apexgrpc: err = nil")
+	}
+}
+
+// fileContainingSymbol serves FileContainingSymbol for symbol and returns the
+// names of the files in the response, in order.
+func fileContainingSymbol(t *testing.T, s *Server, symbol string) ([]string, error) {
+	t.Helper()
+	got, err := serve(t, s, `{"service":"apexgrpc","method":"FileContainingSymbol","data":{"symbol":"`+symbol+`"}}`)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		FileDescriptorProto []string `json:"fileDescriptorProto"`
+	}
+	if err := json.Unmarshal([]byte(got), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, enc := range resp.FileDescriptorProto {
+		b, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			t.Fatalf("file descriptor is not base64: %v", err)
+		}
+		var fd descriptorpb.FileDescriptorProto
+		if err := protov2.Unmarshal(b, &fd); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, fd.GetName())
+	}
+	return names, nil
+}
+
+func TestReflectionFileContainingSymbol(t *testing.T) {
+	s := newEchoServer(t, WithReflection())
+	for _, symbol := range []string{"apexgrpc.test.Echo", "apexgrpc.test.Echo.Echo", "apexgrpc.test.EchoRequest"} {
+		names, err := fileContainingSymbol(t, s, symbol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != "apexgrpc/test/echo.proto" {
+			t.Errorf("%s: files = %v", symbol, names)
+		}
+	}
+	_, err := fileContainingSymbol(t, s, "apexgrpc.test.Missing")
+	assertCode(t, err, codes.NotFound)
+
+	// Files given to RegisterDynamic are found with their imports.
+	s = newWellKnownServer(t, WithReflection())
+	names, err := fileContainingSymbol(t, s, "apexgrpc.wkttest.WellKnown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[apexgrpc/test/wkt.proto google/protobuf/wrappers.proto google/protobuf/struct.proto]"
+	if fmt.Sprint(names) != want {
+		t.Errorf("files = %v, want %s", names, want)
+	}
+}
+
+func TestReflectionListServicesWithoutDescriptors(t *testing.T) {
+	s := NewServer(WithReflection())
+	desc := grpc.ServiceDesc{
+		ServiceName: "apexgrpc.unregistered.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods:     echoServiceDesc.Methods[:1],
+	}
+	if err := s.Register([]Service{{Desc: &desc, Server: &echoServer{}}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := serve(t, s, `{"service":"apexgrpc","method":"ListServices","data":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"service":[{"name":"apexgrpc","descriptorUnavailable":true},{"name":"apexgrpc.unregistered.Echo","descriptorUnavailable":true}]}`)
+}
@@ -0,0 +1,193 @@
+package apexgrpc
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// RetryPolicy retries failed calls of unary methods inside the invocation.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls including the first. Less than two
+	// disables retries.
+	MaxAttempts int
+	// PerAttemptTimeout bounds every attempt. Zero means no bound.
+	PerAttemptTimeout time.Duration
+	// The delay before attempt n+1 is random between zero and
+	// InitialBackoff*BackoffMultiplier^(n-1), capped at MaxBackoff when it is
+	// set. BackoffMultiplier defaults to 2.
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// RetryableCodes are the codes of the failures that are retried.
+	RetryableCodes []codes.Code
+}
+
+// RetryHook observes a failed attempt that is retried after delay.
+type RetryHook func(c context.Context, id MethodID, attempt int, err error, delay time.Duration)
+
+// AttemptRecorder is implemented by MetricsRecorders that want to know about
+// every attempt of calls retried by WithRetryPolicy. It is called in addition
+// to RecordInvocation, which sees the call as a whole.
+type AttemptRecorder interface {
+	RecordAttempt(id MethodID, attempt int, duration time.Duration, code codes.Code)
+}
+
+// WithRetryPolicy retries the handler of unary methods, with a copy of the
+// already decoded request, while it fails with one of the retryable codes. Interceptors
+// run again for every attempt and see its number in RetryAttemptFromContext.
+// No attempt starts that could not finish before the deadline of the call: the
+// delay, plus the per-attempt timeout if set or else the duration of the
+// failed attempt, must fit in the remaining time.
+// Header and trailer metadata of failed attempts are discarded. Streaming
+// methods are not retried.
+func WithRetryPolicy(policy RetryPolicy) ServerOption {
+	return func(o *options) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithoutRetry exempts ids, e.g. handlers with side effects, from
+// WithRetryPolicy.
+func WithoutRetry(ids ...MethodID) ServerOption {
+	return func(o *options) {
+		if o.noRetryMethods == nil {
+			o.noRetryMethods = map[MethodID]bool{}
+		}
+		for _, id := range ids {
+			o.noRetryMethods[id] = true
+		}
+	}
+}
+
+// WithOnRetry appends hooks run before every retry, in the order given.
+func WithOnRetry(hooks ...RetryHook) ServerOption {
+	return func(o *options) {
+		o.retryHooks = append(o.retryHooks, hooks...)
+	}
+}
+
+type retryAttemptKey struct{}
+
+// RetryAttemptFromContext returns the number of the attempt being made,
+// starting at 1, for calls of methods retried by WithRetryPolicy.
+func RetryAttemptFromContext(c context.Context) (int, bool) {
+	n, ok := c.Value(retryAttemptKey{}).(int)
+	return n, ok
+}
+
+func (s *Server) retryPolicy(id MethodID) *RetryPolicy {
+	p := s.opts.retryPolicy
+	if p == nil || p.MaxAttempts < 2 || s.opts.noRetryMethods[id] {
+		return nil
+	}
+	return p
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	code := Code(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	mult := p.BackoffMultiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(rand.Float64() * d)
+}
+
+// fits reports whether an attempt started after delay can finish before the
+// deadline of c, assuming it takes as long as the last one unless
+// PerAttemptTimeout bounds it.
+func (p *RetryPolicy) fits(c context.Context, delay time.Duration, last time.Duration) bool {
+	deadline, ok := c.Deadline()
+	if !ok {
+		return true
+	}
+	need := p.PerAttemptTimeout
+	if need <= 0 {
+		need = last
+	}
+	remaining := time.Until(deadline) - delay
+	return remaining > 0 && remaining >= need
+}
+
+// retryInterceptor wraps next, which may be nil, in the retry loop of p.
+func (s *Server) retryInterceptor(id MethodID, p *RetryPolicy, md *outgoingMetadata, next grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for attempt := 1; ; attempt++ {
+			// Every attempt gets its own copy, in case a failed one
+			// modified the request.
+			r := req
+			if m, ok := req.(proto.Message); ok {
+				r = cloneProto(m)
+			}
+			start := time.Now()
+			reply, err := s.callAttempt(context.WithValue(c, retryAttemptKey{}, attempt), p, r, info, handler, next)
+			took := time.Since(start)
+			s.recordAttempt(id, attempt, took, err)
+			if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) || c.Err() != nil {
+				return reply, err
+			}
+			delay := p.backoff(attempt)
+			if !p.fits(c, delay, took) {
+				return reply, err
+			}
+			s.logRetry(id, attempt, err)
+			for _, hook := range s.opts.retryHooks {
+				hook(c, id, attempt, err, delay)
+			}
+			md.reset()
+			t := time.NewTimer(delay)
+			select {
+			case <-c.Done():
+				t.Stop()
+				return reply, err
+			case <-t.C:
+			}
+		}
+	}
+}
+
+func (s *Server) callAttempt(c context.Context, p *RetryPolicy, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler, next grpc.UnaryServerInterceptor) (interface{}, error) {
+	if p.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, p.PerAttemptTimeout)
+		defer cancel()
+	}
+	var reply interface{}
+	var err error
+	if next == nil {
+		reply, err = handler(c, req)
+	} else {
+		reply, err = next(c, req, info, handler)
+	}
+	return reply, deadlineError(c, err)
+}
+
+func (s *Server) recordAttempt(id MethodID, attempt int, duration time.Duration, err error) {
+	ar, ok := s.opts.metrics.(AttemptRecorder)
+	if !ok {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	ar.RecordAttempt(id, attempt, duration, Code(err))
+}
@@ -0,0 +1,126 @@
+package apexgrpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type attemptRecorder struct {
+	MemoryRecorder
+	attempts []codes.Code
+}
+
+func (r *attemptRecorder) RecordAttempt(id MethodID, attempt int, duration time.Duration, code codes.Code) {
+	r.attempts = append(r.attempts, code)
+}
+
+// flakyEcho fails with codes.Unavailable until it was called failures times,
+// modifying the request of every failed attempt.
+func flakyEcho(failures int, calls *int) *echoServer {
+	return &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		*calls++
+		if n, ok := RetryAttemptFromContext(c); ok && n != *calls {
+			return nil, status.Errorf(codes.Internal, "attempt %d on call %d", n, *calls)
+		}
+		if stringField(req, "message") != "hi" {
+			return nil, status.Errorf(codes.Internal, "attempt %d saw a modified request", *calls)
+		}
+		if *calls <= failures {
+			req.Set(req.Descriptor().Fields().ByName("message"), protoreflect.ValueOfString("dirty"))
+			return nil, status.Error(codes.Unavailable, "flaky")
+		}
+		return echoReply(req), nil
+	}}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryableCodes: []codes.Code{codes.Unavailable}}
+
+	t.Run("succeeds", func(t *testing.T) {
+		var calls, hooks int
+		rec := &attemptRecorder{}
+		s := newEchoServerWith(t, flakyEcho(2, &calls),
+			WithRetryPolicy(policy),
+			WithMetricsRecorder(rec),
+			WithOnRetry(func(c context.Context, id MethodID, attempt int, err error, delay time.Duration) {
+				hooks++
+			}),
+		)
+		out, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSON(t, out, `{"message":"hi"}`)
+		if calls != 3 || hooks != 2 {
+			t.Errorf("calls = %d, hooks = %d, want 3 and 2", calls, hooks)
+		}
+		want := []codes.Code{codes.Unavailable, codes.Unavailable, codes.OK}
+		if !reflect.DeepEqual(rec.attempts, want) {
+			t.Errorf("attempts = %v, want %v", rec.attempts, want)
+		}
+		if records := rec.Records(); len(records) != 1 || records[0].Code != codes.OK {
+			t.Errorf("invocations = %+v, want one that succeeded", records)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		var calls int
+		s := newEchoServerWith(t, flakyEcho(5, &calls), WithRetryPolicy(policy))
+		_, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+		assertCode(t, err, codes.Unavailable)
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		var calls int
+		s := newEchoServer(t,
+			WithRetryPolicy(policy),
+			WithOnRetry(func(context.Context, MethodID, int, error, time.Duration) { calls++ }),
+		)
+		_, err := serve(t, s, echoEvent("Fail", `{"count":5}`))
+		assertCode(t, err, codes.NotFound)
+		if calls != 0 {
+			t.Errorf("retries = %d, want 0", calls)
+		}
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		var calls int
+		s := newEchoServerWith(t, flakyEcho(1, &calls),
+			WithRetryPolicy(policy),
+			WithoutRetry(NewMethodID("", echoService, "Echo")),
+		)
+		_, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+		assertCode(t, err, codes.Unavailable)
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+}
+
+func TestRetryDeadlineBudget(t *testing.T) {
+	var calls int
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		calls++
+		time.Sleep(30 * time.Millisecond)
+		return nil, status.Error(codes.Unavailable, "flaky")
+	}}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, RetryableCodes: []codes.Code{codes.Unavailable}}))
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// A second attempt as slow as the first cannot finish in the 20ms left.
+	_, err := s.Invoke(c, "", echoService, "Echo", map[string]string{})
+	assertCode(t, err, codes.Unavailable)
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
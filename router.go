@@ -0,0 +1,280 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// Router turns a raw Lambda payload into method invocations and their results
+// back into the Lambda response.
+//
+// Batch routers return one Invocation per record and set Invocation.ID to the
+// record's identifier, e.g. the SQS messageId. Records that cannot be routed
+// are returned with Err set instead of failing the whole payload; the server
+// reports them as failed results without dispatching them. EncodeResponse
+// receives the results in the same order as the invocations and decides how
+// failures surface, e.g. as batchItemFailures.
+type Router interface {
+	Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error)
+	ResponseEncoder
+}
+
+type ResponseEncoder interface {
+	EncodeResponse(results []InvocationResult) (interface{}, error)
+}
+
+// Invocation is one method call routed from a Lambda payload.
+type Invocation struct {
+	// ID identifies the invocation to the router's ResponseEncoder.
+	ID string
+	// Method is resolved like the service and method of an Event.
+	Method MethodID
+	// Data is the encoded request; nil means an empty request.
+	Data io.Reader
+	// Encoding is the encoding of Data and of the reply, EncodingJSON by
+	// default.
+	Encoding string
+	// Metadata is passed to the handler like Event.Metadata.
+	Metadata map[string][]string
+	// DataRef is fetched in place of Data like Event.DataRef.
+	DataRef *BlobRef
+	// ContentEncoding and AcceptEncoding are handled like the Event fields.
+	ContentEncoding string
+	AcceptEncoding  string
+	// IdempotencyKey is handled like Event.IdempotencyKey.
+	IdempotencyKey string
+	// Fields is the field mask applied to the reply like Event.Fields.
+	Fields string
+	// DryRun marks the invocation like Event.DryRun.
+	DryRun bool
+	// APIVersion selects versioned methods like Event.APIVersion.
+	APIVersion string
+	// Err marks an invocation that could not be routed.
+	Err error
+
+	// event is the Event the invocation was routed from, if any, which
+	// EventFromContext and event hooks see in place of the one built from the
+	// fields above.
+	event *Event
+}
+
+type InvocationResult struct {
+	Invocation *Invocation
+	// Reply is the encoded reply, as Run would return it for a single Event.
+	Reply interface{}
+	Err   error
+}
+
+// WithRouter makes Run route payloads with r instead of DefaultRouter.
+func WithRouter(r Router) ServerOption {
+	return func(o *options) {
+		o.router = r
+	}
+}
+
+// DefaultRouter routes payloads that are a single Event.
+type DefaultRouter struct {
+	// Strict rejects Events with unknown fields; see WithStrictEventParsing.
+	Strict bool
+}
+
+func (r DefaultRouter) Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error) {
+	event, err := decodeEvent(eventMsg, r.Strict)
+	if err != nil {
+		return nil, invalidEventf("invalid event: %v", err)
+	}
+	inv := eventInvocation(&event)
+	if inv.Err != nil {
+		return nil, inv.Err
+	}
+	return []Invocation{inv}, nil
+}
+
+func (DefaultRouter) EncodeResponse(results []InvocationResult) (interface{}, error) {
+	if len(results) != 1 {
+		return nil, codedErrorf(codes.Internal, "expected 1 result, got %d", len(results))
+	}
+	return results[0].Reply, results[0].Err
+}
+
+// eventInvocation converts an Event into an Invocation, setting Err when the
+// event does not address a method.
+func eventInvocation(event *Event) Invocation {
+	pkg, svc, mtd, err := eventTarget(event)
+	if err != nil {
+		return Invocation{Err: err}
+	}
+	if pkg != "" && !hasPackage(svc, pkg) {
+		svc = pkg + "." + svc
+	}
+	inv := Invocation{
+		Method:   NewMethodID("", svc, mtd),
+		Metadata: event.Metadata,
+		DataRef:  event.DataRef,
+		DryRun:   event.DryRun,
+	}
+	if event.ContentEncoding != nil {
+		inv.ContentEncoding = *event.ContentEncoding
+	}
+	if event.AcceptEncoding != nil {
+		inv.AcceptEncoding = *event.AcceptEncoding
+	}
+	if event.IdempotencyKey != nil {
+		inv.IdempotencyKey = *event.IdempotencyKey
+	}
+	if event.Fields != nil {
+		inv.Fields = *event.Fields
+	}
+	if event.APIVersion != nil {
+		inv.APIVersion = *event.APIVersion
+	}
+	if event.Data != nil {
+		inv.Data = newEventData(*event.Data)
+	}
+	if event.Encoding != nil {
+		inv.Encoding = *event.Encoding
+	}
+	inv.event = event
+	return inv
+}
+
+// eventData is the reader eventInvocation wraps event data in, so that
+// invokeInvocation can take the bytes back without copying them.
+type eventData struct {
+	*bytes.Reader
+	raw []byte
+}
+
+func newEventData(raw []byte) *eventData {
+	return &eventData{Reader: bytes.NewReader(raw), raw: raw}
+}
+
+// readInvocationData returns the data of an Invocation, reusing the bytes of
+// an unread eventData.
+func readInvocationData(r io.Reader) ([]byte, error) {
+	if d, ok := r.(*eventData); ok && d.Len() == len(d.raw) {
+		return d.raw, nil
+	}
+	return io.ReadAll(r)
+}
+
+// concurrentRouter is implemented by routers whose invocations may be
+// dispatched in parallel.
+type concurrentRouter interface {
+	Concurrency() int
+}
+
+func (s *Server) route(c context.Context, r Router, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+	start := time.Now()
+	invs, err := r.Route(eventMsg, ctx)
+	if err != nil {
+		s.logRouteFailure(c, ctx, eventMsg, err, start)
+		return nil, err
+	}
+	var concurrency int
+	if cr, ok := r.(concurrentRouter); ok {
+		concurrency = cr.Concurrency()
+	}
+	results := make([]InvocationResult, len(invs))
+	forEach(len(invs), concurrency, func(i int) {
+		results[i] = s.invokeInvocation(c, &invs[i], ctx)
+	})
+	return r.EncodeResponse(results)
+}
+
+func (s *Server) invokeInvocation(c context.Context, inv *Invocation, ctx *apex.Context) InvocationResult {
+	res := InvocationResult{Invocation: inv}
+	if inv.Err != nil {
+		s.logRouteFailure(c, ctx, nil, inv.Err, time.Now())
+		res.Err = inv.Err
+		return res
+	}
+	var data []byte
+	if inv.Data != nil {
+		b, err := readInvocationData(inv.Data)
+		if err != nil {
+			res.Err = invalidInputError(inv.Method, err)
+			return res
+		}
+		data = b
+	}
+	event := methodEvent(inv.Method, data)
+	event.Metadata = inv.Metadata
+	event.DataRef = inv.DataRef
+	event.DryRun = inv.DryRun
+	if inv.ContentEncoding != "" {
+		event.ContentEncoding = &inv.ContentEncoding
+	}
+	if inv.AcceptEncoding != "" {
+		event.AcceptEncoding = &inv.AcceptEncoding
+	}
+	if inv.IdempotencyKey != "" {
+		event.IdempotencyKey = &inv.IdempotencyKey
+	}
+	if inv.APIVersion != "" {
+		event.APIVersion = &inv.APIVersion
+	}
+	if inv.Fields != "" {
+		event.Fields = &inv.Fields
+	}
+	if inv.Encoding != "" {
+		event.Encoding = &inv.Encoding
+	}
+	if inv.event != nil {
+		event.raw = inv.event.raw
+		c = newSourceEventContext(c, inv.event)
+	}
+	res.Reply, res.Err = s.invokeEvent(c, &event, ctx)
+	return res
+}
+
+// invokeEvent dispatches event and encodes the reply as Run returns it.
+func (s *Server) invokeEvent(c context.Context, event *Event, ctx *apex.Context) (interface{}, error) {
+	return s.accessLogged(c, func(c context.Context) (interface{}, error) {
+		return s.encodeEvent(c, event, ctx)
+	})
+}
+
+func (s *Server) encodeEvent(c context.Context, event *Event, ctx *apex.Context) (interface{}, error) {
+	res, err := s.processEvent(c, event, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if event.Fields != nil && *event.Fields != "" {
+		if res, err = filterResult(res.id, res, *event.Fields); err != nil {
+			return nil, err
+		}
+	}
+	encoding, _ := s.eventEncoding(event)
+	data, err := s.encodeResult(encoding, res)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = compressResponse(event, data); err != nil {
+		return nil, err
+	}
+	if data, err = s.offloadResponse(c, res.id, data); err != nil {
+		return nil, err
+	}
+	if data, err = s.limitResponse(res.id, data); err != nil {
+		return nil, err
+	}
+	partial := s.partialStatus(res)
+	if !s.opts.metadataEnvelope && partial == nil {
+		return data, nil
+	}
+	env := &MetadataEnvelope{Data: data, PartialStatus: partial}
+	if s.opts.metadataEnvelope {
+		env.Metadata = &ResponseMetadata{
+			Header:  encodeMetadata(res.header),
+			Trailer: encodeMetadata(res.trailer),
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,103 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apex/go-apex"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// lineRouter routes payloads of the form {"lines":["Method message", ...]} to
+// the methods of apexgrpc.test.Echo, and responds with the outcome of every
+// line.
+type lineRouter struct{}
+
+func (lineRouter) Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error) {
+	var payload struct {
+		Lines []string `json:"lines"`
+	}
+	if err := json.Unmarshal(eventMsg, &payload); err != nil || payload.Lines == nil {
+		return nil, invalidEventf("not a line payload")
+	}
+	invs := make([]Invocation, len(payload.Lines))
+	for i, line := range payload.Lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			invs[i] = Invocation{ID: line, Err: invalidEventf("invalid line %q", line)}
+			continue
+		}
+		data, _ := json.Marshal(map[string]string{"message": fields[1]})
+		invs[i] = Invocation{
+			ID:       line,
+			Method:   NewMethodID("", echoService, fields[0]),
+			Data:     strings.NewReader(string(data)),
+			Metadata: map[string][]string{"x-line": {line}},
+		}
+	}
+	return invs, nil
+}
+
+func (lineRouter) EncodeResponse(results []InvocationResult) (interface{}, error) {
+	out := []string{}
+	for _, r := range results {
+		if r.Err != nil {
+			out = append(out, r.Invocation.ID+": "+Code(r.Err).String())
+			continue
+		}
+		b, _ := json.Marshal(r.Reply)
+		out = append(out, r.Invocation.ID+": "+string(b))
+	}
+	return out, nil
+}
+
+func TestWithRouter(t *testing.T) {
+	var lines []string
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ := metadata.FromIncomingContext(c)
+		lines = append(lines, md.Get("x-line")...)
+		return echoReply(req), nil
+	}}, WithRouter(lineRouter{}))
+	got, err := serve(t, s, `{"lines":["Echo a","bad","Nope b","Echo c"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `["Echo a: {\"message\":\"a\"}","bad: InvalidArgument","Nope b: Unimplemented","Echo c: {\"message\":\"c\"}"]`)
+	if strings.Join(lines, ",") != "Echo a,Echo c" {
+		t.Errorf("handled %q, want only the routable lines", lines)
+	}
+
+	_, err = serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestDefaultRouter(t *testing.T) {
+	invs, err := DefaultRouter{}.Route(json.RawMessage(`{"package":"apexgrpc.test","service":"Echo","method":"Echo","data":{"message":"hi"},"fields":"message"}`), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != 1 || invs[0].Method != NewMethodID("", echoService, "Echo") || invs[0].Fields != "message" {
+		t.Fatalf("invocations = %+v", invs)
+	}
+	for _, event := range []string{`{"data":{}}`, `{"service":`} {
+		if _, err := (DefaultRouter{}).Route(json.RawMessage(event), testApexContext()); Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: err = %v, want InvalidArgument", event, err)
+		}
+	}
+	if _, err := (DefaultRouter{Strict: true}).Route(json.RawMessage(`{"service":"s","method":"m","bogus":1}`), testApexContext()); err == nil {
+		t.Error("strict router accepted an unknown field")
+	}
+
+	_, err = DefaultRouter{}.EncodeResponse([]InvocationResult{{}, {}})
+	assertCode(t, err, codes.Internal)
+	want := errors.New("failed")
+	if _, err := (DefaultRouter{}).EncodeResponse([]InvocationResult{{Err: want}}); err != want {
+		t.Errorf("err = %v, want the error of the result", err)
+	}
+}
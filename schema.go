@@ -0,0 +1,254 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// JSONSchemaDialect is the JSON Schema version of the schemas of Schema.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// MethodSchema holds JSON Schemas of the request data and reply of a method
+// as they appear in events and Lambda results, following the proto3 JSON
+// mapping: 64-bit integers are strings, enums are their value names and
+// well-known types take their JSON forms. The data of client-streaming and
+// the reply of server-streaming methods are arrays. Fields are listed under
+// their JSON names; other keys are not rejected since original proto names
+// are accepted too.
+type MethodSchema struct {
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Schema returns the schemas of every registered method whose message types
+// are known from its proto descriptor or HandlerType.
+func (s *Server) Schema() map[MethodID]*MethodSchema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schemas := map[MethodID]*MethodSchema{}
+	for id, h := range s.handlers {
+		if sc := methodSchema(id, h); sc != nil {
+			schemas[id] = sc
+		}
+	}
+	return schemas
+}
+
+func methodSchema(id MethodID, h handler) *MethodSchema {
+	req, resp := messageDescriptors(id, h)
+	if req == nil || resp == nil {
+		return nil
+	}
+	var clientStreams, serverStreams bool
+	if h.streamDesc != nil {
+		clientStreams, serverStreams = h.streamDesc.ClientStreams, h.streamDesc.ServerStreams
+	}
+	return &MethodSchema{
+		Request:  messageSchema(req, clientStreams),
+		Response: messageSchema(resp, serverStreams),
+	}
+}
+
+// messageDescriptors returns the descriptors of the request and response
+// messages of h.
+func messageDescriptors(id MethodID, h handler) (protoreflect.MessageDescriptor, protoreflect.MessageDescriptor) {
+	if h.descriptor != nil {
+		return h.descriptor.Input(), h.descriptor.Output()
+	}
+	req, resp := methodTypes(id, h)
+	return typeDescriptor(req), typeDescriptor(resp)
+}
+
+func typeDescriptor(t reflect.Type) protoreflect.MessageDescriptor {
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+	m, ok := reflect.New(t.Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil
+	}
+	return messageV2(m).ProtoReflect().Descriptor()
+}
+
+// messageSchema returns the schema document of md, or of an array of md.
+func messageSchema(md protoreflect.MessageDescriptor, array bool) json.RawMessage {
+	g := schemaGenerator{defs: map[string]interface{}{}}
+	root := g.message(md)
+	if array {
+		root = map[string]interface{}{"type": "array", "items": root}
+	}
+	doc := map[string]interface{}{"$schema": JSONSchemaDialect}
+	for k, v := range root {
+		doc[k] = v
+	}
+	if len(g.defs) > 0 {
+		doc["$defs"] = g.defs
+	}
+	b, _ := json.Marshal(doc)
+	return b
+}
+
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+// message returns the schema of a message value: the JSON form of well-known
+// types, or a reference to a definition otherwise.
+func (g *schemaGenerator) message(md protoreflect.MessageDescriptor) map[string]interface{} {
+	if sc := wellKnownSchema(md); sc != nil {
+		return sc
+	}
+	name := string(md.FullName())
+	if _, ok := g.defs[name]; !ok {
+		// Reserve the name first so that recursive messages terminate.
+		g.defs[name] = nil
+		g.defs[name] = g.object(md)
+	}
+	return map[string]interface{}{"$ref": "#/$defs/" + name}
+}
+
+func (g *schemaGenerator) object(md protoreflect.MessageDescriptor) map[string]interface{} {
+	props := map[string]interface{}{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		props[fd.JSONName()] = g.field(fd)
+	}
+	sc := map[string]interface{}{"type": "object", "properties": props}
+	var exclusive []interface{}
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		od := oneofs.Get(i)
+		if od.IsSynthetic() {
+			continue
+		}
+		if rule := oneofRule(od); rule != nil {
+			exclusive = append(exclusive, rule)
+		}
+	}
+	if len(exclusive) > 0 {
+		sc["allOf"] = exclusive
+	}
+	return sc
+}
+
+// oneofRule forbids setting two fields of od together.
+func oneofRule(od protoreflect.OneofDescriptor) map[string]interface{} {
+	fields := od.Fields()
+	var pairs []interface{}
+	for i := 0; i < fields.Len(); i++ {
+		for j := i + 1; j < fields.Len(); j++ {
+			pairs = append(pairs, map[string]interface{}{
+				"required": []string{fields.Get(i).JSONName(), fields.Get(j).JSONName()},
+			})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"not": map[string]interface{}{"anyOf": pairs}}
+}
+
+func (g *schemaGenerator) field(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.singular(fd.MapValue()),
+		}
+	}
+	if fd.IsList() {
+		return map[string]interface{}{"type": "array", "items": g.singular(fd)}
+	}
+	return g.singular(fd)
+}
+
+func (g *schemaGenerator) singular(fd protoreflect.FieldDescriptor) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.message(fd.Message())
+	case protoreflect.EnumKind:
+		ed := fd.Enum()
+		if ed.FullName() == "google.protobuf.NullValue" {
+			return map[string]interface{}{"type": "null"}
+		}
+		values := ed.Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	}
+	return scalarSchema(fd.Kind())
+}
+
+func scalarSchema(kind protoreflect.Kind) map[string]interface{} {
+	switch kind {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "uint32", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "int64", "pattern": `^-?[0-9]+$`}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "uint64", "pattern": `^[0-9]+$`}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "number"},
+			map[string]interface{}{"enum": []string{"NaN", "Infinity", "-Infinity"}},
+		}}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// wellKnownSchema returns the schema of the JSON form of a well-known type,
+// or nil for other messages.
+func wellKnownSchema(md protoreflect.MessageDescriptor) map[string]interface{} {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]{1,9})?s$`}
+	case "google.protobuf.FieldMask":
+		return map[string]interface{}{"type": "string"}
+	case "google.protobuf.Struct":
+		return map[string]interface{}{"type": "object"}
+	case "google.protobuf.ListValue":
+		return map[string]interface{}{"type": "array"}
+	case "google.protobuf.Value":
+		return map[string]interface{}{}
+	case "google.protobuf.Empty":
+		return map[string]interface{}{"type": "object", "maxProperties": 0}
+	case "google.protobuf.Any":
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+			"required":   []string{"@type"},
+		}
+	case "google.protobuf.BoolValue":
+		return scalarSchema(protoreflect.BoolKind)
+	case "google.protobuf.Int32Value":
+		return scalarSchema(protoreflect.Int32Kind)
+	case "google.protobuf.UInt32Value":
+		return scalarSchema(protoreflect.Uint32Kind)
+	case "google.protobuf.Int64Value":
+		return scalarSchema(protoreflect.Int64Kind)
+	case "google.protobuf.UInt64Value":
+		return scalarSchema(protoreflect.Uint64Kind)
+	case "google.protobuf.FloatValue":
+		return scalarSchema(protoreflect.FloatKind)
+	case "google.protobuf.DoubleValue":
+		return scalarSchema(protoreflect.DoubleKind)
+	case "google.protobuf.StringValue":
+		return scalarSchema(protoreflect.StringKind)
+	case "google.protobuf.BytesValue":
+		return scalarSchema(protoreflect.BytesKind)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// sampleServiceFiles describes apexgrpc.schematest.Samples:
+//
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Sample {
+//	  int64 big = 1; uint32 small = 2; double ratio = 3; bytes blob = 4;
+//	  repeated string tags = 5; map<string, int32> counts = 6; Color color = 7;
+//	  oneof choice { string a = 8; int32 b = 9; bool c = 10; }
+//	  google.protobuf.Timestamp at = 11; Sample child = 12;
+//	}
+//	service Samples { rpc Get(Sample) returns (Sample); }
+func sampleServiceFiles() *descriptorpb.FileDescriptorSet {
+	opt, rep := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	field := func(name string, n int32, t descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(n),
+			Type:     t.Enum(),
+			Label:    label.Enum(),
+		}
+	}
+	typed := func(f *descriptorpb.FieldDescriptorProto, typeName string) *descriptorpb.FieldDescriptorProto {
+		f.TypeName = proto.String(typeName)
+		return f
+	}
+	inChoice := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.OneofIndex = proto.Int32(0)
+		return f
+	}
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		{
+			Name:       proto.String("apexgrpc/test/sample.proto"),
+			Package:    proto.String("apexgrpc.schematest"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"google/protobuf/timestamp.proto"},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name: proto.String("Color"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("RED"), Number: proto.Int32(0)},
+					{Name: proto.String("GREEN"), Number: proto.Int32(1)},
+				},
+			}},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Sample"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("big", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, opt),
+					field("small", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT32, opt),
+					field("ratio", 3, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, opt),
+					field("blob", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES, opt),
+					field("tags", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, rep),
+					typed(field("counts", 6, msg, rep), ".apexgrpc.schematest.Sample.CountsEntry"),
+					typed(field("color", 7, descriptorpb.FieldDescriptorProto_TYPE_ENUM, opt), ".apexgrpc.schematest.Color"),
+					inChoice(field("a", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt)),
+					inChoice(field("b", 9, descriptorpb.FieldDescriptorProto_TYPE_INT32, opt)),
+					inChoice(field("c", 10, descriptorpb.FieldDescriptorProto_TYPE_BOOL, opt)),
+					typed(field("at", 11, msg, opt), ".google.protobuf.Timestamp"),
+					typed(field("child", 12, msg, opt), ".apexgrpc.schematest.Sample"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("CountsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, opt),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+			}},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Samples"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Get"),
+					InputType:  proto.String(".apexgrpc.schematest.Sample"),
+					OutputType: proto.String(".apexgrpc.schematest.Sample"),
+				}},
+			}},
+		},
+	}}
+}
+
+func decodeSchema(t *testing.T, b json.RawMessage) map[string]interface{} {
+	t.Helper()
+	var sc map[string]interface{}
+	if err := json.Unmarshal(b, &sc); err != nil {
+		t.Fatalf("invalid schema %s: %v", b, err)
+	}
+	return sc
+}
+
+func TestSchema(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterDynamic(sampleServiceFiles(), echoDynamic); err != nil {
+		t.Fatal(err)
+	}
+	sc := s.Schema()[NewMethodID("", "apexgrpc.schematest.Samples", "Get")]
+	if sc == nil {
+		t.Fatal("no schema for Get")
+	}
+	doc := decodeSchema(t, sc.Request)
+	if doc["$schema"] != JSONSchemaDialect || doc["$ref"] != "#/$defs/apexgrpc.schematest.Sample" {
+		t.Errorf("schema document = %v", doc)
+	}
+	sample := doc["$defs"].(map[string]interface{})["apexgrpc.schematest.Sample"].(map[string]interface{})
+	props := sample["properties"].(map[string]interface{})
+	want := map[string]string{
+		"big":    `{"format":"int64","pattern":"^-?[0-9]+$","type":"string"}`,
+		"small":  `{"format":"uint32","minimum":0,"type":"integer"}`,
+		"ratio":  `{"anyOf":[{"type":"number"},{"enum":["NaN","Infinity","-Infinity"]}]}`,
+		"blob":   `{"contentEncoding":"base64","type":"string"}`,
+		"tags":   `{"items":{"type":"string"},"type":"array"}`,
+		"counts": `{"additionalProperties":{"format":"int32","type":"integer"},"type":"object"}`,
+		"color":  `{"enum":["RED","GREEN"],"type":"string"}`,
+		"at":     `{"format":"date-time","type":"string"}`,
+		"child":  `{"$ref":"#/$defs/apexgrpc.schematest.Sample"}`,
+	}
+	for name, js := range want {
+		got, _ := json.Marshal(props[name])
+		assertJSON(t, string(got), js)
+	}
+	got, _ := json.Marshal(sample["allOf"])
+	assertJSON(t, string(got), `[{"not":{"anyOf":[{"required":["a","b"]},{"required":["a","c"]},{"required":["b","c"]}]}}]`)
+	if !reflect.DeepEqual(decodeSchema(t, sc.Response), doc) {
+		t.Errorf("response schema = %s, want the request schema", sc.Response)
+	}
+}
+
+func TestSchemaStreams(t *testing.T) {
+	schemas := newEchoServer(t).Schema()
+	join := decodeSchema(t, schemas[NewMethodID("", echoService, "Join")].Request)
+	split := decodeSchema(t, schemas[NewMethodID("", echoService, "Split")].Response)
+	for _, sc := range []map[string]interface{}{join, split} {
+		if sc["type"] != "array" || sc["items"].(map[string]interface{})["$ref"] == nil {
+			t.Errorf("schema of a stream = %v", sc)
+		}
+	}
+}
+
+func TestReflectionSchemas(t *testing.T) {
+	s := newEchoServer(t, WithReflection())
+	reply, err := s.Invoke(context.Background(), "", ReflectionService, "ListMethods", map[string]interface{}{"include_schemas": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range reply.(*ListMethodsResponse).Methods {
+		if m.Id == "apexgrpc.test.Echo/Echo" {
+			if m.RequestSchema != string(s.Schema()[NewMethodID("", echoService, "Echo")].Request) {
+				t.Errorf("request schema = %s", m.RequestSchema)
+			}
+			return
+		}
+	}
+	t.Error("Echo not listed")
+}
@@ -0,0 +1,144 @@
+package apexgrpc
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// ShadowFunc receives a copy of the requests sampled by WithShadow.
+type ShadowFunc func(c context.Context, req proto.Message)
+
+// ShadowSampler decides whether a call of id is shadowed, given the fraction
+// set with WithShadow.
+type ShadowSampler func(id MethodID, fraction float64) bool
+
+// ShadowRecorder is implemented by MetricsRecorders that want to know about
+// shadow calls. The code is codes.Internal if the shadow panicked.
+type ShadowRecorder interface {
+	RecordShadowInvocation(id MethodID, duration time.Duration, code codes.Code)
+}
+
+type shadow struct {
+	fraction float64
+	fn       ShadowFunc
+}
+
+// WithShadow passes a fraction of the requests of unary method id, between 0
+// and 1, to fn as well, once they passed authorization and the interceptors.
+// fn runs in its own goroutine with a copy of the request and a context that
+// keeps the values of the call but not its deadline or transport stream, and
+// neither its duration nor a panic affects the call.
+func WithShadow(id MethodID, fraction float64, fn ShadowFunc) ServerOption {
+	return func(o *options) {
+		if o.shadows == nil {
+			o.shadows = map[MethodID]shadow{}
+		}
+		o.shadows[id] = shadow{fraction: fraction, fn: fn}
+	}
+}
+
+// WithShadowSampler replaces the random sampling of WithShadow, e.g. with a
+// deterministic one in tests.
+func WithShadowSampler(f ShadowSampler) ServerOption {
+	return func(o *options) {
+		o.shadowSampler = f
+	}
+}
+
+func randomSample(id MethodID, fraction float64) bool {
+	return rand.Float64() < fraction
+}
+
+// shadowInterceptor shadows the request of a call of id once it passed the
+// other interceptors, and only on its first attempt.
+func (s *Server) shadowInterceptor(id MethodID) grpc.UnaryServerInterceptor {
+	var once sync.Once
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if msg, ok := req.(proto.Message); ok {
+			once.Do(func() {
+				s.shadowRequest(c, id, msg)
+			})
+		}
+		return handler(c, req)
+	}
+}
+
+func (s *Server) shadowRequest(c context.Context, id MethodID, req proto.Message) {
+	sh, ok := s.opts.shadows[id]
+	if !ok {
+		return
+	}
+	sample := s.opts.shadowSampler
+	if sample == nil {
+		sample = randomSample
+	}
+	if !sample(id, sh.fraction) {
+		return
+	}
+	req = cloneProto(req)
+	c = newDetachedContext(c)
+	go func() {
+		start := time.Now()
+		code := codes.Internal
+		defer func() {
+			recover()
+			s.recordShadowInvocation(id, time.Since(start), code)
+		}()
+		sh.fn(c, req)
+		code = codes.OK
+	}()
+}
+
+func (s *Server) recordShadowInvocation(id MethodID, duration time.Duration, code codes.Code) {
+	sr, ok := s.opts.metrics.(ShadowRecorder)
+	if !ok {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	sr.RecordShadowInvocation(id, duration, code)
+}
+
+// detachedContext keeps the values of a context but is never done. It hides
+// the transport stream of the call, so that the shadow cannot set its header
+// and trailer metadata.
+type detachedContext struct {
+	context.Context
+}
+
+// newDetachedContext detaches c, with a copy of its incoming metadata.
+func newDetachedContext(c context.Context) context.Context {
+	d := detachedContext{c}
+	if md, ok := metadata.FromIncomingContext(c); ok {
+		return metadata.NewIncomingContext(d, md.Copy())
+	}
+	return d
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	v := d.Context.Value(key)
+	if _, ok := v.(grpc.ServerTransportStream); ok {
+		return nil
+	}
+	return v
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package apexgrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestShadow(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	var calls int
+	shadowed := make(chan error, 10)
+	var sampled []bool
+	sampler := func(sid MethodID, fraction float64) bool {
+		sample := len(sampled) == 0
+		sampled = append(sampled, sample)
+		if sid != id || fraction != 0.5 {
+			t.Errorf("sampler got %s %v", sid, fraction)
+		}
+		return sample
+	}
+	rec := &MemoryRecorder{}
+	s := newEchoServerWith(t, flakyEcho(2, &calls),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, RetryableCodes: []codes.Code{codes.Unavailable}}),
+		WithMetricsRecorder(rec),
+		WithShadowSampler(sampler),
+		WithShadow(id, 0.5, func(c context.Context, req proto.Message) {
+			if _, ok := c.Deadline(); ok {
+				shadowed <- errors.New("the shadow context has a deadline")
+				return
+			}
+			if grpc.ServerTransportStreamFromContext(c) != nil {
+				shadowed <- errors.New("the shadow context has the transport stream")
+				return
+			}
+			if err := grpc.SetHeader(c, metadata.Pairs("x-shadow", "1")); err == nil {
+				shadowed <- errors.New("the shadow set header metadata")
+				return
+			}
+			m := proto.MessageReflect(req)
+			m.Set(m.Descriptor().Fields().ByName("message"), protoreflect.ValueOfString("shadow"))
+			shadowed <- nil
+			panic("shadow")
+		}),
+		WithMetadataEnvelope(),
+	)
+	got, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"data":{"message":"hi"},"metadata":{}}`)
+	select {
+	case err := <-shadowed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the shadow was not called")
+	}
+
+	calls = 0
+	if _, err := serve(t, s, echoEvent("Echo", `{"message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sampled) != 2 {
+		t.Errorf("sampled %d times over two retried calls, want once per call", len(sampled))
+	}
+	select {
+	case <-shadowed:
+		t.Error("a call that was not sampled was shadowed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		var shadow []InvocationRecord
+		for _, r := range rec.Records() {
+			if r.Shadow {
+				shadow = append(shadow, r)
+			}
+		}
+		if len(shadow) == 1 {
+			if shadow[0].Code != codes.Internal {
+				t.Errorf("shadow record = %+v, want codes.Internal for the panic", shadow[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("shadow records = %+v, want one", shadow)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
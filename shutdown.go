@@ -0,0 +1,108 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+// drainState tracks the calls in flight for Shutdown.
+type drainState struct {
+	mu       sync.Mutex
+	shutdown bool
+	active   int
+	// idle is closed once no call is in flight after Shutdown.
+	idle chan struct{}
+}
+
+// begin admits a call unless the server is shutting down, returning the
+// function ending it.
+func (d *drainState) begin() (func(), bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.shutdown {
+		return nil, false
+	}
+	d.active++
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.active--
+		if d.active == 0 && d.idle != nil {
+			close(d.idle)
+		}
+	}, true
+}
+
+type admittedContextKey struct{}
+
+// Shutdown makes the server reject new invocations and Invoke calls with
+// codes.Unavailable, then waits for those in flight, including the remaining
+// items of batch events being served, until they return or c is done. c
+// therefore bounds the drain period. Shutdown cannot be undone.
+func (s *Server) Shutdown(c context.Context) error {
+	d := &s.drain
+	d.mu.Lock()
+	if !d.shutdown {
+		d.shutdown = true
+		d.idle = make(chan struct{})
+		if d.active == 0 {
+			close(d.idle)
+		}
+	}
+	idle := d.idle
+	d.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// admitted wraps h to count its invocations as in flight. The events of an
+// invocation admitted before Shutdown are all processed.
+func (s *Server) admitted(h lambdaHandler) lambdaHandler {
+	return func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		if end, ok := s.drain.begin(); ok {
+			defer end()
+			c = context.WithValue(c, admittedContextKey{}, true)
+		}
+		return h(c, eventMsg, ctx)
+	}
+}
+
+// admit admits a call made outside an admitted invocation, such as through
+// Invoke or ServeHTTP.
+func (s *Server) admit(c context.Context) (func(), error) {
+	if c.Value(admittedContextKey{}) != nil {
+		return func() {}, nil
+	}
+	end, ok := s.drain.begin()
+	if !ok {
+		return nil, errShuttingDown
+	}
+	return end, nil
+}
+
+// canceledError reports a call whose context was canceled, e.g. by the base
+// context of RunWithContext, as codes.Canceled: the caller is gone, so a reply
+// or a failure caused by the cancellation is not returned.
+func canceledError(c context.Context, err error) error {
+	if c.Err() != context.Canceled {
+		return err
+	}
+	if err == nil {
+		return status.Error(codes.Canceled, "call canceled")
+	}
+	if code := Code(err); code != codes.Unknown && code != codes.Canceled {
+		return err
+	}
+	return status.Error(codes.Canceled, err.Error())
+}
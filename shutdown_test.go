@@ -0,0 +1,78 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestShutdown(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	s := newEchoServerWith(t, blockingEcho(entered, release))
+	served := make(chan error)
+	go func() {
+		_, err := s.ApexHandler(context.Background())(json.RawMessage(echoEvent("Echo", `{}`)), testApexContext())
+		served <- err
+	}()
+	<-entered
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Shutdown(context.Background())
+	}()
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(expired); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown with a call in flight = %v, want %v", err, context.DeadlineExceeded)
+	}
+	_, err := serve(t, s, echoEvent("Echo", `{}`))
+	assertCode(t, err, codes.Unavailable)
+	_, err = s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+	assertCode(t, err, codes.Unavailable)
+	select {
+	case err := <-stopped:
+		t.Fatalf("Shutdown returned %v before the call in flight", err)
+	default:
+	}
+	close(release)
+	if err := <-served; err != nil {
+		t.Errorf("call in flight: %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
+
+func TestCanceledCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"reply", nil, codes.Canceled},
+		{"generic error", errors.New("read failed"), codes.Canceled},
+		{"wrapped cancellation", status.Error(codes.Canceled, "stopped"), codes.Canceled},
+		{"status", status.Error(codes.NotFound, "gone"), codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, cancel := context.WithCancel(context.Background())
+			s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+				cancel()
+				<-c.Done()
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return echoReply(req), nil
+			}})
+			_, err := s.ApexHandler(base)(json.RawMessage(echoEvent("Echo", `{}`)), testApexContext())
+			assertCode(t, err, tt.code)
+		})
+	}
+}
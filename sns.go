@@ -0,0 +1,140 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+const snsEventSource = "aws:sns"
+
+type SNSEvent struct {
+	Records []SNSEventRecord `json:"Records"`
+}
+
+type SNSEventRecord struct {
+	EventVersion         string    `json:"EventVersion"`
+	EventSubscriptionArn string    `json:"EventSubscriptionArn"`
+	EventSource          string    `json:"EventSource"`
+	SNS                  SNSEntity `json:"Sns"`
+}
+
+type SNSEntity struct {
+	Type              string                         `json:"Type"`
+	MessageID         string                         `json:"MessageId"`
+	TopicArn          string                         `json:"TopicArn"`
+	Subject           string                         `json:"Subject"`
+	Message           string                         `json:"Message"`
+	Timestamp         string                         `json:"Timestamp"`
+	MessageAttributes map[string]SNSMessageAttribute `json:"MessageAttributes"`
+}
+
+type SNSMessageAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// WithoutSNSDetection stops Run from treating SNS notification events
+// specially, so every payload is parsed as an Event.
+func WithoutSNSDetection() ServerOption {
+	return func(o *options) {
+		o.noSNSDetection = true
+	}
+}
+
+// SNSRouter routes SNS notification events whose messages are Events. SNS has
+// no partial batch semantics, so any failing record fails the invocation.
+type SNSRouter struct {
+	// Strict rejects Events with unknown fields; see WithStrictEventParsing.
+	Strict bool
+}
+
+func (r SNSRouter) Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error) {
+	var event SNSEvent
+	if err := json.Unmarshal(eventMsg, &event); err != nil {
+		return nil, invalidEventf("invalid SNS event")
+	}
+	invs := make([]Invocation, len(event.Records))
+	for i := range event.Records {
+		msg := &event.Records[i].SNS
+		e, err := decodeEvent([]byte(msg.Message), r.Strict)
+		if err != nil {
+			invs[i] = Invocation{Err: invalidEventf("invalid event in SNS message %s: %v", msg.MessageID, err)}
+		} else {
+			md := snsMetadata(msg)
+			for k, vals := range e.Metadata {
+				md[strings.ToLower(k)] = vals
+			}
+			e.Metadata = md
+			invs[i] = eventInvocation(&e)
+		}
+		invs[i].ID = msg.MessageID
+	}
+	return invs, nil
+}
+
+func (SNSRouter) EncodeResponse(results []InvocationResult) (interface{}, error) {
+	var failed int
+	var first error
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			if first == nil {
+				first = r.Err
+			}
+		}
+	}
+	if failed > 0 {
+		return nil, fmt.Errorf("%d of %d SNS records failed: %v", failed, len(results), first)
+	}
+	return nil, nil
+}
+
+// RunSNS serves SNS notification events with an SNSRouter.
+func (s *Server) RunSNS() {
+	s.RunSNSWithContext(context.Background())
+}
+
+func (s *Server) RunSNSWithContext(c context.Context) {
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.route(c, SNSRouter{Strict: s.opts.strictEvents}, eventMsg, ctx)
+	})
+}
+
+// isSNSEvent sniffs whether eventMsg is an SNS notification event.
+func isSNSEvent(eventMsg json.RawMessage) bool {
+	var event struct {
+		Records []struct {
+			EventSource string `json:"EventSource"`
+		} `json:"Records"`
+	}
+	if err := json.Unmarshal(eventMsg, &event); err != nil || len(event.Records) == 0 {
+		return false
+	}
+	for _, r := range event.Records {
+		if r.EventSource != snsEventSource {
+			return false
+		}
+	}
+	return true
+}
+
+// snsMetadata exposes the topic and message attributes of an SNS message as
+// metadata. Binary attributes are already base64 encoded and get "-bin" keys.
+func snsMetadata(msg *SNSEntity) map[string][]string {
+	md := map[string][]string{
+		"x-sns-topic-arn":  {msg.TopicArn},
+		"x-sns-message-id": {msg.MessageID},
+	}
+	for k, attr := range msg.MessageAttributes {
+		key := strings.ToLower(k)
+		if attr.Type == "Binary" {
+			key += "-bin"
+		}
+		md[key] = append(md[key], attr.Value)
+	}
+	return md
+}
@@ -0,0 +1,89 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func snsEvent(t *testing.T, messages ...string) string {
+	t.Helper()
+	var event SNSEvent
+	for i, msg := range messages {
+		event.Records = append(event.Records, SNSEventRecord{
+			EventSource: snsEventSource,
+			SNS: SNSEntity{
+				MessageID: fmt.Sprintf("m%d", i),
+				TopicArn:  "arn:aws:sns:us-east-1:000000000000:topic",
+				Message:   msg,
+				MessageAttributes: map[string]SNSMessageAttribute{
+					"Tenant": {Type: "String", Value: "acme"},
+					"Token":  {Type: "Binary", Value: "dG9rZW4="},
+				},
+			},
+		})
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSNS(t *testing.T) {
+	var seen []metadata.MD
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		md, _ := metadata.FromIncomingContext(c)
+		seen = append(seen, md)
+		return echoReply(req), nil
+	}})
+	res, err := serve(t, s, snsEvent(t, echoEvent("Echo", `{}`), `{"service":"apexgrpc.test.Echo","method":"Echo","metadata":{"Tenant":["override"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "null" {
+		t.Errorf("response = %s, want null", res)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("handled %d records, want 2", len(seen))
+	}
+	md := seen[0]
+	if md.Get("x-sns-topic-arn")[0] != "arn:aws:sns:us-east-1:000000000000:topic" || md.Get("x-sns-message-id")[0] != "m0" {
+		t.Errorf("metadata = %v, want the topic and message ID", md)
+	}
+	if md.Get("tenant")[0] != "acme" || md.Get("token-bin")[0] != "token" {
+		t.Errorf("metadata = %v, want the message attributes", md)
+	}
+	if got := seen[1].Get("tenant"); len(got) != 1 || got[0] != "override" {
+		t.Errorf("tenant = %q, want the event metadata to win", got)
+	}
+}
+
+func TestSNSFailures(t *testing.T) {
+	var calls int
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		calls++
+		return echoReply(req), nil
+	}})
+	for _, messages := range [][]string{
+		{echoEvent("Echo", `{}`), echoEvent("Fail", `{"count":5}`)},
+		{echoEvent("Echo", `{}`), `not an event`},
+	} {
+		calls = 0
+		if _, err := serve(t, s, snsEvent(t, messages...)); err == nil {
+			t.Errorf("%q: err = nil, want the failing record to fail the invocation", messages)
+		}
+		if calls != 1 {
+			t.Errorf("%q: calls = %d, want the other records still processed", messages, calls)
+		}
+	}
+
+	_, err := serve(t, newEchoServer(t, WithoutSNSDetection()), snsEvent(t, echoEvent("Echo", `{}`)))
+	assertCode(t, err, codes.InvalidArgument)
+}
@@ -0,0 +1,115 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+
+	"github.com/apex/go-apex"
+	"golang.org/x/net/context"
+)
+
+const sqsEventSource = "aws:sqs"
+
+type SQSEvent struct {
+	Records []SQSMessage `json:"Records"`
+}
+
+type SQSMessage struct {
+	MessageID         string                         `json:"messageId"`
+	ReceiptHandle     string                         `json:"receiptHandle"`
+	Body              string                         `json:"body"`
+	Attributes        map[string]string              `json:"attributes"`
+	MessageAttributes map[string]SQSMessageAttribute `json:"messageAttributes"`
+	EventSource       string                         `json:"eventSource"`
+	EventSourceARN    string                         `json:"eventSourceARN"`
+	AWSRegion         string                         `json:"awsRegion"`
+}
+
+type SQSMessageAttribute struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BinaryValue []byte  `json:"binaryValue,omitempty"`
+	DataType    string  `json:"dataType"`
+}
+
+// BatchResponse reports the records to retry when the SQS, Kinesis or
+// DynamoDB event source mapping enables ReportBatchItemFailures.
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// WithSQSConcurrency processes up to n SQS records at once. Records are
+// processed one at a time by default.
+func WithSQSConcurrency(n int) ServerOption {
+	return func(o *options) {
+		o.sqsConcurrency = n
+	}
+}
+
+// SQSRouter routes SQS events whose record bodies are Events. Records whose
+// handler fails, or whose body is not a valid Event, are reported as batch
+// item failures.
+type SQSRouter struct {
+	// MaxConcurrency bounds how many records are processed at once.
+	MaxConcurrency int
+	// Strict rejects Events with unknown fields; see WithStrictEventParsing.
+	Strict bool
+}
+
+func (r SQSRouter) Concurrency() int {
+	return r.MaxConcurrency
+}
+
+func (r SQSRouter) Route(eventMsg json.RawMessage, ctx *apex.Context) ([]Invocation, error) {
+	var event SQSEvent
+	if err := json.Unmarshal(eventMsg, &event); err != nil || !isSQSEvent(&event) {
+		return nil, invalidEventf("invalid SQS event")
+	}
+	invs := make([]Invocation, len(event.Records))
+	for i, msg := range event.Records {
+		e, err := decodeEvent([]byte(msg.Body), r.Strict)
+		if err != nil {
+			invs[i] = Invocation{Err: invalidEventf("invalid event: %v", err)}
+		} else {
+			invs[i] = eventInvocation(&e)
+		}
+		invs[i].ID = msg.MessageID
+	}
+	return invs, nil
+}
+
+func (SQSRouter) EncodeResponse(results []InvocationResult) (interface{}, error) {
+	res := &BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+	for _, r := range results {
+		if r.Err != nil {
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: r.Invocation.ID})
+		}
+	}
+	return res, nil
+}
+
+// RunSQS serves SQS events with an SQSRouter.
+func (s *Server) RunSQS() {
+	s.RunSQSWithContext(context.Background())
+}
+
+func (s *Server) RunSQSWithContext(c context.Context) {
+	r := SQSRouter{MaxConcurrency: s.opts.sqsConcurrency, Strict: s.opts.strictEvents}
+	s.runApex(c, func(c context.Context, eventMsg json.RawMessage, ctx *apex.Context) (interface{}, error) {
+		return s.route(c, r, eventMsg, ctx)
+	})
+}
+
+func isSQSEvent(event *SQSEvent) bool {
+	if len(event.Records) == 0 {
+		return false
+	}
+	for _, r := range event.Records {
+		if r.EventSource != sqsEventSource {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func sqsEvent(t *testing.T, bodies ...string) json.RawMessage {
+	t.Helper()
+	var event SQSEvent
+	for i, body := range bodies {
+		event.Records = append(event.Records, SQSMessage{
+			MessageID:   fmt.Sprintf("m%d", i),
+			Body:        body,
+			EventSource: sqsEventSource,
+		})
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func batchFailures(t *testing.T, res interface{}) []string {
+	t.Helper()
+	br, ok := res.(*BatchResponse)
+	if !ok {
+		t.Fatalf("response = %#v, want a *BatchResponse", res)
+	}
+	ids := []string{}
+	for _, f := range br.BatchItemFailures {
+		ids = append(ids, f.ItemIdentifier)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSQSRouter(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		mu.Lock()
+		messages = append(messages, stringField(req, "message"))
+		mu.Unlock()
+		return echoReply(req), nil
+	}})
+	event := sqsEvent(t,
+		echoEvent("Echo", `{"message":"one"}`),
+		echoEvent("Fail", `{"count":14}`),
+		`{"service":`,
+		echoEvent("Echo", `{"message":"four"}`),
+	)
+	for _, concurrency := range []int{0, 4} {
+		messages = nil
+		res, err := s.route(context.Background(), SQSRouter{MaxConcurrency: concurrency}, event, testApexContext())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := batchFailures(t, res); fmt.Sprint(got) != "[m1 m2]" {
+			t.Errorf("concurrency %d: failures = %v, want the failed and the malformed record", concurrency, got)
+		}
+		sort.Strings(messages)
+		if fmt.Sprint(messages) != "[four one]" {
+			t.Errorf("concurrency %d: handled %q", concurrency, messages)
+		}
+	}
+
+	res, err := s.route(context.Background(), SQSRouter{}, sqsEvent(t, echoEvent("Echo", `{}`)), testApexContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(res); string(b) != `{"batchItemFailures":[]}` {
+		t.Errorf("response without failures = %s", b)
+	}
+}
+
+func TestSQSRouterRejectsOtherEvents(t *testing.T) {
+	s := newEchoServer(t)
+	for _, event := range []string{
+		`{"Records":[]}`,
+		`{"Records":[{"messageId":"m0","body":"{}","eventSource":"aws:kinesis"}]}`,
+		echoEvent("Echo", `{}`),
+		`[`,
+	} {
+		_, err := s.route(context.Background(), SQSRouter{}, json.RawMessage(event), testApexContext())
+		assertCode(t, err, codes.InvalidArgument)
+	}
+}
@@ -0,0 +1,97 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+var stepFunctionsErrorNames = map[codes.Code]string{
+	codes.Canceled:           "GrpcCanceled",
+	codes.Unknown:            "GrpcUnknown",
+	codes.InvalidArgument:    "GrpcInvalidArgument",
+	codes.DeadlineExceeded:   "GrpcDeadlineExceeded",
+	codes.NotFound:           "GrpcNotFound",
+	codes.AlreadyExists:      "GrpcAlreadyExists",
+	codes.PermissionDenied:   "GrpcPermissionDenied",
+	codes.ResourceExhausted:  "GrpcResourceExhausted",
+	codes.FailedPrecondition: "GrpcFailedPrecondition",
+	codes.Aborted:            "GrpcAborted",
+	codes.OutOfRange:         "GrpcOutOfRange",
+	codes.Unimplemented:      "GrpcUnimplemented",
+	codes.Internal:           "GrpcInternal",
+	codes.Unavailable:        "GrpcUnavailable",
+	codes.DataLoss:           "GrpcDataLoss",
+	codes.Unauthenticated:    "GrpcUnauthenticated",
+}
+
+// StepFunctionsErrorName returns the error name of code under
+// WithStepFunctionsErrors: "Grpc" followed by the name of the code in
+// UpperCamelCase, e.g. "GrpcNotFound" or "GrpcDeadlineExceeded". Codes
+// without a name map to "GrpcUnknown". The names are stable so that state
+// machines can match on them.
+func StepFunctionsErrorName(code codes.Code) string {
+	if name, ok := stepFunctionsErrorNames[code]; ok {
+		return name
+	}
+	return stepFunctionsErrorNames[codes.Unknown]
+}
+
+// StepFunctionsError is the Lambda error returned for failures under
+// WithStepFunctionsErrors. Name is the StepFunctionsErrorName of the failure
+// and Cause is its ErrorResponse as JSON.
+type StepFunctionsError struct {
+	Name  string
+	Cause string
+}
+
+func (e *StepFunctionsError) Error() string {
+	return e.Name + ": " + e.Cause
+}
+
+// WithStepFunctionsErrors reports failures as a *StepFunctionsError. On the
+// aws-lambda-go runtime (Server.Handler) its Name becomes the error type,
+// which Step Functions exposes as the "Error" matched by Retry and Catch, and
+// its Cause the error message. Under apex only the message can be set, so it
+// starts with the name instead.
+func WithStepFunctionsErrors() ServerOption {
+	return func(o *options) {
+		o.stepFunctionsErrors = true
+	}
+}
+
+func (s *Server) newStepFunctionsError(err error) *StepFunctionsError {
+	res := s.newErrorResponse(err)
+	cause, jerr := json.Marshal(res)
+	if jerr != nil {
+		cause = []byte(res.Error.Message)
+	}
+	return &StepFunctionsError{Name: StepFunctionsErrorName(res.Error.GRPCCode), Cause: string(cause)}
+}
+
+// lambdaError converts a *StepFunctionsError into the error aws-lambda-go
+// reports with its own type.
+func lambdaError(err error) error {
+	if sfe, ok := err.(*StepFunctionsError); ok {
+		return messages.InvokeResponse_Error{Type: sfe.Name, Message: sfe.Cause}
+	}
+	return err
+}
+
+// TaskTokenMetadataKey is the metadata key TaskToken reads.
+const TaskTokenMetadataKey = "tasktoken"
+
+// TaskToken returns the Step Functions task token an event passed as
+// "taskToken" metadata, for handlers of waitForTaskToken tasks that report
+// their result with a callback.
+func TaskToken(c context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(c)
+	vals := md.Get(TaskTokenMetadataKey)
+	if len(vals) == 0 || vals[0] == "" {
+		return "", false
+	}
+	return vals[0], true
+}
@@ -0,0 +1,49 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestStepFunctionsErrors(t *testing.T) {
+	s := newEchoServer(t, WithStepFunctionsErrors())
+	_, err := serve(t, s, echoEvent("Fail", `{"count":4,"message":"slow"}`))
+	var sfe *StepFunctionsError
+	if !errors.As(err, &sfe) || sfe.Name != "GrpcDeadlineExceeded" {
+		t.Fatalf("err = %v, want a StepFunctionsError named GrpcDeadlineExceeded", err)
+	}
+	var cause ErrorResponse
+	if err := json.Unmarshal([]byte(sfe.Cause), &cause); err != nil || cause.Error.Message != "slow" || cause.Error.GRPCCode != codes.DeadlineExceeded {
+		t.Errorf("cause = %s (%v)", sfe.Cause, err)
+	}
+	le, ok := lambdaError(sfe).(messages.InvokeResponse_Error)
+	if !ok || le.Type != "GrpcDeadlineExceeded" || le.Message != sfe.Cause {
+		t.Errorf("lambda error = %#v", lambdaError(sfe))
+	}
+	if name := StepFunctionsErrorName(codes.Code(99)); name != "GrpcUnknown" {
+		t.Errorf("name of an unknown code = %q", name)
+	}
+}
+
+func TestTaskToken(t *testing.T) {
+	s := newEchoServerWith(t, &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		reply := dynamicpb.NewMessage(echoReplyMD)
+		if token, ok := TaskToken(c); ok {
+			reply.Set(echoReplyMD.Fields().ByName("message"), protoreflect.ValueOfString(token))
+		}
+		return reply, nil
+	}})
+	got, err := serve(t, s, `{"service":"apexgrpc.test.Echo","method":"Echo","data":{},"metadata":{"taskToken":["tok"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"tok"}`)
+}
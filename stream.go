@@ -0,0 +1,92 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serverStream drives a streaming handler in memory: RecvMsg decodes the next
+// request and every SendMsg is buffered.
+type serverStream struct {
+	ctx           context.Context
+	id            MethodID
+	decs          []messageDecoder
+	next          int
+	clientStreams bool
+	max           int
+	replies       []proto.Message
+	md            *outgoingMetadata
+	validate      func(MethodID, proto.Message) error
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) SetHeader(md metadata.MD) error {
+	return ss.md.setHeader(md)
+}
+
+func (ss *serverStream) SendHeader(md metadata.MD) error {
+	return ss.md.sendHeader(md)
+}
+
+func (ss *serverStream) SetTrailer(md metadata.MD) {
+	ss.md.setTrailer(md)
+}
+
+func (ss *serverStream) SendMsg(m interface{}) error {
+	if ss.max > 0 && len(ss.replies) >= ss.max {
+		return status.Errorf(codes.ResourceExhausted, "method (%s) exceeded %d stream responses", ss.id, ss.max)
+	}
+	ss.replies = append(ss.replies, cloneProto(m.(proto.Message)))
+	return nil
+}
+
+func (ss *serverStream) RecvMsg(m interface{}) error {
+	if ss.next >= len(ss.decs) {
+		return io.EOF
+	}
+	i := ss.next
+	ss.next++
+	if err := ss.decs[i](m.(proto.Message)); err != nil {
+		var fe *fieldError
+		if ss.clientStreams && errors.As(err, &fe) {
+			if fe.path == "/" {
+				fe.path = ""
+			}
+			fe.path = "/" + strconv.Itoa(i) + fe.path
+			return invalidInputError(ss.id, fe)
+		}
+		if ss.clientStreams {
+			return wrapCodedf(codes.InvalidArgument, &DecodeError{ID: ss.id, Err: err}, "invalid input data for method (%s) at index %d: %v", ss.id, i, err)
+		}
+		return invalidInputError(ss.id, err)
+	}
+	return ss.validate(ss.id, m.(proto.Message))
+}
+
+// newStreamDecoders splits the data of a client-streaming event, a JSON array,
+// into one decoder per request message.
+func (s *Server) newStreamDecoders(id MethodID, encoding string, data *json.RawMessage) ([]messageDecoder, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(*data, &elems); err != nil {
+		return nil, invalidInputError(id, errors.New("expected an array"))
+	}
+	decs := make([]messageDecoder, len(elems))
+	for i := range elems {
+		decs[i] = s.newMessageDecoder(encoding, &elems[i])
+	}
+	return decs, nil
+}
@@ -0,0 +1,94 @@
+package apexgrpc
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestServerStreaming(t *testing.T) {
+	s := newEchoServer(t)
+	got, err := serve(t, s, echoEvent("Split", `{"tags":["a","b","c"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `[{"message":"a"},{"message":"b"},{"message":"c"}]`)
+	got, err = serve(t, s, echoEvent("Split", `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `[]`)
+
+	s = newEchoServer(t, WithMaxStreamResponses(2))
+	if _, err := serve(t, s, echoEvent("Split", `{"tags":["a","b"]}`)); err != nil {
+		t.Fatalf("at the cap: %v", err)
+	}
+	_, err = serve(t, s, echoEvent("Split", `{"tags":["a","b","c"]}`))
+	assertCode(t, err, codes.ResourceExhausted)
+	if !strings.Contains(err.Error(), "method (apexgrpc.test.Echo/Split) exceeded 2 stream responses") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestStreamRoutingErrors(t *testing.T) {
+	s := newEchoServer(t)
+	bidi := &grpc.ServiceDesc{
+		ServiceName: "apexgrpc.test.Chat",
+		HandlerType: (*interface{})(nil),
+		Streams:     []grpc.StreamDesc{{StreamName: "Talk", Handler: splitHandler, ClientStreams: true, ServerStreams: true}},
+	}
+	if err := s.Register([]Service{{Desc: bidi, Server: &echoServer{}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, event string
+		code        codes.Code
+		err         string
+	}{
+		{"bidi", `{"service":"apexgrpc.test.Chat","method":"Talk","data":[]}`, codes.Unimplemented, "streaming direction not supported for method (apexgrpc.test.Chat/Talk)"},
+		{"unknown method", echoEvent("Splits", `{}`), codes.Unimplemented, "method handler not found - apexgrpc.test.Echo/Splits"},
+		{"unknown service", `{"service":"apexgrpc.test.Stream","method":"Split","data":{}}`, codes.Unimplemented, "method handler not found - apexgrpc.test.Stream/Split"},
+		{"malformed method", `{"method":"/apexgrpc.test.Echo/Split/","data":{}}`, codes.InvalidArgument, `malformed method "/apexgrpc.test.Echo/Split/"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := serve(t, s, tt.event)
+			assertCode(t, err, tt.code)
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClientStreaming(t *testing.T) {
+	s := newEchoServer(t)
+	got, err := serve(t, s, echoEvent("Join", `[{"message":"a"},{"message":"b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"message":"a b","count":2}`)
+	// An empty stream reaches the handler as an immediate EOF.
+	got, err = serve(t, s, echoEvent("Join", `[]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{}`)
+
+	for _, tt := range []struct{ data, err string }{
+		{`[{"message":"a"},{"message":1}]`, "at /1/message"},
+		{`[{"message":"a"},{"nope":true}]`, "at index 1"},
+		{`[{"message":"a"},"b"]`, "at /1: expected message apexgrpc.test.EchoRequest"},
+	} {
+		_, err := serve(t, s, echoEvent("Join", tt.data))
+		assertCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("data %s: err = %v, want it to contain %q", tt.data, err, tt.err)
+		}
+	}
+	_, err = serve(t, s, `{"method":"apexgrpc.test.Echo/","data":[]}`)
+	assertCode(t, err, codes.InvalidArgument)
+	_, err = serve(t, s, echoEvent("Joins", `[]`))
+	assertCode(t, err, codes.Unimplemented)
+}
@@ -0,0 +1,122 @@
+package apexgrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Transcoder converts the messages of an encoding registered with
+// WithEncoding to and from their proto3 JSON form. md is the type of the
+// message converted.
+type Transcoder interface {
+	ToJSON(data []byte, md protoreflect.MessageDescriptor) ([]byte, error)
+	FromJSON(data []byte, md protoreflect.MessageDescriptor) ([]byte, error)
+}
+
+// WithEncoding accepts events whose encoding is name, with t converting their
+// data. As with EncodingProtoBase64, the data is a base64 string, or an array
+// of them for client-streaming methods, and replies are returned as an
+// EncodedResponse of base64 strings. Methods need a known proto descriptor or
+// HandlerType to be called in such an encoding.
+func WithEncoding(name string, t Transcoder) ServerOption {
+	return func(o *options) {
+		if o.transcoders == nil {
+			o.transcoders = map[string]Transcoder{}
+		}
+		o.transcoders[name] = t
+	}
+}
+
+// eventEncoding returns the encoding of event, accepting those registered
+// with WithEncoding.
+func (s *Server) eventEncoding(event *Event) (string, error) {
+	if event.Encoding != nil && s.opts.transcoders[*event.Encoding] != nil {
+		return *event.Encoding, nil
+	}
+	return eventEncoding(event)
+}
+
+// binaryEncoding reports whether the data of event is carried as base64.
+func (s *Server) binaryEncoding(event *Event) bool {
+	encoding, _ := s.eventEncoding(event)
+	return encoding == EncodingProtoBase64 || s.opts.transcoders[encoding] != nil
+}
+
+// transcodeData returns event with its data converted to JSON by t.
+func (s *Server) transcodeData(id MethodID, t Transcoder, event *Event) (*Event, error) {
+	h, ok := s.handler(id)
+	if !ok || isNullData(event.Data) {
+		return event, nil
+	}
+	md, _ := messageDescriptors(id, h)
+	if md == nil {
+		return nil, codedErrorf(codes.Unimplemented, "method (%s) does not support encoding %q", id, *event.Encoding)
+	}
+	clientStreams := h.streamDesc != nil && h.streamDesc.ClientStreams
+	var encoded []string
+	if clientStreams {
+		if err := json.Unmarshal(*event.Data, &encoded); err != nil {
+			return nil, &DecodeError{ID: id, Err: errors.New("expected an array of base64 strings")}
+		}
+	} else {
+		var one string
+		if err := json.Unmarshal(*event.Data, &one); err != nil {
+			return nil, &DecodeError{ID: id, Err: errors.New("expected a base64 string")}
+		}
+		encoded = []string{one}
+	}
+	elems := make([]json.RawMessage, len(encoded))
+	for i, str := range encoded {
+		b, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, &DecodeError{ID: id, Err: err}
+		}
+		if elems[i], err = t.ToJSON(b, md); err != nil {
+			return nil, &DecodeError{ID: id, Err: err}
+		}
+	}
+	raw := elems[0]
+	if clientStreams {
+		raw, _ = json.Marshal(elems)
+	}
+	e := *event
+	e.Data = &raw
+	return &e, nil
+}
+
+// transcodeResult encodes the replies of res with t.
+func (s *Server) transcodeResult(t Transcoder, encoding string, res *result) (interface{}, error) {
+	h, ok := s.handler(res.id)
+	if !ok {
+		return nil, &MethodNotFoundError{ID: res.id}
+	}
+	_, md := messageDescriptors(res.id, h)
+	if md == nil {
+		return nil, codedErrorf(codes.Unimplemented, "method (%s) does not support encoding %q", res.id, encoding)
+	}
+	replies := res.replies
+	if !res.streaming {
+		replies = []proto.Message{res.reply}
+	}
+	data := make([]string, len(replies))
+	for i, reply := range replies {
+		raw, err := s.encodeJSONReply(res.id, reply)
+		if err != nil {
+			return nil, err
+		}
+		b, err := t.FromJSON(raw, md)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = base64.StdEncoding.EncodeToString(b)
+	}
+	if !res.streaming {
+		return &EncodedResponse{Data: data[0], Encoding: encoding}, nil
+	}
+	return &EncodedResponse{Data: data, Encoding: encoding}, nil
+}
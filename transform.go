@@ -0,0 +1,68 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+)
+
+// TransformFunc rewrites the JSON of a request or reply.
+type TransformFunc func(json.RawMessage) (json.RawMessage, error)
+
+// WithRequestTransform rewrites the JSON data of events for id with f before
+// it is decoded, e.g. to accept an old request shape. f sees the data after it
+// was fetched, decompressed and converted from the encodings of WithEncoding,
+// and is not called for proto-base64 data, absent data or requests passed to
+// InvokeProto. An error of f fails the call with codes.InvalidArgument.
+func WithRequestTransform(id MethodID, f TransformFunc) ServerOption {
+	return func(o *options) {
+		if o.requestTransforms == nil {
+			o.requestTransforms = map[MethodID]TransformFunc{}
+		}
+		o.requestTransforms[id] = f
+	}
+}
+
+// WithResponseTransform rewrites every JSON reply of id with f once it is
+// encoded, before it is converted to the encodings of WithEncoding. Replies
+// encoded as proto-base64 are not affected. An error of f, or f returning
+// invalid JSON, fails the call with codes.Internal.
+func WithResponseTransform(id MethodID, f TransformFunc) ServerOption {
+	return func(o *options) {
+		if o.responseTransforms == nil {
+			o.responseTransforms = map[MethodID]TransformFunc{}
+		}
+		o.responseTransforms[id] = f
+	}
+}
+
+// transformRequest applies the WithRequestTransform of id to JSON event data.
+func (s *Server) transformRequest(id MethodID, encoding string, event *Event) (*Event, error) {
+	f := s.opts.requestTransforms[id]
+	if f == nil || encoding != EncodingJSON || event.Data == nil {
+		return event, nil
+	}
+	data, err := f(*event.Data)
+	if err != nil {
+		return nil, wrapCodedf(codes.InvalidArgument, err, "request transform of method (%s) failed: %v", id, err)
+	}
+	e := *event
+	e.Data = &data
+	return &e, nil
+}
+
+// transformReply applies the WithResponseTransform of id to an encoded reply.
+func (s *Server) transformReply(id MethodID, raw json.RawMessage) (json.RawMessage, error) {
+	f := s.opts.responseTransforms[id]
+	if f == nil {
+		return raw, nil
+	}
+	out, err := f(raw)
+	if err != nil {
+		return nil, wrapCodedf(codes.Internal, err, "response transform of method (%s) failed: %v", id, err)
+	}
+	if !json.Valid(out) {
+		return nil, codedErrorf(codes.Internal, "response transform of method (%s) returned invalid JSON", id)
+	}
+	return out, nil
+}
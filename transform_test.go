@@ -0,0 +1,122 @@
+package apexgrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+// renameMsg accepts the old request shape, which called message msg.
+func renameMsg(raw json.RawMessage) (json.RawMessage, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	if v, ok := m["msg"]; ok {
+		m["message"] = v
+		delete(m, "msg")
+	}
+	return json.Marshal(m)
+}
+
+func wrapReply(raw json.RawMessage) (json.RawMessage, error) {
+	return json.RawMessage(`{"reply":` + string(raw) + `}`), nil
+}
+
+func TestTransforms(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	s := newEchoServer(t,
+		WithRequestTransform(id, renameMsg),
+		WithResponseTransform(id, wrapReply),
+		WithLenientMethodMatching(),
+	)
+	for _, method := range []string{"Echo", "echo"} {
+		out, err := serve(t, s, echoEvent(method, `{"msg":"hi","count":2}`))
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		assertJSON(t, out, `{"reply":{"message":"hi","count":2}}`)
+	}
+
+	// Other methods are not transformed.
+	out, err := serve(t, s, echoEvent("Join", `[{"message":"a"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, out, `{"message":"a","count":1}`)
+}
+
+func TestTransformErrors(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	fail := func(json.RawMessage) (json.RawMessage, error) { return nil, errors.New("boom") }
+	invalid := func(json.RawMessage) (json.RawMessage, error) { return json.RawMessage(`{`), nil }
+	tests := []struct {
+		name string
+		opt  ServerOption
+		code codes.Code
+	}{
+		{"request", WithRequestTransform(id, fail), codes.InvalidArgument},
+		{"response", WithResponseTransform(id, fail), codes.Internal},
+		{"invalid response", WithResponseTransform(id, invalid), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := serve(t, newEchoServer(t, tt.opt), echoEvent("Echo", `{}`))
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestTransformsSeeDecompressedJSON(t *testing.T) {
+	id := NewMethodID("", echoService, "Echo")
+	var seen []string
+	record := func(f TransformFunc) TransformFunc {
+		return func(raw json.RawMessage) (json.RawMessage, error) {
+			seen = append(seen, string(raw))
+			return f(raw)
+		}
+	}
+	s := newEchoServer(t,
+		WithRequestTransform(id, record(renameMsg)),
+		WithResponseTransform(id, record(wrapReply)),
+	)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"msg":"zipped"}`))
+	zw.Close()
+	event := fmt.Sprintf(`{"service":%q,"method":"Echo","contentEncoding":"gzip","acceptEncoding":"gzip","data":%q}`,
+		echoService, base64.StdEncoding.EncodeToString(buf.Bytes()))
+	out, err := serve(t, s, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != `{"msg":"zipped"}` {
+		t.Fatalf("transforms saw %q, want the decompressed request first", seen)
+	}
+	assertJSON(t, seen[1], `{"message":"zipped"}`)
+
+	var resp CompressedResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.StdEncoding.DecodeString(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, string(reply), `{"reply":{"message":"zipped"}}`)
+}
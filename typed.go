@@ -0,0 +1,27 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// InvokeTyped calls a unary method through InvokeProto and returns the reply
+// as Resp. It fails if the handler returned no reply or one of another type.
+func InvokeTyped[Req proto.Message, Resp proto.Message](c context.Context, s *Server, pkg string, svc string, mtd string, req Req) (Resp, error) {
+	var resp Resp
+	reply, err := s.InvokeProto(c, pkg, svc, mtd, req)
+	if err != nil {
+		return resp, err
+	}
+	if reply == nil || reflect.ValueOf(reply).IsNil() {
+		return resp, fmt.Errorf("method (%s) returned a nil reply", NewMethodID(pkg, svc, mtd))
+	}
+	resp, ok := reply.(Resp)
+	if !ok {
+		return resp, fmt.Errorf("method (%s) returned %T, not %T", NewMethodID(pkg, svc, mtd), reply, resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,24 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestInvokeTyped(t *testing.T) {
+	s := newEchoServer(t)
+	req := newEchoRequest(t, `{"message":"hi"}`)
+	reply, err := InvokeTyped[*dynamicpb.Message, *dynamicpb.Message](context.Background(), s, "", echoService, "Echo", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stringField(reply, "message"); got != "hi" {
+		t.Errorf("message = %q, want %q", got, "hi")
+	}
+	if _, err := InvokeTyped[*dynamicpb.Message, *emptypb.Empty](context.Background(), s, "", echoService, "Echo", req); err == nil {
+		t.Error("reply of another type: err = nil")
+	}
+}
@@ -0,0 +1,36 @@
+package apexgrpc
+
+import "github.com/golang/protobuf/proto"
+
+// RequestValidator checks a decoded request message before the handler sees
+// it.
+type RequestValidator func(msg proto.Message) error
+
+// WithRequestValidator installs f to validate every request message after it
+// is decoded. Requests it rejects fail with a *ValidationError, reported as
+// codes.InvalidArgument, without calling the handler.
+func WithRequestValidator(f RequestValidator) ServerOption {
+	return func(o *options) {
+		o.requestValidator = f
+	}
+}
+
+// ValidateMessage is a RequestValidator for messages generated by
+// protoc-gen-validate: it calls their Validate method and accepts messages
+// without one.
+func ValidateMessage(msg proto.Message) error {
+	if v, ok := msg.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func (s *Server) validateRequest(id MethodID, msg proto.Message) error {
+	if s.opts.requestValidator == nil {
+		return nil
+	}
+	if err := s.opts.requestValidator(msg); err != nil {
+		return &ValidationError{ID: id, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package apexgrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var errEmptyMessage = errors.New("message is required")
+
+func requireMessage(msg proto.Message) error {
+	if stringField(msg.(protoreflect.ProtoMessage), "message") == "" {
+		return errEmptyMessage
+	}
+	return nil
+}
+
+func TestRequestValidator(t *testing.T) {
+	var called bool
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		called = true
+		return echoReply(req), nil
+	}}
+	s := newEchoServerWith(t, srv, WithRequestValidator(requireMessage))
+	_, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{})
+	assertCode(t, err, codes.InvalidArgument)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || !errors.Is(err, errEmptyMessage) || ve.ID != NewMethodID("", echoService, "Echo") {
+		t.Errorf("err = %v, want a ValidationError wrapping the validator error", err)
+	}
+	if called {
+		t.Error("handler called for an invalid request")
+	}
+	if _, err := s.Invoke(context.Background(), "", echoService, "Echo", map[string]string{"message": "hi"}); err != nil || !called {
+		t.Errorf("valid request: err = %v, called = %v", err, called)
+	}
+	if err := ValidateMessage(newEchoRequest(t, `{}`)); err != nil {
+		t.Errorf("ValidateMessage of a message without Validate: %v", err)
+	}
+}
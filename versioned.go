@@ -0,0 +1,106 @@
+package apexgrpc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RegisterVersioned adds the methods of svcs like Register and also makes them
+// reachable by their package-less service name from events whose apiVersion is
+// version, so that e.g. myapp.v1.Users and myapp.v2.Users can both be called
+// as Users, selected by {"apiVersion": "v2"}. Events with an apiVersion resolve
+// against the methods of that version first and fall back to the unversioned
+// lookup. Two methods of one version must not share a package-less name.
+func (s *Server) RegisterVersioned(version string, svcs []Service) error {
+	if version == "" {
+		return fmt.Errorf("missing API version")
+	}
+	versioned := make([]Service, len(svcs))
+	for i, svc := range svcs {
+		svc.version = version
+		versioned[i] = svc
+	}
+	return s.Register(versioned)
+}
+
+// MethodsByVersion returns the IDs of the methods registered with
+// RegisterVersioned in sorted order, keyed by API version.
+func (s *Server) MethodsByVersion() map[string][]MethodID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := map[string][]MethodID{}
+	for id, h := range s.handlers {
+		if h.version != "" {
+			versions[h.version] = append(versions[h.version], id)
+		}
+	}
+	for _, ids := range versions {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return versions
+}
+
+// checkVersions fails if methods of svcs would share a package-less name with
+// each other or with a registered method of the same API version.
+func (s *Server) checkVersions(svcs []Service) error {
+	taken := map[string]map[MethodID]MethodID{}
+	add := func(version string, uid MethodID) error {
+		serviceName, methodName := uid.split()
+		b, ok := bareMethodID(serviceName, methodName)
+		if !ok {
+			b = uid
+		}
+		if taken[version] == nil {
+			taken[version] = map[MethodID]MethodID{}
+		}
+		if prev, ok := taken[version][b]; ok && prev != uid {
+			return fmt.Errorf("method (%s) collides with (%s) in API version %q", uid, prev, version)
+		}
+		taken[version][b] = uid
+		return nil
+	}
+	for uid, h := range s.handlers {
+		if h.version != "" {
+			add(h.version, uid)
+		}
+	}
+	for _, svc := range svcs {
+		if svc.version == "" {
+			continue
+		}
+		for _, id := range serviceMethodIDs(svc.Desc) {
+			if err := add(svc.version, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexVersions rebuilds the per-version lookup of versioned methods by their
+// fully qualified and package-less IDs.
+func (s *Server) indexVersions() {
+	s.versions = map[string]map[MethodID]MethodID{}
+	for uid, h := range s.handlers {
+		if h.version == "" {
+			continue
+		}
+		index := s.versions[h.version]
+		if index == nil {
+			index = map[MethodID]MethodID{}
+			s.versions[h.version] = index
+		}
+		index[uid] = uid
+		serviceName, methodName := uid.split()
+		if b, ok := bareMethodID(serviceName, methodName); ok {
+			index[b] = uid
+		}
+	}
+}
+
+func eventVersion(event *Event) string {
+	if event.APIVersion == nil {
+		return ""
+	}
+	return *event.APIVersion
+}
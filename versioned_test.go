@@ -0,0 +1,71 @@
+package apexgrpc
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// renamedEcho returns a Service called name whose only method, Echo, replies
+// with reply as its message.
+func renamedEcho(name, reply string) Service {
+	desc := grpc.ServiceDesc{
+		ServiceName: name,
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Echo", Handler: echoUnaryHandler("Echo")}},
+	}
+	srv := &echoServer{echo: func(c context.Context, req *dynamicpb.Message) (proto.Message, error) {
+		m := dynamicpb.NewMessage(echoReplyMD)
+		m.Set(echoReplyMD.Fields().ByName("message"), protoreflect.ValueOfString(reply))
+		return m, nil
+	}}
+	return Service{Desc: &desc, Server: srv}
+}
+
+func TestRegisterVersioned(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterVersioned("v1", []Service{renamedEcho("myapp.v1.Users", "v1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterVersioned("v2", []Service{renamedEcho("myapp.v2.Users", "v2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register([]Service{renamedEcho("myapp.Health", "unversioned")}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		event string
+		want  string
+	}{
+		{"v1", `{"service":"Users","method":"Echo","apiVersion":"v1","data":{}}`, "v1"},
+		{"v2", `{"service":"Users","method":"Echo","apiVersion":"v2","data":{}}`, "v2"},
+		{"qualified", `{"service":"myapp.v1.Users","method":"Echo","apiVersion":"v2","data":{}}`, "v1"},
+		{"unversioned fallback", `{"service":"Health","method":"Echo","apiVersion":"v2","data":{}}`, "unversioned"},
+		{"no version", `{"service":"myapp.v2.Users","method":"Echo","data":{}}`, "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serve(t, s, tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, `{"message":"`+tt.want+`"}`)
+		})
+	}
+
+	if err := s.RegisterVersioned("v1", []Service{renamedEcho("other.v1.Users", "")}); err == nil {
+		t.Error("registering a colliding method in one version: err = nil")
+	}
+	if err := s.RegisterVersioned("", []Service{renamedEcho("other.Users", "")}); err == nil {
+		t.Error("registering without a version: err = nil")
+	}
+	versions := s.MethodsByVersion()
+	if len(versions) != 2 || len(versions["v1"]) != 1 || versions["v2"][0] != NewMethodID("", "myapp.v2.Users", "Echo") {
+		t.Errorf("MethodsByVersion = %v", versions)
+	}
+}
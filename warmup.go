@@ -0,0 +1,48 @@
+package apexgrpc
+
+import "encoding/json"
+
+// WarmupPredicate reports whether an event is a warmup ping.
+type WarmupPredicate func(eventMsg json.RawMessage) bool
+
+// WarmupResponse is returned to Lambda for warmup pings.
+type WarmupResponse struct {
+	Warmup string `json:"warmup"`
+}
+
+const serverlessWarmupSource = "serverless-plugin-warmup"
+
+// DefaultWarmupPredicate recognizes {"warmup": true} and the default payload
+// of serverless-plugin-warmup, {"source": "serverless-plugin-warmup"}.
+func DefaultWarmupPredicate(eventMsg json.RawMessage) bool {
+	var event struct {
+		Warmup bool   `json:"warmup"`
+		Source string `json:"source"`
+	}
+	if err := json.Unmarshal(eventMsg, &event); err != nil {
+		return false
+	}
+	return event.Warmup || event.Source == serverlessWarmupSource
+}
+
+// WithWarmupPredicate replaces DefaultWarmupPredicate, which Run uses to
+// answer warmup pings with {"warmup": "ack"} before routing. Pings are not
+// recorded as method calls. A nil predicate routes every event.
+func WithWarmupPredicate(f WarmupPredicate) ServerOption {
+	return func(o *options) {
+		o.warmupPredicate = f
+		o.warmupPredicateSet = true
+	}
+}
+
+func (s *Server) isWarmup(eventMsg json.RawMessage) bool {
+	f := s.opts.warmupPredicate
+	if !s.opts.warmupPredicateSet {
+		f = DefaultWarmupPredicate
+	}
+	if f == nil || !f(eventMsg) {
+		return false
+	}
+	s.logger().Log(LevelDebug, "warmup ping", nil)
+	return true
+}
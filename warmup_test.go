@@ -0,0 +1,57 @@
+package apexgrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestDefaultWarmupPredicate(t *testing.T) {
+	for _, c := range []struct {
+		event string
+		want  bool
+	}{
+		{`{"warmup":true}`, true},
+		{`{"source":"serverless-plugin-warmup"}`, true},
+		{`{"warmup":false}`, false},
+		{`{"source":"aws.events"}`, false},
+		{echoEvent("Echo", `{}`), false},
+		{`[1,2]`, false},
+		{`"warmup"`, false},
+	} {
+		if got := DefaultWarmupPredicate(json.RawMessage(c.event)); got != c.want {
+			t.Errorf("DefaultWarmupPredicate(%s) = %v, want %v", c.event, got, c.want)
+		}
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	rec := &MemoryRecorder{}
+	s := newEchoServer(t, WithMetricsRecorder(rec))
+	for _, event := range []string{`{"warmup":true}`, `{"source":"serverless-plugin-warmup"}`} {
+		got, err := serve(t, s, event)
+		if err != nil {
+			t.Fatalf("%s: %v", event, err)
+		}
+		assertJSON(t, got, `{"warmup":"ack"}`)
+	}
+	if records := rec.Records(); len(records) != 0 {
+		t.Errorf("warmups were recorded: %+v", records)
+	}
+
+	s = newEchoServer(t, WithWarmupPredicate(func(eventMsg json.RawMessage) bool {
+		return string(eventMsg) == `{"ping":1}`
+	}))
+	got, err := serve(t, s, `{"ping":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, got, `{"warmup":"ack"}`)
+	_, err = serve(t, s, `{"warmup":true}`)
+	assertCode(t, err, codes.InvalidArgument)
+
+	s = newEchoServer(t, WithWarmupPredicate(nil))
+	_, err = serve(t, s, `{"warmup":true}`)
+	assertCode(t, err, codes.InvalidArgument)
+}
@@ -0,0 +1,57 @@
+// Package xray records an AWS X-Ray subsegment for every unary method call of
+// an apexgrpc.Server.
+package xray
+
+import (
+	"fmt"
+	"strings"
+
+	awsxray "github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	apexgrpc "github.com/pilwon/go-apexgrpc"
+)
+
+// UnaryServerInterceptor returns an interceptor, to be installed with
+// apexgrpc.WithUnaryInterceptor, that wraps each handler in a subsegment named
+// after the method ID. The subsegment is annotated with the service, method,
+// gRPC code and request size, and failed calls are recorded as faults. Calls
+// made without an active segment, such as local Invoke calls, are not traced.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if awsxray.GetSegment(c) == nil {
+			return handler(c, req)
+		}
+		id := strings.TrimPrefix(info.FullMethod, "/")
+		c, seg := awsxray.BeginSubsegment(c, id)
+		if seg == nil {
+			return handler(c, req)
+		}
+		svc, mtd := splitMethod(id)
+		seg.AddAnnotation("service", svc)
+		seg.AddAnnotation("method", mtd)
+		if msg, ok := req.(proto.Message); ok {
+			seg.AddAnnotation("payload_bytes", proto.Size(msg))
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				seg.AddAnnotation("grpc_code", "INTERNAL")
+				seg.Close(fmt.Errorf("panic in method (%s): %v", id, r))
+				panic(r)
+			}
+			seg.AddAnnotation("grpc_code", apexgrpc.CodeName(apexgrpc.Code(err)))
+			seg.Close(err)
+		}()
+		return handler(c, req)
+	}
+}
+
+func splitMethod(id string) (string, string) {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return "", id
+	}
+	return id[:i], id[i+1:]
+}